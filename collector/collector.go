@@ -28,6 +28,12 @@ type Collector interface {
 	Update(ch chan<- prometheus.Metric) (err error)
 }
 
+// Describer is implemented by collectors that describe their metrics, so
+// that conflicts are detected when registering them.
+type Describer interface {
+	Describe(ch chan<- *prometheus.Desc)
+}
+
 // TODO: Instead of periodically call Update, a Collector could be implemented
 // as a real prometheus.Collector that only gathers metrics when
 // scraped. (However, for metric gathering that takes very long, it might
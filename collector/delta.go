@@ -0,0 +1,160 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	// DeltaCursorHeader is the response header carrying the cursor to pass
+	// as the cursor parameter of the next request.
+	DeltaCursorHeader = "X-Delta-Cursor"
+	// DeltaFullHeader is set to "true" if the response contains all series
+	// because no valid cursor was given.
+	DeltaFullHeader = "X-Delta-Full"
+)
+
+// deltaHandler serves the series of a collector that changed since the
+// snapshot identified by the cursor of the request.
+type deltaHandler struct {
+	collector  prometheus.Collector
+	maxCursors int
+	epoch      string
+
+	mtx       sync.Mutex
+	seq       uint64
+	snapshots map[string]map[string]uint64
+	cursors   []string
+}
+
+// NewDeltaHandler returns a handler for consumers that only want the series
+// of c that changed since their last pull. Every request collects c and
+// returns the series that are new or have a different value than in the
+// snapshot of its cursor parameter, followed by a "# DELETED <series>"
+// comment for each series that disappeared. The cursor of the new snapshot
+// is returned in the DeltaCursorHeader.
+//
+// Only the snapshots of the last maxCursors responses are kept, each holding
+// a hash per series. A request with an older, unknown or no cursor gets all
+// series and the DeltaFullHeader. Cursors are invalidated by restarts.
+func NewDeltaHandler(c prometheus.Collector, maxCursors int) (http.Handler, error) {
+	if maxCursors < 1 {
+		return nil, fmt.Errorf("the delta endpoint needs to keep at least one cursor, got %d", maxCursors)
+	}
+	return &deltaHandler{
+		collector:  c,
+		maxCursors: maxCursors,
+		epoch:      strconv.FormatInt(time.Now().UnixNano(), 36),
+		snapshots:  map[string]map[string]uint64{},
+	}, nil
+}
+
+func (h *deltaHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Pulls are serialized, so that each snapshot is complete when its
+	// cursor is handed out.
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	families, err := metricFamilies(gatherMetrics(h.collector))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("An error has occurred during metrics collection:\n\n%s", err), http.StatusInternalServerError)
+		return
+	}
+
+	previous, ok := h.snapshots[r.URL.Query().Get("cursor")]
+	current := map[string]uint64{}
+	var changed []*dto.MetricFamily
+	for _, mf := range families {
+		var metrics []*dto.Metric
+		for _, m := range mf.Metric {
+			series := seriesString(mf.GetName(), m)
+			sum := metricHash(m)
+			current[series] = sum
+			if prev, found := previous[series]; !ok || !found || prev != sum {
+				metrics = append(metrics, m)
+			}
+		}
+		if len(metrics) > 0 {
+			mf.Metric = metrics
+			changed = append(changed, mf)
+		}
+	}
+	var deleted []string
+	for series := range previous {
+		if _, found := current[series]; !found {
+			deleted = append(deleted, series)
+		}
+	}
+	sort.Strings(deleted)
+
+	w.Header().Set("Content-Type", string(expfmt.FmtText))
+	w.Header().Set(DeltaCursorHeader, h.store(current))
+	if !ok {
+		w.Header().Set(DeltaFullHeader, "true")
+	}
+	enc := expfmt.NewEncoder(w, expfmt.FmtText)
+	for _, mf := range changed {
+		if err := enc.Encode(mf); err != nil {
+			return
+		}
+	}
+	for _, series := range deleted {
+		fmt.Fprintf(w, "# DELETED %s\n", series)
+	}
+}
+
+// store keeps snapshot under a new cursor, dropping the oldest snapshot once
+// maxCursors are kept.
+func (h *deltaHandler) store(snapshot map[string]uint64) string {
+	h.seq++
+	cursor := h.epoch + "-" + strconv.FormatUint(h.seq, 36)
+	h.snapshots[cursor] = snapshot
+	h.cursors = append(h.cursors, cursor)
+	if len(h.cursors) > h.maxCursors {
+		delete(h.snapshots, h.cursors[0])
+		h.cursors = h.cursors[1:]
+	}
+	return cursor
+}
+
+// seriesString returns the series of m in the text exposition format.
+func seriesString(name string, m *dto.Metric) string {
+	s := name + "{"
+	for i, l := range m.GetLabel() {
+		if i > 0 {
+			s += ","
+		}
+		s += l.GetName() + "=" + strconv.Quote(l.GetValue())
+	}
+	return s + "}"
+}
+
+// metricHash returns a hash of the values of m.
+func metricHash(m *dto.Metric) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(proto.CompactTextString(m)))
+	return h.Sum64()
+}
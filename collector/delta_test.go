@@ -0,0 +1,146 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type fakeCollector struct {
+	desc   *prometheus.Desc
+	values map[string]float64
+}
+
+func (c *fakeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *fakeCollector) Collect(ch chan<- prometheus.Metric) {
+	for name, v := range c.values {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, v, name)
+	}
+}
+
+// pullDelta requests the delta endpoint with cursor and returns the sorted
+// samples and comments of the response besides HELP and TYPE.
+func pullDelta(t *testing.T, h http.Handler, cursor string) (samples []string, next string, full bool) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/delta?cursor="+cursor, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+	body, err := ioutil.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(body), "\n") {
+		if line == "" || strings.HasPrefix(line, "# HELP ") || strings.HasPrefix(line, "# TYPE ") {
+			continue
+		}
+		samples = append(samples, line)
+	}
+	sort.Strings(samples)
+	return samples, rec.Header().Get(DeltaCursorHeader), rec.Header().Get(DeltaFullHeader) == "true"
+}
+
+func newTestDeltaHandler(t *testing.T, maxCursors int) (*fakeCollector, http.Handler) {
+	c := &fakeCollector{
+		desc:   prometheus.NewDesc("test_value", "Test value.", []string{"name"}, nil),
+		values: map[string]float64{"a": 1, "b": 2},
+	}
+	h, err := NewDeltaHandler(c, maxCursors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, h
+}
+
+func TestDeltaHandler(t *testing.T) {
+	c, h := newTestDeltaHandler(t, 2)
+
+	var cursor string
+	for i, test := range []struct {
+		change  func()
+		unknown bool
+		want    []string
+		full    bool
+	}{
+		{
+			want: []string{`test_value{name="a"} 1`, `test_value{name="b"} 2`},
+			full: true,
+		},
+		{
+			want: nil,
+		},
+		{
+			change: func() { c.values["a"] = 3; c.values["c"] = 4 },
+			want:   []string{`test_value{name="a"} 3`, `test_value{name="c"} 4`},
+		},
+		{
+			change: func() { delete(c.values, "b") },
+			want:   []string{`# DELETED test_value{name="b"}`},
+		},
+		{
+			unknown: true,
+			want:    []string{`test_value{name="a"} 3`, `test_value{name="c"} 4`},
+			full:    true,
+		},
+	} {
+		if test.change != nil {
+			test.change()
+		}
+		if test.unknown {
+			cursor = "unknown"
+		}
+		got, next, full := pullDelta(t, h, cursor)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%d: want samples %q, got %q", i, test.want, got)
+		}
+		if full != test.full {
+			t.Errorf("%d: want full %t, got %t", i, test.full, full)
+		}
+		if next == "" || next == cursor {
+			t.Errorf("%d: want a new cursor, got %q", i, next)
+		}
+		cursor = next
+	}
+}
+
+func TestDeltaHandlerExpiredCursor(t *testing.T) {
+	_, h := newTestDeltaHandler(t, 2)
+
+	_, first, _ := pullDelta(t, h, "")
+	_, second, _ := pullDelta(t, h, "")
+	if _, _, full := pullDelta(t, h, second); full {
+		t.Errorf("want a delta for a kept cursor")
+	}
+	// The third pull dropped the snapshot of the first.
+	if _, _, full := pullDelta(t, h, first); !full {
+		t.Errorf("want all series for an expired cursor")
+	}
+}
+
+func TestNewDeltaHandlerInvalidCursors(t *testing.T) {
+	if _, err := NewDeltaHandler(&fakeCollector{}, 0); err == nil {
+		t.Errorf("want an error for no kept cursors")
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/log"
+)
+
+// NewCollectorHandler returns a handler serving the metrics of c alone, in
+// the format negotiated with the client like the handler of the default
+// registry.
+func NewCollectorHandler(c prometheus.Collector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		families, err := metricFamilies(gatherMetrics(c))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("An error has occurred during metrics collection:\n\n%s", err), http.StatusInternalServerError)
+			return
+		}
+		format := expfmt.Negotiate(r.Header)
+		w.Header().Set("Content-Type", string(format))
+		enc := expfmt.NewEncoder(w, format)
+		for _, mf := range families {
+			if err := enc.Encode(mf); err != nil {
+				log.Errorf("Unable to encode the metrics: %s", err)
+				return
+			}
+		}
+	})
+}
+
+// gatherMetrics returns the metrics collected by c.
+func gatherMetrics(c prometheus.Collector) []prometheus.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	var metrics []prometheus.Metric
+	for m := range ch {
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+// metricFamilies groups metrics into metric families sorted by name.
+func metricFamilies(metrics []prometheus.Metric) ([]*dto.MetricFamily, error) {
+	byName := map[string]*dto.MetricFamily{}
+	for _, m := range metrics {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			return nil, err
+		}
+		name, help, err := descNameAndHelp(m.Desc())
+		if err != nil {
+			return nil, err
+		}
+		mf, ok := byName[name]
+		if !ok {
+			mf = &dto.MetricFamily{
+				Name: proto.String(name),
+				Help: proto.String(help),
+				Type: metricType(pb).Enum(),
+			}
+			byName[name] = mf
+		}
+		mf.Metric = append(mf.Metric, pb)
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	families := make([]*dto.MetricFamily, 0, len(names))
+	for _, name := range names {
+		mf := byName[name]
+		sort.Sort(metricsByLabels(mf.Metric))
+		families = append(families, mf)
+	}
+	return families, nil
+}
+
+// descNameAndHelp returns the fully-qualified name and the help string of a
+// descriptor, which are only accessible through its string representation.
+func descNameAndHelp(d *prometheus.Desc) (name, help string, err error) {
+	if _, err := fmt.Sscanf(d.String(), "Desc{fqName: %q, help: %q", &name, &help); err != nil {
+		return "", "", fmt.Errorf("couldn't parse descriptor %s: %s", d, err)
+	}
+	return name, help, nil
+}
+
+// descLabelNames returns the variable label names of a descriptor, which are
+// only accessible through its string representation as well.
+func descLabelNames(d *prometheus.Desc) ([]string, error) {
+	s := d.String()
+	i := strings.LastIndex(s, "variableLabels: [")
+	if i < 0 || !strings.HasSuffix(s, "]}") {
+		return nil, fmt.Errorf("couldn't parse descriptor %s", d)
+	}
+	return strings.Fields(s[i+len("variableLabels: [") : len(s)-len("]}")]), nil
+}
+
+func metricType(m *dto.Metric) dto.MetricType {
+	switch {
+	case m.Gauge != nil:
+		return dto.MetricType_GAUGE
+	case m.Counter != nil:
+		return dto.MetricType_COUNTER
+	case m.Summary != nil:
+		return dto.MetricType_SUMMARY
+	case m.Histogram != nil:
+		return dto.MetricType_HISTOGRAM
+	}
+	return dto.MetricType_UNTYPED
+}
+
+// metricsByLabels sorts metrics of a family by their label values.
+type metricsByLabels []*dto.Metric
+
+func (m metricsByLabels) Len() int      { return len(m) }
+func (m metricsByLabels) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m metricsByLabels) Less(i, j int) bool {
+	return labelsString(m[i]) < labelsString(m[j])
+}
+
+func labelsString(m *dto.Metric) string {
+	s := ""
+	for _, l := range m.GetLabel() {
+		s += l.GetName() + "=" + l.GetValue() + ","
+	}
+	return s
+}
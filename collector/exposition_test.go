@@ -0,0 +1,43 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestCollectorHandler(t *testing.T) {
+	c := &fakeCollector{
+		desc:   prometheus.NewDesc("test_value", "Test value.", []string{"name"}, nil),
+		values: map[string]float64{"b": 2, "a": 1},
+	}
+	rec := httptest.NewRecorder()
+	NewCollectorHandler(c).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics?collect[]=test", nil))
+	if want, got := string(expfmt.FmtText), rec.Header().Get("Content-Type"); want != got {
+		t.Errorf("want content type %q, got %q", want, got)
+	}
+	body, err := ioutil.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "test_value{name=\"a\"} 1\ntest_value{name=\"b\"} 2\n"; !strings.HasSuffix(string(body), want) {
+		t.Errorf("want sorted samples %q, got %q", want, body)
+	}
+}
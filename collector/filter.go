@@ -0,0 +1,115 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/log"
+)
+
+// processFilterHandler serves the metrics of the processes requested by the
+// process parameter, e.g. ?process=hekad,nginx.
+type processFilterHandler struct {
+	collector processFilterer
+}
+
+// processFilterer is implemented by collectors that can collect a subset of
+// their processes.
+type processFilterer interface {
+	// processNames returns the names of all configured processes.
+	processNames() []string
+	// updateProcesses collects the named processes.
+	updateProcesses(ch chan<- prometheus.Metric, names map[string]bool) error
+}
+
+// NewProcessFilterHandler returns a handler serving the procstats metrics of
+// a subset of the configured processes. Only the requested processes are
+// resolved and collected. c must be the procstats collector of the local
+// host.
+func NewProcessFilterHandler(c Collector) (http.Handler, error) {
+	pc, ok := c.(processFilterer)
+	if !ok {
+		return nil, fmt.Errorf("processes can only be filtered for the local procstats collector")
+	}
+	return &processFilterHandler{collector: pc}, nil
+}
+
+func (h *processFilterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	configured := map[string]bool{}
+	for _, name := range h.collector.processNames() {
+		configured[name] = true
+	}
+	names := map[string]bool{}
+	var unknown []string
+	for _, name := range strings.Split(r.URL.Query().Get("process"), ",") {
+		switch {
+		case name == "":
+		case configured[name]:
+			names[name] = true
+		default:
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		log.Debugf("Ignoring unknown processes %q requested by %s", unknown, r.RemoteAddr)
+	}
+	if len(names) == 0 && len(unknown) == 0 {
+		http.Error(w, "No process requested, use ?process=name1,name2", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		metrics []prometheus.Metric
+		ch      = make(chan prometheus.Metric)
+		errc    = make(chan error, 1)
+	)
+	go func() {
+		errc <- h.collector.updateProcesses(ch, names)
+		close(ch)
+	}()
+	for m := range ch {
+		metrics = append(metrics, m)
+	}
+	if err := <-errc; err != nil {
+		log.Errorf("Unable to collect the processes %q: %s", r.URL.Query().Get("process"), err)
+	}
+	families, err := metricFamilies(metrics)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("An error has occurred during metrics collection:\n\n%s", err), http.StatusInternalServerError)
+		return
+	}
+
+	if acceptsOpenMetrics(r) {
+		w.Header().Set("Content-Type", OpenMetricsContentType)
+		if err := writeOpenMetrics(w, families); err != nil {
+			log.Errorf("Unable to encode the processes %q: %s", r.URL.Query().Get("process"), err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", string(expfmt.FmtText))
+	if len(unknown) > 0 {
+		fmt.Fprintf(w, "# Ignored unknown processes: %s\n", strings.Join(unknown, ","))
+	}
+	enc := expfmt.NewEncoder(w, expfmt.FmtText)
+	for _, mf := range families {
+		if err := enc.Encode(mf); err != nil {
+			return
+		}
+	}
+}
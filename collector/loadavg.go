@@ -11,8 +11,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// +build !noloadavg
-// +build !windows
+// +build !noloadavg,!windows
 
 package collector
 
@@ -0,0 +1,126 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// OpenMetricsContentType is the content type of the OpenMetrics text format.
+// The vendored client_golang doesn't support it, the metrics are encoded by
+// writeOpenMetrics.
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// metricUnits are the units declared for metric families whose name ends in
+// them, the base units of the procstats metrics and the kilobytes of its
+// legacy ones.
+var metricUnits = []string{"seconds", "bytes", "kilobytes"}
+
+// acceptsOpenMetrics returns whether the client prefers the OpenMetrics text
+// format, as Prometheus does when it is enabled.
+func acceptsOpenMetrics(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+}
+
+// metricUnit returns the unit of the metric family, or "" if it has none. The
+// unit is a suffix of the family name, which excludes the _total of
+// counters.
+func metricUnit(family string) string {
+	for _, unit := range metricUnits {
+		if strings.HasSuffix(family, "_"+unit) {
+			return unit
+		}
+	}
+	return ""
+}
+
+// writeOpenMetrics writes the metric families in the OpenMetrics text format,
+// declaring the unit of each family with one. Only counters, gauges and
+// untyped metrics are supported.
+func writeOpenMetrics(w io.Writer, families []*dto.MetricFamily) error {
+	bw := bufio.NewWriter(w)
+	for _, mf := range families {
+		name, suffix, typ := mf.GetName(), "", ""
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			name, suffix, typ = strings.TrimSuffix(name, "_total"), "_total", "counter"
+		case dto.MetricType_GAUGE:
+			typ = "gauge"
+		case dto.MetricType_UNTYPED:
+			typ = "unknown"
+		default:
+			return fmt.Errorf("unsupported type %s of %s", mf.GetType(), name)
+		}
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, typ)
+		if unit := metricUnit(name); unit != "" {
+			fmt.Fprintf(bw, "# UNIT %s %s\n", name, unit)
+		}
+		if mf.GetHelp() != "" {
+			fmt.Fprintf(bw, "# HELP %s %s\n", name, escapeOpenMetrics(mf.GetHelp()))
+		}
+		for _, m := range mf.GetMetric() {
+			var v float64
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				v = m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				v = m.GetGauge().GetValue()
+			default:
+				v = m.GetUntyped().GetValue()
+			}
+			bw.WriteString(name + suffix)
+			if len(m.GetLabel()) > 0 {
+				labels := make([]string, 0, len(m.GetLabel()))
+				for _, l := range m.GetLabel() {
+					labels = append(labels, fmt.Sprintf("%s=\"%s\"", l.GetName(), escapeOpenMetrics(l.GetValue())))
+				}
+				bw.WriteString("{" + strings.Join(labels, ",") + "}")
+			}
+			bw.WriteString(" " + formatOpenMetricsFloat(v))
+			if m.TimestampMs != nil {
+				bw.WriteString(" " + formatOpenMetricsFloat(float64(m.GetTimestampMs())/1000))
+			}
+			bw.WriteString("\n")
+		}
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+var openMetricsEscaper = strings.NewReplacer("\\", `\\`, "\n", `\n`, "\"", `\"`)
+
+// escapeOpenMetrics escapes label values and help strings.
+func escapeOpenMetrics(s string) string {
+	return openMetricsEscaper.Replace(s)
+}
+
+func formatOpenMetricsFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,67 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestWriteOpenMetrics(t *testing.T) {
+	families := []*dto.MetricFamily{
+		{
+			Name: proto.String("test_wait_seconds_total"),
+			Help: proto.String("Time waited."),
+			Type: dto.MetricType_COUNTER.Enum(),
+			Metric: []*dto.Metric{{
+				Label:   []*dto.LabelPair{{Name: proto.String("name"), Value: proto.String(`a "b"\c`)}},
+				Counter: &dto.Counter{Value: proto.Float64(1.5)},
+			}},
+		},
+		{
+			Name: proto.String("test_limit"),
+			Help: proto.String("Limit,\nunbounded."),
+			Type: dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{
+				Gauge:       &dto.Gauge{Value: proto.Float64(math.Inf(1))},
+				TimestampMs: proto.Int64(1500),
+			}},
+		},
+	}
+	var buf bytes.Buffer
+	if err := writeOpenMetrics(&buf, families); err != nil {
+		t.Fatal(err)
+	}
+	want := `# TYPE test_wait_seconds counter
+# UNIT test_wait_seconds seconds
+# HELP test_wait_seconds Time waited.
+test_wait_seconds_total{name="a \"b\"\\c"} 1.5
+# TYPE test_limit gauge
+# HELP test_limit Limit,\nunbounded.
+test_limit +Inf 1.5
+# EOF
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+
+	histogram := []*dto.MetricFamily{{Name: proto.String("test_histogram"), Type: dto.MetricType_HISTOGRAM.Enum()}}
+	if err := writeOpenMetrics(&buf, histogram); err == nil {
+		t.Errorf("want an error for a histogram")
+	}
+}
@@ -16,6 +16,7 @@ package collector
 import (
 	"flag"
 	"path"
+	"path/filepath"
 
 	"github.com/prometheus/procfs"
 )
@@ -24,8 +25,17 @@ var (
 	// The path of the proc filesystem.
 	procPath = flag.String("collector.procfs", procfs.DefaultMountPoint, "procfs mountpoint.")
 	sysPath  = flag.String("collector.sysfs", "/sys", "sysfs mountpoint.")
+	// The prefix of host paths read by the procstats collector.
+	rootfsPath = flag.String("path.rootfs", "", "Prefix of the host filesystem for the procstats collector, e.g. /host if the host root is mounted there.")
 )
 
+func init() {
+	// The path.* flags are the names of the mountpoints shared with
+	// --path.rootfs, the collector.* ones are kept for compatibility.
+	flag.StringVar(procPath, "path.procfs", procfs.DefaultMountPoint, "procfs mountpoint, same as --collector.procfs.")
+	flag.StringVar(sysPath, "path.sysfs", "/sys", "sysfs mountpoint, same as --collector.sysfs.")
+}
+
 func procFilePath(name string) string {
 	return path.Join(*procPath, name)
 }
@@ -33,3 +43,7 @@ func procFilePath(name string) string {
 func sysFilePath(name string) string {
 	return path.Join(*sysPath, name)
 }
+
+func rootfsFilePath(name string) string {
+	return filepath.Join(*rootfsPath, name)
+}
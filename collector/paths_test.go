@@ -48,6 +48,24 @@ func TestCustomProcPath(t *testing.T) {
 	}
 }
 
+func TestPathFlagAliases(t *testing.T) {
+	defer flag.Set("path.procfs", procfs.DefaultMountPoint)
+	defer flag.Set("path.sysfs", "/sys")
+
+	if err := flag.Set("path.procfs", "/host/proc"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := procFilePath("somefile"), "/host/proc/somefile"; got != want {
+		t.Errorf("Expected: %s, Got: %s", want, got)
+	}
+	if err := flag.Set("path.sysfs", "/host/sys"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sysFilePath("somefile"), "/host/sys/somefile"; got != want {
+		t.Errorf("Expected: %s, Got: %s", want, got)
+	}
+}
+
 func TestDefaultSysPath(t *testing.T) {
 	if err := flag.Set("collector.sysfs", "/sys"); err != nil {
 		t.Fatal(err)
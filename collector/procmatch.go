@@ -0,0 +1,156 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocmatch
+
+package collector
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/prometheus/procfs"
+)
+
+const procMatchSubsystem = "procmatch"
+
+var procMatchRules = flag.String("collector.procmatch.rules", "",
+	"Comma separated list of name=regex rules. Each process is counted under the first rule whose regex matches its comm.")
+
+// compiledRule is a procmatch rule with its regex compiled.
+type compiledRule struct {
+	name string
+	re   *regexp.Regexp
+}
+
+type processMatchCollector struct {
+	procRoot string
+	rules    []compiledRule
+	count    *prometheus.Desc
+	totalRSS *prometheus.Desc
+	maxRSS   *prometheus.Desc
+}
+
+func init() {
+	Factories[procMatchSubsystem] = NewProcessMatchCollector
+}
+
+// NewProcessMatchCollector returns a new Collector aggregating the processes
+// matched by the --collector.procmatch.rules.
+func NewProcessMatchCollector() (Collector, error) {
+	return newProcessMatchCollector(*procPath, *procMatchRules)
+}
+
+// newProcessMatchCollector returns a Collector aggregating the processes of
+// the procfs at procRoot matched by the given rules.
+func newProcessMatchCollector(procRoot, procMatchRules string) (Collector, error) {
+	rules, err := parseProcMatchRules(procMatchRules)
+	if err != nil {
+		return nil, err
+	}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(Namespace, procMatchSubsystem, name), help, []string{"name"}, nil)
+	}
+	return &processMatchCollector{
+		procRoot: procRoot,
+		rules:    rules,
+		count:    desc("count", "Number of processes matched by the rule."),
+		totalRSS: desc("total_rss_bytes", "Sum of the resident memory of the processes matched by the rule."),
+		maxRSS:   desc("max_rss_bytes", "Largest resident memory of a process matched by the rule."),
+	}, nil
+}
+
+// parseProcMatchRules parses a comma separated list of name=regex rules,
+// keeping their order.
+func parseProcMatchRules(s string) ([]compiledRule, error) {
+	var rules []compiledRule
+	seen := map[string]bool{}
+	for _, rule := range strings.Split(s, ",") {
+		if rule == "" {
+			continue
+		}
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid procmatch rule %q, want name=regex", rule)
+		}
+		if seen[parts[0]] {
+			return nil, fmt.Errorf("duplicate procmatch rule %q", parts[0])
+		}
+		seen[parts[0]] = true
+		re, err := regexp.Compile(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex of procmatch rule %q: %s", parts[0], err)
+		}
+		rules = append(rules, compiledRule{name: parts[0], re: re})
+	}
+	return rules, nil
+}
+
+// match returns the index of the first rule matching comm, or -1.
+func (c *processMatchCollector) match(comm string) int {
+	for i, rule := range c.rules {
+		if rule.re.MatchString(comm) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *processMatchCollector) Update(ch chan<- prometheus.Metric) error {
+	fs, err := procfs.NewFS(c.procRoot)
+	if err != nil {
+		return err
+	}
+	procs, err := fs.AllProcs()
+	if err != nil {
+		return err
+	}
+
+	counts := make([]int, len(c.rules))
+	totals := make([]int, len(c.rules))
+	maxes := make([]int, len(c.rules))
+	for _, p := range procs {
+		// Processes may exit while walking procfs, skip the ones gone.
+		comm, err := p.Comm()
+		if err != nil {
+			log.Debugf("Unable to read comm of process %d: %s", p.PID, err)
+			continue
+		}
+		i := c.match(comm)
+		if i < 0 {
+			continue
+		}
+		stat, err := p.NewStat()
+		if err != nil {
+			log.Debugf("Unable to read stat of process %d: %s", p.PID, err)
+			continue
+		}
+		rss := stat.ResidentMemory()
+		counts[i]++
+		totals[i] += rss
+		if rss > maxes[i] {
+			maxes[i] = rss
+		}
+	}
+
+	for i, rule := range c.rules {
+		ch <- prometheus.MustNewConstMetric(c.count, prometheus.GaugeValue, float64(counts[i]), rule.name)
+		ch <- prometheus.MustNewConstMetric(c.totalRSS, prometheus.GaugeValue, float64(totals[i]), rule.name)
+		ch <- prometheus.MustNewConstMetric(c.maxRSS, prometheus.GaugeValue, float64(maxes[i]), rule.name)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestProcessMatchCollector(t *testing.T) {
+	dir := t.TempDir()
+
+	// RSS of the processes, in pages.
+	for pid, p := range map[int]struct {
+		comm string
+		rss  int
+	}{
+		10: {comm: "nginx", rss: 10},
+		11: {comm: "nginx", rss: 30},
+		20: {comm: "java", rss: 100},
+		30: {comm: "javac", rss: 5},
+		40: {comm: "bash", rss: 1},
+	} {
+		pidDir := filepath.Join(dir, strconv.Itoa(pid))
+		if err := os.Mkdir(pidDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		stat := fmt.Sprintf("%d (%s) S 1 %d %d 0 -1 4202752 0 0 0 0 0 0 0 0 20 0 1 0 100 1000 %d 18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0\n",
+			pid, p.comm, pid, pid, p.rss)
+		for name, content := range map[string]string{"comm": p.comm + "\n", "stat": stat} {
+			if err := ioutil.WriteFile(filepath.Join(pidDir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	c, err := newProcessMatchCollector(dir, "nginx=^nginx$,java=^java,jvm=^javac$,sshd=^sshd$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := collectProcStats(t, c)
+
+	page := float64(os.Getpagesize())
+	for name, want := range map[string]float64{
+		`node_procmatch_count{name="nginx"}`:           2,
+		`node_procmatch_total_rss_bytes{name="nginx"}`: 40 * page,
+		`node_procmatch_max_rss_bytes{name="nginx"}`:   30 * page,
+		// javac matches both ^java and ^javac$, the first rule wins.
+		`node_procmatch_count{name="java"}`:           2,
+		`node_procmatch_total_rss_bytes{name="java"}`: 105 * page,
+		`node_procmatch_max_rss_bytes{name="java"}`:   100 * page,
+		`node_procmatch_count{name="jvm"}`:            0,
+		`node_procmatch_count{name="sshd"}`:           0,
+		`node_procmatch_max_rss_bytes{name="sshd"}`:   0,
+	} {
+		got, ok := metrics[name]
+		if !ok {
+			t.Errorf("want %s, got none", name)
+			continue
+		}
+		if got != want {
+			t.Errorf("want %s %f, got %f", name, want, got)
+		}
+	}
+	if want, got := 12, len(metrics); want != got {
+		t.Errorf("want %d metrics, got %d", want, got)
+	}
+}
+
+func TestParseProcMatchRules(t *testing.T) {
+	rules, err := parseProcMatchRules("nginx=^nginx$,java=^java$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0].name != "nginx" || rules[1].name != "java" {
+		t.Errorf("want rules nginx and java in order, got %v", rules)
+	}
+
+	for _, invalid := range []string{"nginx", "=^nginx$", "nginx=", "nginx=(", "a=a,a=b"} {
+		if _, err := parseProcMatchRules(invalid); err == nil {
+			t.Errorf("want error for rules %q, got none", invalid)
+		}
+	}
+}
@@ -16,149 +16,2329 @@
 package collector
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
+	"math/bits"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/model"
 )
 
 const (
 	processSubsystem = "process"
 
+	// maxEnvLabelValueLength caps the length of label values taken from a
+	// process environment.
+	maxEnvLabelValueLength = 64
+
+	// defaultPIDFileDir is the directory the PID files are read from by
+	// default.
+	defaultPIDFileDir = "/var/run"
+
 // diskSectorSize uint64 = 512
 )
 
+// ProcessStats are the stats of /proc/$PID/status of a process. The memory
+// sizes are in kilobytes, as given by the kernel. A field the status file
+// doesn't have, e.g. VmSwap of a kernel thread or the parts of VmRSS before
+// Linux 4.5, is zero and not reported by Has.
+type ProcessStats struct {
+	PID    int
+	VmRSS  int
+	VmHWM  int
+	VmStk  int
+	VmPeak int
+	VmSwap int
+	VmSize int
+	// RssAnon, RssFile and RssShmem are the parts of VmRSS.
+	RssAnon                  int
+	RssFile                  int
+	RssShmem                 int
+	VoluntaryCtxtSwitches    int
+	NonvoluntaryCtxtSwitches int
+	Threads                  int
+	// SignalsPending and SignalsCaught are the number of signals in the
+	// SigPnd and SigCgt masks.
+	SignalsPending int
+	SignalsCaught  int
+	// State is the state code of the process, e.g. 'S', see
+	// processStates.
+	State byte
+
+	// present are the names of the fields of the status file that were
+	// parsed.
+	present map[string]bool
+}
+
+// Has returns whether the field name of the status file, e.g. "VmSwap", was
+// parsed into s.
+func (s ProcessStats) Has(name string) bool {
+	return s.present[name]
+}
+
+// memoryStats maps the memory fields of /proc/$PID/status, given in kB, to
+// those of ProcessStats.
+var memoryStats = map[string]func(*ProcessStats) *int{
+	"VmRSS":    func(s *ProcessStats) *int { return &s.VmRSS },
+	"VmHWM":    func(s *ProcessStats) *int { return &s.VmHWM },
+	"VmStk":    func(s *ProcessStats) *int { return &s.VmStk },
+	"VmPeak":   func(s *ProcessStats) *int { return &s.VmPeak },
+	"VmSwap":   func(s *ProcessStats) *int { return &s.VmSwap },
+	"VmSize":   func(s *ProcessStats) *int { return &s.VmSize },
+	"RssAnon":  func(s *ProcessStats) *int { return &s.RssAnon },
+	"RssFile":  func(s *ProcessStats) *int { return &s.RssFile },
+	"RssShmem": func(s *ProcessStats) *int { return &s.RssShmem },
+}
+
+// residentMemoryTypes maps the type label of node_process_rss_bytes
+// to the parts of VmRSS.
+var residentMemoryTypes = []struct {
+	name  string
+	field string
+}{
+	{"anon", "RssAnon"},
+	{"file", "RssFile"},
+	{"shmem", "RssShmem"},
+}
+
+// ctxtSwitchStats maps the context switch fields and the number of threads
+// of /proc/$PID/status to those of ProcessStats.
+var ctxtSwitchStats = map[string]func(*ProcessStats) *int{
+	"voluntary_ctxt_switches":    func(s *ProcessStats) *int { return &s.VoluntaryCtxtSwitches },
+	"nonvoluntary_ctxt_switches": func(s *ProcessStats) *int { return &s.NonvoluntaryCtxtSwitches },
+	"Threads":                    func(s *ProcessStats) *int { return &s.Threads },
+}
+
+// signalMaskStats maps the signal bitmasks of /proc/$PID/status to the
+// fields of ProcessStats holding the number of signals in the mask.
+var signalMaskStats = map[string]func(*ProcessStats) *int{
+	"SigPnd": func(s *ProcessStats) *int { return &s.SignalsPending },
+	"SigCgt": func(s *ProcessStats) *int { return &s.SignalsCaught },
+}
+
+// statField returns the field of s parsed from the numeric field name of the
+// status file, nil for other names.
+func statField(s *ProcessStats, name string) *int {
+	for _, fields := range []map[string]func(*ProcessStats) *int{memoryStats, ctxtSwitchStats, signalMaskStats} {
+		if field, ok := fields[name]; ok {
+			return field(s)
+		}
+	}
+	return nil
+}
+
 var (
 	registeredProcesses = flag.String("collector.procstats.registered-processes", "hekad",
-		"Comma-separated list of processes whose statistics need to be exposed")
+		"Comma-separated list of processes whose statistics need to be exposed. An entry NAME=PATH reads the PID of the process from the file PATH instead of --collector.procstats.pid-dir.")
+	pidFileDir = flag.String("collector.procstats.pid-dir", defaultPIDFileDir,
+		"Directory the PID file $NAME.pid of each process is read from.")
+	envLabels = flag.String("collector.procstats.env-labels", "",
+		"Comma-separated list of LABEL_NAME=ENV_VAR pairs. The value of ENV_VAR in /proc/$PID/environ is added as label LABEL_NAME to the process metrics.")
+	continuousCountersEnabled = flag.Bool("collector.procstats.continuous-counters", false,
+		"Carry process counters forward across process restarts instead of letting them reset. This hides restarts from rate() and changes counter semantics.")
+	cgroupKernelMemory = flag.Bool("collector.procstats.cgroup-kernel-memory", false,
+		"Expose the kernel memory charged to the memory cgroup of each process.")
+	inotifyInstances = flag.Bool("collector.procstats.inotify-instances", false,
+		"Expose the number of inotify instances of all processes. This reads the file descriptors of every process on each scrape.")
+	maxPIDFileAge = flag.Duration("collector.procstats.max-pid-file-age", 24*time.Hour,
+		"PID files that haven't been modified for longer than this are reported as stale.")
 )
 
+// envLabel maps an environment variable of a process to a metric label.
+type envLabel struct {
+	labelName string
+	varName   string
+}
+
 type procstatsCollector struct {
 	registeredProcessesList []string
-	metrics                 []prometheus.Collector
+	envLabels               []envLabel
+	// staticLabelNames are the names of the labels of the config file,
+	// staticLabels their values by process.
+	staticLabelNames []string
+	staticLabels     map[string]map[string]string
+	// The descriptors of the const metrics and the metric vectors of the
+	// registered processes by group, see metricGroups.
+	procstatsDescs
+	status    *statusMetrics
+	memory    *memoryMetrics
+	cpu       *cpuMetrics
+	fds       *fdMetrics
+	sockets   *socketMetrics
+	io        *ioMetrics
+	cgroup    *cgroupMetrics
+	lifecycle *lifecycleMetrics
+	security  *securityMetrics
+	cmdline   *cmdlineMetrics
+	tree      *treeMetrics
+
+	continuousCounters *continuousCounters
+	textfile           *textfileWriter
+	renamer            *metricRenamer
+	nodeLabeler        *nodeLabeler
+	seriesLimiter      *seriesLimiter
+	startupGraces      *startupGraces
+	versions           map[string]*versionSource
+	schedules          map[string]*cronSchedule
+	namespaces         map[string]*namespaceResolver
+	expectedPorts      map[string]int
+	requiredArgs       map[string][]string
+	memoryThresholds   *memoryThresholds
+	latencies          *latencyWindow
+	commands           map[string]*commandResolver
+	// systemdUnits are the systemd units by process name, whose main PIDs
+	// are queried through systemdConnect.
+	systemdUnits    map[string]string
+	systemdConnect  func() (systemdClient, error)
+	matchers        []*processMatcher
+	pidFileGlobs    []*pidFileGlob
+	supervisors     []*supervisorResolver
+	libPathPrefixes []string
+	discovery       *processDiscovery
+	listed          *processList
+	// procRoot is the procfs directory of the processes, pidDir the
+	// directory of their PID files unless given in pidFiles, sysRoot the
+	// sysfs directory of their cgroups.
+	procRoot string
+	pidDir   string
+	pidFiles map[string]string
+	sysRoot  string
+	// The per-scrape options, see ProcStatsOptions.
+	cpuAffinityCores  int
+	perThreadRSS      bool
+	smaps             bool
+	socketsEnabled    bool
+	maps              bool
+	perThreadStates   bool
+	discoverByCmdline bool
+	matchByName       bool
+	ssPath            string
+	minInterval       time.Duration
+
+	mtx               sync.Mutex
+	lastHWM           map[string]int
+	lastPressure      map[string]pressureSample
+	binaryHashes      map[string]binaryHash
+	previousFDs       map[string]fdSample
+	previousCPU       map[string]cpuActivity
+	previousIO        map[string]ioSample
+	previousCgroupCPU map[string]cgroupCPUSample
+	previousSwap      map[string]swapSample
+	instances         map[string]processInstance
+	statusCaches      map[string]*rateLimitedCache
+
+	// seriesLabels are the values of the process labels of the series of
+	// each process, see processLabels. They have a mutex of their own as
+	// they are read while mtx is held.
+	labelsMtx    sync.Mutex
+	seriesLabels map[string][]string
 }
 
 func init() {
 	Factories["procstats"] = NewProcStatsCollector
+	flag.StringVar(pidFileDir, "path.rundir", defaultPIDFileDir, "Directory the PID files of the procstats collector are read from, same as --collector.procstats.pid-dir.")
 }
 
 // NewProcStatsCollector takes a prometheus registry and returns a new Collector exposing
 // process stats based on the default process names.
 func NewProcStatsCollector() (Collector, error) {
-	var processLabelNames = []string{"name"}
-
-	return &procstatsCollector{
-		registeredProcessesList: strings.Split(*registeredProcesses, ","),
-		metrics: []prometheus.Collector{
-			prometheus.NewGaugeVec(
-				prometheus.GaugeOpts{
-					Namespace: Namespace,
-					Subsystem: processSubsystem,
-					Name:      "pid",
-					Help:      "The PID of the process right now",
-				}, processLabelNames),
-			prometheus.NewGaugeVec(
-				prometheus.GaugeOpts{
-					Namespace: Namespace,
-					Subsystem: processSubsystem,
-					Name:      "mem_kilobytes",
-					Help:      "The memory consumed, in bytes, by the process right now",
-				}, processLabelNames),
-		},
-	}, nil
+	c, err := newProcStatsCollectorFromFlags()
+	if err != nil || (*procstatsConfigFile == "" && *processesFile == "") {
+		return c, err
+	}
+	r := &reloadingCollector{
+		build:         newProcStatsCollectorFromFlags,
+		configFile:    *procstatsConfigFile,
+		processesFile: *processesFile,
+		current:       c,
+	}
+	r.reloadOnSIGHUP()
+	return r, nil
 }
 
-func (c *procstatsCollector) Update(ch chan<- prometheus.Metric) (err error) {
+// newProcStatsCollectorFromFlags returns the collector configured by the
+// flags and the files they name.
+func newProcStatsCollectorFromFlags() (Collector, error) {
+	processes, pidFiles, err := parseRegisteredProcesses(*registeredProcesses)
+	if err != nil {
+		return nil, err
+	}
+	for name, path := range pidFiles {
+		pidFiles[name] = rootfsFilePath(path)
+	}
+	c, err := newProcStatsCollector(processes, ProcStatsOptions{
+		ProcRoot:           rootfsFilePath(*procPath),
+		SysRoot:            rootfsFilePath(*sysPath),
+		RootFS:             *rootfsPath,
+		PIDDir:             rootfsFilePath(*pidFileDir),
+		PIDFiles:           pidFiles,
+		ConfigFile:         *procstatsConfigFile,
+		EnvLabels:          *envLabels,
+		ContinuousCounters: *continuousCountersEnabled,
+		CPUAffinityCores:   *cpuAffinityCores,
+		PerThreadRSS:       *perThreadRSS,
+		Smaps:              *smapsEnabled,
+		Sockets:            *socketsEnabled,
+		Maps:               *mapsEnabled,
+		PerThreadStates:    *perThreadStates,
+		DiscoverByCmdline:  *discoverByCmdline,
+		MatchByName:        *matchByName,
+		SSFallback:         *ssFallback,
+		SSPath:             *ssPath,
+		StartupGrace:       *startupGrace,
+		MinInterval:        *minInterval,
+		NodeLabelName:      *nodeLabelName,
+		NodeLabelValue:     *nodeLabelValue,
+	})
+	if err != nil || *processesFile == "" {
+		return c, err
+	}
+	pc, ok := c.(*procstatsCollector)
+	if !ok {
+		return nil, fmt.Errorf("a processes file isn't supported with remote hosts")
+	}
+	if err := pc.reloadProcessesFile(*processesFile); err != nil {
+		return nil, err
+	}
+	return pc, nil
+}
 
-	//Iterate over all the proces names and get the PIDs from /var/run/$name.pid
-	procPID := make(map[string]int, 0)
-	var pid int
-	var pidBytes []byte
-	for _, procName := range c.registeredProcessesList {
-		pidBytes, err = ioutil.ReadFile("/var/run/" + procName + ".pid")
-		if err != nil {
-			// log.Errorf("Unable to open the PID file for %s. Cause: %s", procName, err.Error())
+// parseRegisteredProcesses parses a comma-separated list of processes, each
+// either NAME or NAME=PATH, into the names in order and the explicit PID
+// file paths by name.
+func parseRegisteredProcesses(s string) ([]string, map[string]string, error) {
+	var processes []string
+	pidFiles := map[string]string{}
+	for _, entry := range strings.Split(s, ",") {
+		if entry == "" {
 			continue
 		}
-		pidStr := string(pidBytes[:len(pidBytes)-1])
-		pid, err = strconv.Atoi(pidStr)
-		if err != nil {
-			log.Errorf("Failed to convert byte array to int while reading the PID for %s. Cause: %s", procName, err)
+		parts := strings.SplitN(entry, "=", 2)
+		name := parts[0]
+		if name == "" {
+			return nil, nil, fmt.Errorf("invalid registered process %q, missing name", entry)
 		}
-		procPID[procName] = int(pid)
+		if containsString(processes, name) {
+			return nil, nil, fmt.Errorf("duplicate registered process %q", name)
+		}
+		if len(parts) == 2 {
+			if !filepath.IsAbs(parts[1]) {
+				return nil, nil, fmt.Errorf("invalid PID file %q of registered process %q, must be absolute", parts[1], name)
+			}
+			pidFiles[name] = parts[1]
+		}
+		processes = append(processes, name)
 	}
-	processStats, err := getProcessStats(procPID)
+	return processes, pidFiles, nil
+}
+
+// ProcStatsOptions are the options of a procstats collector, given by the
+// flags of the same name unless the collector is built by
+// NewTestProcStatsCollector.
+type ProcStatsOptions struct {
+	// ProcRoot and SysRoot are the procfs and sysfs directories, RootFS is
+	// prepended to the PID and version files of the config file.
+	ProcRoot string
+	SysRoot  string
+	RootFS   string
+	// PIDDir is the directory of the PID files of the processes not in
+	// PIDFiles, which are the PID file paths or patterns by process.
+	PIDDir   string
+	PIDFiles map[string]string
+	// ConfigFile is the path of the config file, if any.
+	ConfigFile         string
+	EnvLabels          string
+	ContinuousCounters bool
+	CPUAffinityCores   int
+	PerThreadRSS       bool
+	PerThreadStates    bool
+	Smaps              bool
+	Sockets            bool
+	Maps               bool
+	DiscoverByCmdline  bool
+	MatchByName        bool
+	SSFallback         bool
+	SSPath             string
+	StartupGrace       time.Duration
+	MinInterval        time.Duration
+	NodeLabelName      string
+	NodeLabelValue     string
+}
+
+// NewTestProcStatsCollector returns a collector of the given processes that
+// reads procfs from procRoot, e.g. a t.TempDir(), instead of the flags. The
+// PID files and sysfs are read from procRoot as well, and the other options
+// are the defaults of their flags, unless changed by options. The flags
+// without an option still apply, so tests may only rely on their defaults.
+func NewTestProcStatsCollector(procRoot string, processes []string, options ...func(*ProcStatsOptions)) (*procstatsCollector, error) {
+	opts := ProcStatsOptions{
+		ProcRoot:    procRoot,
+		SysRoot:     procRoot,
+		PIDDir:      procRoot,
+		SSPath:      "ss",
+		MinInterval: time.Second,
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+	c, err := newProcStatsCollector(processes, opts)
 	if err != nil {
-		return fmt.Errorf("couldn't get process stats: %s", err)
+		return nil, err
+	}
+	pc, ok := c.(*procstatsCollector)
+	if !ok {
+		return nil, fmt.Errorf("remote hosts are configured")
 	}
+	return pc, nil
+}
 
-	for procName, stats := range processStats {
-		for k, value := range stats {
+// newProcStatsCollector returns a collector of processes with the given
+// options.
+func newProcStatsCollector(processes []string, opts ProcStatsOptions) (Collector, error) {
+	var processLabelNames = []string{"name"}
+
+	labels, err := parseEnvLabels(opts.EnvLabels)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range labels {
+		processLabelNames = append(processLabelNames, l.labelName)
+	}
+
+	config := &procstatsConfig{}
+	if opts.ConfigFile != "" {
+		if config, err = loadProcstatsConfig(opts.ConfigFile); err != nil {
+			return nil, err
+		}
+	}
+	staticLabelNames := config.staticLabelNames()
+	for _, name := range staticLabelNames {
+		for _, l := range labels {
+			if l.labelName == name {
+				return nil, fmt.Errorf("static label %q conflicts with an env label", name)
+			}
+		}
+		if name == "name" || containsString(metricLabelNames, name) {
+			return nil, fmt.Errorf("static label %q conflicts with a label of the process metrics", name)
+		}
+		processLabelNames = append(processLabelNames, name)
+	}
+	textfile, err := newTextfileWriter()
+	if err != nil {
+		return nil, err
+	}
+
+	renamer, err := newMetricRenamer()
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range labels {
+		if renamer != nil && l.labelName == renamer.labelName {
+			return nil, fmt.Errorf("env label %q conflicts with the process label", l.labelName)
+		}
+	}
+	for _, name := range staticLabelNames {
+		if renamer != nil && name == renamer.labelName {
+			return nil, fmt.Errorf("static label %q conflicts with the process label", name)
+		}
+	}
+
+	reserved := append([]string{"name", "cgroup", "exe_sha256", "cpu_affinity", "wchan", "container_runtime", "container_id"}, metricLabelNames...)
+	for _, l := range labels {
+		reserved = append(reserved, l.labelName)
+	}
+	reserved = append(reserved, staticLabelNames...)
+	if renamer != nil {
+		reserved = append(reserved, renamer.labelName)
+	}
+	labeler, err := newNodeLabeler(opts.NodeLabelName, opts.NodeLabelValue, reserved)
+	if err != nil {
+		return nil, err
+	}
+
+	var limiter *seriesLimiter
+	if *maxSeries > 0 {
+		labelNames := []string{"name"}
+		if renamer != nil {
+			labelNames = append(labelNames, renamer.labelName)
+		}
+		limiter = newSeriesLimiter(*maxSeries, labelNames)
+	}
+
+	if opts.MinInterval < 0 {
+		return nil, fmt.Errorf("invalid minimum interval %s, must not be negative", opts.MinInterval)
+	}
+	if *fdRateAlpha <= 0 || *fdRateAlpha > 1 {
+		return nil, fmt.Errorf("invalid FD rate alpha %g, must be in (0, 1]", *fdRateAlpha)
+	}
+	if *ioRateAlpha <= 0 || *ioRateAlpha > 1 {
+		return nil, fmt.Errorf("invalid I/O rate alpha %g, must be in (0, 1]", *ioRateAlpha)
+	}
+	if err := validatePIDAggregation(*pidAggregation, *representativePID); err != nil {
+		return nil, err
+	}
+	if *sloWindowSize < 1 || *sloBudget < 1 {
+		return nil, fmt.Errorf("invalid SLO window size %d or budget %dms, must be positive", *sloWindowSize, *sloBudget)
+	}
+
+	var counters *continuousCounters
+	if opts.ContinuousCounters {
+		counters = newContinuousCounters()
+	}
+
+	var libPrefixes []string
+	for _, prefix := range strings.Split(*libPathPrefixes, ",") {
+		if prefix != "" {
+			libPrefixes = append(libPrefixes, prefix)
+		}
+	}
+
+	// PID files of the config file are added to those of the flag.
+	allPIDFiles := map[string]string{}
+	for name, path := range opts.PIDFiles {
+		allPIDFiles[name] = path
+	}
+	for _, p := range config.Processes {
+		if p.PIDFile == "" {
+			continue
+		}
+		if _, ok := allPIDFiles[p.Name]; ok {
+			return nil, fmt.Errorf("PID file of process %q set in --collector.procstats.registered-processes and in the config file", p.Name)
+		}
+		allPIDFiles[p.Name] = filepath.Join(opts.RootFS, p.PIDFile)
+	}
+	pidFiles := allPIDFiles
+
+	// Processes with a glob of PID files expose their instances like
+	// processes discovered by regex, without the metric vectors.
+	var (
+		globs      []*pidFileGlob
+		registered []string
+	)
+	for _, name := range processes {
+		if path, ok := pidFiles[name]; ok && isPIDFileGlob(path) {
+			g, err := newPIDFileGlob(name, path)
 			if err != nil {
-				return fmt.Errorf("invalid value %d in diskstats: %s", value, err)
+				return nil, fmt.Errorf("invalid PID file pattern %q of registered process %q: %s", path, name, err)
 			}
-			if gauge, ok := c.metrics[k].(*prometheus.GaugeVec); ok {
-				gauge.WithLabelValues(procName).Set(float64(value))
-			} else {
-				return fmt.Errorf("unexpected collector %d", k)
+			globs = append(globs, g)
+			continue
+		}
+		registered = append(registered, name)
+	}
+	processes = registered
+
+	commands := map[string]*commandResolver{}
+	gracePeriods := map[string]time.Duration{}
+	versions := map[string]*versionSource{}
+	thresholds := map[string]memoryThresholdsConfig{}
+	schedules := map[string]*cronSchedule{}
+	namespaces := map[string]*namespaceResolver{}
+	expectedPorts := map[string]int{}
+	requiredArgs := map[string][]string{}
+	var (
+		matchers    []*processMatcher
+		supervisors []*supervisorResolver
+	)
+	staticLabels := map[string]map[string]string{}
+	for _, p := range config.Processes {
+		if p.Supervisor != nil {
+			s, err := newSupervisorResolver(p)
+			if err != nil {
+				return nil, err
+			}
+			supervisors = append(supervisors, s)
+			continue
+		}
+		if p.discovered() {
+			m, err := newProcessMatcher(p)
+			if err != nil {
+				return nil, err
+			}
+			matchers = append(matchers, m)
+			continue
+		}
+		if len(p.Command) > 0 {
+			commands[p.Name] = newCommandResolver(p)
+		}
+		if p.Namespace != nil {
+			namespaces[p.Name] = newNamespaceResolver(p)
+		}
+		if p.StartupGrace != nil {
+			gracePeriods[p.Name] = time.Duration(*p.StartupGrace)
+		}
+		if p.MemoryThresholds != nil {
+			thresholds[p.Name] = *p.MemoryThresholds
+		}
+		if p.Version != nil {
+			// Validated with the config.
+			versions[p.Name], _ = newVersionSource(p.Version)
+			if versions[p.Name].file != "" {
+				versions[p.Name].file = filepath.Join(opts.RootFS, versions[p.Name].file)
+			}
+		}
+		if p.Schedule != "" {
+			schedules[p.Name], _ = parseCronSchedule(p.Schedule)
+		}
+		if p.ExpectedPort != 0 {
+			expectedPorts[p.Name] = p.ExpectedPort
+		}
+		if len(p.RequiredArgs) > 0 {
+			requiredArgs[p.Name] = p.RequiredArgs
+		}
+		if len(p.Labels) > 0 {
+			staticLabels[p.Name] = p.Labels
+		}
+		for _, g := range globs {
+			if g.name == p.Name {
+				return nil, fmt.Errorf("process %q is registered with a PID file pattern and in the config file", p.Name)
 			}
 		}
+		if !containsString(processes, p.Name) {
+			processes = append(processes, p.Name)
+		}
 	}
-	for _, c := range c.metrics {
-		c.Collect(ch)
+
+	unitProcesses, units, err := parseSystemdUnits(*systemdUnits)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range unitProcesses {
+		_, command := commands[name]
+		_, namespace := namespaces[name]
+		if command || namespace {
+			return nil, fmt.Errorf("process %q of a systemd unit is resolved by the config file", name)
+		}
+		for _, g := range globs {
+			if g.name == name {
+				return nil, fmt.Errorf("process %q of a systemd unit is registered with a PID file pattern", name)
+			}
+		}
+		if !containsString(processes, name) {
+			processes = append(processes, name)
+		}
 	}
-	return err
-}
 
-func getProcessStats(procPID map[string]int) (map[string]map[int]int, error) {
-	procStats := make(map[string]map[int]int, 0)
-	for procName, pid := range procPID {
-		pidStr := strconv.Itoa(pid)
-		filename := procFilePath(pidStr) + "/status"
-		var err error
-		procFile, err := os.Open(filename)
-		if err != nil {
-			log.Errorf("Unable to open the file %s", filename)
-			return procStats, err
+	discovery, err := newProcessDiscoveryFromFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	if *remoteHostsFile != "" {
+		if discovery != nil {
+			return nil, fmt.Errorf("service discovery isn't supported with remote hosts")
+		}
+		if len(units) > 0 {
+			return nil, fmt.Errorf("systemd units aren't supported with remote hosts")
 		}
-		defer procFile.Close()
-		procStats[procName], err = parseProcessStats(procFile, pid)
+		if len(globs) > 0 {
+			return nil, fmt.Errorf("PID file pattern %q of registered process %q isn't supported with remote hosts", globs[0].pattern, globs[0].name)
+		}
+		hosts, err := loadRemoteHosts(*remoteHostsFile)
 		if err != nil {
-			log.Errorf("Unable to parse the process statistics for %s", procName)
+			return nil, err
+		}
+		// The PID files are read on the remote hosts, without --path.rootfs.
+		paths := map[string]string{}
+		for name, path := range opts.PIDFiles {
+			paths[name] = path
+		}
+		for _, p := range config.Processes {
+			if p.PIDFile != "" {
+				paths[p.Name] = p.PIDFile
+			}
+		}
+		return newAggregatingCollector(hosts, processes, remotePIDFiles(processes, *pidFileDir, paths), sshRunner), nil
+	}
+
+	// ss is only run if the file descriptors of a process can't be read.
+	ssPath := ""
+	if opts.SSFallback {
+		ssPath = opts.SSPath
+	}
+
+	return &procstatsCollector{
+		registeredProcessesList: processes,
+		procRoot:                opts.ProcRoot,
+		pidDir:                  opts.PIDDir,
+		pidFiles:                pidFiles,
+		sysRoot:                 opts.SysRoot,
+		cpuAffinityCores:        opts.CPUAffinityCores,
+		perThreadRSS:            opts.PerThreadRSS,
+		smaps:                   opts.Smaps,
+		socketsEnabled:          opts.Sockets,
+		maps:                    opts.Maps,
+		perThreadStates:         opts.PerThreadStates,
+		discoverByCmdline:       opts.DiscoverByCmdline,
+		matchByName:             opts.MatchByName,
+		ssPath:                  ssPath,
+		minInterval:             opts.MinInterval,
+		envLabels:               labels,
+		staticLabelNames:        staticLabelNames,
+		staticLabels:            staticLabels,
+		continuousCounters:      counters,
+		textfile:                textfile,
+		renamer:                 renamer,
+		nodeLabeler:             labeler,
+		seriesLimiter:           limiter,
+		startupGraces:           newStartupGraces(gracePeriods, opts.StartupGrace),
+		commands:                commands,
+		systemdUnits:            units,
+		systemdConnect:          newDBusSystemdClient,
+		matchers:                matchers,
+		pidFileGlobs:            globs,
+		supervisors:             supervisors,
+		libPathPrefixes:         libPrefixes,
+		discovery:               discovery,
+		listed:                  &processList{},
+		versions:                versions,
+		schedules:               schedules,
+		namespaces:              namespaces,
+		expectedPorts:           expectedPorts,
+		requiredArgs:            requiredArgs,
+		memoryThresholds:        newMemoryThresholds(thresholds),
+		latencies:               newLatencyWindow(*sloWindowSize, time.Duration(*sloBudget)*time.Millisecond),
+		procstatsDescs:          newProcstatsDescs(),
+		status:                  newStatusMetrics(processLabelNames),
+		memory:                  newMemoryMetrics(processLabelNames),
+		cpu:                     newCPUMetrics(processLabelNames),
+		fds:                     newFDMetrics(processLabelNames),
+		sockets:                 newSocketMetrics(processLabelNames),
+		io:                      newIOMetrics(processLabelNames),
+		cgroup:                  newCgroupMetrics(processLabelNames),
+		lifecycle:               newLifecycleMetrics(processLabelNames),
+		security:                newSecurityMetrics(processLabelNames),
+		cmdline:                 newCmdlineMetrics(processLabelNames),
+		tree:                    newTreeMetrics(processLabelNames),
+		lastHWM:                 map[string]int{},
+		lastPressure:            map[string]pressureSample{},
+		binaryHashes:            map[string]binaryHash{},
+		previousFDs:             map[string]fdSample{},
+		previousCPU:             map[string]cpuActivity{},
+		previousIO:              map[string]ioSample{},
+		previousCgroupCPU:       map[string]cgroupCPUSample{},
+		previousSwap:            map[string]swapSample{},
+		instances:               map[string]processInstance{},
+		statusCaches:            map[string]*rateLimitedCache{},
+		seriesLabels:            map[string][]string{},
+	}, nil
+}
+
+// vecs returns the metric vectors of the collector.
+func (c *procstatsCollector) vecs() []prometheus.Collector {
+	var vecs []prometheus.Collector
+	for _, g := range c.metricGroups() {
+		vecs = append(vecs, g.vecs()...)
+	}
+	return vecs
+}
+
+// metricGroups returns the groups of metric vectors of the collector.
+func (c *procstatsCollector) metricGroups() []processMetricGroup {
+	return []processMetricGroup{
+		c.status,
+		c.memory,
+		c.cpu,
+		c.fds,
+		c.sockets,
+		c.io,
+		c.cgroup,
+		c.lifecycle,
+		c.security,
+		c.cmdline,
+		c.tree,
+	}
+}
+
+// procstatsDescs are the descriptors of the const metrics of the collector,
+// e.g. whether the processes are up, and of the collector itself.
+type procstatsDescs struct {
+	resolutionRatio         *prometheus.Desc
+	cacheAge                *prometheus.Desc
+	up                      *prometheus.Desc
+	oldestAge               *prometheus.Desc
+	startupGraceActive      *prometheus.Desc
+	versionInfo             *prometheus.Desc
+	expectedRunning         *prometheus.Desc
+	collectionSLORatio      *prometheus.Desc
+	procfsAvailable         *prometheus.Desc
+	sdError                 *prometheus.Desc
+	systemdAvailable        *prometheus.Desc
+	systemdUnitState        *prometheus.Desc
+	systemdRestarts         *prometheus.Desc
+	lastScrape              *prometheus.Desc
+	inotifyMaxUserWatches   *prometheus.Desc
+	inotifyMaxUserInstances *prometheus.Desc
+	inotifyInstances        *prometheus.Desc
+	pidFilePID              *prometheus.Desc
+	runningPID              *prometheus.Desc
+	info                    *prometheus.Desc
+}
+
+// newProcstatsDescs returns the descriptors of the const metrics.
+func newProcstatsDescs() procstatsDescs {
+	return procstatsDescs{
+		resolutionRatio: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "resolution_ratio"),
+			"Ratio of registered processes whose statistics could be read. 1 if no processes are registered.",
+			nil, nil,
+		),
+		cacheAge: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "collector_cache_age_seconds"),
+			"Age of the oldest process status reused from a read within --collector.procstats.min-interval, 0 if all were read by this scrape.",
+			nil, nil,
+		),
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "up"),
+			"Whether the PID of the registered process was found and its status could be read.",
+			[]string{"name"}, nil,
+		),
+		oldestAge: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "oldest_age_seconds"),
+			"Age of the oldest of the processes resolved for the name.",
+			[]string{"name"}, nil,
+		),
+		startupGraceActive: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "startup_grace_active"),
+			"The process hasn't been found yet within its startup grace period, its state is unknown.",
+			[]string{"name"}, nil,
+		),
+		versionInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "version_info"),
+			"Version of the process as configured in the procstats config, value is always 1.",
+			[]string{"name", "version"}, nil,
+		),
+		expectedRunning: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "expected_running"),
+			"Whether the process is expected to run now according to its configured schedule.",
+			[]string{"name"}, nil,
+		),
+		collectionSLORatio: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "collection_slo_ratio"),
+			"Proportion of the latest collections that completed within --collector.procstats.slo-budget-ms.",
+			nil, nil,
+		),
+		procfsAvailable: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "collector_procfs_available"),
+			"Whether procfs could be accessed, no process is collected without it.",
+			nil, nil,
+		),
+		sdError: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "sd_error"),
+			"Whether the last fetch of --collector.procstats.sd-url failed, the processes of the last successful fetch are kept.",
+			nil, nil,
+		),
+		systemdAvailable: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "systemd_available"),
+			"Whether systemd could be reached over D-Bus, otherwise the processes of --collector.procstats.systemd-units are read from their PID files.",
+			nil, nil,
+		),
+		systemdUnitState: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "systemd_unit_state"),
+			"Whether the systemd unit of the process is in the state, from its ActiveState.",
+			[]string{"name", "unit", "state"}, nil,
+		),
+		systemdRestarts: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "systemd_unit_restarts_total"),
+			"Number of automatic restarts of the systemd unit of the process, from its NRestarts.",
+			[]string{"name", "unit"}, nil,
+		),
+		lastScrape: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "collector_last_scrape_timestamp_seconds"),
+			"Time the procstats collector last finished collecting, whether or not any process was found.",
+			nil, nil,
+		),
+		inotifyMaxUserWatches: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "inotify", "max_user_watches"),
+			"Maximum number of inotify watches per user, from /proc/sys/fs/inotify/max_user_watches.",
+			nil, nil,
+		),
+		inotifyMaxUserInstances: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "inotify", "max_user_instances"),
+			"Maximum number of inotify instances per user, from /proc/sys/fs/inotify/max_user_instances.",
+			nil, nil,
+		),
+		inotifyInstances: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "inotify", "instances"),
+			"Number of inotify instances of all processes whose file descriptors are readable.",
+			nil, nil,
+		),
+		pidFilePID: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "pidfile_pid"),
+			"The PID read from the PID file of the process.",
+			[]string{"name"}, nil,
+		),
+		runningPID: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "running_pid"),
+			"The lowest PID of the running processes whose comm is the process name.",
+			[]string{"name"}, nil,
+		),
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "info"),
+			"Information about the process, value is always 1.",
+			[]string{"name", "cgroup", "exe_sha256", "cpu_affinity", "wchan", "container_runtime", "container_id"}, nil,
+		),
+	}
+}
+
+// descs returns all descriptors.
+func (d procstatsDescs) descs() []*prometheus.Desc {
+	return []*prometheus.Desc{
+		d.resolutionRatio,
+		d.cacheAge,
+		d.up,
+		d.oldestAge,
+		d.startupGraceActive,
+		d.versionInfo,
+		d.expectedRunning,
+		d.collectionSLORatio,
+		d.procfsAvailable,
+		d.sdError,
+		d.systemdAvailable,
+		d.systemdUnitState,
+		d.systemdRestarts,
+		d.lastScrape,
+		d.inotifyMaxUserWatches,
+		d.inotifyMaxUserInstances,
+		d.inotifyInstances,
+		d.pidFilePID,
+		d.runningPID,
+		d.info,
+	}
+}
+
+// processMetricGroup is a group of related metric vectors of the registered
+// processes, e.g. their memory or file descriptor metrics. Each group is
+// built by a constructor of its own and collected as a whole.
+type processMetricGroup interface {
+	prometheus.Collector
+	// vecs returns the metric vectors of the group.
+	vecs() []prometheus.Collector
+}
+
+// metricVecs are the metric vectors of a group, embedded in the group to
+// implement processMetricGroup.
+type metricVecs []prometheus.Collector
+
+func (m metricVecs) vecs() []prometheus.Collector {
+	return m
+}
+
+// Describe sends the descriptors of all vectors to ch.
+func (m metricVecs) Describe(ch chan<- *prometheus.Desc) {
+	for _, v := range m {
+		v.Describe(ch)
+	}
+}
+
+// Collect sends the metrics of all vectors to ch.
+func (m metricVecs) Collect(ch chan<- prometheus.Metric) {
+	for _, v := range m {
+		v.Collect(ch)
+	}
+}
+
+// withLabelNames returns the label names of a metric vector adding names to
+// the labels of the process.
+func withLabelNames(labelNames []string, names ...string) []string {
+	return append(append([]string{}, labelNames...), names...)
+}
+
+// Describe sends the descriptors of the metrics of the collector to ch, so
+// that conflicting metrics are detected when registering it.
+func (c *procstatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		c.describe(descs)
+		close(descs)
+	}()
+	// The processes matched by regex, PID file pattern or supervisor expose
+	// some metrics of the vectors with other labels. The registry requires
+	// the same labels for all descriptors of a name and checks collected
+	// metrics by name only, so only the first descriptor of a name is sent.
+	described := map[string]bool{}
+	for desc := range descs {
+		for _, d := range c.transformDesc(desc) {
+			name, _, err := descNameAndHelp(d)
+			if err != nil || described[name] {
+				continue
+			}
+			described[name] = true
+			ch <- d
+		}
+	}
+}
+
+// describe sends the descriptors of all metrics update may send, before
+// they are renamed and labeled, to ch.
+func (c *procstatsCollector) describe(ch chan<- *prometheus.Desc) {
+	for _, g := range c.metricGroups() {
+		g.Describe(ch)
+	}
+	for _, desc := range c.descs() {
+		ch <- desc
+	}
+	for _, m := range c.matchers {
+		m.metrics.describe(ch)
+		ch <- m.instances
+	}
+	for _, s := range c.supervisors {
+		s.metrics.describe(ch)
+	}
+	for _, g := range c.pidFileGlobs {
+		g.metrics.describe(ch)
+	}
+	if c.seriesLimiter != nil {
+		ch <- c.seriesLimiter.capped
+	}
+}
+
+// transformDesc returns the descriptors of the metrics updateProcesses
+// sends for the metrics of d, renamed and with the node label.
+func (c *procstatsCollector) transformDesc(d *prometheus.Desc) []*prometheus.Desc {
+	descs := []*prometheus.Desc{d}
+	if c.renamer != nil {
+		descs = c.renamer.describe(d)
+	}
+	if c.nodeLabeler != nil {
+		for i, desc := range descs {
+			descs[i] = c.nodeLabeler.describe(desc)
+		}
+	}
+	return descs
+}
+
+func (c *procstatsCollector) Update(ch chan<- prometheus.Metric) error {
+	return c.updateProcesses(ch, nil)
+}
+
+// updateProcesses collects the named processes, or all processes if names is
+// nil. Collections of a subset don't write the textfile, aren't limited in
+// their series and don't count towards node_process_collection_slo_ratio.
+func (c *procstatsCollector) updateProcesses(ch chan<- prometheus.Metric, names map[string]bool) error {
+	all := names == nil
+	var (
+		textfileMetrics []prometheus.Metric
+		waits           []func()
+	)
+	// Timestamps are attached last, the textfile collector doesn't accept
+	// them.
+	if *sampleTimestamps {
+		var wait func()
+		ch, wait = transformMetrics(ch, withTimestamp(time.Now()))
+		waits = append(waits, wait)
+	}
+	// Metrics pass the renamer, the node labeler and the series limit
+	// before they are teed to the textfile, so that the textfile matches
+	// the scraped output.
+	if all && c.textfile != nil {
+		var wait func()
+		ch, wait = transformMetrics(ch, func(m prometheus.Metric) []prometheus.Metric {
+			textfileMetrics = append(textfileMetrics, m)
+			return []prometheus.Metric{m}
+		})
+		waits = append(waits, wait)
+	}
+	if all && c.seriesLimiter != nil {
+		var wait func()
+		ch, wait = bufferMetrics(ch, c.seriesLimiter.limit)
+		waits = append(waits, wait)
+	}
+	if c.nodeLabeler != nil {
+		var wait func()
+		ch, wait = transformMetrics(ch, c.nodeLabeler.label)
+		waits = append(waits, wait)
+	}
+	if c.renamer != nil {
+		var wait func()
+		ch, wait = transformMetrics(ch, c.renamer.translate)
+		waits = append(waits, wait)
+	}
+	// The vectors hold the series of all processes, the others are dropped
+	// by their name before it is renamed.
+	if !all {
+		var wait func()
+		ch, wait = transformMetrics(ch, processFilter(names))
+		waits = append(waits, wait)
+	}
+
+	begin := time.Now()
+	err := c.update(ch, names)
+	if all {
+		c.latencies.add(time.Since(begin))
+		ch <- prometheus.MustNewConstMetric(c.collectionSLORatio, prometheus.GaugeValue, c.latencies.ratio())
+		ch <- prometheus.MustNewConstMetric(c.lastScrape, prometheus.GaugeValue, float64(time.Now().UnixNano())/1e9)
+	}
+	for i := len(waits) - 1; i >= 0; i-- {
+		waits[i]()
+	}
+
+	if all && c.textfile != nil {
+		if werr := c.textfile.write(textfileMetrics); werr != nil {
+			log.Errorf("Unable to write the procstats textfile: %s", werr)
+		}
+	}
+	return err
+}
+
+// transformMetrics returns a channel whose metrics are passed through
+// transform and sent to out. The returned function closes the channel and
+// waits until all metrics have been sent.
+func transformMetrics(out chan<- prometheus.Metric, transform func(prometheus.Metric) []prometheus.Metric) (chan<- prometheus.Metric, func()) {
+	in := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for m := range in {
+			for _, t := range transform(m) {
+				out <- t
+			}
 		}
+		close(done)
+	}()
+	return in, func() {
+		close(in)
+		<-done
 	}
-	return procStats, nil
 }
 
-func parseProcessStats(r io.Reader, pid int) (map[int]int, error) {
-	stats := make(map[int]int, 0)
-	stats[0] = pid
-	var err error
-	scanner := bufio.NewScanner(r)
-	scanner.Split(bufio.ScanLines)
+// update collects the named processes, or all processes if names is nil.
+func (c *procstatsCollector) update(ch chan<- prometheus.Metric, names map[string]bool) (err error) {
+	if c.discovery != nil {
+		sdError := 0.0
+		if err := c.discovery.refresh(time.Now()); err != nil {
+			log.Errorf("Unable to discover the processes: %s", err)
+			sdError = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.sdError, prometheus.GaugeValue, sdError)
+	}
+	c.deleteProcessSeries(c.listed.takeRemoved()...)
+	// Without procfs every process would fail on its own, fail once instead.
+	if err := checkProcfs(c.procRoot); err != nil {
+		ch <- prometheus.MustNewConstMetric(c.procfsAvailable, prometheus.GaugeValue, 0)
+		return fmt.Errorf("procfs is unavailable: %s", err)
+	}
+	ch <- prometheus.MustNewConstMetric(c.procfsAvailable, prometheus.GaugeValue, 1)
+	files := newProcessFiles(c.procRoot)
 
-	for scanner.Scan() {
-		//Refer: http://manpages.ubuntu.com/manpages/wily/man5/proc.5.html
-		text := scanner.Text()
-		procStats := strings.Split(text, ":")
-		if procStats[0] == "VmRSS" {
-			data := procStats[1]
-			data = data[1:]
-			data = strings.TrimSuffix(data, "kB")
-			data = strings.TrimSpace(data)
-			stats[1], err = strconv.Atoi(data)
+	//Iterate over all the proces names and get the PIDs from /var/run/$name.pid
+	procPID := make(map[string]int, 0)
+	procPIDs := map[string][]int{}
+	pidFilePIDs := map[string]int{}
+	pidFileStale := map[string]float64{}
+	var pid int
+	var pidBytes []byte
+	var withoutPIDFile []string
+	var units map[string]systemdUnit
+	if len(c.systemdUnits) > 0 {
+		var unitsErr error
+		units, unitsErr = c.querySystemdUnits(c.registeredProcesses(names))
+		available := 1.0
+		if unitsErr != nil {
+			systemdUnavailableOnce.Do(func() {
+				log.Warnf("Unable to reach systemd, reading the PID files of the systemd units instead: %s", unitsErr)
+			})
+			log.Debugf("Unable to reach systemd: %s", unitsErr)
+			available = 0
+		}
+		ch <- prometheus.MustNewConstMetric(c.systemdAvailable, prometheus.GaugeValue, available)
+		for procName, unit := range units {
+			for _, state := range systemdActiveStates {
+				v := 0.0
+				if unit.ActiveState == state {
+					v = 1
+				}
+				ch <- prometheus.MustNewConstMetric(c.systemdUnitState, prometheus.GaugeValue, v, procName, c.systemdUnits[procName], state)
+			}
+			if unit.HasRestarts {
+				ch <- prometheus.MustNewConstMetric(c.systemdRestarts, prometheus.CounterValue, float64(unit.Restarts), procName, c.systemdUnits[procName])
+			}
+		}
+	}
+	for _, procName := range c.registeredProcesses(names) {
+		// A unit that isn't running has no main PID, systemd knows better
+		// than a PID file left behind.
+		if unit, ok := units[procName]; ok {
+			if unit.MainPID > 0 {
+				procPID[procName] = unit.MainPID
+				procPIDs[procName] = []int{unit.MainPID}
+			}
+			continue
+		}
+		if r, ok := c.commands[procName]; ok {
+			pids, err := r.resolve()
+			if err != nil {
+				processLogger(procName, 0).Errorf("Unable to resolve the PID: %s", err)
+				continue
+			}
+			procPID[procName] = selectRepresentativePID(files, pids, *representativePID)
+			procPIDs[procName] = pids
+			continue
+		}
+		if r, ok := c.namespaces[procName]; ok {
+			pid, err := r.resolve(c.procRoot)
 			if err != nil {
-				log.Errorf("Unable to parse the resident memory for pid: %d", pid)
+				processLogger(procName, 0).Errorf("Unable to resolve the PID in the namespace of process %d: %s", r.initPID, err)
 				continue
 			}
+			procPID[procName] = pid
+			procPIDs[procName] = []int{pid}
+			continue
+		}
+
+		pidFile := c.pidFilePath(procName)
+		pidBytes, err = ioutil.ReadFile(pidFile)
+		if err != nil {
+			// log.Errorf("Unable to open the PID file for %s. Cause: %s", procName, err.Error())
+			if c.discoverByCmdline {
+				pids, derr := discoverPIDsFromProc(c.procRoot, procName)
+				if derr != nil {
+					processLogger(procName, 0).Debugf("Unable to discover the PID by the command line: %s", derr)
+					continue
+				}
+				procPID[procName] = selectRepresentativePID(files, pids, *representativePID)
+				procPIDs[procName] = pids
+			}
+			if _, ok := procPIDs[procName]; !ok {
+				withoutPIDFile = append(withoutPIDFile, procName)
+			}
+			continue
+		}
+		pid, err = strconv.Atoi(strings.TrimSpace(string(pidBytes)))
+		if err == nil && pid <= 0 {
+			err = fmt.Errorf("invalid PID %d", pid)
+		}
+		if err != nil {
+			// Reported as down rather than reading /proc/0.
+			processLogger(procName, 0).With("path", pidFile).Errorf("Failed to convert byte array to int while reading the PID. Cause: %s", err)
+			withoutPIDFile = append(withoutPIDFile, procName)
+			continue
+		}
+		procPID[procName] = int(pid)
+		procPIDs[procName] = []int{pid}
+		pidFilePIDs[procName] = pid
+
+		staleness, err := getProcessPIDFileStaleness(files, pidFile, pid)
+		if err != nil {
+			processLogger(procName, pid).With("path", pidFile).Debugf("Unable to determine the staleness of the PID file: %s", err)
+		} else {
+			stale := 0.0
+			if staleness > maxPIDFileAge.Seconds() {
+				stale = 1.0
+			}
+			pidFileStale[procName] = stale
+		}
+	}
+	var processCounts map[string]int
+	if c.matchByName && len(withoutPIDFile) > 0 {
+		processCounts = c.resolveByName(files, withoutPIDFile, procPID, procPIDs)
+	}
+	// Sent before reading the stats, which skips a stale PID file.
+	if *pidDivergence {
+		c.collectPIDDivergence(pidFilePIDs, ch)
+	}
+	c.collectExpectedRunning(c.registeredProcesses(names), time.Now(), ch)
+	processStats, affinities, err := getProcessStats(files, procPID)
+	if err != nil {
+		return fmt.Errorf("couldn't get process stats: %s", err)
+	}
+	// A process that exited or whose PID file was removed would keep the
+	// last values of its series, delete them. The staleness of a PID file
+	// left behind is set afterwards.
+	var vanished []string
+	for _, procName := range c.registeredProcesses(names) {
+		if _, ok := processStats[procName]; !ok {
+			vanished = append(vanished, procName)
+		}
+	}
+	c.deleteProcessSeries(vanished...)
+	c.setProcessLabels(procPID)
+	for procName, stale := range pidFileStale {
+		c.lifecycle.pidFileStale.WithLabelValues(c.processLabels(procName)...).Set(stale)
+	}
+	for procName, count := range processCounts {
+		c.lifecycle.processCount.WithLabelValues(c.processLabels(procName)...).Set(float64(count))
+	}
+	if *pidAggregation != pidAggregationRepresentative {
+		for procName, stats := range processStats {
+			if pids := procPIDs[procName]; len(pids) > 1 {
+				processStats[procName] = aggregateProcessStats(files, stats, procPID[procName], pids, *pidAggregation)
+			}
+		}
+	}
+
+	now := time.Now()
+	// cacheAge is the age of the oldest cached status of the scrape.
+	var cacheAge time.Duration
+	availableMem, memErr := getMemAvailableBytes(c.procRoot)
+	if memErr != nil {
+		log.Debugf("Unable to read the available memory: %s", memErr)
+	}
+	cmdlineLimit, cmdlineErr := getCmdlineLimit(c.procRoot)
+	if cmdlineErr != nil {
+		log.Debugf("Unable to read the command line limit: %s", cmdlineErr)
+	}
+	mqueuesMax, mqueuesErr := getMqueueLimit(c.procRoot, "queues_max")
+	if mqueuesErr != nil {
+		log.Debugf("Unable to read the message queue limit: %s", mqueuesErr)
+	}
+	bootTime, bootErr := files.bootTime()
+	if bootErr != nil {
+		log.Debugf("Unable to read the boot time: %s", bootErr)
+	}
+	var (
+		numaNodes map[int][]int
+		numaErr   error
+	)
+	if *numaPages {
+		if numaNodes, numaErr = getNUMANodeCPUs(c.sysRoot); numaErr != nil {
+			log.Debugf("Unable to read the NUMA nodes: %s", numaErr)
+		}
+	}
+	var parents map[int]int
+	if *includeChildren {
+		if pids, err := listPIDs(c.procRoot); err != nil {
+			log.Errorf("Unable to list the processes: %s", err)
+		} else {
+			parents = getProcessParents(files, pids)
+		}
+	}
+	for procName, stats := range processStats {
+		logger := processLogger(procName, procPID[procName])
+		labelValues := c.processLabels(procName)
+		startTime, continuous := c.startTime(files, procName, procPID[procName])
+		// counter carries the counter key of the process forward across
+		// restarts if continuous counters are enabled.
+		counter := func(key string, value float64) float64 {
+			if continuous {
+				return c.continuousCounters.adjust(procName, startTime, key, value)
+			}
+			return value
+		}
+		c.status.pid.WithLabelValues(labelValues...).Set(float64(stats.PID))
+		if stats.Has("VmRSS") {
+			c.status.memKilobytes.WithLabelValues(labelValues...).Set(float64(stats.VmRSS))
+		}
+		if stats.Has("Threads") {
+			c.status.threads.WithLabelValues(labelValues...).Set(float64(stats.Threads))
+		}
+		if stats.Has("SigPnd") {
+			c.status.signalsPending.WithLabelValues(labelValues...).Set(float64(stats.SignalsPending))
+		}
+		if stats.Has("SigCgt") {
+			c.status.signalsCaught.WithLabelValues(labelValues...).Set(float64(stats.SignalsCaught))
+		}
+		if stats.Has("voluntary_ctxt_switches") {
+			c.status.voluntaryCtxtSwitches.WithLabelValues(labelValues...).Set(counter("voluntary_ctxt_switches", float64(stats.VoluntaryCtxtSwitches)))
+		}
+		if stats.Has("nonvoluntary_ctxt_switches") {
+			c.status.nonvoluntaryCtxtSwitches.WithLabelValues(labelValues...).Set(counter("nonvoluntary_ctxt_switches", float64(stats.NonvoluntaryCtxtSwitches)))
+		}
+		if stats.Has("VmStk") {
+			c.memory.stackBytes.WithLabelValues(c.processLabels(procName)...).Set(kbToBytes(stats.VmStk))
+		}
+		if stats.Has("VmSize") {
+			c.memory.virtualMemoryBytes.WithLabelValues(c.processLabels(procName)...).Set(kbToBytes(stats.VmSize))
+		}
+		for _, t := range residentMemoryTypes {
+			if stats.Has(t.field) {
+				c.memory.residentMemoryBytes.WithLabelValues(c.processLabels(procName, t.name)...).Set(kbToBytes(*statField(&stats, t.field)))
+			}
+		}
+		if stats.Has("VmSwap") {
+			c.memory.swapBytes.WithLabelValues(c.processLabels(procName)...).Set(kbToBytes(stats.VmSwap))
+			c.updateSwapRate(procName, procPID[procName], kbToBytes(stats.VmSwap), now)
+		}
+		if parents != nil {
+			c.updateTree(files, procName, procPIDs[procName], parents)
+		}
+		if stats.Has("State") {
+			for _, state := range processStates {
+				v := 0.0
+				if stats.State == state.code {
+					v = 1
+				}
+				c.status.processState.WithLabelValues(c.processLabels(procName, state.name)...).Set(v)
+			}
+		}
+		// The peak of the representative PID doesn't compare to the
+		// resident memory of several PIDs.
+		if len(procPIDs[procName]) <= 1 || *pidAggregation == pidAggregationRepresentative {
+			if ratio, ok := vmPeakToRSSRatio(stats); ok {
+				c.memory.vmPeakToRSS.WithLabelValues(c.processLabels(procName)...).Set(ratio)
+			}
+		}
+		if stats.Has("VmHWM") {
+			reset := c.detectHWMReset(procName, stats.VmHWM)
+			if c.startupGraces.starting(procName, now) {
+				reset = 0
+			}
+			c.memory.hwmReset.WithLabelValues(c.processLabels(procName)...).Set(reset)
+		}
+		if c.perThreadRSS {
+			if rss, tid, err := getMaxThreadRSS(c.procRoot, procPID[procName]); err != nil {
+				logger.Debugf("Unable to read the thread memory: %s", err)
+			} else {
+				c.memory.maxThreadRSS.WithLabelValues(c.processLabels(procName)...).Set(float64(rss))
+				c.memory.maxThreadTID.WithLabelValues(c.processLabels(procName)...).Set(float64(tid))
+			}
+		}
+		if c.perThreadStates {
+			if states, err := getThreadStates(c.procRoot, procPID[procName]); err != nil {
+				logger.Debugf("Unable to read the thread states: %s", err)
+			} else {
+				for _, state := range threadStates {
+					c.cpu.threadsState.WithLabelValues(c.processLabels(procName, state)...).Set(float64(states[state]))
+				}
+			}
+		}
+		if inode, err := getNamespaceInode(c.procRoot, procPID[procName], "net"); err != nil {
+			logger.Debugf("Unable to read the network namespace: %s", err)
+		} else {
+			c.sockets.netNamespaceInode.WithLabelValues(c.processLabels(procName)...).Set(float64(inode))
+		}
+		if c.smaps {
+			if rollup, err := getProcessSmapsRollup(c.procRoot, procPID[procName]); err != nil {
+				logger.Debugf("Unable to read the memory rollup: %s", err)
+			} else {
+				for _, v := range []struct {
+					vec    *prometheus.GaugeVec
+					fields []string
+				}{
+					{c.memory.dirtyPages, smapsDirty},
+					{c.memory.pssBytes, smapsPSS},
+					{c.memory.ussBytes, smapsUSS},
+				} {
+					if bytes, err := smapsRollupBytes(rollup, v.fields); err != nil {
+						logger.Debugf("Unable to read the memory rollup: %s", err)
+					} else {
+						v.vec.WithLabelValues(c.processLabels(procName)...).Set(float64(bytes))
+					}
+				}
+			}
+		}
+		if c.maps {
+			if mapped, err := getProcessMappedFiles(c.procRoot, procPID[procName]); err != nil {
+				logger.Debugf("Unable to read the memory maps: %s", err)
+			} else {
+				c.memory.mmapFileCount.WithLabelValues(c.processLabels(procName)...).Set(float64(len(mapped)))
+				c.memory.mmapUniqueLibraries.WithLabelValues(c.processLabels(procName)...).Set(float64(countLibraries(mapped, c.libPathPrefixes)))
+			}
+		}
+		if *numaPages && numaErr == nil {
+			if local, remote, err := getProcessNUMAPages(files, procPID[procName], numaNodes); err != nil {
+				logger.Debugf("Unable to read the NUMA pages: %s", err)
+			} else {
+				c.memory.numaLocalPages.WithLabelValues(c.processLabels(procName)...).Set(float64(local))
+				c.memory.numaRemotePages.WithLabelValues(c.processLabels(procName)...).Set(float64(remote))
+			}
+		}
+		limits, limitsErr := getProcessLimits(c.procRoot, procPID[procName])
+		if limitsErr != nil {
+			logger.Debugf("Unable to read the limits: %s", limitsErr)
+		} else {
+			if l, ok := limits[limitOpenFiles]; ok {
+				c.fds.openFDsSoftLimit.WithLabelValues(c.processLabels(procName)...).Set(l.soft)
+				c.fds.openFDsHardLimit.WithLabelValues(c.processLabels(procName)...).Set(l.hard)
+			}
+			if l, ok := limits[limitStackSize]; ok {
+				if stats.Has("VmStk") {
+					c.memory.stackUtilization.WithLabelValues(c.processLabels(procName)...).Set(stackUtilization(logger, kbToBytes(stats.VmStk), l))
+				}
+			}
+		}
+		if stats.Has("VmRSS") {
+			c.updateMemoryThresholds(procName, kbToBytes(stats.VmRSS))
+		}
+		if stats.Has("VmRSS") && memErr == nil {
+			c.updateResourcePressure(files, procName, procPID[procName], kbToBytes(stats.VmRSS), availableMem, now)
+		}
+		if fields, age, err := c.statusFields(files, procName, procPID[procName], now); err != nil {
+			logger.Debugf("Unable to read the security state: %s", err)
+		} else {
+			if age > cacheAge {
+				cacheAge = age
+			}
+			c.security.securityScore.WithLabelValues(c.processLabels(procName)...).Set(float64(computeSecurityScore(fields)))
+			c.security.capabilitiesEffective.WithLabelValues(c.processLabels(procName)...).Set(float64(fields.EffectiveCapabilities))
+			dangerous := 0.0
+			if hasDangerousCapability(fields.EffectiveCapabilities) {
+				dangerous = 1
+			}
+			c.security.dangerousCapability.WithLabelValues(c.processLabels(procName)...).Set(dangerous)
+			setuid := 0.0
+			if setuidActive(fields) {
+				setuid = 1
+			}
+			c.security.setuidActive.WithLabelValues(c.processLabels(procName)...).Set(setuid)
+		}
+		if length, err := getProcessCmdlineLength(files, procPID[procName]); err != nil {
+			logger.Debugf("Unable to read the command line: %s", err)
+		} else {
+			c.cmdline.length.WithLabelValues(c.processLabels(procName)...).Set(float64(length))
+			if cmdlineErr == nil {
+				truncated := 0.0
+				if cmdlineTruncated(length, cmdlineLimit) {
+					truncated = 1
+				}
+				c.cmdline.truncated.WithLabelValues(c.processLabels(procName)...).Set(truncated)
+			}
+		}
+		if args, ok := c.requiredArgs[procName]; ok {
+			c.updateRequiredArgs(files, procName, procPID[procName], args)
+		}
+		if schedstat, err := getProcessSchedstat(c.procRoot, procPID[procName]); err != nil {
+			logger.Debugf("Unable to read the scheduler statistics: %s", err)
+		} else {
+			c.cpu.runqueueWait.WithLabelValues(c.processLabels(procName)...).Set(nanosecondsToSeconds(schedstat.WaitNanoseconds))
+		}
+		c.updateCgroupThrottling(files, procName, procPID[procName])
+		c.updateCgroupCPUQuota(files, procName, procPID[procName], now)
+		if kills, err := getCgroupOOMKills(files, c.sysRoot, procPID[procName]); err != nil {
+			logger.Debugf("Unable to read the cgroup OOM kills: %s", err)
+		} else {
+			c.cgroup.oomKills.WithLabelValues(c.processLabels(procName)...).Set(float64(kills))
+		}
+		if usage, limit, unlimited, err := getProcessCgroupMemory(files, c.sysRoot, procPID[procName]); err != nil {
+			logger.Debugf("Unable to read the cgroup memory: %s", err)
+		} else {
+			c.cgroup.memoryUsage.WithLabelValues(c.processLabels(procName)...).Set(float64(usage))
+			if unlimited {
+				c.cgroup.memoryLimit.DeleteLabelValues(c.processLabels(procName)...)
+			} else {
+				c.cgroup.memoryLimit.WithLabelValues(c.processLabels(procName)...).Set(float64(limit))
+			}
+		}
+		if pids, err := getProcessCgroupPids(files, c.sysRoot, procPID[procName]); err != nil {
+			logger.Debugf("Unable to read the cgroup pids: %s", err)
+		} else {
+			c.cgroup.pids.WithLabelValues(c.processLabels(procName)...).Set(float64(pids))
+		}
+		if *cgroupKernelMemory {
+			if kmem, err := getProcessCgroupKernelMemory(files, c.sysRoot, procPID[procName]); err != nil {
+				logger.Debugf("Unable to read the cgroup kernel memory: %s", err)
+			} else {
+				c.cgroup.kernelMemoryBytes.WithLabelValues(c.processLabels(procName)...).Set(float64(kmem))
+			}
+		}
+		if fds, err := files.processFDs(procPID[procName]); err != nil {
+			logger.Debugf("Unable to read the file descriptors: %s", err)
+		} else {
+			c.updateFDs(procName, fds, mqueuesMax)
+			if l, ok := limits[limitOpenFiles]; ok {
+				c.fds.fdRatio.WithLabelValues(c.processLabels(procName)...).Set(fdRatio(len(fds), l))
+			}
+			c.updateFDChanges(procName, procPID[procName], len(fds), now)
+		}
+		if c.socketsEnabled {
+			if states, err := getSocketsByState(files, procPID[procName], c.ssPath); err != nil {
+				logger.Debugf("Unable to count the TCP sockets: %s", err)
+			} else {
+				for _, state := range tcpStates {
+					c.sockets.connectionsByState.WithLabelValues(c.processLabels(procName, state)...).Set(float64(states[state]))
+				}
+			}
+			if counts, err := getProcessSocketsByProtocol(files, procPID[procName]); err != nil {
+				logger.Debugf("Unable to count the sockets: %s", err)
+			} else {
+				for protocol, count := range counts {
+					c.sockets.byProtocol.WithLabelValues(c.processLabels(procName, protocol)...).Set(float64(count))
+				}
+			}
+			if queue, err := getProcessMaxRxQueue(files, procPID[procName]); err != nil {
+				logger.Debugf("Unable to read the TCP socket queues: %s", err)
+			} else {
+				c.sockets.socketRxQueue.WithLabelValues(c.processLabels(procName)...).Set(float64(queue))
+			}
+		}
+		c.updateListeningPorts(files, procName, procPID[procName])
+		if counters, err := getProcessIO(c.procRoot, procPID[procName]); err != nil {
+			if os.IsPermission(err) {
+				ioPermissionOnce.Do(func() {
+					logger.Warnf("Unable to read the I/O, the exporter lacks privileges to read /proc/$PID/io of other users: %s", err)
+				})
+			}
+			logger.Debugf("Unable to read the I/O: %s", err)
+		} else {
+			c.updateIO(procName, procPID[procName], counters, now)
+		}
+		if stale, err := getProcessBinaryStale(c.procRoot, procPID[procName]); err != nil {
+			logger.Debugf("Unable to determine whether the executable is stale: %s", err)
+		} else {
+			v := 0.0
+			if stale {
+				v = 1
+			}
+			c.security.binaryStale.WithLabelValues(c.processLabels(procName)...).Set(v)
+		}
+		var exeHash string
+		if *executableHash {
+			hash, changed, err := c.binaryHash(procName, procPID[procName])
+			if err != nil {
+				logger.Debugf("Unable to hash the executable: %s", err)
+				c.security.binaryHashChanged.DeleteLabelValues(c.processLabels(procName)...)
+			} else {
+				exeHash = hash
+				v := 0.0
+				if changed {
+					v = 1
+				}
+				c.security.binaryHashChanged.WithLabelValues(c.processLabels(procName)...).Set(v)
+			}
+		}
+		if c.cpuAffinityCores > 0 {
+			c.updateCPUAffinity(procName, affinities[procName])
+		}
+		stat, statErr := files.stat(procPID[procName])
+		if statErr != nil {
+			logger.Debugf("Unable to read the stat: %s", statErr)
+		} else {
+			if bootErr == nil {
+				startTime := stat.startTimeSeconds(bootTime)
+				c.lifecycle.startTimeSeconds.WithLabelValues(c.processLabels(procName)...).Set(startTime)
+				c.lifecycle.uptimeSeconds.WithLabelValues(c.processLabels(procName)...).Set(processUptime(startTime, now))
+			}
+			c.updateIdle(procName, procPID[procName], stat.UTime+stat.STime, now)
+			c.updateRestarts(procName, procPID[procName], stat.StartTime)
+			for _, mode := range []struct {
+				name  string
+				key   string
+				ticks uint64
+			}{
+				{"user", "utime", stat.UTime},
+				{"system", "stime", stat.STime},
+			} {
+				cpu := counter(mode.key, float64(mode.ticks)/userHZ)
+				c.cpu.cpuSeconds.WithLabelValues(c.processLabels(procName, mode.name)...).Set(cpu)
+			}
+		}
+		wchan, err := getProcessWchan(c.procRoot, procPID[procName])
+		if err != nil {
+			logger.Debugf("Unable to read the wait channel: %s", err)
+		} else if statErr == nil {
+			blocked := 0.0
+			if kernelBlocked(stat.State, wchan) {
+				blocked = 1
+			}
+			c.cpu.kernelBlocked.WithLabelValues(c.processLabels(procName)...).Set(blocked)
+		}
+		ch <- c.infoMetric(files, procName, procPID[procName], exeHash, affinities[procName], wchan)
+		if src, ok := c.versions[procName]; ok {
+			if version, err := src.version(c.procRoot, procPID[procName]); err != nil {
+				logger.Debugf("Unable to determine the version: %s", err)
+			} else {
+				ch <- prometheus.MustNewConstMetric(c.versionInfo, prometheus.GaugeValue, 1, procName, version)
+			}
+		}
+	}
+	for _, g := range c.metricGroups() {
+		g.Collect(ch)
+	}
+
+	if len(c.matchers) > 0 || *inotifyInstances {
+		pids, lerr := listPIDs(c.procRoot)
+		if lerr != nil {
+			log.Errorf("Unable to list the processes: %s", lerr)
+		}
+		for _, m := range c.matchers {
+			if names == nil || names[m.name] {
+				procPIDs[m.name] = m.collect(c.procRoot, pids, ch)
+			}
+		}
+		if *inotifyInstances && lerr == nil {
+			ch <- prometheus.MustNewConstMetric(c.inotifyInstances, prometheus.GaugeValue, float64(countInotifyInstances(c.procRoot, pids)))
+		}
+	}
+	for _, s := range c.supervisors {
+		if names == nil || names[s.name] {
+			procPIDs[s.name] = s.collect(c.procRoot, ch)
+		}
+	}
+	for _, g := range c.pidFileGlobs {
+		if names == nil || names[g.name] {
+			procPIDs[g.name] = g.collect(c.procRoot, ch)
+		}
+	}
+	c.collectInotifyLimits(ch)
+	for procName, pids := range procPIDs {
+		if age, ok := oldestProcessAge(files, pids, now); ok {
+			ch <- prometheus.MustNewConstMetric(c.oldestAge, prometheus.GaugeValue, age, procName)
+		}
+	}
+
+	// Processes within their startup grace period that haven't been found
+	// yet are neither resolved nor unresolved. With nothing to resolve,
+	// everything is resolved.
+	expected := 0
+	for _, procName := range c.registeredProcesses(names) {
+		_, found := processStats[procName]
+		if c.startupGraces.unknown(procName, found, now) {
+			ch <- prometheus.MustNewConstMetric(c.startupGraceActive, prometheus.GaugeValue, 1, procName)
+			continue
+		}
+		up := 0.0
+		if found {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, up, procName)
+		expected++
+	}
+	ratio := 1.0
+	if expected > 0 {
+		ratio = float64(len(processStats)) / float64(expected)
+	}
+	ch <- prometheus.MustNewConstMetric(c.resolutionRatio, prometheus.GaugeValue, ratio)
+	ch <- prometheus.MustNewConstMetric(c.cacheAge, prometheus.GaugeValue, cacheAge.Seconds())
+	return err
+}
+
+// processLogger returns a logger with the name and, if known, the PID of a
+// process as fields, so that they are separate keys with --log.format JSON
+// output.
+func processLogger(procName string, pid int) log.Logger {
+	l := log.With("name", procName)
+	if pid != 0 {
+		l = l.With("pid", pid)
+	}
+	return l
+}
+
+// infoMetric returns the info metric of the process. exeHash is empty if
+// hashing is disabled or failed, affinity is the Cpus_allowed mask and wchan
+// the kernel function the process sleeps in.
+func (c *procstatsCollector) infoMetric(files *processFiles, procName string, pid int, exeHash, affinity, wchan string) prometheus.Metric {
+	cgroup, err := getProcessPrimaryCgroup(files, pid)
+	if err != nil {
+		processLogger(procName, pid).Debugf("Unable to determine the cgroup: %s", err)
+	}
+	runtime, containerID := detectContainerRuntime(cgroup)
+	cgroup = truncateLabelValue(cgroup, maxCgroupLabelLength)
+	return prometheus.MustNewConstMetric(c.info, prometheus.GaugeValue, 1, procName, cgroup, exeHash, affinity, wchan, runtime, containerID)
+}
+
+// detectHWMReset returns 1 if the peak resident memory of the named process
+// is lower than at the previous scrape, 0 otherwise. VmHWM only decreases
+// when the process restarts.
+func (c *procstatsCollector) detectHWMReset(procName string, hwm int) float64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	last, ok := c.lastHWM[procName]
+	c.lastHWM[procName] = hwm
+	if ok && hwm < last {
+		return 1
+	}
+	return 0
+}
+
+// collectInotifyLimits sends the system wide inotify limits to ch.
+func (c *procstatsCollector) collectInotifyLimits(ch chan<- prometheus.Metric) {
+	for name, desc := range map[string]*prometheus.Desc{
+		"max_user_watches":   c.inotifyMaxUserWatches,
+		"max_user_instances": c.inotifyMaxUserInstances,
+	} {
+		limit, err := getInotifyLimit(c.procRoot, name)
+		if err != nil {
+			log.Debugf("Unable to read the inotify limit %s: %s", name, err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(limit))
+	}
+}
+
+// updateFDChanges sets the change of the number of open file descriptors of
+// the process since the previous scrape and its smoothed growth rate.
+// Nothing is set at the first scrape and after a restart.
+func (c *procstatsCollector) updateFDChanges(procName string, pid, count int, now time.Time) {
+	c.mtx.Lock()
+	last, ok := c.previousFDs[procName]
+	sample := nextFDSample(last, ok, pid, count, now, *fdRateAlpha)
+	c.previousFDs[procName] = sample
+	c.mtx.Unlock()
+
+	if sample.hasDelta {
+		c.fds.openFDsDelta.WithLabelValues(c.processLabels(procName)...).Set(float64(sample.delta))
+	} else {
+		c.fds.openFDsDelta.DeleteLabelValues(c.processLabels(procName)...)
+	}
+	if !sample.hasRate {
+		c.fds.fdGrowthRate.DeleteLabelValues(c.processLabels(procName)...)
+		return
+	}
+	c.fds.fdGrowthRate.WithLabelValues(c.processLabels(procName)...).Set(sample.rate)
+}
+
+// updateIO sets the I/O counters of the process and the smoothed rates of
+// its storage I/O.
+func (c *procstatsCollector) updateIO(procName string, pid int, counters map[string]uint64, now time.Time) {
+	for _, d := range ioDirections {
+		if v, ok := counters[d.bytes]; ok {
+			c.io.bytes.WithLabelValues(c.processLabels(procName, d.direction)...).Set(float64(v))
+		}
+		if v, ok := counters[d.chars]; ok {
+			c.io.chars.WithLabelValues(c.processLabels(procName, d.direction)...).Set(float64(v))
+		}
+		if v, ok := counters[d.syscalls]; ok {
+			c.io.syscalls.WithLabelValues(c.processLabels(procName, d.direction)...).Set(float64(v))
+		}
+	}
+	if v, ok := counters["cancelled_write_bytes"]; ok {
+		c.io.cancelledWriteBytes.WithLabelValues(c.processLabels(procName)...).Set(float64(v))
+	}
+	if read, write, err := ioBytes(counters); err != nil {
+		processLogger(procName, pid).Debugf("Unable to read the storage I/O: %s", err)
+	} else {
+		c.updateIORates(procName, pid, read, write, now)
+	}
+}
+
+// updateIORates sets the smoothed rates of the bytes the process read from
+// and wrote to storage since the previous scrape. Nothing is set at the
+// first scrape and after a restart.
+func (c *procstatsCollector) updateIORates(procName string, pid int, readBytes, writeBytes uint64, now time.Time) {
+	c.mtx.Lock()
+	last, ok := c.previousIO[procName]
+	sample := nextIOSample(last, ok, pid, readBytes, writeBytes, now, *ioRateAlpha)
+	c.previousIO[procName] = sample
+	c.mtx.Unlock()
+
+	if !sample.hasRate {
+		c.io.readRate.DeleteLabelValues(c.processLabels(procName)...)
+		c.io.writeRate.DeleteLabelValues(c.processLabels(procName)...)
+		return
+	}
+	c.io.readRate.WithLabelValues(c.processLabels(procName)...).Set(sample.readRate)
+	c.io.writeRate.WithLabelValues(c.processLabels(procName)...).Set(sample.writeRate)
+}
+
+// updateSwapRate sets the rate of change of the swapped out memory of the
+// process since the previous scrape. Nothing is set at the first scrape and
+// after a restart.
+func (c *procstatsCollector) updateSwapRate(procName string, pid int, swapBytes float64, now time.Time) {
+	sample := swapSample{time: now, pid: pid, bytes: swapBytes}
+	c.mtx.Lock()
+	last, ok := c.previousSwap[procName]
+	c.previousSwap[procName] = sample
+	c.mtx.Unlock()
+
+	rate, ok := swapRate(last, ok, sample)
+	if !ok {
+		c.memory.swapRate.DeleteLabelValues(c.processLabels(procName)...)
+		return
+	}
+	c.memory.swapRate.WithLabelValues(c.processLabels(procName)...).Set(rate)
+}
+
+// updateMemoryThresholds sets the threshold breaches of the resident memory
+// of the process. The counter only increases when a breach starts.
+func (c *procstatsCollector) updateMemoryThresholds(procName string, rssBytes float64) {
+	for direction, breach := range c.memoryThresholds.update(procName, rssBytes) {
+		active := 0.0
+		if breach.active {
+			active = 1
+		}
+		c.memory.thresholdBreached.WithLabelValues(c.processLabels(procName, "rss", direction)...).Set(active)
+		// Initialized with 0, so that the first breach shows in rate().
+		breaches := c.memory.thresholdBreaches.WithLabelValues(c.processLabels(procName, "rss", direction)...)
+		if breach.new {
+			breaches.Inc()
+		}
+	}
+}
+
+// updateIdle sets the time since the CPU time of the process, in clock
+// ticks, last changed.
+func (c *procstatsCollector) updateIdle(procName string, pid int, ticks uint64, now time.Time) {
+	c.mtx.Lock()
+	last, ok := c.previousCPU[procName]
+	activity, idle := nextCPUActivity(last, ok, pid, ticks, now)
+	c.previousCPU[procName] = activity
+	c.mtx.Unlock()
+
+	c.cpu.idleSeconds.WithLabelValues(c.processLabels(procName)...).Set(idle)
+}
+
+// updateRestarts sets the number of restarts of the process observed since
+// the exporter started.
+func (c *procstatsCollector) updateRestarts(procName string, pid int, startTime uint64) {
+	c.mtx.Lock()
+	last, ok := c.instances[procName]
+	instance := nextProcessInstance(last, ok, pid, startTime)
+	c.instances[procName] = instance
+	c.mtx.Unlock()
+
+	c.lifecycle.restarts.WithLabelValues(c.processLabels(procName)...).Set(float64(instance.restarts))
+}
+
+// updateFDs sets the metrics derived from the open file descriptors of the
+// process. mqueuesMax is the system wide limit of POSIX message queues, 0 if
+// unknown.
+func (c *procstatsCollector) updateFDs(procName string, fds []processFD, mqueuesMax int) {
+	classes := classifyFDTargets(fds)
+	c.fds.openFDs.WithLabelValues(c.processLabels(procName)...).Set(float64(classes.total))
+	c.fds.openDeviceFDs.WithLabelValues(c.processLabels(procName)...).Set(float64(classes.devices))
+	c.fds.memfdCount.WithLabelValues(c.processLabels(procName)...).Set(float64(classes.memfds))
+	c.fds.pipeFDs.WithLabelValues(c.processLabels(procName)...).Set(float64(classes.pipes))
+	c.fds.mqueueFDs.WithLabelValues(c.processLabels(procName)...).Set(float64(classes.mqueues))
+	if mqueuesMax > 0 {
+		c.fds.mqueueUtilization.WithLabelValues(c.processLabels(procName)...).Set(float64(classes.mqueues) / float64(mqueuesMax))
+	}
+	c.fds.epollFDs.WithLabelValues(c.processLabels(procName)...).Set(float64(classes.epoll))
+	c.fds.inotifyFDs.WithLabelValues(c.processLabels(procName)...).Set(float64(classes.inotify))
+	if size, err := memfdBytes(fds); err != nil {
+		processLogger(procName, 0).Debugf("Unable to determine the size of the memfds: %s", err)
+		c.fds.memfdBytes.DeleteLabelValues(c.processLabels(procName)...)
+	} else {
+		c.fds.memfdBytes.WithLabelValues(c.processLabels(procName)...).Set(float64(size))
+	}
+}
+
+// updateListeningPorts sets the number of listening TCP ports of the process
+// if sockets are enabled and whether it listens on its expected port. The
+// ports of a process with an expected port are always read.
+func (c *procstatsCollector) updateListeningPorts(files *processFiles, procName string, pid int) {
+	expected, hasExpected := c.expectedPorts[procName]
+	if !c.socketsEnabled && !hasExpected {
+		return
+	}
+	ports, err := getProcessListeningPorts(files, pid)
+	if err != nil {
+		processLogger(procName, pid).Debugf("Unable to read the listening ports: %s", err)
+		c.sockets.listeningPorts.DeleteLabelValues(c.processLabels(procName)...)
+		if hasExpected {
+			c.sockets.expectedPortListening.DeleteLabelValues(c.processLabels(procName, strconv.Itoa(expected))...)
+		}
+		return
+	}
+	if c.socketsEnabled {
+		c.sockets.listeningPorts.WithLabelValues(c.processLabels(procName)...).Set(float64(len(ports)))
+	}
+	if !hasExpected {
+		return
+	}
+	v := 0.0
+	if i := sort.SearchInts(ports, expected); i < len(ports) && ports[i] == expected {
+		v = 1
+	}
+	c.sockets.expectedPortListening.WithLabelValues(c.processLabels(procName, strconv.Itoa(expected))...).Set(v)
+}
+
+// updateRequiredArgs sets whether the command line of the process contains
+// each of its required args and all of them.
+func (c *procstatsCollector) updateRequiredArgs(files *processFiles, procName string, pid int, args []string) {
+	cmdline, err := files.read(pid, "cmdline")
+	if err != nil {
+		processLogger(procName, pid).Debugf("Unable to read the command line: %s", err)
+		return
+	}
+	all := 1.0
+	for i, present := range requiredArgsPresent(formatCmdline(cmdline), args) {
+		v := 0.0
+		if present {
+			v = 1
+		} else {
+			all = 0
+		}
+		c.cmdline.requiredArgPresent.WithLabelValues(c.processLabels(procName, args[i])...).Set(v)
+	}
+	c.cmdline.allRequiredArgsPresent.WithLabelValues(c.processLabels(procName)...).Set(all)
+}
+
+// updateCPUAffinity sets the per-CPU affinity of the process for the first
+// --collector.procstats.cpu-affinity-cores CPUs.
+func (c *procstatsCollector) updateCPUAffinity(procName, mask string) {
+	allowed, err := parseCPUMask(mask)
+	if err != nil {
+		processLogger(procName, 0).Debugf("Unable to parse the CPU affinity: %s", err)
+		return
+	}
+	for cpu := 0; cpu < len(allowed) && cpu < c.cpuAffinityCores; cpu++ {
+		v := 0.0
+		if allowed[cpu] {
+			v = 1
+		}
+		c.cpu.cpuAffinity.WithLabelValues(c.processLabels(procName, strconv.Itoa(cpu))...).Set(v)
+	}
+}
+
+// updateCgroupThrottling sets the CPU throttling metrics of the process from
+// its cgroup v1 cpu or cgroup v2 cgroup. It does nothing for processes
+// outside of both.
+func (c *procstatsCollector) updateCgroupThrottling(files *processFiles, procName string, pid int) {
+	throttledSeconds, nrThrottled, err := getProcessCgroupCPUThrottling(files, c.sysRoot, pid)
+	if err != nil {
+		processLogger(procName, pid).Debugf("Unable to read the CPU throttling: %s", err)
+		return
+	}
+	c.cgroup.throttledSeconds.WithLabelValues(c.processLabels(procName)...).Set(throttledSeconds)
+	c.cgroup.throttledPeriods.WithLabelValues(c.processLabels(procName)...).Set(float64(nrThrottled))
+}
+
+// updateCgroupCPUQuota sets the CPU usage of the cgroup v2 cgroup of the
+// process relative to its quota. Nothing is set at the first scrape and for
+// cgroups without a limit.
+func (c *procstatsCollector) updateCgroupCPUQuota(files *processFiles, procName string, pid int, now time.Time) {
+	logger := processLogger(procName, pid)
+	cgroupPath, err := getProcessCgroupV2Path(files, pid)
+	if err != nil {
+		logger.Debugf("Unable to determine the cgroup: %s", err)
+		return
+	}
+	stats, err := parseCgroupStatFile(cgroupV2FilePath(c.sysRoot, cgroupPath, "cpu.stat"))
+	if err != nil {
+		logger.Debugf("Unable to read the CPU usage of the cgroup: %s", err)
+		return
+	}
+	usage, ok := stats["usage_usec"]
+	if !ok {
+		logger.Debugf("Missing usage_usec in the cpu.stat of the cgroup")
+		return
+	}
+	sample := cgroupCPUSample{time: now, cgroupPath: cgroupPath, usageUsec: usage}
+	c.mtx.Lock()
+	last, ok := c.previousCgroupCPU[procName]
+	c.previousCgroupCPU[procName] = sample
+	c.mtx.Unlock()
+
+	quota, period, unlimited, err := getCgroupCPUMax(c.sysRoot, cgroupPath)
+	if err != nil {
+		logger.Debugf("Unable to read the CPU quota of the cgroup: %s", err)
+		return
+	}
+	utilization, ok := cgroupCPUQuotaUtilization(last, ok, sample, quota, period)
+	if unlimited || !ok {
+		c.cgroup.cpuQuotaUsage.DeleteLabelValues(c.processLabels(procName)...)
+		return
+	}
+	c.cgroup.cpuQuotaUsage.WithLabelValues(c.processLabels(procName)...).Set(utilization)
+}
+
+// getProcessPIDFileStaleness returns the time in seconds since the PID file
+// was last modified. If the PID file was modified before the process pid
+// started, it is a leftover of a previous run and +Inf is returned.
+func getProcessPIDFileStaleness(files *processFiles, pidFilePath string, pid int) (float64, error) {
+	fi, err := os.Stat(pidFilePath)
+	if err != nil {
+		return 0, err
+	}
+	startTime, err := processStartTime(files, pid)
+	if err != nil {
+		return 0, err
+	}
+	mtime := fi.ModTime()
+	if float64(mtime.UnixNano())/1e9 < startTime {
+		return math.Inf(1), nil
+	}
+	return time.Since(mtime).Seconds(), nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// pidFilePath returns the path of the PID file of the named process.
+func (c *procstatsCollector) pidFilePath(procName string) string {
+	if path, ok := c.pidFiles[procName]; ok {
+		return path
+	}
+	return filepath.Join(c.pidDir, procName+".pid")
+}
+
+// checkProcfs returns an error if procfs is missing or not mounted, i.e.
+// /proc/stat can't be accessed.
+func checkProcfs(procRoot string) error {
+	_, err := os.Stat(filepath.Join(procRoot, "stat"))
+	return err
+}
+
+// processFilePath returns the path of file name in the procfs directory of
+// the given process.
+func processFilePath(procRoot string, pid int, name string) string {
+	return filepath.Join(procRoot, strconv.Itoa(pid), name)
+}
+
+// startTime returns the start time of the process if continuous counters
+// are enabled. The second return value is false if counters of the process
+// should be exported as is.
+func (c *procstatsCollector) startTime(files *processFiles, procName string, pid int) (uint64, bool) {
+	if c.continuousCounters == nil {
+		return 0, false
+	}
+	stat, err := files.stat(pid)
+	if err != nil {
+		processLogger(procName, pid).Debugf("Unable to read the start time: %s", err)
+		return 0, false
+	}
+	return stat.StartTime, true
+}
+
+// metricLabelNames are the labels metric vectors add to the labels of a
+// process, which the env and static labels must not clash with.
+var metricLabelNames = []string{"mode", "direction", "state", "protocol", "port", "cpu", "metric", "arg", "scope", "type"}
+
+// labelValues returns the values for all process labels of procName, in the
+// order of the label names passed to the metric vectors. The env labels are
+// empty without a PID.
+func (c *procstatsCollector) labelValues(procName string, pid int) []string {
+	values := []string{procName}
+	for _, l := range c.envLabels {
+		var value string
+		if pid > 0 {
+			var err error
+			if value, err = getProcessEnvVar(c.procRoot, pid, l.varName); err != nil {
+				processLogger(procName, pid).Debugf("Unable to read %s from the environment: %s", l.varName, err)
+			}
+		}
+		values = append(values, value)
+	}
+	for _, name := range c.staticLabelNames {
+		values = append(values, c.staticLabels[procName][name])
+	}
+	return values
+}
+
+// setProcessLabels reads the label values of the processes with the PIDs of
+// procPID for this scrape. The series of a process whose label values
+// changed, e.g. as it restarted with another environment, are deleted.
+func (c *procstatsCollector) setProcessLabels(procPID map[string]int) {
+	values := make(map[string][]string, len(procPID))
+	var changed []string
+	c.labelsMtx.Lock()
+	for procName, pid := range procPID {
+		values[procName] = c.labelValues(procName, pid)
+		if previous, ok := c.seriesLabels[procName]; ok && !reflect.DeepEqual(previous, values[procName]) {
+			changed = append(changed, procName)
+		}
+	}
+	c.labelsMtx.Unlock()
+
+	c.deleteProcessSeries(changed...)
+	c.labelsMtx.Lock()
+	defer c.labelsMtx.Unlock()
+	for procName, v := range values {
+		c.seriesLabels[procName] = v
+	}
+}
+
+// processLabels returns the values of the process labels of the series of
+// procName followed by extra, the values of the labels the metric vector
+// adds. The env labels of a process that isn't running are empty.
+func (c *procstatsCollector) processLabels(procName string, extra ...string) []string {
+	c.labelsMtx.Lock()
+	values, ok := c.seriesLabels[procName]
+	c.labelsMtx.Unlock()
+	if !ok {
+		values = c.labelValues(procName, 0)
+	}
+	return append(append([]string{}, values...), extra...)
+}
+
+// parseEnvLabels parses a comma-separated list of LABEL_NAME=ENV_VAR pairs.
+func parseEnvLabels(s string) ([]envLabel, error) {
+	var labels []envLabel
+	if s == "" {
+		return labels, nil
+	}
+	seen := map[string]bool{"name": true}
+	for _, name := range metricLabelNames {
+		seen[name] = true
+	}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid env label %q, expected LABEL_NAME=ENV_VAR", pair)
+		}
+		if !model.LabelName(parts[0]).IsValid() {
+			return nil, fmt.Errorf("invalid label name %q in env label %q", parts[0], pair)
+		}
+		if seen[parts[0]] {
+			return nil, fmt.Errorf("duplicate label name %q in env labels", parts[0])
+		}
+		seen[parts[0]] = true
+		labels = append(labels, envLabel{labelName: parts[0], varName: parts[1]})
+	}
+	return labels, nil
+}
+
+// getProcessEnvVar returns the value of the environment variable varName of
+// the process pid, truncated to maxEnvLabelValueLength bytes. An empty string
+// is returned if the variable isn't set.
+func getProcessEnvVar(procRoot string, pid int, varName string) (string, error) {
+	environ, err := ioutil.ReadFile(processFilePath(procRoot, pid, "environ"))
+	if err != nil {
+		return "", err
+	}
+	prefix := varName + "="
+	for _, entry := range strings.Split(string(environ), "\x00") {
+		if !strings.HasPrefix(entry, prefix) {
+			continue
+		}
+		return truncateLabelValue(entry[len(prefix):], maxEnvLabelValueLength), nil
+	}
+	return "", nil
+}
+
+// truncateLabelValue returns value truncated to at most n bytes without
+// splitting a UTF-8 encoded character, which would make an invalid label
+// value.
+func truncateLabelValue(value string, n int) string {
+	if len(value) <= n {
+		return value
+	}
+	for n > 0 && !utf8.RuneStart(value[n]) {
+		n--
+	}
+	return value[:n]
+}
+
+// getProcessStats returns the stats and CPU affinities of the processes by
+// name. Processes whose status can't be read, e.g. because the PID file is
+// stale, are left out and reported as down.
+func getProcessStats(files *processFiles, procPID map[string]int) (map[string]ProcessStats, map[string]string, error) {
+	procStats := make(map[string]ProcessStats, 0)
+	affinities := make(map[string]string, 0)
+	for procName, pid := range procPID {
+		filename := processFilePath(files.procRoot, pid, "status")
+		procFile, err := files.open(pid, "status")
+		if err != nil {
+			processLogger(procName, pid).With("path", filename).Errorf("Unable to open the file: %s", err)
+			continue
+		}
+		stats, affinity, err := parseProcessStatus(procFile, pid)
+		if err != nil {
+			processLogger(procName, pid).With("path", filename).Errorf("Unable to parse the process statistics: %s", err)
+			continue
+		}
+		procStats[procName], affinities[procName] = stats, affinity
+	}
+	return procStats, affinities, nil
+}
+
+func parseProcessStats(r io.Reader, pid int) (ProcessStats, error) {
+	stats, _, err := parseProcessStatus(r, pid)
+	return stats, err
+}
+
+// parseProcessStatus returns the stats of /proc/$PID/status and its
+// Cpus_allowed mask, e.g. "ff" or "ffffffff,ffffffff".
+func parseProcessStatus(r io.Reader, pid int) (ProcessStats, string, error) {
+	//Refer: http://manpages.ubuntu.com/manpages/wily/man5/proc.5.html
+	fields, err := parseStatusFile(r)
+	if err != nil {
+		return ProcessStats{}, "", err
+	}
+	stats := ProcessStats{PID: pid, present: map[string]bool{}}
+	for name, value := range fields {
+		var convert func(string) (int, error)
+		field, ok := memoryStats[name]
+		if ok {
+			convert = func(v string) (int, error) { return parseMemoryKilobytes(name, v) }
+		} else if field, ok = ctxtSwitchStats[name]; ok {
+			convert = strconv.Atoi
+		} else if field, ok = signalMaskStats[name]; ok {
+			convert = countBits
+		} else {
+			continue
+		}
+		v, err := convert(value)
+		if err != nil {
+			log.Errorf("Unable to parse the %s for pid: %d", name, pid)
+			continue
+		}
+		*field(&stats) = v
+		stats.present[name] = true
+	}
+	if value, ok := fields["State"]; ok {
+		if code, err := parseStatusState(value); err != nil {
+			log.Errorf("Unable to parse the State for pid: %d", pid)
+		} else {
+			stats.State = code
+			stats.present["State"] = true
+		}
+	}
+	return stats, fields["Cpus_allowed"], nil
+}
+
+// kbToBytes converts a memory field of /proc/$PID/status to bytes.
+func kbToBytes(kb int) float64 {
+	return float64(kb) * 1024
+}
+
+// vmPeakToRSSRatio returns VmPeak relative to VmRSS of stats. A process far
+// below its peak allocated and freed lots of memory, which may be allocator
+// fragmentation. There is no ratio without both or without resident memory.
+func vmPeakToRSSRatio(stats ProcessStats) (float64, bool) {
+	if !stats.Has("VmPeak") || !stats.Has("VmRSS") || stats.VmRSS == 0 {
+		return 0, false
+	}
+	return float64(stats.VmPeak) / float64(stats.VmRSS), true
+}
+
+// countBits returns the number of bits set in a hexadecimal bitmask like the
+// signal masks of /proc/$PID/status.
+func countBits(hexStr string) (int, error) {
+	mask, err := strconv.ParseUint(hexStr, 16, 64)
+	if err != nil {
+		return 0, err
+	}
+	return bits.OnesCount64(mask), nil
+}
+
+// memoryUnitKilobytes maps the unit suffixes of memory fields to their size
+// in kilobytes. Linux always writes kB, the others turn up in status files
+// synthesized by container runtimes.
+var memoryUnitKilobytes = map[string]float64{
+	"B":  1.0 / 1024,
+	"kB": 1,
+	"KB": 1,
+	"k":  1,
+	"mB": 1024,
+	"MB": 1024,
+	"gB": 1024 * 1024,
+	"GB": 1024 * 1024,
+}
+
+var unitlessMemoryOnce sync.Once
+
+// parseMemoryKilobytes parses the value of a memory field of
+// /proc/$PID/status into kilobytes. Values without a unit are taken to be in
+// kB as documented in proc(5).
+func parseMemoryKilobytes(field, data string) (int, error) {
+	parts := strings.Fields(data)
+	switch len(parts) {
+	case 1:
+		unitlessMemoryOnce.Do(func() {
+			log.Warnf("Memory field %s has no unit, assuming kB", field)
+		})
+		return strconv.Atoi(parts[0])
+	case 2:
+		size, ok := memoryUnitKilobytes[parts[1]]
+		if !ok {
+			return 0, fmt.Errorf("unknown unit %q of %s", parts[1], field)
+		}
+		value, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return 0, err
 		}
+		return int(value * size), nil
+	default:
+		return 0, fmt.Errorf("invalid value %q of %s", data, field)
 	}
-	return stats, nil
 }
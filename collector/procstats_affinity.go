@@ -0,0 +1,49 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var cpuAffinityCores = flag.Int("collector.procstats.cpu-affinity-cores", 0,
+	"Expose whether each process may run on each of the first N CPUs. 0 disables the per-CPU affinity, the mask is always a label of node_process_info.")
+
+// parseCPUMask parses a CPU mask like the Cpus_allowed of /proc/$PID/status,
+// comma separated groups of 32 bits with the highest CPUs first, e.g.
+// "00000000,000000ff". Element i of the result is whether CPU i is set.
+func parseCPUMask(mask string) ([]bool, error) {
+	groups := strings.Split(mask, ",")
+	cpus := make([]bool, 0, 32*len(groups))
+	for i := len(groups) - 1; i >= 0; i-- {
+		bits, err := strconv.ParseUint(groups[i], 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU mask %q: %s", mask, err)
+		}
+		// Only the last group may be shorter than 32 bits.
+		n := 32
+		if i == 0 {
+			n = 4 * len(groups[i])
+		}
+		for b := 0; b < n; b++ {
+			cpus = append(cpus, bits&(1<<uint(b)) != 0)
+		}
+	}
+	return cpus, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCPUMask(t *testing.T) {
+	for _, test := range []struct {
+		mask    string
+		allowed []int
+		cpus    int
+	}{
+		{mask: "ff", allowed: []int{0, 1, 2, 3, 4, 5, 6, 7}, cpus: 8},
+		{mask: "5", allowed: []int{0, 2}, cpus: 4},
+		{mask: "00000001,00000006", allowed: []int{1, 2, 32}, cpus: 64},
+	} {
+		cpus, err := parseCPUMask(test.mask)
+		if err != nil {
+			t.Errorf("%s: %s", test.mask, err)
+			continue
+		}
+		if len(cpus) != test.cpus {
+			t.Errorf("%s: want %d CPUs, got %d", test.mask, test.cpus, len(cpus))
+		}
+		var allowed []int
+		for cpu, ok := range cpus {
+			if ok {
+				allowed = append(allowed, cpu)
+			}
+		}
+		if !reflect.DeepEqual(allowed, test.allowed) {
+			t.Errorf("%s: want allowed CPUs %v, got %v", test.mask, test.allowed, allowed)
+		}
+	}
+
+	for _, mask := range []string{"", "xyz", "ff,"} {
+		if _, err := parseCPUMask(mask); err == nil {
+			t.Errorf("%q: want an error", mask)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"flag"
+	"fmt"
+)
+
+// Policies of --collector.procstats.pid-aggregation.
+const (
+	pidAggregationRepresentative = "representative"
+	pidAggregationSum            = "sum"
+	pidAggregationMean           = "mean"
+)
+
+// Policies of --collector.procstats.representative-pid.
+const (
+	representativeFirst  = "first"
+	representativeOldest = "oldest"
+	representativeLowest = "lowest"
+)
+
+var (
+	pidAggregation = flag.String("collector.procstats.pid-aggregation", pidAggregationRepresentative,
+		"How the additive stats of /proc/$PID/status of a process resolved to several PIDs are combined: representative, sum or mean. The other stats are always those of the representative PID.")
+	representativePID = flag.String("collector.procstats.representative-pid", representativeFirst,
+		"Which PID represents a process resolved to several PIDs: first (as resolved), oldest or lowest.")
+)
+
+// additiveStats are the stats of parseProcessStats that can be combined
+// across the PIDs of a process. The PID, the number of pending or caught
+// signals and the peak memory, whose drop reveals a restart, don't add up
+// and are taken from the representative PID.
+var additiveStats = []string{
+	"VmRSS",
+	"VmStk",
+	"VmSize",
+	"Threads",
+	"RssAnon",
+	"RssFile",
+	"RssShmem",
+	"voluntary_ctxt_switches",
+	"nonvoluntary_ctxt_switches",
+}
+
+// validatePIDAggregation returns an error for unknown policies.
+func validatePIDAggregation(aggregation, representative string) error {
+	switch aggregation {
+	case pidAggregationRepresentative, pidAggregationSum, pidAggregationMean:
+	default:
+		return fmt.Errorf("unknown PID aggregation %q", aggregation)
+	}
+	switch representative {
+	case representativeFirst, representativeOldest, representativeLowest:
+	default:
+		return fmt.Errorf("unknown representative PID %q", representative)
+	}
+	return nil
+}
+
+// selectRepresentativePID returns the PID among pids chosen by the policy.
+// Processes whose start time can't be read aren't the oldest.
+func selectRepresentativePID(files *processFiles, pids []int, policy string) int {
+	selected := pids[0]
+	switch policy {
+	case representativeLowest:
+		for _, pid := range pids[1:] {
+			if pid < selected {
+				selected = pid
+			}
+		}
+	case representativeOldest:
+		var oldest uint64
+		found := false
+		for _, pid := range pids {
+			stat, err := files.stat(pid)
+			if err != nil {
+				continue
+			}
+			if !found || stat.StartTime < oldest {
+				selected, oldest, found = pid, stat.StartTime, true
+			}
+		}
+	}
+	return selected
+}
+
+// aggregateProcessStats combines the additive stats of all pids into those
+// of the representative PID, summed or averaged over the PIDs having them.
+// PIDs that exited since they were resolved are skipped.
+func aggregateProcessStats(files *processFiles, stats ProcessStats, representative int, pids []int, policy string) ProcessStats {
+	sums := map[string]int{}
+	counts := map[string]int{}
+	for _, pid := range pids {
+		pidStats := stats
+		if pid != representative {
+			f, err := files.open(pid, "status")
+			if err != nil {
+				continue
+			}
+			pidStats, err = parseProcessStats(f, pid)
+			if err != nil {
+				continue
+			}
+		}
+		for _, name := range additiveStats {
+			if pidStats.Has(name) {
+				sums[name] += *statField(&pidStats, name)
+				counts[name]++
+			}
+		}
+	}
+
+	aggregated := stats
+	aggregated.present = make(map[string]bool, len(stats.present))
+	for name := range stats.present {
+		aggregated.present[name] = true
+	}
+	for name, sum := range sums {
+		if policy == pidAggregationMean {
+			sum /= counts[name]
+		}
+		*statField(&aggregated, name) = sum
+		aggregated.present[name] = true
+	}
+	return aggregated
+}
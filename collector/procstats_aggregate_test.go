@@ -0,0 +1,111 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// makeAggregateProcs creates the processes 10, 11 and 12 in dir, started in
+// reverse order, and returns their PIDs.
+func makeAggregateProcs(t *testing.T, dir string) []int {
+	for i, pid := range []int{10, 11, 12} {
+		status := fmt.Sprintf("Name:\tworker\nSigPnd:\t%016x\nVmRSS:\t%d kB\nvoluntary_ctxt_switches:\t%d\n", i+1, 1000*(i+1), 10*(i+1))
+		stat := fmt.Sprintf("%d (worker) S 1 %d %d 0 -1 0 0 0 0 0 1 1 0 0 20 0 1 0 %d 0 0\n", pid, pid, pid, 300-100*i)
+		if err := os.MkdirAll(filepath.Join(dir, fmt.Sprint(pid)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range map[string]string{"status": status, "stat": stat} {
+			if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprint(pid), name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return []int{11, 12, 10}
+}
+
+func TestSelectRepresentativePID(t *testing.T) {
+	dir := t.TempDir()
+	pids := makeAggregateProcs(t, dir)
+
+	for policy, want := range map[string]int{
+		representativeFirst:  11,
+		representativeLowest: 10,
+		representativeOldest: 12,
+	} {
+		if got := selectRepresentativePID(newProcessFiles(dir), pids, policy); got != want {
+			t.Errorf("%s: want PID %d, got %d", policy, want, got)
+		}
+	}
+	// Exited processes have no start time.
+	if got := selectRepresentativePID(newProcessFiles(dir), []int{99, 11}, representativeOldest); got != 11 {
+		t.Errorf("want PID 11, got %d", got)
+	}
+}
+
+func TestAggregateProcessStats(t *testing.T) {
+	dir := t.TempDir()
+	pids := append(makeAggregateProcs(t, dir), 99)
+
+	f, err := os.Open(filepath.Join(dir, "11", "status"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stats, err := parseProcessStats(f, 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	present := map[string]bool{"SigPnd": true, "VmRSS": true, "voluntary_ctxt_switches": true}
+	for policy, want := range map[string]ProcessStats{
+		pidAggregationSum: {
+			PID:                   11,
+			SignalsPending:        1,
+			VmRSS:                 6000,
+			VoluntaryCtxtSwitches: 60,
+			present:               present,
+		},
+		pidAggregationMean: {
+			PID:                   11,
+			SignalsPending:        1,
+			VmRSS:                 2000,
+			VoluntaryCtxtSwitches: 20,
+			present:               present,
+		},
+	} {
+		if got := aggregateProcessStats(newProcessFiles(dir), stats, 11, pids, policy); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: want stats %v, got %v", policy, want, got)
+		}
+	}
+	if stats.VmRSS != 2000 {
+		t.Errorf("want the stats of the representative unchanged, got %v", stats)
+	}
+}
+
+func TestValidatePIDAggregation(t *testing.T) {
+	if err := validatePIDAggregation(pidAggregationSum, representativeOldest); err != nil {
+		t.Errorf("want no error, got %s", err)
+	}
+	for _, policies := range [][2]string{{"max", representativeFirst}, {pidAggregationSum, "newest"}} {
+		if err := validatePIDAggregation(policies[0], policies[1]); err == nil {
+			t.Errorf("%v: want error, got none", policies)
+		}
+	}
+}
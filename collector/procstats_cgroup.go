@@ -0,0 +1,482 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxCgroupLabelLength caps the length of cgroup paths used as label values.
+const maxCgroupLabelLength = 128
+
+// processCgroup is an entry of /proc/$PID/cgroup.
+type processCgroup struct {
+	hierarchyID string
+	controllers []string
+	path        string
+}
+
+// getProcessCgroups returns the cgroups of the given process.
+func getProcessCgroups(files *processFiles, pid int) ([]processCgroup, error) {
+	f, err := files.open(pid, "cgroup")
+	if err != nil {
+		return nil, err
+	}
+
+	var cgroups []processCgroup
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Format: hierarchy-ID:controller-list:cgroup-path. The unified
+		// hierarchy has ID 0 and an empty controller list.
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		cgroup := processCgroup{hierarchyID: parts[0], path: parts[2]}
+		if parts[1] != "" {
+			cgroup.controllers = strings.Split(parts[1], ",")
+		}
+		cgroups = append(cgroups, cgroup)
+	}
+	return cgroups, scanner.Err()
+}
+
+// getProcessCgroupV2Path returns the path of the cgroup v2 (unified
+// hierarchy) cgroup of the given process below the cgroup mountpoint.
+func getProcessCgroupV2Path(files *processFiles, pid int) (string, error) {
+	cgroups, err := getProcessCgroups(files, pid)
+	if err != nil {
+		return "", err
+	}
+	for _, cgroup := range cgroups {
+		if cgroup.hierarchyID == "0" && len(cgroup.controllers) == 0 {
+			return cgroup.path, nil
+		}
+	}
+	return "", fmt.Errorf("process %d is not in a cgroup v2 hierarchy", pid)
+}
+
+// getProcessPrimaryCgroup returns the cgroup path best identifying the
+// container or service of the given process: the cgroup v1 memory or cpu
+// controller path, or else the cgroup v2 path.
+func getProcessPrimaryCgroup(files *processFiles, pid int) (string, error) {
+	cgroups, err := getProcessCgroups(files, pid)
+	if err != nil {
+		return "", err
+	}
+	for _, controller := range []string{"memory", "cpu"} {
+		for _, cgroup := range cgroups {
+			for _, c := range cgroup.controllers {
+				if c == controller {
+					return cgroup.path, nil
+				}
+			}
+		}
+	}
+	for _, cgroup := range cgroups {
+		if cgroup.hierarchyID == "0" && len(cgroup.controllers) == 0 {
+			return cgroup.path, nil
+		}
+	}
+	return "", fmt.Errorf("no memory, cpu or cgroup v2 cgroup found for process %d", pid)
+}
+
+// cgroupV2FilePath returns the path of file in the given cgroup v2 cgroup of
+// the sysfs at sysRoot.
+func cgroupV2FilePath(sysRoot, cgroupPath, file string) string {
+	return filepath.Join(sysRoot, "fs/cgroup", cgroupPath, file)
+}
+
+// getCgroupCPUThrottling returns the total time in microseconds and the
+// number of periods the given cgroup v2 cgroup was throttled, as reported in
+// its cpu.stat.
+func getCgroupCPUThrottling(sysRoot, cgroupPath string) (throttledUsec int64, nrThrottled int64, err error) {
+	f, err := os.Open(cgroupV2FilePath(sysRoot, cgroupPath, "cpu.stat"))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var foundUsec, foundPeriods bool
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "throttled_usec":
+			throttledUsec, err = strconv.ParseInt(fields[1], 10, 64)
+			foundUsec = true
+		case "nr_throttled":
+			nrThrottled, err = strconv.ParseInt(fields[1], 10, 64)
+			foundPeriods = true
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid %s value in %s: %s", fields[0], f.Name(), err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, 0, err
+	}
+	if !foundUsec || !foundPeriods {
+		return 0, 0, fmt.Errorf("missing throttling statistics in %s", f.Name())
+	}
+	return throttledUsec, nrThrottled, nil
+}
+
+// getCgroupCPUMax returns the CPU bandwidth limit of the given cgroup v2
+// cgroup from its cpu.max, see parseCgroupCPUMax.
+func getCgroupCPUMax(sysRoot, cgroupPath string) (quota, period float64, unlimited bool, err error) {
+	content, err := ioutil.ReadFile(cgroupV2FilePath(sysRoot, cgroupPath, "cpu.max"))
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return parseCgroupCPUMax(string(content))
+}
+
+// parseCgroupCPUMax parses the content of cpu.max, "<quota> <period>" in
+// microseconds, or "max <period>" for a cgroup without a limit.
+func parseCgroupCPUMax(content string) (quota float64, period float64, unlimited bool, err error) {
+	fields := strings.Fields(content)
+	if len(fields) != 2 {
+		return 0, 0, false, fmt.Errorf("invalid cpu.max %q", content)
+	}
+	period, err = strconv.ParseFloat(fields[1], 64)
+	if err != nil || period <= 0 {
+		return 0, 0, false, fmt.Errorf("invalid period in cpu.max %q", content)
+	}
+	if fields[0] == "max" {
+		return 0, period, true, nil
+	}
+	quota, err = strconv.ParseFloat(fields[0], 64)
+	if err != nil || quota <= 0 {
+		return 0, 0, false, fmt.Errorf("invalid quota in cpu.max %q", content)
+	}
+	return quota, period, false, nil
+}
+
+// cgroupCPUSample is the CPU usage of the cgroup v2 cgroup of a process at
+// a scrape.
+type cgroupCPUSample struct {
+	time       time.Time
+	cgroupPath string
+	usageUsec  uint64
+}
+
+// cgroupCPUQuotaUtilization returns the CPU usage between last and current
+// relative to the quota per period, 1 when the cgroup uses all of its quota.
+// There is none without a previous sample of the same cgroup or if the
+// usage dropped, i.e. the cgroup was recreated.
+func cgroupCPUQuotaUtilization(last cgroupCPUSample, ok bool, current cgroupCPUSample, quota, period float64) (float64, bool) {
+	if !ok || last.cgroupPath != current.cgroupPath || current.usageUsec < last.usageUsec {
+		return 0, false
+	}
+	elapsed := current.time.Sub(last.time).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	cpus := float64(current.usageUsec-last.usageUsec) / 1e6 / elapsed
+	return cpus / (quota / period), true
+}
+
+// cgroupV1FilePath returns the path of file in the given cgroup of a cgroup
+// v1 controller hierarchy of the sysfs at sysRoot.
+func cgroupV1FilePath(sysRoot, controller, cgroupPath, file string) string {
+	return filepath.Join(sysRoot, "fs/cgroup", controller, cgroupPath, file)
+}
+
+// getProcessCgroupV1Path returns the path of the cgroup of the given process
+// in the hierarchy of a cgroup v1 controller.
+func getProcessCgroupV1Path(files *processFiles, pid int, controller string) (string, error) {
+	cgroups, err := getProcessCgroups(files, pid)
+	if err != nil {
+		return "", err
+	}
+	for _, cgroup := range cgroups {
+		for _, c := range cgroup.controllers {
+			if c == controller {
+				return cgroup.path, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("process %d is not in a cgroup v1 %s hierarchy", pid, controller)
+}
+
+// parseCgroupStatFile parses a flat keyed cgroup file like memory.stat.
+func parseCgroupStatFile(filename string) (map[string]uint64, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stats := map[string]uint64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value in %s: %s", fields[0], filename, err)
+		}
+		stats[fields[0]] = v
+	}
+	return stats, scanner.Err()
+}
+
+// cgroupV2KernelMemoryStats are the memory.stat fields summed up as kernel
+// memory on kernels without the "kernel" field (added in Linux 5.18).
+var cgroupV2KernelMemoryStats = []string{"slab", "kernel_stack", "pagetables", "percpu"}
+
+// getProcessCgroupKernelMemory returns the kernel memory in bytes, including
+// socket buffers, charged to the memory cgroup of the given process. cgroup
+// v1 only accounts kernel memory in memory.kmem.usage_in_bytes, memory.stat
+// has no kernel memory fields there.
+func getProcessCgroupKernelMemory(files *processFiles, sysRoot string, pid int) (uint64, error) {
+	if cgroupPath, err := getProcessCgroupV1Path(files, pid, "memory"); err == nil {
+		content, err := ioutil.ReadFile(cgroupV1FilePath(sysRoot, "memory", cgroupPath, "memory.kmem.usage_in_bytes"))
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+	}
+
+	cgroupPath, err := getProcessCgroupV2Path(files, pid)
+	if err != nil {
+		return 0, err
+	}
+	filename := cgroupV2FilePath(sysRoot, cgroupPath, "memory.stat")
+	stats, err := parseCgroupStatFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	if kernel, ok := stats["kernel"]; ok {
+		return kernel + stats["sock"], nil
+	}
+	var (
+		total uint64
+		found bool
+	)
+	for _, name := range append(cgroupV2KernelMemoryStats, "sock") {
+		if v, ok := stats[name]; ok {
+			total += v
+			found = true
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("no kernel memory statistics in %s", filename)
+	}
+	return total, nil
+}
+
+// cgroupV1UnlimitedBytes is the smallest cgroup v1 memory limit taken as no
+// limit. Without a limit memory.limit_in_bytes holds the largest page aligned
+// 64 bit value instead of "max".
+const cgroupV1UnlimitedBytes = 1 << 62
+
+// readCgroupValue reads a cgroup file holding a single value, or "max" for
+// no limit.
+func readCgroupValue(filename string) (value uint64, unlimited bool, err error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, false, err
+	}
+	s := strings.TrimSpace(string(content))
+	if s == "max" {
+		return 0, true, nil
+	}
+	value, err = strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid value %q in %s", s, filename)
+	}
+	return value, false, nil
+}
+
+// getProcessCgroupMemory returns the memory usage and limit in bytes of the
+// memory cgroup of the given process, from memory.usage_in_bytes and
+// memory.limit_in_bytes for cgroup v1 and from memory.current and memory.max
+// for cgroup v2.
+func getProcessCgroupMemory(files *processFiles, sysRoot string, pid int) (usage, limit uint64, unlimited bool, err error) {
+	var usageFile, limitFile string
+	if cgroupPath, err := getProcessCgroupV1Path(files, pid, "memory"); err == nil {
+		usageFile = cgroupV1FilePath(sysRoot, "memory", cgroupPath, "memory.usage_in_bytes")
+		limitFile = cgroupV1FilePath(sysRoot, "memory", cgroupPath, "memory.limit_in_bytes")
+	} else {
+		cgroupPath, err := getProcessCgroupV2Path(files, pid)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		usageFile = cgroupV2FilePath(sysRoot, cgroupPath, "memory.current")
+		limitFile = cgroupV2FilePath(sysRoot, cgroupPath, "memory.max")
+	}
+
+	if usage, _, err = readCgroupValue(usageFile); err != nil {
+		return 0, 0, false, err
+	}
+	if limit, unlimited, err = readCgroupValue(limitFile); err != nil {
+		return 0, 0, false, err
+	}
+	if limit >= cgroupV1UnlimitedBytes {
+		return usage, 0, true, nil
+	}
+	return usage, limit, unlimited, nil
+}
+
+// getProcessCgroupPids returns the number of tasks in the pids cgroup of the
+// given process, from its pids.current.
+func getProcessCgroupPids(files *processFiles, sysRoot string, pid int) (uint64, error) {
+	var filename string
+	if cgroupPath, err := getProcessCgroupV1Path(files, pid, "pids"); err == nil {
+		filename = cgroupV1FilePath(sysRoot, "pids", cgroupPath, "pids.current")
+	} else {
+		cgroupPath, err := getProcessCgroupV2Path(files, pid)
+		if err != nil {
+			return 0, err
+		}
+		filename = cgroupV2FilePath(sysRoot, cgroupPath, "pids.current")
+	}
+	pids, _, err := readCgroupValue(filename)
+	return pids, err
+}
+
+// getProcessCgroupCPUThrottling returns the total time in seconds and the
+// number of periods the cpu cgroup of the given process was throttled. cgroup
+// v1 reports the time in nanoseconds as throttled_time in cpu.stat.
+func getProcessCgroupCPUThrottling(files *processFiles, sysRoot string, pid int) (throttledSeconds float64, nrThrottled int64, err error) {
+	if cgroupPath, err := getProcessCgroupV1Path(files, pid, "cpu"); err == nil {
+		filename := cgroupV1FilePath(sysRoot, "cpu", cgroupPath, "cpu.stat")
+		stats, err := parseCgroupStatFile(filename)
+		if err != nil {
+			return 0, 0, err
+		}
+		throttledTime, ok := stats["throttled_time"]
+		periods, ok2 := stats["nr_throttled"]
+		if !ok || !ok2 {
+			return 0, 0, fmt.Errorf("missing throttling statistics in %s", filename)
+		}
+		return float64(throttledTime) / 1e9, int64(periods), nil
+	}
+
+	cgroupPath, err := getProcessCgroupV2Path(files, pid)
+	if err != nil {
+		return 0, 0, err
+	}
+	throttledUsec, nrThrottled, err := getCgroupCPUThrottling(sysRoot, cgroupPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	return float64(throttledUsec) / 1e6, nrThrottled, nil
+}
+
+// cgroupMetrics are the metrics of the cgroups of the registered processes.
+type cgroupMetrics struct {
+	metricVecs
+
+	throttledSeconds  *prometheus.CounterVec
+	throttledPeriods  *prometheus.CounterVec
+	cpuQuotaUsage     *prometheus.GaugeVec
+	kernelMemoryBytes *prometheus.GaugeVec
+	oomKills          *prometheus.CounterVec
+	memoryUsage       *prometheus.GaugeVec
+	memoryLimit       *prometheus.GaugeVec
+	pids              *prometheus.GaugeVec
+}
+
+// newCgroupMetrics returns the cgroup metrics of processes with the given
+// label names.
+func newCgroupMetrics(labelNames []string) *cgroupMetrics {
+	m := &cgroupMetrics{
+		throttledSeconds: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "cgroup_cpu_throttled_seconds_total",
+				Help:      "Total time the cpu cgroup of the process was CPU throttled.",
+			}, labelNames),
+		throttledPeriods: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "cgroup_cpu_throttled_periods_total",
+				Help:      "Number of periods the cpu cgroup of the process was CPU throttled.",
+			}, labelNames),
+		cpuQuotaUsage: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "cgroup_cpu_quota_utilization",
+				Help:      "CPU usage of the cgroup v2 cgroup of the process since the previous scrape relative to its CPU quota in cpu.max.",
+			}, labelNames),
+		kernelMemoryBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "cgroup_kernel_memory_bytes",
+				Help:      "Kernel memory, including socket buffers, charged to the memory cgroup of the process.",
+			}, labelNames),
+		oomKills: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "cgroup_oom_kills_total",
+				Help:      "Number of processes killed by the OOM killer in the cgroup v2 cgroup of the process.",
+			}, labelNames),
+		memoryUsage: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "cgroup_memory_usage_bytes",
+				Help:      "Memory usage of the memory cgroup of the process in bytes.",
+			}, labelNames),
+		memoryLimit: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "cgroup_memory_limit_bytes",
+				Help:      "Memory limit of the memory cgroup of the process in bytes.",
+			}, labelNames),
+		pids: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "cgroup_pids",
+				Help:      "Number of tasks in the pids cgroup of the process.",
+			}, labelNames),
+	}
+	m.metricVecs = metricVecs{
+		m.throttledSeconds,
+		m.throttledPeriods,
+		m.cpuQuotaUsage,
+		m.kernelMemoryBytes,
+		m.oomKills,
+		m.memoryUsage,
+		m.memoryLimit,
+		m.pids,
+	}
+	return m
+}
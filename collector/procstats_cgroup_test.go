@@ -0,0 +1,264 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGetCgroupCPUThrottling(t *testing.T) {
+	cgroupPath, err := getProcessCgroupV2Path(newProcessFiles("fixtures/proc"), 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "/system.slice/hekad.service", cgroupPath; want != got {
+		t.Errorf("want cgroup path %s, got %s", want, got)
+	}
+
+	throttledUsec, nrThrottled, err := getCgroupCPUThrottling("fixtures/sys", cgroupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := int64(2500000), throttledUsec; want != got {
+		t.Errorf("want throttled_usec %d, got %d", want, got)
+	}
+	if want, got := int64(42), nrThrottled; want != got {
+		t.Errorf("want nr_throttled %d, got %d", want, got)
+	}
+
+	if _, _, err := getCgroupCPUThrottling("fixtures/sys", "/nonexistent.slice"); err == nil {
+		t.Error("want error for missing cgroup, got none")
+	}
+}
+
+func TestGetCgroupCPUMax(t *testing.T) {
+	for _, test := range []struct {
+		cgroupPath    string
+		quota, period float64
+		unlimited     bool
+	}{
+		{cgroupPath: "/system.slice/hekad.service", quota: 50000, period: 100000},
+		{cgroupPath: "/system.slice/unlimited.service", period: 100000, unlimited: true},
+	} {
+		quota, period, unlimited, err := getCgroupCPUMax("fixtures/sys", test.cgroupPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if quota != test.quota || period != test.period || unlimited != test.unlimited {
+			t.Errorf("%s: want quota %g, period %g and unlimited %t, got %g, %g and %t", test.cgroupPath, test.quota, test.period, test.unlimited, quota, period, unlimited)
+		}
+	}
+
+	for _, invalid := range []string{"", "max", "50000", "x 100000", "50000 0", "-1 100000", "50000 100000 1"} {
+		if _, _, _, err := parseCgroupCPUMax(invalid); err == nil {
+			t.Errorf("want error for cpu.max %q, got none", invalid)
+		}
+	}
+}
+
+func TestCgroupCPUQuotaUtilization(t *testing.T) {
+	start := time.Unix(1000, 0)
+	last := cgroupCPUSample{time: start, cgroupPath: "/a", usageUsec: 1000000}
+	// Half a CPU of a quota of half a CPU.
+	current := cgroupCPUSample{time: start.Add(10 * time.Second), cgroupPath: "/a", usageUsec: 6000000}
+	if got, ok := cgroupCPUQuotaUtilization(last, true, current, 50000, 100000); !ok || got != 1 {
+		t.Errorf("want utilization 1, got %g (%t)", got, ok)
+	}
+	if got, ok := cgroupCPUQuotaUtilization(last, true, current, 200000, 100000); !ok || got != 0.25 {
+		t.Errorf("want utilization 0.25, got %g (%t)", got, ok)
+	}
+
+	if _, ok := cgroupCPUQuotaUtilization(last, false, current, 50000, 100000); ok {
+		t.Error("want no utilization without a previous sample")
+	}
+	moved := current
+	moved.cgroupPath = "/b"
+	if _, ok := cgroupCPUQuotaUtilization(last, true, moved, 50000, 100000); ok {
+		t.Error("want no utilization for another cgroup")
+	}
+	recreated := current
+	recreated.usageUsec = 10
+	if _, ok := cgroupCPUQuotaUtilization(last, true, recreated, 50000, 100000); ok {
+		t.Error("want no utilization for a recreated cgroup")
+	}
+}
+
+func TestGetProcessPrimaryCgroup(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		cgroup string
+		want   string
+	}{
+		{
+			cgroup: "0::/system.slice/hekad.service\n",
+			want:   "/system.slice/hekad.service",
+		},
+		{
+			cgroup: "12:pids:/system.slice/hekad.service\n" +
+				"4:cpu,cpuacct:/docker/cpu\n" +
+				"3:memory:/docker/memory\n" +
+				"0::/init.scope\n",
+			want: "/docker/memory",
+		},
+		{
+			cgroup: "4:cpu,cpuacct:/docker/cpu\n1:name=systemd:/docker/systemd\n",
+			want:   "/docker/cpu",
+		},
+	}
+	for i, test := range tests {
+		pidDir := filepath.Join(dir, strconv.Itoa(i))
+		if err := os.MkdirAll(pidDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(pidDir, "cgroup"), []byte(test.cgroup), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := getProcessPrimaryCgroup(newProcessFiles(dir), i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("%d. want cgroup %s, got %s", i, test.want, got)
+		}
+	}
+}
+
+func TestGetProcessCgroupKernelMemory(t *testing.T) {
+	// kernel + sock from the cgroup v2 memory.stat.
+	kmem, err := getProcessCgroupKernelMemory(newProcessFiles("fixtures/proc"), "fixtures/sys", 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := uint64(2097152 + 8192); kmem != want {
+		t.Errorf("want kernel memory %d, got %d", want, kmem)
+	}
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		// cgroup v1.
+		"1/cgroup": "3:memory:/docker/abc\n0::/\n",
+		"fs/cgroup/memory/docker/abc/memory.kmem.usage_in_bytes": "3145728\n",
+		// cgroup v2 before Linux 5.18.
+		"2/cgroup":                        "0::/old.slice\n",
+		"fs/cgroup/old.slice/memory.stat": "anon 4096\nslab 1000\nkernel_stack 200\npagetables 30\nsock 4\n",
+		// cgroup v2 without kernel memory accounting.
+		"3/cgroup":                         "0::/none.slice\n",
+		"fs/cgroup/none.slice/memory.stat": "anon 4096\n",
+	} {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for pid, want := range map[int]uint64{1: 3145728, 2: 1234} {
+		kmem, err := getProcessCgroupKernelMemory(newProcessFiles(dir), dir, pid)
+		if err != nil {
+			t.Fatalf("PID %d: %s", pid, err)
+		}
+		if kmem != want {
+			t.Errorf("PID %d: want kernel memory %d, got %d", pid, want, kmem)
+		}
+	}
+	if _, err := getProcessCgroupKernelMemory(newProcessFiles(dir), dir, 3); err == nil {
+		t.Error("want error without kernel memory statistics, got none")
+	}
+}
+
+func TestGetProcessCgroupMemory(t *testing.T) {
+	usage, limit, unlimited, err := getProcessCgroupMemory(newProcessFiles("fixtures/proc"), "fixtures/sys", 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage != 52428800 || limit != 268435456 || unlimited {
+		t.Errorf("want usage 52428800 and limit 268435456, got %d, %d (unlimited %t)", usage, limit, unlimited)
+	}
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		// cgroup v1 without a limit.
+		"1/cgroup": "3:memory:/docker/abc\n4:pids:/docker/abc\n0::/\n",
+		"fs/cgroup/memory/docker/abc/memory.usage_in_bytes": "1048576\n",
+		"fs/cgroup/memory/docker/abc/memory.limit_in_bytes": "9223372036854771712\n",
+		"fs/cgroup/pids/docker/abc/pids.current":            "3\n",
+		// cgroup v2 without a limit.
+		"2/cgroup":                           "0::/max.slice\n",
+		"fs/cgroup/max.slice/memory.current": "4096\n",
+		"fs/cgroup/max.slice/memory.max":     "max\n",
+		// cgroup v2 with an invalid limit.
+		"3/cgroup":                               "0::/invalid.slice\n",
+		"fs/cgroup/invalid.slice/memory.current": "4096\n",
+		"fs/cgroup/invalid.slice/memory.max":     "lots\n",
+	} {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for pid, want := range map[int]uint64{1: 1048576, 2: 4096} {
+		usage, _, unlimited, err := getProcessCgroupMemory(newProcessFiles(dir), dir, pid)
+		if err != nil {
+			t.Fatalf("PID %d: %s", pid, err)
+		}
+		if usage != want || !unlimited {
+			t.Errorf("PID %d: want usage %d without a limit, got %d (unlimited %t)", pid, want, usage, unlimited)
+		}
+	}
+	if _, _, _, err := getProcessCgroupMemory(newProcessFiles(dir), dir, 3); err == nil {
+		t.Error("want error for an invalid limit, got none")
+	}
+
+	if pids, err := getProcessCgroupPids(newProcessFiles(dir), dir, 1); err != nil || pids != 3 {
+		t.Errorf("want 3 cgroup v1 pids, got %d (%v)", pids, err)
+	}
+	if _, err := getProcessCgroupPids(newProcessFiles(dir), dir, 2); err == nil {
+		t.Error("want error for a missing pids.current, got none")
+	}
+}
+
+func TestGetProcessCgroupCPUThrottlingV1(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"1/cgroup":                          "5:cpu,cpuacct:/docker/abc\n0::/\n",
+		"fs/cgroup/cpu/docker/abc/cpu.stat": "nr_periods 100\nnr_throttled 12\nthrottled_time 1500000000\n",
+	} {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seconds, periods, err := getProcessCgroupCPUThrottling(newProcessFiles(dir), dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seconds != 1.5 || periods != 12 {
+		t.Errorf("want 1.5s throttled in 12 periods, got %fs in %d", seconds, periods)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	discoverByCmdline = flag.Bool("collector.procstats.discover-by-cmdline", false,
+		"Find registered processes whose PID file can't be read by the base name of argv[0] in /proc/$PID/cmdline. Walks all processes for each such process on every scrape.")
+	matchByName = flag.Bool("collector.procstats.match-by-name", false,
+		"Find registered processes whose PID file can't be read by their command name in /proc/$PID/comm. Walks all processes once per scrape.")
+)
+
+const (
+	// defaultCmdlineLimit is used if the kernel doesn't report arg_max. It
+	// is the maximum length of a single argument (MAX_ARG_STRLEN).
+	defaultCmdlineLimit = 131072
+
+	// cmdlineTruncatedRatio is the share of the limit from which a command
+	// line is considered truncated.
+	cmdlineTruncatedRatio = 0.95
+)
+
+// getProcessCmdlineLength returns the length in bytes of the command line
+// of the given process, as exposed by the kernel.
+func getProcessCmdlineLength(files *processFiles, pid int) (int, error) {
+	cmdline, err := files.read(pid, "cmdline")
+	if err != nil {
+		return 0, err
+	}
+	return len(cmdline), nil
+}
+
+// getCmdlineLimit returns the limit command lines are truncated at, from
+// /proc/sys/kernel/arg_max if available.
+func getCmdlineLimit(procRoot string) (int, error) {
+	content, err := ioutil.ReadFile(filepath.Join(procRoot, "sys/kernel/arg_max"))
+	if os.IsNotExist(err) {
+		return defaultCmdlineLimit, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(content)))
+}
+
+// discoverPIDsFromProc returns the sorted PIDs of the processes whose argv[0]
+// has the base name name, for processes without a PID file, e.g. started
+// by systemd. Kernel threads have no command line and never match.
+func discoverPIDsFromProc(procRoot, name string) ([]int, error) {
+	pids, err := listPIDs(procRoot)
+	if err != nil {
+		return nil, err
+	}
+	var matched []int
+	for _, pid := range pids {
+		cmdline, err := ioutil.ReadFile(processFilePath(procRoot, pid, "cmdline"))
+		if err != nil {
+			// The process may have exited since procfs was listed.
+			continue
+		}
+		argv0 := strings.SplitN(string(cmdline), "\x00", 2)[0]
+		if argv0 != "" && filepath.Base(argv0) == name {
+			matched = append(matched, pid)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no process with the command %q", name)
+	}
+	return matched, nil
+}
+
+// discoverPIDsByComm returns the sorted PIDs of the processes whose command
+// name is each of names, truncated like the kernel does. Processes exiting
+// during the walk are skipped.
+func discoverPIDsByComm(procRoot string, names []string) (map[string][]int, error) {
+	byComm := make(map[string][]string, len(names))
+	for _, name := range names {
+		comm := name
+		if len(comm) > maxCommLength {
+			comm = comm[:maxCommLength]
+		}
+		byComm[comm] = append(byComm[comm], name)
+	}
+	pids, err := listPIDs(procRoot)
+	if err != nil {
+		return nil, err
+	}
+	matched := make(map[string][]int, len(names))
+	for _, pid := range pids {
+		comm, err := getProcessComm(procRoot, pid)
+		if err != nil {
+			continue
+		}
+		for _, name := range byComm[comm] {
+			matched[name] = append(matched[name], pid)
+		}
+	}
+	return matched, nil
+}
+
+// resolveByName resolves the given processes without PID file by their
+// command name and returns the number of processes found for each.
+func (c *procstatsCollector) resolveByName(files *processFiles, procNames []string, procPID map[string]int, procPIDs map[string][]int) map[string]int {
+	matched, err := discoverPIDsByComm(c.procRoot, procNames)
+	if err != nil {
+		log.Debugf("Unable to find the processes by name: %s", err)
+		return nil
+	}
+	counts := make(map[string]int, len(procNames))
+	for _, procName := range procNames {
+		pids := matched[procName]
+		counts[procName] = len(pids)
+		if len(pids) == 0 {
+			continue
+		}
+		procPID[procName] = selectRepresentativePID(files, pids, *representativePID)
+		procPIDs[procName] = pids
+	}
+	return counts
+}
+
+// requiredArgsPresent returns whether each of args is a substring of
+// cmdline, whose arguments are separated by spaces, so that a required arg
+// may span several arguments like "-log-level error".
+func requiredArgsPresent(cmdline string, args []string) []bool {
+	present := make([]bool, len(args))
+	for i, arg := range args {
+		present[i] = strings.Contains(cmdline, arg)
+	}
+	return present
+}
+
+// cmdlineTruncated returns whether a command line of the given length is
+// likely truncated.
+func cmdlineTruncated(length, limit int) bool {
+	return float64(length) >= cmdlineTruncatedRatio*float64(limit)
+}
+
+// cmdlineMetrics are the metrics of the command lines of the registered
+// processes.
+type cmdlineMetrics struct {
+	metricVecs
+
+	length                 *prometheus.GaugeVec
+	truncated              *prometheus.GaugeVec
+	requiredArgPresent     *prometheus.GaugeVec
+	allRequiredArgsPresent *prometheus.GaugeVec
+}
+
+// newCmdlineMetrics returns the command line metrics of processes with the
+// given label names.
+func newCmdlineMetrics(labelNames []string) *cmdlineMetrics {
+	m := &cmdlineMetrics{
+		length: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "cmdline_length_bytes",
+				Help:      "Length of the command line of the process in /proc/$PID/cmdline.",
+			}, labelNames),
+		truncated: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "cmdline_truncated",
+				Help:      "Whether the command line of the process is at least 95% of the kernel limit and thus likely truncated.",
+			}, labelNames),
+		requiredArgPresent: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "required_args_present",
+				Help:      "Whether the command line of the process contains the required arg from the config file.",
+			}, withLabelNames(labelNames, "arg")),
+		allRequiredArgsPresent: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "all_required_args_present",
+				Help:      "Whether the command line of the process contains all its required args from the config file.",
+			}, labelNames),
+	}
+	m.metricVecs = metricVecs{
+		m.length,
+		m.truncated,
+		m.requiredArgPresent,
+		m.allRequiredArgsPresent,
+	}
+	return m
+}
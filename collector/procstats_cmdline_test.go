@@ -0,0 +1,208 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestGetProcessCmdlineLength(t *testing.T) {
+	dir := t.TempDir()
+
+	limit, err := getCmdlineLimit(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit != defaultCmdlineLimit {
+		t.Errorf("want default limit %d, got %d", defaultCmdlineLimit, limit)
+	}
+
+	// Older kernels truncate the command line at a page.
+	if err := os.MkdirAll(filepath.Join(dir, "sys", "kernel"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "sys", "kernel", "arg_max"), []byte("4096\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if limit, err = getCmdlineLimit(dir); err != nil {
+		t.Fatal(err)
+	}
+	if limit != 4096 {
+		t.Errorf("want limit 4096, got %d", limit)
+	}
+
+	for pid, tt := range map[int]struct {
+		length    int
+		truncated bool
+	}{
+		1: {0, false},
+		2: {100, false},
+		3: {3890, false},
+		4: {3892, true},
+		5: {4096, true},
+	} {
+		d := filepath.Join(dir, strconv.Itoa(pid))
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+		cmdline := bytes.Repeat([]byte{'a'}, tt.length)
+		if err := ioutil.WriteFile(filepath.Join(d, "cmdline"), cmdline, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		length, err := getProcessCmdlineLength(newProcessFiles(dir), pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if length != tt.length {
+			t.Errorf("PID %d: want length %d, got %d", pid, tt.length, length)
+		}
+		if got := cmdlineTruncated(length, limit); got != tt.truncated {
+			t.Errorf("PID %d: want truncated %t, got %t", pid, tt.truncated, got)
+		}
+	}
+}
+
+func TestProcStatsRequiredArgs(t *testing.T) {
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fixture command line is "/usr/bin/hekad\x00-config=/etc/heka/ingest-3.toml\x00".
+	c.requiredArgs = map[string][]string{"hekad": {"hekad -config=", "ingest-3.toml", "-tls-enabled"}}
+	metrics := collectProcStats(t, c)
+
+	for series, want := range map[string]float64{
+		`node_process_required_args_present{arg="hekad -config=",name="hekad"}`: 1,
+		`node_process_required_args_present{arg="ingest-3.toml",name="hekad"}`:  1,
+		`node_process_required_args_present{arg="-tls-enabled",name="hekad"}`:   0,
+		`node_process_all_required_args_present{name="hekad"}`:                  0,
+	} {
+		if got, ok := metrics[series]; !ok || got != want {
+			t.Errorf("%s: want %f, got %f (%t)", series, want, got, ok)
+		}
+	}
+}
+
+func TestDiscoverPIDsFromProc(t *testing.T) {
+	dir := t.TempDir()
+	for pid, cmdline := range map[string]string{
+		"10": "/usr/sbin/app\x00-x\x00",
+		"11": "app\x00",
+		"12": "/usr/bin/other\x00app\x00",
+		"13": "",
+		"14": "/usr/sbin/application\x00",
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, pid), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, pid, "cmdline"), []byte(cmdline), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Not a process.
+	if err := os.MkdirAll(filepath.Join(dir, "net"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	pids, err := discoverPIDsFromProc(dir, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{10, 11}; !reflect.DeepEqual(want, pids) {
+		t.Errorf("want PIDs %v, got %v", want, pids)
+	}
+	if _, err := discoverPIDsFromProc(dir, "missing"); err == nil {
+		t.Error("want error for a missing process, got none")
+	}
+}
+
+func TestProcStatsDiscoverByCmdline(t *testing.T) {
+	// Without a PID file the fixture process is found by its command line.
+	pidDir := t.TempDir()
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad"}, func(o *ProcStatsOptions) {
+		o.PIDDir = pidDir
+		o.DiscoverByCmdline = true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := collectProcStats(t, c)
+	if want, got := 1234.0, metrics[`node_process_pid{name="hekad"}`]; want != got {
+		t.Errorf("want pid %f, got %f", want, got)
+	}
+}
+
+func TestDiscoverPIDsByComm(t *testing.T) {
+	dir := t.TempDir()
+	for pid, comm := range map[string]string{
+		"10": "nginx\n",
+		"11": "nginx\n",
+		"12": "nginx-helper\n",
+		"13": "very-long-name-\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, pid), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, pid, "comm"), []byte(comm), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Exited after listing procfs.
+	if err := os.MkdirAll(filepath.Join(dir, "14"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	matched, err := discoverPIDsByComm(dir, []string{"nginx", "very-long-name-of-a-daemon", "cron"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string][]int{"nginx": {10, 11}, "very-long-name-of-a-daemon": {13}}; !reflect.DeepEqual(want, matched) {
+		t.Errorf("want PIDs %v, got %v", want, matched)
+	}
+}
+
+func TestProcStatsMatchByName(t *testing.T) {
+	pidDir := t.TempDir()
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad", "missing"}, func(o *ProcStatsOptions) {
+		o.PIDDir = pidDir
+		o.MatchByName = true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := collectProcStats(t, c)
+	for series, want := range map[string]float64{
+		`node_process_pid{name="hekad"}`:     1234,
+		`node_process_count{name="hekad"}`:   1,
+		`node_process_count{name="missing"}`: 0,
+	} {
+		if got, ok := metrics[series]; !ok || got != want {
+			t.Errorf("%s: want %f, got %f (%t)", series, want, got, ok)
+		}
+	}
+}
+
+func TestRequiredArgsPresent(t *testing.T) {
+	got := requiredArgsPresent("/usr/bin/app -tls-enabled -log-level error", []string{"-tls-enabled", "-log-level error", "-log-level=error", "pp -t"})
+	if want := []bool{true, true, false, true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
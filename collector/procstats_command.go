@@ -0,0 +1,108 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCommandTimeout bounds PID resolution commands without a configured
+// timeout.
+const defaultCommandTimeout = 5 * time.Second
+
+// commandResolver resolves the PIDs of a process by running a user-supplied
+// command that prints them to stdout, separated by whitespace.
+type commandResolver struct {
+	name    string
+	args    []string
+	timeout time.Duration
+	ttl     time.Duration
+
+	mtx     sync.Mutex
+	pids    []int
+	expires time.Time
+}
+
+func newCommandResolver(p processConfig) *commandResolver {
+	r := &commandResolver{
+		name:    p.Name,
+		args:    p.Command,
+		timeout: time.Duration(p.CommandTimeout),
+		ttl:     time.Duration(p.CommandCacheTTL),
+	}
+	if r.timeout == 0 {
+		r.timeout = defaultCommandTimeout
+	}
+	return r
+}
+
+// resolve returns the PIDs printed by the command. Results are cached for
+// the configured TTL.
+func (r *commandResolver) resolve() ([]int, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.pids != nil && time.Now().Before(r.expires) {
+		return r.pids, nil
+	}
+	pids, err := r.run()
+	if err != nil {
+		return nil, err
+	}
+	r.pids = pids
+	r.expires = time.Now().Add(r.ttl)
+	return pids, nil
+}
+
+func (r *commandResolver) run() ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, r.args[0], r.args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if stderr.Len() > 0 {
+		processLogger(r.name, 0).Warnf("PID command wrote to stderr: %s", strings.TrimSpace(stderr.String()))
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("PID command of %s timed out after %s", r.name, r.timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("PID command of %s failed: %s", r.name, err)
+	}
+
+	var pids []int
+	for _, field := range strings.Fields(stdout.String()) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("PID command of %s printed invalid PID %q", r.name, field)
+		}
+		pids = append(pids, pid)
+	}
+	if len(pids) == 0 {
+		return nil, fmt.Errorf("PID command of %s printed no PID", r.name)
+	}
+	return pids, nil
+}
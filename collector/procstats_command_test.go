@@ -0,0 +1,83 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCommandResolver(t *testing.T) {
+	tests := []struct {
+		script string
+		want   []int
+	}{
+		{script: "echo 1234", want: []int{1234}},
+		{script: "echo 1234 5678; echo warning >&2", want: []int{1234, 5678}},
+		{script: "exit 1"},
+		{script: "echo"},
+		{script: "echo not-a-pid"},
+		{script: "exec sleep 5"},
+	}
+	for i, test := range tests {
+		r := newCommandResolver(processConfig{
+			Name:           "worker",
+			Command:        []string{"/bin/sh", "-c", test.script},
+			CommandTimeout: duration(100 * time.Millisecond),
+		})
+		pids, err := r.resolve()
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("%d. want error, got PIDs %v", i, pids)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d. %s", i, err)
+		}
+		if !reflect.DeepEqual(test.want, pids) {
+			t.Errorf("%d. want PIDs %v, got %v", i, test.want, pids)
+		}
+	}
+}
+
+func TestCommandResolverCache(t *testing.T) {
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "pid")
+	if err := ioutil.WriteFile(pidFile, []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newCommandResolver(processConfig{
+		Name:            "worker",
+		Command:         []string{"/bin/cat", pidFile},
+		CommandCacheTTL: duration(time.Hour),
+	})
+	if _, err := r.resolve(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(pidFile, []byte("2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pids, err := r.resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1}; !reflect.DeepEqual(want, pids) {
+		t.Errorf("want cached PIDs %v, got %v", want, pids)
+	}
+}
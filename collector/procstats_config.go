@@ -0,0 +1,409 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	procstatsConfigFile = flag.String("collector.procstats.config", "",
+		"Path of a YAML file configuring processes in addition to --collector.procstats.registered-processes.")
+)
+
+// procstatsConfig is the configuration file of the procstats collector.
+type procstatsConfig struct {
+	Processes []processConfig `yaml:"processes" json:"processes"`
+}
+
+// processConfig configures a monitored process.
+type processConfig struct {
+	Name string `yaml:"name" json:"name"`
+
+	// Command is run to resolve the PID of the process instead of reading
+	// its PID file. It must print the PID to stdout.
+	Command         []string `yaml:"command,omitempty" json:"command,omitempty"`
+	CommandTimeout  duration `yaml:"command_timeout,omitempty" json:"command_timeout,omitempty"`
+	CommandCacheTTL duration `yaml:"command_cache_ttl,omitempty" json:"command_cache_ttl,omitempty"`
+
+	// CommRegex or CmdlineRegex discover all processes whose comm or
+	// cmdline matches instead of a single process. Named capture groups
+	// become labels, MaxSeries caps the number of discovered processes.
+	CommRegex    string `yaml:"comm_regex,omitempty" json:"comm_regex,omitempty"`
+	CmdlineRegex string `yaml:"cmdline_regex,omitempty" json:"cmdline_regex,omitempty"`
+	MaxSeries    int    `yaml:"max_series,omitempty" json:"max_series,omitempty"`
+
+	// LabelTransform normalizes the values of the capture group labels.
+	LabelTransform *labelTransformConfig `yaml:"label_transform,omitempty" json:"label_transform,omitempty"`
+
+	// Metrics restricts the metrics of discovered processes. With
+	// ["count"] only the number of matching processes is exposed.
+	Metrics []string `yaml:"metrics,omitempty" json:"metrics,omitempty"`
+
+	// StartupGrace overrides --collector.procstats.startup-grace for the
+	// process.
+	StartupGrace *duration `yaml:"startup_grace,omitempty" json:"startup_grace,omitempty"`
+
+	// Supervisor reports the processes managed by a supervisor instead of
+	// a single process.
+	Supervisor *supervisorConfig `yaml:"supervisor,omitempty" json:"supervisor,omitempty"`
+
+	// Version exposes the version of the process as node_process_version_info.
+	Version *versionConfig `yaml:"version,omitempty" json:"version,omitempty"`
+
+	// MemoryThresholds counts the breaches of resident memory limits.
+	MemoryThresholds *memoryThresholdsConfig `yaml:"memory_thresholds,omitempty" json:"memory_thresholds,omitempty"`
+
+	// Schedule is a cron expression of the minutes in which the process is
+	// expected to run, in the local time of the node. It is exposed as
+	// node_process_expected_running.
+	Schedule string `yaml:"schedule,omitempty" json:"schedule,omitempty"`
+
+	// ExpectedPort is the TCP port the process is expected to listen on,
+	// exposed as node_process_expected_port_listening.
+	ExpectedPort int `yaml:"expected_port,omitempty" json:"expected_port,omitempty"`
+
+	// RequiredArgs are substrings the command line of the process must
+	// contain, its arguments separated by spaces, e.g. "-tls-enabled".
+	RequiredArgs []string `yaml:"required_args,omitempty" json:"required_args,omitempty"`
+
+	// Namespace reads the PID file inside a container instead of on the
+	// host.
+	Namespace *namespaceConfig `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+
+	// PIDFile is the path of the PID file of the process instead of
+	// $NAME.pid in --collector.procstats.pid-dir.
+	PIDFile string `yaml:"pid_file,omitempty" json:"pid_file,omitempty"`
+
+	// Labels are static labels added to the series of the process that
+	// carry the env labels, e.g. {"team": "platform"}. Processes of other
+	// entries have an empty value for them.
+	Labels map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// namespaceConfig configures the container a process runs in.
+type namespaceConfig struct {
+	// InitPID is the PID on the host of the init process of the container,
+	// whose root and PID namespace the process is resolved in.
+	InitPID int `yaml:"init_pid" json:"init_pid"`
+	// PIDFile is the path of the PID file inside the container,
+	// /var/run/<name>.pid by default.
+	PIDFile string `yaml:"pid_file,omitempty" json:"pid_file,omitempty"`
+}
+
+// memoryThresholdsConfig are the limits of the resident memory of a
+// process. 0 disables a limit.
+type memoryThresholdsConfig struct {
+	MaxRSSBytes uint64 `yaml:"max_rss_bytes,omitempty" json:"max_rss_bytes,omitempty"`
+	MinRSSBytes uint64 `yaml:"min_rss_bytes,omitempty" json:"min_rss_bytes,omitempty"`
+}
+
+// labelTransformConfig configures the normalization of label values, e.g. to
+// strip paths or version suffixes from captured binary names.
+type labelTransformConfig struct {
+	TrimPrefix string `yaml:"trim_prefix,omitempty" json:"trim_prefix,omitempty"`
+	TrimSuffix string `yaml:"trim_suffix,omitempty" json:"trim_suffix,omitempty"`
+	// Regex is replaced with Replacement, which may refer to its capture
+	// groups as $1 or ${name}.
+	Regex       string `yaml:"regex,omitempty" json:"regex,omitempty"`
+	Replacement string `yaml:"replacement,omitempty" json:"replacement,omitempty"`
+	Lowercase   bool   `yaml:"lowercase,omitempty" json:"lowercase,omitempty"`
+}
+
+// versionConfig configures where the version of a process is read from.
+type versionConfig struct {
+	// Env is an environment variable of the process, File a file whose
+	// first line is read and Binary searches the executable of the process
+	// with Regex. Exactly one is set.
+	Env    string `yaml:"env,omitempty" json:"env,omitempty"`
+	File   string `yaml:"file,omitempty" json:"file,omitempty"`
+	Binary bool   `yaml:"binary,omitempty" json:"binary,omitempty"`
+	// Regex extracts the version from the value, from its capture group if
+	// it has one.
+	Regex string `yaml:"regex,omitempty" json:"regex,omitempty"`
+}
+
+// supervisorConfig configures the supervisor queried for its processes.
+type supervisorConfig struct {
+	// Type is the protocol of the supervisor, e.g. "supervisord".
+	Type string `yaml:"type" json:"type"`
+	// URL is the endpoint of the supervisor, unix:// URLs are Unix sockets.
+	URL      string   `yaml:"url" json:"url"`
+	Timeout  duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	CacheTTL duration `yaml:"cache_ttl,omitempty" json:"cache_ttl,omitempty"`
+}
+
+// processMetricCount selects the instance count of discovered processes.
+const processMetricCount = "count"
+
+// discovered returns whether the processes of the entry are discovered by
+// a regex.
+func (p processConfig) discovered() bool {
+	return p.CommRegex != "" || p.CmdlineRegex != ""
+}
+
+// countOnly returns whether only the number of discovered processes is
+// exposed for the entry.
+func (p processConfig) countOnly() bool {
+	return len(p.Metrics) == 1 && p.Metrics[0] == processMetricCount
+}
+
+// duration is a time.Duration in the string format of time.ParseDuration.
+type duration time.Duration
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, for the processes of
+// --collector.procstats.sd-url.
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d *duration) parse(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// staticLabelNames returns the sorted names of the labels of all processes.
+func (c *procstatsConfig) staticLabelNames() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, p := range c.Processes {
+		for name := range p.Labels {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadProcstatsConfig reads and validates a procstats configuration file.
+func loadProcstatsConfig(path string) (*procstatsConfig, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &procstatsConfig{}
+	if err := yaml.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %s", path, err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %s", path, err)
+	}
+	return config, nil
+}
+
+func (c *procstatsConfig) validate() error {
+	seen := map[string]bool{}
+	for i, p := range c.Processes {
+		if p.Name == "" {
+			return fmt.Errorf("process %d has no name", i)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("duplicate process %q", p.Name)
+		}
+		seen[p.Name] = true
+		if len(p.Command) > 0 && p.Command[0] == "" {
+			return fmt.Errorf("empty command for process %q", p.Name)
+		}
+		if p.CommandTimeout < 0 || p.CommandCacheTTL < 0 {
+			return fmt.Errorf("negative command timeout or cache TTL for process %q", p.Name)
+		}
+		if p.StartupGrace != nil && *p.StartupGrace < 0 {
+			return fmt.Errorf("negative startup grace for process %q", p.Name)
+		}
+		if p.CommRegex != "" && p.CmdlineRegex != "" {
+			return fmt.Errorf("both comm_regex and cmdline_regex set for process %q", p.Name)
+		}
+		if p.Supervisor != nil {
+			if err := p.Supervisor.validate(); err != nil {
+				return fmt.Errorf("invalid supervisor for process %q: %s", p.Name, err)
+			}
+			if len(p.Command) > 0 || p.discovered() {
+				return fmt.Errorf("a supervisor and a command or regex set for process %q", p.Name)
+			}
+		}
+		if p.Version != nil {
+			if err := p.Version.validate(); err != nil {
+				return fmt.Errorf("invalid version for process %q: %s", p.Name, err)
+			}
+			if p.Supervisor != nil || p.discovered() {
+				return fmt.Errorf("a version and a supervisor or regex set for process %q", p.Name)
+			}
+		}
+		if t := p.MemoryThresholds; t != nil {
+			if t.MaxRSSBytes == 0 && t.MinRSSBytes == 0 {
+				return fmt.Errorf("no memory threshold set for process %q", p.Name)
+			}
+			if t.MaxRSSBytes > 0 && t.MinRSSBytes >= t.MaxRSSBytes {
+				return fmt.Errorf("min_rss_bytes not below max_rss_bytes for process %q", p.Name)
+			}
+			if p.Supervisor != nil || p.discovered() {
+				return fmt.Errorf("memory thresholds and a supervisor or regex set for process %q", p.Name)
+			}
+		}
+		if p.Schedule != "" {
+			if _, err := parseCronSchedule(p.Schedule); err != nil {
+				return fmt.Errorf("invalid schedule for process %q: %s", p.Name, err)
+			}
+			if p.Supervisor != nil || p.discovered() {
+				return fmt.Errorf("a schedule and a supervisor or regex set for process %q", p.Name)
+			}
+		}
+		if n := p.Namespace; n != nil {
+			if n.InitPID <= 0 {
+				return fmt.Errorf("invalid namespace init PID %d for process %q", n.InitPID, p.Name)
+			}
+			if n.PIDFile != "" && !filepath.IsAbs(n.PIDFile) {
+				return fmt.Errorf("relative namespace PID file %q for process %q", n.PIDFile, p.Name)
+			}
+			if len(p.Command) > 0 || p.Supervisor != nil || p.discovered() {
+				return fmt.Errorf("a namespace and a command, supervisor or regex set for process %q", p.Name)
+			}
+		}
+		if p.PIDFile != "" {
+			if !filepath.IsAbs(p.PIDFile) {
+				return fmt.Errorf("relative PID file %q for process %q", p.PIDFile, p.Name)
+			}
+			if isPIDFileGlob(p.PIDFile) {
+				return fmt.Errorf("PID file pattern %q for process %q, patterns are only supported by --collector.procstats.registered-processes", p.PIDFile, p.Name)
+			}
+			if len(p.Command) > 0 || p.Supervisor != nil || p.discovered() || p.Namespace != nil {
+				return fmt.Errorf("a PID file and a command, supervisor, regex or namespace set for process %q", p.Name)
+			}
+		}
+		if len(p.Labels) > 0 {
+			for name := range p.Labels {
+				if !model.LabelName(name).IsValid() {
+					return fmt.Errorf("invalid label name %q for process %q", name, p.Name)
+				}
+				// node_process_cpu_seconds_total adds a mode label.
+				if name == "name" || name == "mode" {
+					return fmt.Errorf("reserved label name %q for process %q", name, p.Name)
+				}
+			}
+			if p.Supervisor != nil || p.discovered() {
+				return fmt.Errorf("labels and a supervisor or regex set for process %q", p.Name)
+			}
+		}
+		if len(p.RequiredArgs) > 0 {
+			for _, arg := range p.RequiredArgs {
+				if strings.TrimSpace(arg) == "" {
+					return fmt.Errorf("empty required arg for process %q", p.Name)
+				}
+			}
+			if p.Supervisor != nil || p.discovered() {
+				return fmt.Errorf("required args and a supervisor or regex set for process %q", p.Name)
+			}
+		}
+		if p.ExpectedPort != 0 {
+			if p.ExpectedPort < 0 || p.ExpectedPort > 65535 {
+				return fmt.Errorf("invalid expected port %d for process %q", p.ExpectedPort, p.Name)
+			}
+			if p.Supervisor != nil || p.discovered() {
+				return fmt.Errorf("an expected port and a supervisor or regex set for process %q", p.Name)
+			}
+		}
+		for _, m := range p.Metrics {
+			if m != processMetricCount {
+				return fmt.Errorf("unknown metric %q for process %q", m, p.Name)
+			}
+		}
+		if p.LabelTransform != nil {
+			if !p.discovered() {
+				return fmt.Errorf("label_transform set without a regex for process %q", p.Name)
+			}
+			if _, err := newLabelTransform(p.LabelTransform); err != nil {
+				return fmt.Errorf("invalid label_transform for process %q: %s", p.Name, err)
+			}
+		}
+		if len(p.Metrics) > 0 && !p.discovered() {
+			return fmt.Errorf("metrics set without a regex for process %q", p.Name)
+		}
+		if p.discovered() {
+			if len(p.Command) > 0 {
+				return fmt.Errorf("both a command and a regex set for process %q", p.Name)
+			}
+			if p.MaxSeries < 0 {
+				return fmt.Errorf("negative max_series for process %q", p.Name)
+			}
+			if _, _, err := compileProcessRegex(p); err != nil {
+				return fmt.Errorf("invalid regex for process %q: %s", p.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *versionConfig) validate() error {
+	sources := 0
+	for _, set := range []bool{c.Env != "", c.File != "", c.Binary} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("exactly one of env, file and binary must be set")
+	}
+	if c.Binary && c.Regex == "" {
+		return fmt.Errorf("binary without a regex")
+	}
+	if _, err := newVersionSource(c); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *supervisorConfig) validate() error {
+	if _, ok := supervisorProtocols[c.Type]; !ok {
+		return fmt.Errorf("unknown type %q", c.Type)
+	}
+	if c.URL == "" {
+		return fmt.Errorf("no url")
+	}
+	if c.Timeout < 0 || c.CacheTTL < 0 {
+		return fmt.Errorf("negative timeout or cache TTL")
+	}
+	return nil
+}
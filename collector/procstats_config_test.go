@@ -0,0 +1,108 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadProcstatsConfig(t *testing.T) {
+	want := &procstatsConfig{
+		Processes: []processConfig{
+			{Name: "hekad"},
+			{
+				Name:            "worker",
+				Command:         []string{"/usr/local/bin/find-worker", "--primary"},
+				CommandTimeout:  duration(2 * time.Second),
+				CommandCacheTTL: duration(time.Minute),
+			},
+		},
+	}
+	// A JSON config is valid YAML as well.
+	for _, path := range []string{"fixtures/procstats/config.yml", "fixtures/procstats/config.json"} {
+		config, err := loadProcstatsConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(want, config) {
+			t.Errorf("%s: want config %+v, got %+v", path, want, config)
+		}
+	}
+}
+
+func TestProcstatsConfigValidate(t *testing.T) {
+	for i, config := range []procstatsConfig{
+		{Processes: []processConfig{{}}},
+		{Processes: []processConfig{{Name: "a"}, {Name: "a"}}},
+		{Processes: []processConfig{{Name: "a", Command: []string{""}}}},
+		{Processes: []processConfig{{Name: "a", CommandTimeout: -1}}},
+		{Processes: []processConfig{{Name: "a", CommRegex: "a", CmdlineRegex: "a"}}},
+		{Processes: []processConfig{{Name: "a", CommRegex: "a", Command: []string{"true"}}}},
+		{Processes: []processConfig{{Name: "a", CommRegex: "a", MaxSeries: -1}}},
+		{Processes: []processConfig{{Name: "a", CommRegex: "(a"}}},
+		{Processes: []processConfig{{Name: "a", CommRegex: "(?P<__role>a)"}}},
+		{Processes: []processConfig{{Name: "a", CommRegex: "(?P<name>a)"}}},
+		{Processes: []processConfig{{Name: "a", CommRegex: "(?P<role>a)(?P<role>b)"}}},
+		{Processes: []processConfig{{Name: "a", CommRegex: "a", Metrics: []string{"rss"}}}},
+		{Processes: []processConfig{{Name: "a", Metrics: []string{"count"}}}},
+		{Processes: []processConfig{{Name: "a", Supervisor: &supervisorConfig{Type: "upstart", URL: "unix:///run/upstart"}}}},
+		{Processes: []processConfig{{Name: "a", Supervisor: &supervisorConfig{Type: "supervisord"}}}},
+		{Processes: []processConfig{{Name: "a", CommRegex: "a", Supervisor: &supervisorConfig{Type: "supervisord", URL: "unix:///run/supervisor.sock"}}}},
+		{Processes: []processConfig{{Name: "a", Version: &versionConfig{}}}},
+		{Processes: []processConfig{{Name: "a", Version: &versionConfig{Env: "VERSION", File: "/opt/a/VERSION"}}}},
+		{Processes: []processConfig{{Name: "a", Version: &versionConfig{Env: "VERSION", Regex: "(a"}}}},
+		{Processes: []processConfig{{Name: "a", Version: &versionConfig{Binary: true}}}},
+		{Processes: []processConfig{{Name: "a", Version: &versionConfig{Binary: true, File: "/opt/a/VERSION", Regex: "v(.*)"}}}},
+		{Processes: []processConfig{{Name: "a", Version: &versionConfig{Env: "VERSION", Regex: "(a)(b)"}}}},
+		{Processes: []processConfig{{Name: "a", CommRegex: "a", Version: &versionConfig{Env: "VERSION"}}}},
+		{Processes: []processConfig{{Name: "a", MemoryThresholds: &memoryThresholdsConfig{}}}},
+		{Processes: []processConfig{{Name: "a", LabelTransform: &labelTransformConfig{Lowercase: true}}}},
+		{Processes: []processConfig{{Name: "a", CommRegex: "(?P<bin>.*)", LabelTransform: &labelTransformConfig{Regex: "(a"}}}},
+		{Processes: []processConfig{{Name: "a", CommRegex: "(?P<bin>.*)", LabelTransform: &labelTransformConfig{Replacement: "$1"}}}},
+		{Processes: []processConfig{{Name: "a", MemoryThresholds: &memoryThresholdsConfig{MaxRSSBytes: 1024, MinRSSBytes: 1024}}}},
+		{Processes: []processConfig{{Name: "a", CommRegex: "a", MemoryThresholds: &memoryThresholdsConfig{MaxRSSBytes: 1024}}}},
+		{Processes: []processConfig{{Name: "a", Schedule: "* 9-17 * *"}}},
+		{Processes: []processConfig{{Name: "a", CommRegex: "a", Schedule: "* 9-17 * * 1-5"}}},
+		{Processes: []processConfig{{Name: "a", ExpectedPort: 65536}}},
+		{Processes: []processConfig{{Name: "a", RequiredArgs: []string{"-tls-enabled", " "}}}},
+		{Processes: []processConfig{{Name: "a", CommRegex: "a", RequiredArgs: []string{"-tls-enabled"}}}},
+		{Processes: []processConfig{{Name: "a", Namespace: &namespaceConfig{}}}},
+		{Processes: []processConfig{{Name: "a", Namespace: &namespaceConfig{InitPID: 1, PIDFile: "run/a.pid"}}}},
+		{Processes: []processConfig{{Name: "a", Command: []string{"true"}, Namespace: &namespaceConfig{InitPID: 1}}}},
+		{Processes: []processConfig{{Name: "a", CommRegex: "a", ExpectedPort: 8080}}},
+		{Processes: []processConfig{{Name: "a", PIDFile: "run/a.pid"}}},
+		{Processes: []processConfig{{Name: "a", PIDFile: "/run/a-*.pid"}}},
+		{Processes: []processConfig{{Name: "a", PIDFile: "/run/a.pid", Command: []string{"true"}}}},
+		{Processes: []processConfig{{Name: "a", Labels: map[string]string{"1team": "platform"}}}},
+		{Processes: []processConfig{{Name: "a", Labels: map[string]string{"name": "b"}}}},
+		{Processes: []processConfig{{Name: "a", CommRegex: "a", Labels: map[string]string{"team": "platform"}}}},
+	} {
+		if err := config.validate(); err == nil {
+			t.Errorf("%d. want validation error, got none", i)
+		}
+	}
+}
+
+func TestProcstatsConfigStaticLabelNames(t *testing.T) {
+	config := procstatsConfig{Processes: []processConfig{
+		{Name: "a", Labels: map[string]string{"tier": "1", "team": "platform"}},
+		{Name: "b"},
+		{Name: "c", Labels: map[string]string{"team": "billing"}},
+	}}
+	if want, got := []string{"team", "tier"}, config.staticLabelNames(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want label names %q, got %q", want, got)
+	}
+}
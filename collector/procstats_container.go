@@ -0,0 +1,52 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import "regexp"
+
+// containerIDLength is the length container IDs are shortened to, as shown
+// by the docker and podman CLIs.
+const containerIDLength = 12
+
+// containerRuntimes are the runtimes detected from the cgroup path of a
+// process, with a regex whose capture group is the container ID.
+var containerRuntimes = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	// systemd cgroup driver (docker-<id>.scope) and cgroupfs (/docker/<id>).
+	{"docker", regexp.MustCompile(`docker[-/]([0-9a-f]{64})`)},
+	{"containerd", regexp.MustCompile(`cri-containerd-([0-9a-f]{64})`)},
+	{"podman", regexp.MustCompile(`libpod-([0-9a-f]{64})`)},
+	// LXC names its containers, /lxc.payload.<name> since LXC 4.
+	{"lxc", regexp.MustCompile(`^/lxc(?:/|\.payload[./])([^/]+)`)},
+}
+
+// detectContainerRuntime returns the container runtime and the shortened
+// container ID of a process from its cgroup path, as read for the cgroup of
+// node_process_info. Both are empty for processes outside of a container.
+func detectContainerRuntime(cgroupPath string) (runtime, id string) {
+	for _, r := range containerRuntimes {
+		if m := r.re.FindStringSubmatch(cgroupPath); m != nil {
+			id = m[1]
+			if r.name != "lxc" && len(id) > containerIDLength {
+				id = id[:containerIDLength]
+			}
+			return r.name, id
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,50 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import "testing"
+
+func TestDetectContainerRuntime(t *testing.T) {
+	for _, test := range []struct {
+		pid         int
+		runtime, id string
+	}{
+		{pid: 1001, runtime: "docker", id: "4f1c2e0b9a8d"},
+		{pid: 1002, runtime: "containerd", id: "8a9b0c1d2e3f"},
+		{pid: 1003, runtime: "podman", id: "c3d2e1f0a9b8"},
+		{pid: 1004, runtime: "lxc", id: "web01"},
+		{pid: 1005},
+	} {
+		cgroup, err := getProcessPrimaryCgroup(newProcessFiles("fixtures/containers"), test.pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		runtime, id := detectContainerRuntime(cgroup)
+		if runtime != test.runtime || id != test.id {
+			t.Errorf("%d: want runtime %q and ID %q, got %q and %q", test.pid, test.runtime, test.id, runtime, id)
+		}
+	}
+
+	for _, cgroup := range []string{
+		"/docker/4f1c2e0b9a8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0d9c8b7a6f5e4d3c2b",
+		"/lxc.payload.web01",
+	} {
+		if runtime, _ := detectContainerRuntime(cgroup); runtime == "" {
+			t.Errorf("%s: want a runtime, got none", cgroup)
+		}
+	}
+	if runtime, _ := detectContainerRuntime("/lxc.monitor.web01"); runtime != "" {
+		t.Errorf("want no runtime for the LXC monitor, got %q", runtime)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"sync"
+)
+
+// continuousCounters keeps per-process counters monotonic across process
+// restarts. When the start time of a process changes, the last values seen
+// before the restart are added to a baseline that is carried forward.
+//
+// This changes the semantics of the exported counters: they no longer
+// reflect the values reported by the kernel and a restart no longer shows
+// up as a counter reset.
+type continuousCounters struct {
+	mtx    sync.Mutex
+	states map[string]*continuousCounterState
+}
+
+type continuousCounterState struct {
+	startTime uint64
+	baseline  map[string]float64
+	last      map[string]float64
+}
+
+func newContinuousCounters() *continuousCounters {
+	return &continuousCounters{
+		states: map[string]*continuousCounterState{},
+	}
+}
+
+// adjust returns value plus the accumulated baseline of counter key of the
+// named process, e.g. "voluntary_ctxt_switches" or "utime". startTime is the
+// current start time of the process.
+func (c *continuousCounters) adjust(name string, startTime uint64, key string, value float64) float64 {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	state, ok := c.states[name]
+	if !ok {
+		state = &continuousCounterState{
+			startTime: startTime,
+			baseline:  map[string]float64{},
+			last:      map[string]float64{},
+		}
+		c.states[name] = state
+	}
+	if state.startTime != startTime {
+		for k, v := range state.last {
+			state.baseline[k] += v
+		}
+		state.last = map[string]float64{}
+		state.startTime = startTime
+	}
+	state.last[key] = value
+	return state.baseline[key] + value
+}
@@ -0,0 +1,254 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// registeredCollector adapts a Collector to prometheus.Collector.
+type registeredCollector struct {
+	Collector
+}
+
+func (c registeredCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.Collector.(Describer).Describe(ch)
+}
+
+func (c registeredCollector) Collect(ch chan<- prometheus.Metric) {
+	c.Update(ch)
+}
+
+func TestProcStatsDescribe(t *testing.T) {
+	c, err := NewProcStatsCollector()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.(Describer); !ok {
+		t.Fatal("want procstats collector to implement Describer")
+	}
+
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		c.(Describer).Describe(ch)
+		close(ch)
+	}()
+	described := map[string]bool{}
+	for desc := range ch {
+		name, _, err := descNameAndHelp(desc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		described[name] = true
+	}
+	for _, name := range []string{
+		"node_process_pid",
+		"node_process_mem_kilobytes",
+		"node_process_voluntary_context_switches_total",
+		"node_process_info",
+		"node_process_resolution_ratio",
+		"node_process_collector_last_scrape_timestamp_seconds",
+		"node_process_collector_cache_age_seconds",
+		"node_process_runqueue_wait_seconds_total",
+		"node_process_series_capped",
+		"node_inotify_max_user_watches",
+	} {
+		if !described[name] {
+			t.Errorf("want %s described, got none", name)
+		}
+	}
+
+	if err := prometheus.Register(registeredCollector{c}); err != nil {
+		t.Fatalf("want procstats collector to register, got %s", err)
+	}
+	defer prometheus.Unregister(registeredCollector{c})
+	if err := prometheus.Register(registeredCollector{c}); err == nil {
+		t.Error("want error registering the procstats collector twice, got none")
+	}
+	conflicting := prometheus.NewGauge(prometheus.GaugeOpts{Name: "node_process_pid", Help: "The PID of the process right now"})
+	if err := prometheus.Register(conflicting); err == nil {
+		t.Error("want error registering a conflicting metric, got none")
+		prometheus.Unregister(conflicting)
+	}
+}
+
+func TestProcStatsMetricGroups(t *testing.T) {
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A vector in two groups would be collected twice.
+	groups := map[string]int{}
+	for i, g := range c.metricGroups() {
+		if len(g.vecs()) == 0 {
+			t.Errorf("group %d: want metric vectors, got none", i)
+		}
+		ch := make(chan *prometheus.Desc)
+		go func() {
+			g.Describe(ch)
+			close(ch)
+		}()
+		for desc := range ch {
+			name, _, err := descNameAndHelp(desc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if j, ok := groups[name]; ok {
+				t.Errorf("%s: want in one group, got in groups %d and %d", name, j, i)
+			}
+			groups[name] = i
+		}
+	}
+	if want, got := len(c.vecs()), len(groups); want != got {
+		t.Errorf("want %d described vectors, got %d", want, got)
+	}
+}
+
+// TestProcStatsCollectChecks checks the described and collected metrics
+// like a registry with collect checks. The vendored client_golang has no
+// pedantic registry of its own, only collect checks of the default registry,
+// which keeps the label names of unregistered descriptors.
+func TestProcStatsCollectChecks(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "procstats.yml")
+	if err := ioutil.WriteFile(config, []byte(`processes:
+- name: hekad
+  labels:
+    team: logging
+- name: heka
+  cmdline_regex: '\S+ -config=/etc/heka/(?P<role>\w+)-(?P<shard>\d+)\.toml'
+- name: hekas-running
+  comm_regex: hek.*
+  metrics: [count]
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name    string
+		options func(*ProcStatsOptions)
+		renamer *metricRenamer
+		series  []string
+	}{
+		{
+			name: "defaults",
+			series: []string{
+				`node_process_pid{name="heka",role="ingest",shard="3"}`,
+				`node_process_pid{instance="hekad",name="hekas"}`,
+				`node_process_instances{name="hekas-running"}`,
+			},
+		},
+		{
+			name: "node label and renamed metrics",
+			options: func(o *ProcStatsOptions) {
+				o.NodeLabelName, o.NodeLabelValue = "node", "web1"
+			},
+			renamer: &metricRenamer{keepLegacy: true, labelName: "process"},
+			series: []string{
+				`node_process_pid{name="heka",node="web1",role="ingest",shard="3"}`,
+				`node_process_pid{node="web1",process="heka",role="ingest",shard="3"}`,
+				`node_process_pid{instance="hekad",node="web1",process="hekas"}`,
+				`node_process_resident_memory_bytes{node="web1",process="hekad",team="logging"}`,
+			},
+		},
+	} {
+		c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad", "hekas"}, func(o *ProcStatsOptions) {
+			o.SysRoot = "fixtures/sys"
+			o.ConfigFile = config
+			o.PIDFiles = map[string]string{"hekas": "fixtures/proc/hek*.pid"}
+			if test.options != nil {
+				test.options(o)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.renamer = test.renamer
+
+		for _, err := range collectChecked(c) {
+			t.Errorf("%s: %s", test.name, err)
+		}
+		metrics := collectProcStats(t, c)
+		for _, series := range test.series {
+			if _, ok := metrics[series]; !ok {
+				t.Errorf("%s: want series %s, got none", test.name, series)
+			}
+		}
+	}
+}
+
+// collectChecked returns the errors a registry with collect checks reports
+// for c: descriptors of the same name with other label names or help, and
+// collected metrics that weren't described or were collected twice.
+func collectChecked(c Collector) []error {
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		c.(Describer).Describe(descs)
+		close(descs)
+	}()
+	var errs []error
+	described := map[string]string{}
+	for desc := range descs {
+		name, help, err := descNameAndHelp(desc)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		labelNames, err := descLabelNames(desc)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sort.Strings(labelNames)
+		dims := fmt.Sprintf("%q %v", help, labelNames)
+		if d, ok := described[name]; ok && d != dims {
+			errs = append(errs, fmt.Errorf("descriptor %s inconsistent with a described one of the same name", desc))
+		}
+		described[name] = dims
+	}
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Update(ch)
+		close(ch)
+	}()
+	collected := map[string]bool{}
+	for m := range ch {
+		name, _, err := descNameAndHelp(m.Desc())
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, ok := described[name]; !ok {
+			errs = append(errs, fmt.Errorf("collected metric with undescribed descriptor %s", m.Desc()))
+		}
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		series := name + pb.String()
+		if collected[series] {
+			errs = append(errs, fmt.Errorf("collected metric %s collected before", series))
+		}
+		collected[series] = true
+	}
+	return errs
+}
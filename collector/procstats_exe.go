@@ -0,0 +1,118 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// deletedSuffix is appended by the kernel to the /proc/$PID/exe target of
+// processes whose executable has been deleted or replaced.
+const deletedSuffix = " (deleted)"
+
+var executableHash = flag.Bool("collector.procstats.executable-hash", false,
+	"Add the SHA-256 of the executable of each process as exe_sha256 label to node_process_info and expose node_process_binary_hash_changed.")
+
+// binaryHash is the cached hash of the executable of a process.
+type binaryHash struct {
+	pid     int
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+// getProcessBinaryHash returns the hex encoded SHA-256 of the executable of
+// the given process. The executable is read through /proc/$PID/exe, which
+// also works if it has been deleted or is in another mount namespace.
+func getProcessBinaryHash(procRoot string, pid int) (string, error) {
+	exe := processFilePath(procRoot, pid, "exe")
+	// Reading the link fails without permission to inspect the process,
+	// which gives a clearer error than opening it.
+	if _, err := os.Readlink(exe); err != nil {
+		return "", err
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// binaryHash returns the hash of the executable of the process and whether
+// it differs from the hash at the previous scrape. The executable is only
+// read again if the PID, its size or its modification time changed.
+func (c *procstatsCollector) binaryHash(procName string, pid int) (string, bool, error) {
+	fi, err := os.Stat(processFilePath(c.procRoot, pid, "exe"))
+	if err != nil {
+		return "", false, err
+	}
+
+	c.mtx.Lock()
+	last, ok := c.binaryHashes[procName]
+	c.mtx.Unlock()
+
+	current := binaryHash{pid: pid, size: fi.Size(), modTime: fi.ModTime(), hash: last.hash}
+	if !ok || current.pid != last.pid || current.size != last.size || !current.modTime.Equal(last.modTime) {
+		if current.hash, err = getProcessBinaryHash(c.procRoot, pid); err != nil {
+			return "", false, err
+		}
+	}
+
+	c.mtx.Lock()
+	c.binaryHashes[procName] = current
+	c.mtx.Unlock()
+	return current.hash, ok && current.hash != last.hash, nil
+}
+
+// getProcessBinaryStale returns whether the executable of the given process
+// has been deleted or replaced on disk since the process started, i.e. the
+// process runs code that is no longer installed. The path is resolved in the
+// root directory of the process, so that processes in containers are
+// compared against their own filesystem.
+func getProcessBinaryStale(procRoot string, pid int) (bool, error) {
+	target, err := os.Readlink(processFilePath(procRoot, pid, "exe"))
+	if err != nil {
+		return false, err
+	}
+	if strings.HasSuffix(target, deletedSuffix) {
+		return true, nil
+	}
+	running, err := os.Stat(processFilePath(procRoot, pid, "exe"))
+	if err != nil {
+		return false, err
+	}
+	onDisk, err := os.Stat(processFilePath(procRoot, pid, path.Join("root", target)))
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !os.SameFile(running, onDisk), nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBinaryHash(t *testing.T) {
+	dir := t.TempDir()
+
+	binary := filepath.Join(dir, "hekad")
+	if err := ioutil.WriteFile(binary, []byte("hello world\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "1234"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(binary, filepath.Join(dir, "1234", "exe")); err != nil {
+		t.Fatal(err)
+	}
+	// sha256sum of "hello world\n".
+	const helloHash = "a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447"
+	hash, err := getProcessBinaryHash(dir, 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != helloHash {
+		t.Errorf("want hash %s, got %s", helloHash, hash)
+	}
+	if _, err := getProcessBinaryHash(dir, 4321); err == nil {
+		t.Error("want error for missing process, got none")
+	}
+
+	c := &procstatsCollector{procRoot: dir, binaryHashes: map[string]binaryHash{}}
+	if hash, changed, err := c.binaryHash("hekad", 1234); err != nil || hash != helloHash || changed {
+		t.Errorf("want %s, unchanged, got %s, %t, %v", helloHash, hash, changed, err)
+	}
+	if hash, changed, err := c.binaryHash("hekad", 1234); err != nil || hash != helloHash || changed {
+		t.Errorf("want %s, unchanged, got %s, %t, %v", helloHash, hash, changed, err)
+	}
+
+	// Replace the binary in place.
+	if err := ioutil.WriteFile(binary, []byte("tampered\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(binary, future, future); err != nil {
+		t.Fatal(err)
+	}
+	hash, changed, err := c.binaryHash("hekad", 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == helloHash || !changed {
+		t.Errorf("want a changed hash, got %s, %t", hash, changed)
+	}
+	if _, changed, _ := c.binaryHash("hekad", 1234); changed {
+		t.Error("want hash unchanged at the following scrape")
+	}
+}
+
+func TestGetProcessBinaryStale(t *testing.T) {
+	dir := t.TempDir()
+
+	binary := filepath.Join(dir, "bin", "hekad")
+	// upgraded is the executable at the same path as seen from the root of
+	// a process whose binary was replaced.
+	upgraded := filepath.Join(dir, "upgraded", binary)
+	for _, f := range []string{binary, upgraded} {
+		if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(f, []byte(f), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for pid, links := range map[string]map[string]string{
+		"1": {"exe": binary, "root": "/"},
+		"2": {"exe": binary, "root": filepath.Join(dir, "upgraded")},
+		"3": {"exe": binary + " (deleted)", "root": "/"},
+		"4": {"exe": binary, "root": filepath.Join(dir, "empty")},
+	} {
+		if err := os.Mkdir(filepath.Join(dir, pid), 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, target := range links {
+			if err := os.Symlink(target, filepath.Join(dir, pid, name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for pid, want := range map[int]bool{1: false, 2: true, 3: true, 4: true} {
+		stale, err := getProcessBinaryStale(dir, pid)
+		if err != nil {
+			t.Fatalf("PID %d: %s", pid, err)
+		}
+		if stale != want {
+			t.Errorf("PID %d: want stale %t, got %t", pid, want, stale)
+		}
+	}
+	if _, err := getProcessBinaryStale(dir, 5); err == nil {
+		t.Error("want error for missing process, got none")
+	}
+}
@@ -0,0 +1,438 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var fdRateAlpha = flag.Float64("collector.procstats.fd-rate-alpha", 0.3,
+	"Smoothing factor in (0, 1] of the exponential moving average of node_process_fd_growth_rate. Higher values follow changes faster.")
+
+// fdSample is the number of open file descriptors of a process at a scrape,
+// its change since the previous scrape and the smoothed growth rate up to it.
+type fdSample struct {
+	time     time.Time
+	pid      int
+	count    int
+	delta    int
+	hasDelta bool
+	rate     float64
+	hasRate  bool
+}
+
+// nextFDSample returns the sample of count file descriptors at now
+// following last. The growth rate since last is smoothed with an
+// exponential moving average, seeded with the first rate. There is no rate
+// without a previous sample of the same process and no delta either.
+func nextFDSample(last fdSample, ok bool, pid, count int, now time.Time, alpha float64) fdSample {
+	sample := fdSample{time: now, pid: pid, count: count}
+	if !ok || last.pid != pid {
+		return sample
+	}
+	sample.delta, sample.hasDelta = count-last.count, true
+	elapsed := now.Sub(last.time).Seconds()
+	if elapsed <= 0 {
+		return sample
+	}
+	sample.rate = smoothRate(float64(count-last.count)/elapsed, last.rate, last.hasRate, alpha)
+	sample.hasRate = true
+	return sample
+}
+
+// smoothRate returns the exponential moving average of rate following last
+// with the smoothing factor alpha, seeded with rate if there is no last.
+func smoothRate(rate, last float64, hasLast bool, alpha float64) float64 {
+	if !hasLast {
+		return rate
+	}
+	return alpha*rate + (1-alpha)*last
+}
+
+// processFD is an open file descriptor of a process.
+type processFD struct {
+	// path is the path of the file descriptor in /proc/$PID/fd.
+	path string
+	// target is the link target, e.g. "/dev/null" or "socket:[12345]".
+	target string
+}
+
+// getProcessFDs returns the open file descriptors of the given process.
+// File descriptors closed while reading are skipped.
+func getProcessFDs(procRoot string, pid int) ([]processFD, error) {
+	dir := processFilePath(procRoot, pid, "fd")
+	d, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	fds := make([]processFD, 0, len(names))
+	for _, name := range names {
+		fd := processFD{path: filepath.Join(dir, name)}
+		if fd.target, err = os.Readlink(fd.path); err != nil {
+			continue
+		}
+		fds = append(fds, fd)
+	}
+	return fds, nil
+}
+
+// countFDs returns the number of file descriptors whose target matches.
+func countFDs(fds []processFD, match func(target string) bool) int {
+	count := 0
+	for _, fd := range fds {
+		if match(fd.target) {
+			count++
+		}
+	}
+	return count
+}
+
+// fdClassification is the number of open file descriptors of a process by
+// type.
+type fdClassification struct {
+	total   int
+	devices int
+	memfds  int
+	pipes   int
+	mqueues int
+	epoll   int
+	inotify int
+}
+
+// classifyFDs returns the number of open file descriptors of the given
+// process by type, reading the descriptors only once.
+func classifyFDs(procRoot string, pid int) (fdClassification, error) {
+	fds, err := getProcessFDs(procRoot, pid)
+	if err != nil {
+		return fdClassification{}, err
+	}
+	return classifyFDTargets(fds), nil
+}
+
+// classifyFDTargets counts fds by the type of their target.
+func classifyFDTargets(fds []processFD) fdClassification {
+	isEpoll, isInotify := isAnonInodeFD("eventpoll"), isAnonInodeFD("inotify")
+	c := fdClassification{total: len(fds)}
+	for _, fd := range fds {
+		switch {
+		case isMqueueFD(fd.target):
+			c.mqueues++
+		case isDeviceFD(fd.target):
+			c.devices++
+		case isMemfdFD(fd.target):
+			c.memfds++
+		case isPipeFD(fd.target):
+			c.pipes++
+		case isEpoll(fd.target):
+			c.epoll++
+		case isInotify(fd.target):
+			c.inotify++
+		}
+	}
+	return c
+}
+
+func isDeviceFD(target string) bool {
+	return strings.HasPrefix(target, "/dev/")
+}
+
+func isMemfdFD(target string) bool {
+	return strings.HasPrefix(target, "memfd:")
+}
+
+func isPipeFD(target string) bool {
+	return strings.HasPrefix(target, "pipe:[")
+}
+
+// isMqueueFD returns whether the target is a POSIX message queue, shown as
+// mqueue:[<name>] or as a file of the mqueue filesystem mounted at
+// /dev/mqueue.
+func isMqueueFD(target string) bool {
+	return strings.HasPrefix(target, "mqueue:[") || strings.HasPrefix(target, "/dev/mqueue/")
+}
+
+// isAnonInodeFD returns a matcher for file descriptors of an anonymous inode
+// type like "eventpoll", "eventfd", "signalfd", "timerfd", "fanotify" or
+// "inotify". Most types are shown in brackets, e.g. anon_inode:[eventpoll],
+// but some without, e.g. anon_inode:inotify.
+func isAnonInodeFD(inodeType string) func(target string) bool {
+	return func(target string) bool {
+		return target == "anon_inode:"+inodeType || target == "anon_inode:["+inodeType+"]"
+	}
+}
+
+// getProcessAnonInodeCount returns the number of file descriptors of the
+// given process of an anonymous inode type, see isAnonInodeFD.
+func getProcessAnonInodeCount(procRoot string, pid int, inodeType string) (int, error) {
+	fds, err := getProcessFDs(procRoot, pid)
+	if err != nil {
+		return 0, err
+	}
+	return countFDs(fds, isAnonInodeFD(inodeType)), nil
+}
+
+// getProcessEpollFDCount returns the number of epoll file descriptors of the
+// given process.
+func getProcessEpollFDCount(procRoot string, pid int) (int, error) {
+	return getProcessAnonInodeCount(procRoot, pid, "eventpoll")
+}
+
+// getProcessInotifyFDCount returns the number of inotify instances of the
+// given process. The number of watches per instance isn't exposed by the
+// kernel without reading /proc/$PID/fdinfo of each instance.
+func getProcessInotifyFDCount(procRoot string, pid int) (int, error) {
+	return getProcessAnonInodeCount(procRoot, pid, "inotify")
+}
+
+// getInotifyLimit returns an inotify limit from /proc/sys/fs/inotify, e.g.
+// max_user_watches.
+func getInotifyLimit(procRoot string, name string) (int, error) {
+	content, err := ioutil.ReadFile(filepath.Join(procRoot, "sys/fs/inotify", name))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(content)))
+}
+
+// countInotifyInstances returns the number of inotify instances of all
+// processes whose file descriptors are readable.
+func countInotifyInstances(procRoot string, pids []int) int {
+	total := 0
+	for _, pid := range pids {
+		if count, err := getProcessInotifyFDCount(procRoot, pid); err == nil {
+			total += count
+		}
+	}
+	return total
+}
+
+// getProcessDeviceFDCount returns the number of file descriptors of the
+// given process that refer to files below /dev.
+func getProcessDeviceFDCount(procRoot string, pid int) (int, error) {
+	c, err := classifyFDs(procRoot, pid)
+	return c.devices, err
+}
+
+// getProcessMemfdCount returns the number of memfd_create(2) file
+// descriptors of the given process.
+func getProcessMemfdCount(procRoot string, pid int) (int, error) {
+	c, err := classifyFDs(procRoot, pid)
+	return c.memfds, err
+}
+
+// getProcessMqueueFDCount returns the number of POSIX message queue file
+// descriptors of the given process.
+func getProcessMqueueFDCount(procRoot string, pid int) (int, error) {
+	c, err := classifyFDs(procRoot, pid)
+	return c.mqueues, err
+}
+
+// getMqueueLimit returns a POSIX message queue limit from
+// /proc/sys/fs/mqueue, e.g. queues_max.
+func getMqueueLimit(procRoot string, name string) (int, error) {
+	content, err := ioutil.ReadFile(filepath.Join(procRoot, "sys/fs/mqueue", name))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(content)))
+}
+
+// getProcessPipeFDCount returns the number of pipe file descriptors of the
+// given process. Pipes piling up usually are inherited pipe ends that a
+// process spawning subprocesses fails to close.
+func getProcessPipeFDCount(procRoot string, pid int) (int, error) {
+	c, err := classifyFDs(procRoot, pid)
+	return c.pipes, err
+}
+
+// memfdBytes returns the total size of the memfds among fds. Stat'ing the
+// file descriptors requires the same privileges as reading the process
+// memory, so memfds that can't be stat'ed are an error.
+func memfdBytes(fds []processFD) (int64, error) {
+	var total int64
+	for _, fd := range fds {
+		if !isMemfdFD(fd.target) {
+			continue
+		}
+		fi, err := os.Stat(fd.path)
+		if os.IsNotExist(err) {
+			// Closed since the directory was read.
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		total += fi.Size()
+	}
+	return total, nil
+}
+
+// fdMetrics are the file descriptor metrics of the registered processes,
+// from /proc/$PID/fd and their limits.
+type fdMetrics struct {
+	metricVecs
+
+	openFDs           *prometheus.GaugeVec
+	openFDsDelta      *prometheus.GaugeVec
+	fdGrowthRate      *prometheus.GaugeVec
+	fdRatio           *prometheus.GaugeVec
+	openFDsSoftLimit  *prometheus.GaugeVec
+	openFDsHardLimit  *prometheus.GaugeVec
+	openDeviceFDs     *prometheus.GaugeVec
+	memfdCount        *prometheus.GaugeVec
+	memfdBytes        *prometheus.GaugeVec
+	pipeFDs           *prometheus.GaugeVec
+	mqueueFDs         *prometheus.GaugeVec
+	mqueueUtilization *prometheus.GaugeVec
+	epollFDs          *prometheus.GaugeVec
+	inotifyFDs        *prometheus.GaugeVec
+}
+
+// newFDMetrics returns the file descriptor metrics of processes with the
+// given label names.
+func newFDMetrics(labelNames []string) *fdMetrics {
+	m := &fdMetrics{
+		openFDs: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "open_fds",
+				Help:      "Number of open file descriptors of the process.",
+			}, labelNames),
+		openFDsDelta: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "open_fds_delta",
+				Help:      "Change of the number of open file descriptors of the process since the previous scrape.",
+			}, labelNames),
+		fdGrowthRate: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "fd_growth_rate",
+				Help:      "Growth of the number of open file descriptors of the process per second, smoothed with --collector.procstats.fd-rate-alpha.",
+			}, labelNames),
+		fdRatio: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "fd_ratio",
+				Help:      "Number of open file descriptors of the process relative to its soft limit, NaN if unlimited.",
+			}, labelNames),
+		openFDsSoftLimit: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "open_fds_soft_limit",
+				Help:      "Soft limit on the number of open file descriptors of the process.",
+			}, labelNames),
+		openFDsHardLimit: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "open_fds_hard_limit",
+				Help:      "Hard limit on the number of open file descriptors of the process.",
+			}, labelNames),
+		openDeviceFDs: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "open_device_fds",
+				Help:      "Number of open file descriptors of the process referring to files below /dev.",
+			}, labelNames),
+		memfdCount: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "memfd_count",
+				Help:      "Number of open memfd_create(2) file descriptors of the process.",
+			}, labelNames),
+		memfdBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "memfd_total_bytes",
+				Help:      "Total size of the open memfd_create(2) files of the process.",
+			}, labelNames),
+		pipeFDs: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "pipe_fd_count",
+				Help:      "Number of open pipe file descriptors of the process.",
+			}, labelNames),
+		mqueueFDs: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "mqueue_fd_count",
+				Help:      "Number of open POSIX message queue file descriptors of the process.",
+			}, labelNames),
+		mqueueUtilization: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "mqueue_utilization",
+				Help:      "Open POSIX message queue file descriptors of the process relative to the system wide limit of queues in /proc/sys/fs/mqueue/queues_max.",
+			}, labelNames),
+		epollFDs: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "epoll_fd_count",
+				Help:      "Number of open epoll file descriptors of the process.",
+			}, labelNames),
+		inotifyFDs: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "inotify_fds",
+				Help:      "Number of open inotify instances of the process.",
+			}, labelNames),
+	}
+	m.metricVecs = metricVecs{
+		m.openFDs,
+		m.openFDsDelta,
+		m.fdGrowthRate,
+		m.fdRatio,
+		m.openFDsSoftLimit,
+		m.openFDsHardLimit,
+		m.openDeviceFDs,
+		m.memfdCount,
+		m.memfdBytes,
+		m.pipeFDs,
+		m.mqueueFDs,
+		m.mqueueUtilization,
+		m.epollFDs,
+		m.inotifyFDs,
+	}
+	return m
+}
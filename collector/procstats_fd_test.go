@@ -0,0 +1,254 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// makeFDDir creates a procfs directory in dir for the given PID whose fd
+// directory holds symlinks to targets.
+func makeFDDir(t *testing.T, dir, pid string, targets []string) {
+	fdDir := filepath.Join(dir, pid, "fd")
+	if err := os.MkdirAll(fdDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i, target := range targets {
+		if err := os.Symlink(target, filepath.Join(fdDir, strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetProcessDeviceFDCount(t *testing.T) {
+	dir := t.TempDir()
+
+	regular := filepath.Join(dir, "data.log")
+	if err := ioutil.WriteFile(regular, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	makeFDDir(t, dir, "1234", []string{"/dev/null", "/dev/zero", regular, "socket:[12345]", "/devices"})
+
+	count, err := getProcessDeviceFDCount(dir, 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("want 2 device fds, got %d", count)
+	}
+
+	if _, err := getProcessDeviceFDCount(dir, 4321); err == nil {
+		t.Error("want error for missing process, got none")
+	}
+}
+
+func TestClassifyFDs(t *testing.T) {
+	dir := t.TempDir()
+
+	makeFDDir(t, dir, "1234", []string{"pipe:[2001]", "pipe:[2002]", "/dev/null", "memfd:jit", "socket:[1001]", "anon_inode:[eventpoll]", "anon_inode:inotify", "/tmp/pipe:[1]", "mqueue:[my_queue]"})
+
+	got, err := classifyFDs(dir, 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fdClassification{total: 9, devices: 1, memfds: 1, pipes: 2, epoll: 1, inotify: 1, mqueues: 1}
+	if got != want {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+
+	count, err := getProcessPipeFDCount(dir, 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("want 2 pipe fds, got %d", count)
+	}
+
+	if _, err := classifyFDs(dir, 4321); err == nil {
+		t.Error("want error for missing process, got none")
+	}
+}
+
+func TestGetProcessMqueueFDCount(t *testing.T) {
+	dir := t.TempDir()
+
+	makeFDDir(t, dir, "1234", []string{"mqueue:[my_queue]", "/dev/mqueue/jobs", "/dev/null", "/tmp/mqueue:[x]"})
+
+	count, err := getProcessMqueueFDCount(dir, 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("want 2 message queue fds, got %d", count)
+	}
+
+	limit, err := getMqueueLimit("fixtures/proc", "queues_max")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limit != 256 {
+		t.Errorf("want a queues_max of 256, got %d", limit)
+	}
+	if _, err := getMqueueLimit(dir, "queues_max"); err == nil {
+		t.Error("want error for missing limit, got none")
+	}
+}
+
+func TestGetProcessMemfdCount(t *testing.T) {
+	dir := t.TempDir()
+
+	makeFDDir(t, dir, "1234", []string{"memfd:wayland-shm (deleted)", "memfd:jit", "/dev/null", "anon_inode:[eventpoll]", "/memfd:x"})
+
+	count, err := getProcessMemfdCount(dir, 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("want 2 memfds, got %d", count)
+	}
+
+	// The relative link target of memfd:jit resolves to a file in the fd
+	// directory, the one of the deleted memfd doesn't resolve.
+	if err := ioutil.WriteFile(filepath.Join(dir, "1234", "fd", "memfd:jit"), make([]byte, 4096), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fds, err := getProcessFDs(dir, 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := memfdBytes(fds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 4096 {
+		t.Errorf("want 4096 memfd bytes, got %d", size)
+	}
+}
+
+func TestGetProcessAnonInodeCount(t *testing.T) {
+	dir := t.TempDir()
+
+	makeFDDir(t, dir, "1234", []string{
+		"anon_inode:[eventpoll]",
+		"anon_inode:[eventpoll]",
+		"anon_inode:[eventfd]",
+		"anon_inode:[timerfd]",
+		"anon_inode:inotify",
+		"socket:[12345]",
+		"/tmp/anon_inode:[eventpoll]",
+	})
+
+	count, err := getProcessEpollFDCount(dir, 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("want 2 epoll fds, got %d", count)
+	}
+
+	for inodeType, want := range map[string]int{
+		"eventfd":  1,
+		"timerfd":  1,
+		"inotify":  1,
+		"signalfd": 0,
+	} {
+		got, err := getProcessAnonInodeCount(dir, 1234, inodeType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("want %d %s fds, got %d", want, inodeType, got)
+		}
+	}
+}
+
+func TestInotify(t *testing.T) {
+	for name, want := range map[string]int{
+		"max_user_watches":   8192,
+		"max_user_instances": 128,
+	} {
+		got, err := getInotifyLimit("fixtures/proc", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("want %s %d, got %d", name, want, got)
+		}
+	}
+
+	dir := t.TempDir()
+
+	makeFDDir(t, dir, "1", []string{"anon_inode:inotify", "anon_inode:inotify", "/dev/null"})
+	makeFDDir(t, dir, "2", []string{"anon_inode:inotify", "anon_inode:[eventpoll]"})
+
+	count, err := getProcessInotifyFDCount(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("want 2 inotify fds, got %d", count)
+	}
+	// PID 3 doesn't exist and is skipped.
+	if want, got := 3, countInotifyInstances(dir, []int{1, 2, 3}); want != got {
+		t.Errorf("want %d inotify instances, got %d", want, got)
+	}
+}
+
+func TestNextFDSample(t *testing.T) {
+	start := time.Unix(1000, 0)
+	var (
+		last fdSample
+		ok   bool
+	)
+	for i, step := range []struct {
+		offset   time.Duration
+		pid      int
+		count    int
+		hasDelta bool
+		delta    int
+		hasRate  bool
+		rate     float64
+	}{
+		// No delta or rate without a previous sample.
+		{offset: 0, pid: 1234, count: 100},
+		// The first rate seeds the average: 20 FDs in 10s.
+		{offset: 10 * time.Second, pid: 1234, count: 120, hasDelta: true, delta: 20, hasRate: true, rate: 2},
+		// 0.3 * -1 + 0.7 * 2 after 10 FDs were closed in 10s.
+		{offset: 20 * time.Second, pid: 1234, count: 110, hasDelta: true, delta: -10, hasRate: true, rate: 1.1},
+		// 0.3 * 4 + 0.7 * 1.1 after 20 more FDs in 5s.
+		{offset: 25 * time.Second, pid: 1234, count: 130, hasDelta: true, delta: 20, hasRate: true, rate: 1.97},
+		// A delta but no rate without time passing.
+		{offset: 25 * time.Second, pid: 1234, count: 131, hasDelta: true, delta: 1},
+		// A restart starts over.
+		{offset: 30 * time.Second, pid: 4321, count: 10},
+	} {
+		sample := nextFDSample(last, ok, step.pid, step.count, start.Add(step.offset), 0.3)
+		if sample.hasDelta != step.hasDelta || sample.delta != step.delta {
+			t.Errorf("%d. want delta %d (%t), got %d (%t)", i, step.delta, step.hasDelta, sample.delta, sample.hasDelta)
+		}
+		if sample.hasRate != step.hasRate {
+			t.Errorf("%d. want rate %t, got %t", i, step.hasRate, sample.hasRate)
+		}
+		if math.Abs(sample.rate-step.rate) > 1e-9 {
+			t.Errorf("%d. want rate %f, got %f", i, step.rate, sample.rate)
+		}
+		last, ok = sample, true
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+)
+
+// processFiles reads the files of /proc/$PID during a single scrape. Several
+// metrics come from the same files, e.g. stat, status, fd and net/tcp, which
+// are read at most once per process and then served from memory. A
+// processFiles must not be kept across scrapes.
+type processFiles struct {
+	procRoot string
+
+	files    map[processFileKey]processFileRead
+	fds      map[int]processFDsRead
+	boot     float64
+	bootErr  error
+	bootRead bool
+}
+
+type processFileKey struct {
+	pid  int
+	name string
+}
+
+type processFileRead struct {
+	content []byte
+	err     error
+}
+
+type processFDsRead struct {
+	fds []processFD
+	err error
+}
+
+// newProcessFiles returns a processFiles reading the processes below
+// procRoot.
+func newProcessFiles(procRoot string) *processFiles {
+	return &processFiles{
+		procRoot: procRoot,
+		files:    map[processFileKey]processFileRead{},
+		fds:      map[int]processFDsRead{},
+	}
+}
+
+// read returns the contents of the file name of /proc/$PID of the given
+// process. The error of the first read, if any, is returned again.
+func (f *processFiles) read(pid int, name string) ([]byte, error) {
+	key := processFileKey{pid: pid, name: name}
+	r, ok := f.files[key]
+	if !ok {
+		r.content, r.err = ioutil.ReadFile(processFilePath(f.procRoot, pid, name))
+		f.files[key] = r
+	}
+	return r.content, r.err
+}
+
+// open returns a reader of the file name of /proc/$PID of the given
+// process.
+func (f *processFiles) open(pid int, name string) (io.Reader, error) {
+	content, err := f.read(pid, name)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(content), nil
+}
+
+// processFDs returns the open file descriptors of the given process.
+func (f *processFiles) processFDs(pid int) ([]processFD, error) {
+	r, ok := f.fds[pid]
+	if !ok {
+		r.fds, r.err = getProcessFDs(f.procRoot, pid)
+		f.fds[pid] = r
+	}
+	return r.fds, r.err
+}
+
+// stat returns the parsed /proc/$PID/stat of the given process.
+func (f *processFiles) stat(pid int) (processStat, error) {
+	r, err := f.open(pid, "stat")
+	if err != nil {
+		return processStat{}, err
+	}
+	return parseProcessStat(r)
+}
+
+// bootTime returns the system boot time in seconds since the Epoch.
+func (f *processFiles) bootTime() (float64, error) {
+	if !f.bootRead {
+		f.boot, f.bootErr = getBootTime(f.procRoot)
+		f.bootRead = true
+	}
+	return f.boot, f.bootErr
+}
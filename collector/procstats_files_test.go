@@ -0,0 +1,55 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProcessFilesReadOnce(t *testing.T) {
+	procRoot := t.TempDir()
+	writeTreeProcess(t, procRoot, 10, 1, 100, 50, 1000)
+	makeFDDir(t, procRoot, "10", []string{"/dev/null", "socket:[1001]"})
+
+	files := newProcessFiles(procRoot)
+	stat, err := files.stat(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := files.read(10, "missing"); !os.IsNotExist(err) {
+		t.Fatalf("want a not exist error, got %v", err)
+	}
+	if _, err := files.processFDs(10); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(procRoot, "10")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The files are served from memory once read.
+	if got, err := files.stat(10); err != nil || got != stat {
+		t.Errorf("want stat %+v, got %+v (%v)", stat, got, err)
+	}
+	if fds, err := files.processFDs(10); err != nil || len(fds) != 2 {
+		t.Errorf("want 2 fds, got %d (%v)", len(fds), err)
+	}
+	if _, err := files.read(10, "missing"); !os.IsNotExist(err) {
+		t.Errorf("want the not exist error again, got %v", err)
+	}
+	if _, err := newProcessFiles(procRoot).stat(10); err == nil {
+		t.Error("want an error reading a removed process, got none")
+	}
+}
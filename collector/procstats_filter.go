@@ -0,0 +1,92 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// processNames returns the names of all configured processes.
+func (c *procstatsCollector) processNames() []string {
+	names := append([]string{}, c.allRegisteredProcesses()...)
+	for _, m := range c.matchers {
+		names = append(names, m.name)
+	}
+	for _, s := range c.supervisors {
+		names = append(names, s.name)
+	}
+	for _, g := range c.pidFileGlobs {
+		names = append(names, g.name)
+	}
+	return names
+}
+
+// allRegisteredProcesses returns the registered processes followed by those
+// of the processes file and the discovered ones that aren't registered as
+// well.
+func (c *procstatsCollector) allRegisteredProcesses() []string {
+	listed := c.listed.names()
+	if c.discovery == nil && len(listed) == 0 {
+		return c.registeredProcessesList
+	}
+	processes := append([]string{}, c.registeredProcessesList...)
+	for _, name := range listed {
+		if !containsString(processes, name) {
+			processes = append(processes, name)
+		}
+	}
+	if c.discovery != nil {
+		for _, name := range c.discovery.names() {
+			if !containsString(processes, name) {
+				processes = append(processes, name)
+			}
+		}
+	}
+	return processes
+}
+
+// registeredProcesses returns the registered processes among names, or all
+// registered processes if names is nil.
+func (c *procstatsCollector) registeredProcesses(names map[string]bool) []string {
+	if names == nil {
+		return c.allRegisteredProcesses()
+	}
+	var processes []string
+	for _, name := range c.allRegisteredProcesses() {
+		if names[name] {
+			processes = append(processes, name)
+		}
+	}
+	return processes
+}
+
+// processFilter returns a transformation keeping the metrics of the named
+// processes.
+func processFilter(names map[string]bool) func(prometheus.Metric) []prometheus.Metric {
+	return func(m prometheus.Metric) []prometheus.Metric {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			return nil
+		}
+		for _, l := range pb.GetLabel() {
+			if l.GetName() == "name" && names[l.GetValue()] {
+				return []prometheus.Metric{m}
+			}
+		}
+		return nil
+	}
+}
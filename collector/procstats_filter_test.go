@@ -0,0 +1,93 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProcessFilterHandler(t *testing.T) {
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad", "nginx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewProcessFilterHandler(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A full collection first, so that the vectors hold the series of hekad.
+	collectProcStats(t, c)
+
+	get := func(query string) (int, string) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/processes"+query, nil))
+		body, err := ioutil.ReadAll(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, string(body)
+	}
+
+	code, body := get("?process=hekad,bogus")
+	if code != http.StatusOK {
+		t.Fatalf("want status %d, got %d", http.StatusOK, code)
+	}
+	for _, want := range []string{
+		"# Ignored unknown processes: bogus\n",
+		`node_process_pid{name="hekad"} 1234`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want %q in the response, got:\n%s", want, body)
+		}
+	}
+	for _, line := range strings.Split(body, "\n") {
+		if line != "" && !strings.HasPrefix(line, "#") && !strings.Contains(line, `name="hekad"`) {
+			t.Errorf("want only series of hekad, got %s", line)
+		}
+	}
+
+	if _, body := get("?process=nginx"); strings.Contains(body, "hekad") {
+		t.Errorf("want no series of hekad for nginx, got:\n%s", body)
+	}
+	if code, _ := get(""); code != http.StatusBadRequest {
+		t.Errorf("want status %d without processes, got %d", http.StatusBadRequest, code)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics/processes?process=hekad", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if want, got := OpenMetricsContentType, rec.Header().Get("Content-Type"); want != got {
+		t.Errorf("want content type %q, got %q", want, got)
+	}
+	body = rec.Body.String()
+	for _, want := range []string{
+		"# TYPE node_process_runqueue_wait_seconds counter\n# UNIT node_process_runqueue_wait_seconds seconds\n",
+		"# TYPE node_process_stack_bytes gauge\n# UNIT node_process_stack_bytes bytes\n",
+		"# TYPE node_process_mem_kilobytes gauge\n# UNIT node_process_mem_kilobytes kilobytes\n",
+		"# TYPE node_process_voluntary_context_switches counter\n# HELP",
+		`node_process_voluntary_context_switches_total{name="hekad"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want %q in the OpenMetrics response, got:\n%s", want, body)
+		}
+	}
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Errorf("want the OpenMetrics response to end with # EOF, got:\n%s", body)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import "testing"
+
+// TestProcFixture scrapes the process in fixtures/proc/1234 with the opt-in
+// reads enabled and checks the values against the content of its files.
+func TestProcFixture(t *testing.T) {
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad"}, func(o *ProcStatsOptions) {
+		o.CPUAffinityCores = 4
+		o.PerThreadRSS = true
+		o.PerThreadStates = true
+		o.Smaps = true
+		o.Sockets = true
+		o.Maps = true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := collectProcStats(t, c)
+
+	for series, want := range map[string]float64{
+		// stat and status.
+		`node_process_pid{name="hekad"}`:                                 1234,
+		`node_process_mem_kilobytes{name="hekad"}`:                       11708,
+		`node_process_voluntary_context_switches_total{name="hekad"}`:    1,
+		`node_process_nonvoluntary_context_switches_total{name="hekad"}`: 3,
+		`node_process_signals_pending_count{name="hekad"}`:               0,
+		`node_process_signals_caught_count{name="hekad"}`:                58,
+		`node_process_cpu_affinity{cpu="0",name="hekad"}`:                1,
+		`node_process_cpu_affinity{cpu="3",name="hekad"}`:                1,
+		`node_process_info{cgroup="/system.slice/hekad.service",container_id="",container_runtime="",cpu_affinity="ff",exe_sha256="",name="hekad",wchan="pipe_wait"}`: 1,
+		`node_process_kernel_blocked{name="hekad"}`: 0,
+		// CapEff 0000000000000000.
+		`node_process_capabilities_effective{name="hekad"}`:   0,
+		`node_process_has_capability_dangerous{name="hekad"}`: 0,
+		`node_process_setuid_active{name="hekad"}`:            0,
+		// task/*/status and task/*/stat.
+		`node_process_max_thread_rss_bytes{name="hekad"}`:    12940 * 1024,
+		`node_process_max_thread_tid{name="hekad"}`:          1235,
+		`node_process_threads_state{name="hekad",state="D"}`: 1,
+		`node_process_threads_state{name="hekad",state="Z"}`: 0,
+		// cmdline.
+		`node_process_cmdline_length_bytes{name="hekad"}`: 47,
+		`node_process_cmdline_truncated{name="hekad"}`:    0,
+		// fd and net.
+		`node_process_open_device_fds{name="hekad"}`:                          1,
+		`node_process_epoll_fd_count{name="hekad"}`:                           1,
+		`node_process_inotify_fds{name="hekad"}`:                              1,
+		`node_process_memfd_count{name="hekad"}`:                              0,
+		`node_process_connections_by_state{name="hekad",state="listen"}`:      1,
+		`node_process_connections_by_state{name="hekad",state="established"}`: 1,
+		`node_process_connections_by_state{name="hekad",state="close_wait"}`:  0,
+		`node_process_connections_by_state{name="hekad",state="time_wait"}`:   0,
+		`node_process_listening_ports_total{name="hekad"}`:                    1,
+		// limits.
+		`node_process_open_fds_soft_limit{name="hekad"}`: 1024,
+		`node_process_open_fds_hard_limit{name="hekad"}`: 4096,
+		// maps and smaps_rollup.
+		`node_process_mmap_file_count{name="hekad"}`:       9,
+		`node_process_mmap_unique_libraries{name="hekad"}`: 5,
+		`node_process_stack_bytes{name="hekad"}`:           136 * 1024,
+		`node_process_stack_utilization{name="hekad"}`:     136.0 * 1024 / 8388608,
+		`node_process_dirty_pages_bytes{name="hekad"}`:     5 * 1024 * 1024,
+		`node_process_pss_bytes{name="hekad"}`:             6342 * 1024,
+		`node_process_uss_bytes{name="hekad"}`:             4784 * 1024,
+		// schedstat.
+		`node_process_runqueue_wait_seconds_total{name="hekad"}`: 3.166250001,
+		// The first scrape of a process with a current PID file.
+		`node_process_pid_file_stale{name="hekad"}`: 0,
+		`node_process_collector_procfs_available`:   1,
+		`node_process_idle_seconds{name="hekad"}`:   0,
+		`node_process_hwm_reset{name="hekad"}`:      0,
+	} {
+		got, ok := metrics[series]
+		if !ok {
+			t.Errorf("%s: missing", series)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: want %f, got %f", series, want, got)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+const procstatsGoldenFile = "fixtures/procstats_expected.txt"
+
+var updateGolden = flag.Bool("update-golden", false, "Rewrite "+procstatsGoldenFile+" with the collected metrics.")
+
+// volatileMetrics depend on the time of the scrape or the age of the
+// checkout of the fixtures and are left out of the golden file.
+var volatileMetrics = map[string]bool{
+	"node_process_collection_slo_ratio":                    true,
+	"node_process_collector_last_scrape_timestamp_seconds": true,
+	"node_process_oldest_age_seconds":                      true,
+	"node_process_pid_file_stale":                          true,
+	"node_process_uptime_seconds":                          true,
+}
+
+func TestProcStatsCollectorGolden(t *testing.T) {
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad"}, func(o *ProcStatsOptions) {
+		o.SysRoot = "fixtures/sys"
+		o.Smaps = true
+		o.Sockets = true
+		o.Maps = true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan prometheus.Metric)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Update(ch)
+		close(ch)
+	}()
+	var metrics []prometheus.Metric
+	for m := range ch {
+		name, _, err := descNameAndHelp(m.Desc())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !volatileMetrics[name] {
+			metrics = append(metrics, m)
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	families, err := metricFamilies(metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	enc := expfmt.NewEncoder(&buf, expfmt.FmtText)
+	for _, mf := range families {
+		if err := enc.Encode(mf); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if *updateGolden {
+		if err := ioutil.WriteFile(procstatsGoldenFile, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(procstatsGoldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := lineDiff(string(want), buf.String()); diff != "" {
+		t.Errorf("metrics differ from %s, rerun with -update-golden if intended:\n%s", procstatsGoldenFile, diff)
+	}
+}
+
+// lineDiff returns the lines only in want prefixed with "-" and the lines
+// only in got prefixed with "+", or "" if both have the same lines.
+func lineDiff(want, got string) string {
+	count := map[string]int{}
+	for _, line := range strings.Split(want, "\n") {
+		count[line]++
+	}
+	for _, line := range strings.Split(got, "\n") {
+		count[line]--
+	}
+	var diff []string
+	for _, line := range strings.Split(want, "\n") {
+		if count[line] > 0 {
+			diff = append(diff, "-"+line)
+			count[line]--
+		}
+	}
+	for _, line := range strings.Split(got, "\n") {
+		if count[line] < 0 {
+			diff = append(diff, "+"+line)
+			count[line]++
+		}
+	}
+	return strings.Join(diff, "\n")
+}
@@ -0,0 +1,80 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"flag"
+	"sync"
+	"time"
+)
+
+var startupGrace = flag.Duration("collector.procstats.startup-grace", 0,
+	"Period after a process is first tracked during which it is not reported as down while it isn't found. Overridden by startup_grace in the config file.")
+
+// startupGraces tracks the startup grace periods of processes. The period
+// of a process starts at the first scrape tracking it, i.e. with the
+// exporter or when it is added to the configuration.
+type startupGraces struct {
+	periods       map[string]time.Duration
+	defaultPeriod time.Duration
+
+	mtx     sync.Mutex
+	tracked map[string]time.Time
+	seen    map[string]bool
+}
+
+func newStartupGraces(periods map[string]time.Duration, defaultPeriod time.Duration) *startupGraces {
+	return &startupGraces{
+		periods:       periods,
+		defaultPeriod: defaultPeriod,
+		tracked:       map[string]time.Time{},
+		seen:          map[string]bool{},
+	}
+}
+
+// unknown returns whether the named process hasn't been found yet within
+// its grace period at now, so it must not be reported as down. found is
+// whether the process was found at now.
+func (g *startupGraces) unknown(name string, found bool, now time.Time) bool {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	if found {
+		g.seen[name] = true
+	}
+	return g.within(name, now) && !g.seen[name]
+}
+
+// starting returns whether the named process is within its grace period at
+// now. Restarts within the period are part of its startup.
+func (g *startupGraces) starting(name string, now time.Time) bool {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.within(name, now)
+}
+
+func (g *startupGraces) within(name string, now time.Time) bool {
+	tracked, ok := g.tracked[name]
+	if !ok {
+		tracked = now
+		g.tracked[name] = now
+	}
+	period, ok := g.periods[name]
+	if !ok {
+		period = g.defaultPeriod
+	}
+	return now.Sub(tracked) < period
+}
@@ -0,0 +1,70 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStartupGraces(t *testing.T) {
+	g := newStartupGraces(map[string]time.Duration{"slow": 5 * time.Minute, "none": 0}, time.Minute)
+	start := time.Unix(1000, 0)
+
+	for i, step := range []struct {
+		name     string
+		found    bool
+		offset   time.Duration
+		unknown  bool
+		starting bool
+	}{
+		{name: "hekad", offset: 0, unknown: true, starting: true},
+		{name: "hekad", offset: 30 * time.Second, unknown: true, starting: true},
+		{name: "hekad", offset: 61 * time.Second, unknown: false, starting: false},
+		{name: "slow", offset: 0, unknown: true, starting: true},
+		{name: "slow", offset: 2 * time.Minute, found: true, unknown: false, starting: true},
+		// Once found, a missing process is down even within the period.
+		{name: "slow", offset: 3 * time.Minute, unknown: false, starting: true},
+		{name: "slow", offset: 5 * time.Minute, unknown: false, starting: false},
+		{name: "none", offset: 0, unknown: false, starting: false},
+	} {
+		now := start.Add(step.offset)
+		if got := g.unknown(step.name, step.found, now); got != step.unknown {
+			t.Errorf("%d. want unknown %t for %s, got %t", i, step.unknown, step.name, got)
+		}
+		if got := g.starting(step.name, now); got != step.starting {
+			t.Errorf("%d. want starting %t for %s, got %t", i, step.starting, step.name, got)
+		}
+	}
+}
+
+func TestProcStatsStartupGrace(t *testing.T) {
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad", "missing"}, func(o *ProcStatsOptions) {
+		o.StartupGrace = time.Hour
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := collectProcStats(t, c)
+	if want, got := 1.0, metrics[`node_process_startup_grace_active{name="missing"}`]; want != got {
+		t.Errorf("want startup_grace_active %f, got %f", want, got)
+	}
+	if _, ok := metrics[`node_process_startup_grace_active{name="hekad"}`]; ok {
+		t.Error("want no startup_grace_active for a found process, got one")
+	}
+	// The missing process is not counted as unresolved.
+	if want, got := 1.0, metrics["node_process_resolution_ratio"]; want != got {
+		t.Errorf("want resolution ratio %f, got %f", want, got)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import "time"
+
+// cpuActivity is the CPU time of a process at a scrape and the last scrape
+// it had changed at.
+type cpuActivity struct {
+	pid        int
+	ticks      uint64
+	lastActive time.Time
+}
+
+// nextCPUActivity returns the activity of a process with the given CPU time
+// in clock ticks at now following last, and the seconds since its CPU time
+// last changed. A process seen for the first time or restarted counts as
+// active at now.
+func nextCPUActivity(last cpuActivity, ok bool, pid int, ticks uint64, now time.Time) (cpuActivity, float64) {
+	if !ok || last.pid != pid || last.ticks != ticks {
+		return cpuActivity{pid: pid, ticks: ticks, lastActive: now}, 0
+	}
+	return last, now.Sub(last.lastActive).Seconds()
+}
@@ -0,0 +1,48 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextCPUActivity(t *testing.T) {
+	start := time.Unix(1500000000, 0)
+	var (
+		last cpuActivity
+		ok   bool
+	)
+	for i, step := range []struct {
+		pid   int
+		ticks uint64
+		after time.Duration
+		idle  float64
+	}{
+		{pid: 1234, ticks: 100, idle: 0},
+		{pid: 1234, ticks: 100, after: 15 * time.Second, idle: 15},
+		{pid: 1234, ticks: 100, after: 30 * time.Second, idle: 30},
+		{pid: 1234, ticks: 101, after: 45 * time.Second, idle: 0},
+		{pid: 1234, ticks: 101, after: 60 * time.Second, idle: 15},
+		// A restarted process with the same CPU time is active again.
+		{pid: 4321, ticks: 101, after: 75 * time.Second, idle: 0},
+	} {
+		var idle float64
+		last, idle = nextCPUActivity(last, ok, step.pid, step.ticks, start.Add(step.after))
+		ok = true
+		if idle != step.idle {
+			t.Errorf("%d: want idle %f, got %f", i, step.idle, idle)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var ioRateAlpha = flag.Float64("collector.procstats.io-rate-alpha", 0.3,
+	"Smoothing factor in (0, 1] of the exponential moving average of node_process_io_read_bytes_per_second and node_process_io_write_bytes_per_second. Higher values follow changes faster.")
+
+// ioPermissionOnce warns about the first /proc/$PID/io the exporter may not
+// read, the others are only logged at debug level.
+var ioPermissionOnce sync.Once
+
+// ioSample is the number of bytes a process has read from and written to
+// storage at a scrape and the smoothed rates up to it.
+type ioSample struct {
+	time       time.Time
+	pid        int
+	readBytes  uint64
+	writeBytes uint64
+	readRate   float64
+	writeRate  float64
+	hasRate    bool
+}
+
+// nextIOSample returns the sample of the given I/O bytes at now following
+// last, smoothing the rates like nextFDSample. There is no rate without a
+// previous sample of the same process. A counter lower than at last has
+// wrapped, its rate is 0 for that scrape.
+func nextIOSample(last ioSample, ok bool, pid int, readBytes, writeBytes uint64, now time.Time, alpha float64) ioSample {
+	sample := ioSample{time: now, pid: pid, readBytes: readBytes, writeBytes: writeBytes}
+	if !ok || last.pid != pid {
+		return sample
+	}
+	elapsed := now.Sub(last.time).Seconds()
+	if elapsed <= 0 {
+		return sample
+	}
+	sample.readRate = smoothRate(ioRate(last.readBytes, readBytes, elapsed), last.readRate, last.hasRate, alpha)
+	sample.writeRate = smoothRate(ioRate(last.writeBytes, writeBytes, elapsed), last.writeRate, last.hasRate, alpha)
+	sample.hasRate = true
+	return sample
+}
+
+func ioRate(last, current uint64, elapsed float64) float64 {
+	if current < last {
+		return 0
+	}
+	return float64(current-last) / elapsed
+}
+
+// getProcessIO returns the counters of /proc/$PID/io of the given process by
+// name, e.g. "rchar" or "read_bytes". Reading the file of another user's
+// process requires privileges.
+func getProcessIO(procRoot string, pid int) (map[string]uint64, error) {
+	f, err := os.Open(processFilePath(procRoot, pid, "io"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseProcessIO(f)
+}
+
+// parseProcessIO parses the "name: value" lines of /proc/$PID/io.
+func parseProcessIO(r io.Reader) (map[string]uint64, error) {
+	counters := map[string]uint64{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid line %q: %s", scanner.Text(), err)
+		}
+		counters[parts[0]] = v
+	}
+	return counters, scanner.Err()
+}
+
+// ioDirections maps the direction label of the I/O counters to the fields of
+// /proc/$PID/io: the bytes read from and written to storage, the bytes
+// passed to read(2) and write(2) like calls, including those served by the
+// page cache, and the number of those calls.
+var ioDirections = []struct {
+	direction string
+	bytes     string
+	chars     string
+	syscalls  string
+}{
+	{"read", "read_bytes", "rchar", "syscr"},
+	{"write", "write_bytes", "wchar", "syscw"},
+}
+
+// ioBytes returns read_bytes and write_bytes of the counters of
+// /proc/$PID/io.
+func ioBytes(counters map[string]uint64) (readBytes, writeBytes uint64, err error) {
+	readBytes, seenRead := counters["read_bytes"]
+	writeBytes, seenWrite := counters["write_bytes"]
+	if !seenRead || !seenWrite {
+		return 0, 0, fmt.Errorf("missing read_bytes or write_bytes")
+	}
+	return readBytes, writeBytes, nil
+}
+
+// ioMetrics are the I/O metrics of the registered processes, from
+// /proc/$PID/io.
+type ioMetrics struct {
+	metricVecs
+
+	bytes               *prometheus.CounterVec
+	chars               *prometheus.CounterVec
+	syscalls            *prometheus.CounterVec
+	cancelledWriteBytes *prometheus.CounterVec
+	readRate            *prometheus.GaugeVec
+	writeRate           *prometheus.GaugeVec
+}
+
+// newIOMetrics returns the I/O metrics of processes with the given label
+// names.
+func newIOMetrics(labelNames []string) *ioMetrics {
+	m := &ioMetrics{
+		bytes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "io_bytes_total",
+				Help:      "Bytes the process read from or wrote to storage by direction, from read_bytes and write_bytes of /proc/$PID/io.",
+			}, withLabelNames(labelNames, "direction")),
+		chars: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "io_chars_total",
+				Help:      "Bytes the process passed to read and write system calls by direction, from rchar and wchar of /proc/$PID/io.",
+			}, withLabelNames(labelNames, "direction")),
+		syscalls: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "io_syscalls_total",
+				Help:      "Number of read and write system calls of the process by direction, from syscr and syscw of /proc/$PID/io.",
+			}, withLabelNames(labelNames, "direction")),
+		cancelledWriteBytes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "io_cancelled_write_bytes_total",
+				Help:      "Bytes the process caused not to be written to storage by truncating dirty page cache, from cancelled_write_bytes of /proc/$PID/io.",
+			}, labelNames),
+		readRate: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "io_read_bytes_per_second",
+				Help:      "Bytes the process read from storage per second, smoothed with --collector.procstats.io-rate-alpha.",
+			}, labelNames),
+		writeRate: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "io_write_bytes_per_second",
+				Help:      "Bytes the process wrote to storage per second, smoothed with --collector.procstats.io-rate-alpha.",
+			}, labelNames),
+	}
+	m.metricVecs = metricVecs{
+		m.bytes,
+		m.chars,
+		m.syscalls,
+		m.cancelledWriteBytes,
+		m.readRate,
+		m.writeRate,
+	}
+	return m
+}
@@ -0,0 +1,105 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNextIOSample(t *testing.T) {
+	start := time.Unix(1000, 0)
+	var (
+		last ioSample
+		ok   bool
+	)
+	for i, test := range []struct {
+		pid                 int
+		read, write         uint64
+		after               time.Duration
+		hasRate             bool
+		readRate, writeRate float64
+	}{
+		// The first scrape has no rate.
+		{pid: 1, read: 1000, write: 0},
+		{pid: 1, read: 3000, write: 500, after: 10 * time.Second, hasRate: true, readRate: 200, writeRate: 50},
+		// 0.5*400 + 0.5*200 and 0.5*0 + 0.5*50.
+		{pid: 1, read: 7000, write: 500, after: 10 * time.Second, hasRate: true, readRate: 300, writeRate: 25},
+		// A wrapped counter has a rate of 0.
+		{pid: 1, read: 100, write: 1500, after: 10 * time.Second, hasRate: true, readRate: 150, writeRate: 62.5},
+		// A restart starts over.
+		{pid: 2, read: 100, write: 100, after: 10 * time.Second},
+	} {
+		now := start.Add(test.after)
+		last, ok = nextIOSample(last, ok, test.pid, test.read, test.write, now, 0.5), true
+		start = now
+		if last.hasRate != test.hasRate {
+			t.Errorf("%d: want rate %t, got %t", i, test.hasRate, last.hasRate)
+			continue
+		}
+		if !test.hasRate {
+			continue
+		}
+		if math.Abs(last.readRate-test.readRate) > 1e-9 || math.Abs(last.writeRate-test.writeRate) > 1e-9 {
+			t.Errorf("%d: want rates %g and %g, got %g and %g", i, test.readRate, test.writeRate, last.readRate, last.writeRate)
+		}
+	}
+}
+
+func TestGetProcessIOBytes(t *testing.T) {
+	counters, err := getProcessIO("fixtures/proc", 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counters["rchar"] != 750339 || counters["wchar"] != 818609 {
+		t.Errorf("want rchar 750339 and wchar 818609, got %d and %d", counters["rchar"], counters["wchar"])
+	}
+	read, write, err := ioBytes(counters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != 1024 || write != 2048 {
+		t.Errorf("want 1024 bytes read and 2048 written, got %d and %d", read, write)
+	}
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "1234"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "1234", "io"), []byte("rchar: 1\nread_bytes: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	counters, err = getProcessIO(dir, 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ioBytes(counters); err == nil {
+		t.Error("want error for missing write_bytes, got none")
+	}
+}
+
+func TestParseProcessIO(t *testing.T) {
+	for _, invalid := range []string{"read_bytes: x\n", "cancelled_write_bytes: -1\n"} {
+		if _, err := parseProcessIO(strings.NewReader(invalid)); err == nil {
+			t.Errorf("want error for %q, got none", invalid)
+		}
+	}
+}
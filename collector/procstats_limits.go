@@ -0,0 +1,118 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/log"
+)
+
+const (
+	limitOpenFiles = "Max open files"
+	limitStackSize = "Max stack size"
+
+	// stackUtilizationWarning is the stack utilization above which a
+	// warning is logged.
+	stackUtilizationWarning = 0.8
+)
+
+// limitsDelimiter separates the columns of /proc/$PID/limits. Limit names
+// contain single spaces, columns are padded with at least two.
+var limitsDelimiter = regexp.MustCompile("  +")
+
+// processLimit is a single resource limit of a process. Unlimited values
+// are represented as +Inf.
+type processLimit struct {
+	soft, hard float64
+}
+
+// getProcessLimits reads the resource limits of the given process from
+// /proc/$PID/limits, keyed by limit name (e.g. "Max open files").
+func getProcessLimits(procRoot string, pid int) (map[string]processLimit, error) {
+	f, err := os.Open(processFilePath(procRoot, pid, "limits"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseProcessLimits(f)
+}
+
+func parseProcessLimits(r io.Reader) (map[string]processLimit, error) {
+	limits := map[string]processLimit{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "Limit ") {
+			continue
+		}
+		fields := limitsDelimiter.Split(line, -1)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("invalid limits line %q", line)
+		}
+		soft, err := parseLimitValue(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid soft limit in line %q: %s", line, err)
+		}
+		hard, err := parseLimitValue(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid hard limit in line %q: %s", line, err)
+		}
+		limits[fields[0]] = processLimit{soft: soft, hard: hard}
+	}
+	return limits, scanner.Err()
+}
+
+func parseLimitValue(s string) (float64, error) {
+	if s == "unlimited" {
+		return math.Inf(1), nil
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return float64(v), nil
+}
+
+// fdRatio returns the number of open file descriptors of a process relative
+// to its soft limit on open files, or NaN if it is unlimited.
+func fdRatio(openFDs int, limit processLimit) float64 {
+	if math.IsInf(limit.soft, 1) || limit.soft <= 0 {
+		return math.NaN()
+	}
+	return float64(openFDs) / limit.soft
+}
+
+// stackUtilization returns the stack size of a process relative to its soft
+// stack size limit, or NaN if the stack is unlimited. A utilization above
+// stackUtilizationWarning is logged to logger.
+func stackUtilization(logger log.Logger, stackBytes float64, limit processLimit) float64 {
+	if math.IsInf(limit.soft, 1) || limit.soft <= 0 {
+		return math.NaN()
+	}
+	utilization := stackBytes / limit.soft
+	if utilization > stackUtilizationWarning {
+		logger.Warnf("The stack uses %.0f%% of its limit of %.0f bytes", utilization*100, limit.soft)
+	}
+	return utilization
+}
@@ -0,0 +1,92 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/prometheus/common/log"
+)
+
+func TestGetProcessLimits(t *testing.T) {
+	limits, err := getProcessLimits("fixtures/proc", 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]processLimit{
+		"Max open files":       {soft: 1024, hard: 4096},
+		"Max stack size":       {soft: 8388608, hard: math.Inf(1)},
+		"Max cpu time":         {soft: math.Inf(1), hard: math.Inf(1)},
+		"Max nice priority":    {soft: 0, hard: 0},
+		"Max realtime timeout": {soft: math.Inf(1), hard: math.Inf(1)},
+	} {
+		got, ok := limits[name]
+		if !ok {
+			t.Errorf("missing limit %q", name)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: want %+v, got %+v", name, want, got)
+		}
+	}
+}
+
+// recordingLogger records the warnings logged to it.
+type recordingLogger struct {
+	log.Logger
+	warnings []string
+}
+
+func (l *recordingLogger) Warnf(format string, args ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+func TestFDRatio(t *testing.T) {
+	if want, got := 0.25, fdRatio(256, processLimit{soft: 1024, hard: 4096}); want != got {
+		t.Errorf("want ratio %f, got %f", want, got)
+	}
+	if got := fdRatio(256, processLimit{soft: math.Inf(1), hard: math.Inf(1)}); !math.IsNaN(got) {
+		t.Errorf("want NaN for an unlimited process, got %f", got)
+	}
+}
+
+func TestStackUtilization(t *testing.T) {
+	for i, test := range []struct {
+		stack   float64
+		limit   processLimit
+		want    float64
+		warning bool
+	}{
+		{stack: 139264, limit: processLimit{soft: 8388608, hard: math.Inf(1)}, want: 139264.0 / 8388608},
+		{stack: 7340032, limit: processLimit{soft: 8388608, hard: 8388608}, want: 0.875, warning: true},
+		{stack: 6710886, limit: processLimit{soft: 8388608, hard: 8388608}, want: 6710886.0 / 8388608},
+		{stack: 139264, limit: processLimit{soft: math.Inf(1), hard: math.Inf(1)}, want: math.NaN()},
+	} {
+		logger := &recordingLogger{Logger: log.Base()}
+		got := stackUtilization(logger, test.stack, test.limit)
+		if math.IsNaN(test.want) {
+			if !math.IsNaN(got) {
+				t.Errorf("%d. want NaN, got %f", i, got)
+			}
+		} else if got != test.want {
+			t.Errorf("%d. want utilization %f, got %f", i, test.want, got)
+		}
+		if warned := len(logger.warnings) > 0; warned != test.warning {
+			t.Errorf("%d. want warning %t, got %q", i, test.warning, logger.warnings)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"bufio"
+	"flag"
+	"io"
+	"os"
+	"strings"
+)
+
+// deletedMappingSuffix marks mappings of files that were removed.
+const deletedMappingSuffix = " (deleted)"
+
+var (
+	mapsEnabled = flag.Bool("collector.procstats.maps", false,
+		"Expose the files and libraries memory-mapped by each process. Reads /proc/$PID/maps on each scrape, which has a line per mapping.")
+	libPathPrefixes = flag.String("collector.procstats.lib-path-prefixes", "/lib,/usr/lib,/usr/local/lib",
+		"Comma-separated list of directories whose mapped files are counted as libraries in node_process_mmap_unique_libraries.")
+)
+
+// getProcessMappedFiles returns the files mapped by the given process.
+func getProcessMappedFiles(procRoot string, pid int) (map[string]bool, error) {
+	f, err := os.Open(processFilePath(procRoot, pid, "maps"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseProcessMaps(f)
+}
+
+// parseProcessMaps returns the unique files mapped in a /proc/$PID/maps
+// file. Anonymous mappings, pseudo paths like [heap] or anon_inode:[...]
+// and mappings of deleted files are skipped.
+func parseProcessMaps(r io.Reader) (map[string]bool, error) {
+	files := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) < 6 {
+			continue
+		}
+		// File names may contain spaces.
+		file := strings.Join(parts[5:], " ")
+		if !strings.HasPrefix(file, "/") || strings.HasSuffix(file, deletedMappingSuffix) {
+			continue
+		}
+		files[file] = true
+	}
+	return files, scanner.Err()
+}
+
+// countLibraries returns the number of files below one of the directories
+// in prefixes.
+func countLibraries(files map[string]bool, prefixes []string) int {
+	n := 0
+	for file := range files {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(file, strings.TrimSuffix(prefix, "/")+"/") {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
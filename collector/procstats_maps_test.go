@@ -0,0 +1,66 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetProcessMappedFiles(t *testing.T) {
+	files, err := getProcessMappedFiles("fixtures/proc", 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{
+		"/usr/bin/hekad":                               true,
+		"/var/cache/hekad/buffer.dat":                  true,
+		"/lib/x86_64-linux-gnu/libc-2.23.so":           true,
+		"/lib/x86_64-linux-gnu/libpthread-2.23.so":     true,
+		"/usr/lib/x86_64-linux-gnu/libyaml-0.so.2.0.5": true,
+		"/usr/local/lib/libgeoip.so.1":                 true,
+		"/usr/share/zoneinfo/UTC":                      true,
+		"/library/libfake.so":                          true,
+		"/lib/x86_64-linux-gnu/ld-2.23.so":             true,
+	}
+	if !reflect.DeepEqual(want, files) {
+		t.Errorf("want mapped files %v, got %v", want, files)
+	}
+
+	if want, got := 5, countLibraries(files, []string{"/lib", "/usr/lib", "/usr/local/lib"}); want != got {
+		t.Errorf("want %d libraries, got %d", want, got)
+	}
+	if want, got := 1, countLibraries(files, []string{"/usr/local/lib/"}); want != got {
+		t.Errorf("want %d libraries with trailing slash, got %d", want, got)
+	}
+}
+
+func TestProcStatsMapsDisabled(t *testing.T) {
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := collectProcStats(t, c)
+	if _, ok := metrics[`node_process_up{name="hekad"}`]; !ok {
+		t.Fatal("want the process collected")
+	}
+	for _, series := range []string{
+		`node_process_mmap_file_count{name="hekad"}`,
+		`node_process_mmap_unique_libraries{name="hekad"}`,
+	} {
+		if _, ok := metrics[series]; ok {
+			t.Errorf("%s: want no series without --collector.procstats.maps", series)
+		}
+	}
+}
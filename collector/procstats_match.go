@@ -0,0 +1,317 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/model"
+)
+
+// defaultMaxMatchedSeries caps the processes a single regex entry reports
+// if max_series isn't configured.
+const defaultMaxMatchedSeries = 100
+
+// processStatMetrics are the stats exposed as const metrics, for processes
+// that are not tracked by procstatsCollector's metric vectors.
+type processStatMetrics []processStatMetric
+
+type processStatMetric struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	// value returns the stat and whether the status file had it.
+	value func(ProcessStats) (int, bool)
+}
+
+// newProcessStatMetrics returns the process stat metrics with the given
+// label names.
+func newProcessStatMetrics(labelNames []string) processStatMetrics {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(Namespace, processSubsystem, name), help, labelNames, nil)
+	}
+	return processStatMetrics{
+		{
+			desc("pid", "The PID of the process right now"), prometheus.GaugeValue,
+			func(s ProcessStats) (int, bool) { return s.PID, true },
+		},
+		{
+			desc("mem_kilobytes", "Resident memory size of the process in kilobytes (VmRSS)."), prometheus.GaugeValue,
+			func(s ProcessStats) (int, bool) { return s.VmRSS, s.Has("VmRSS") },
+		},
+		{
+			desc("voluntary_context_switches_total", "Number of voluntary context switches of the process."), prometheus.CounterValue,
+			func(s ProcessStats) (int, bool) { return s.VoluntaryCtxtSwitches, s.Has("voluntary_ctxt_switches") },
+		},
+		{
+			desc("nonvoluntary_context_switches_total", "Number of nonvoluntary context switches of the process."), prometheus.CounterValue,
+			func(s ProcessStats) (int, bool) {
+				return s.NonvoluntaryCtxtSwitches, s.Has("nonvoluntary_ctxt_switches")
+			},
+		},
+	}
+}
+
+// describe sends the descriptors of the metrics to ch.
+func (m processStatMetrics) describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range m {
+		ch <- metric.desc
+	}
+}
+
+// collect sends the metrics of stats with the given label values to ch.
+func (m processStatMetrics) collect(ch chan<- prometheus.Metric, stats ProcessStats, labelValues ...string) {
+	for _, metric := range m {
+		if value, ok := metric.value(stats); ok {
+			ch <- prometheus.MustNewConstMetric(metric.desc, metric.valueType, float64(value), labelValues...)
+		}
+	}
+}
+
+// compileProcessRegex compiles the comm or cmdline regex of a process
+// entry. The regex is anchored and each named capture group becomes a label.
+func compileProcessRegex(p processConfig) (re *regexp.Regexp, labelNames []string, err error) {
+	expr := p.CommRegex
+	if p.CmdlineRegex != "" {
+		expr = p.CmdlineRegex
+	}
+	re, err = regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, nil, err
+	}
+	seen := map[string]bool{}
+	for _, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, "__") {
+			return nil, nil, fmt.Errorf("capture group %q is not a valid label name", name)
+		}
+		if name == "name" {
+			return nil, nil, fmt.Errorf("capture group %q conflicts with the process label", name)
+		}
+		if seen[name] {
+			return nil, nil, fmt.Errorf("duplicate capture group %q", name)
+		}
+		seen[name] = true
+		labelNames = append(labelNames, name)
+	}
+	return re, labelNames, nil
+}
+
+// processMatcher discovers processes whose comm or cmdline matches a regex.
+type processMatcher struct {
+	name       string
+	cmdline    bool
+	re         *regexp.Regexp
+	labelNames []string
+	maxSeries  int
+	countOnly  bool
+	transform  *labelTransform
+	metrics    processStatMetrics
+	instances  *prometheus.Desc
+}
+
+func newProcessMatcher(p processConfig) (*processMatcher, error) {
+	re, labelNames, err := compileProcessRegex(p)
+	if err != nil {
+		return nil, err
+	}
+	m := &processMatcher{
+		name:       p.Name,
+		cmdline:    p.CmdlineRegex != "",
+		re:         re,
+		labelNames: labelNames,
+		maxSeries:  p.MaxSeries,
+		countOnly:  p.countOnly(),
+		metrics:    newProcessStatMetrics(append([]string{"name"}, labelNames...)),
+		instances: prometheus.NewDesc(prometheus.BuildFQName(Namespace, processSubsystem, "instances"),
+			"Number of running processes matching the regex.", []string{"name"}, nil),
+	}
+	if m.maxSeries == 0 {
+		m.maxSeries = defaultMaxMatchedSeries
+	}
+	if p.LabelTransform != nil {
+		if m.transform, err = newLabelTransform(p.LabelTransform); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// matchedProcess is a process found by a processMatcher.
+type matchedProcess struct {
+	pid         int
+	labelValues []string
+}
+
+// match returns the matching processes among pids, which must be sorted.
+// Processes with the same label values as a process with a lower PID are
+// skipped, as are processes exceeding the series limit.
+func (m *processMatcher) match(procRoot string, pids []int) []matchedProcess {
+	var (
+		matches []matchedProcess
+		seen    = map[string]bool{}
+		dropped int
+	)
+	for _, pid := range pids {
+		groups := m.matchProcess(procRoot, pid)
+		if groups == nil {
+			continue
+		}
+		values, err := m.labelValues(groups)
+		if err != nil {
+			processLogger(m.name, pid).Debugf("Skipping process: %s", err)
+			continue
+		}
+		key := strings.Join(values, "\x00")
+		if seen[key] {
+			processLogger(m.name, pid).Debugf("Skipping process, its labels %q are already used by another process", values)
+			continue
+		}
+		if len(matches) >= m.maxSeries {
+			dropped++
+			continue
+		}
+		seen[key] = true
+		matches = append(matches, matchedProcess{pid: pid, labelValues: values})
+	}
+	if dropped > 0 {
+		log.Warnf("Dropped %d processes of %s exceeding the limit of %d series", dropped, m.name, m.maxSeries)
+	}
+	return matches
+}
+
+// labelValues returns the values of the process label and of the capture
+// group labels for the submatches of a process, normalized by the label
+// transform of the entry.
+func (m *processMatcher) labelValues(groups []string) ([]string, error) {
+	values := []string{m.name}
+	for i, name := range m.re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		value := groups[i]
+		if m.transform != nil {
+			var err error
+			if value, err = m.transform.apply(value); err != nil {
+				return nil, err
+			}
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// matchProcess returns the submatches of the regex in the comm or cmdline of
+// the given process, or nil if it doesn't match.
+func (m *processMatcher) matchProcess(procRoot string, pid int) []string {
+	var (
+		s   string
+		err error
+	)
+	if m.cmdline {
+		s, err = getProcessCmdline(procRoot, pid)
+	} else {
+		s, err = getProcessComm(procRoot, pid)
+	}
+	if err != nil {
+		// The process may have exited since procfs was listed.
+		return nil
+	}
+	return m.re.FindStringSubmatch(s)
+}
+
+// collect sends the stats of the matching processes to ch and returns their
+// PIDs. In count-only mode it only sends the number of matching processes,
+// without reading any further files of them, and returns no PIDs.
+func (m *processMatcher) collect(procRoot string, pids []int, ch chan<- prometheus.Metric) []int {
+	if m.countOnly {
+		n := 0
+		for _, pid := range pids {
+			if m.matchProcess(procRoot, pid) != nil {
+				n++
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(m.instances, prometheus.GaugeValue, float64(n), m.name)
+		return nil
+	}
+	var matched []int
+	for _, p := range m.match(procRoot, pids) {
+		matched = append(matched, p.pid)
+		f, err := os.Open(processFilePath(procRoot, p.pid, "status"))
+		if err != nil {
+			continue
+		}
+		stats, err := parseProcessStats(f, p.pid)
+		f.Close()
+		if err != nil {
+			processLogger(m.name, p.pid).Errorf("Unable to parse the process statistics: %s", err)
+			continue
+		}
+		m.metrics.collect(ch, stats, p.labelValues...)
+	}
+	return matched
+}
+
+// listPIDs returns the sorted PIDs of all processes in procfs.
+func listPIDs(procRoot string) ([]int, error) {
+	entries, err := ioutil.ReadDir(procRoot)
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, e := range entries {
+		if pid, err := strconv.Atoi(e.Name()); err == nil && e.IsDir() {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	return pids, nil
+}
+
+// getProcessComm returns the command name of the given process.
+func getProcessComm(procRoot string, pid int) (string, error) {
+	comm, err := ioutil.ReadFile(processFilePath(procRoot, pid, "comm"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(comm)), nil
+}
+
+// getProcessCmdline returns the command line of the given process with its
+// arguments separated by spaces.
+func getProcessCmdline(procRoot string, pid int) (string, error) {
+	cmdline, err := ioutil.ReadFile(processFilePath(procRoot, pid, "cmdline"))
+	if err != nil {
+		return "", err
+	}
+	return formatCmdline(cmdline), nil
+}
+
+// formatCmdline returns the contents of /proc/$PID/cmdline with its
+// arguments separated by spaces.
+func formatCmdline(cmdline []byte) string {
+	return string(bytes.TrimSpace(bytes.Replace(cmdline, []byte{0}, []byte{' '}, -1)))
+}
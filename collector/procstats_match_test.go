@@ -0,0 +1,130 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestProcessMatcher(t *testing.T) {
+	pids, err := listPIDs("fixtures/proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1234}; !reflect.DeepEqual(want, pids) {
+		t.Fatalf("want PIDs %v, got %v", want, pids)
+	}
+
+	m, err := newProcessMatcher(processConfig{
+		Name:         "heka",
+		CmdlineRegex: `\S+ -config=/etc/heka/(?P<role>\w+)-(?P<shard>\d+)\.toml`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"role", "shard"}; !reflect.DeepEqual(want, m.labelNames) {
+		t.Errorf("want label names %v, got %v", want, m.labelNames)
+	}
+	want := []matchedProcess{{pid: 1234, labelValues: []string{"heka", "ingest", "3"}}}
+	if got := m.match("fixtures/proc", pids); !reflect.DeepEqual(want, got) {
+		t.Errorf("want matches %+v, got %+v", want, got)
+	}
+
+	// The label transform normalizes the captured values.
+	m, err = newProcessMatcher(processConfig{
+		Name:         "heka",
+		CmdlineRegex: `(?P<binary>\S+) -config=(?P<config>\S+)`,
+		LabelTransform: &labelTransformConfig{
+			TrimPrefix:  "/usr/bin/",
+			Regex:       `^/etc/heka/(\w+)-\d+\.toml$`,
+			Replacement: "$1",
+			Lowercase:   true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []matchedProcess{{pid: 1234, labelValues: []string{"heka", "hekad", "ingest"}}}
+	if got := m.match("fixtures/proc", pids); !reflect.DeepEqual(want, got) {
+		t.Errorf("want transformed matches %+v, got %+v", want, got)
+	}
+
+	// The regex is anchored.
+	m, err = newProcessMatcher(processConfig{Name: "heka", CommRegex: "hek"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.match("fixtures/proc", pids); len(got) != 0 {
+		t.Errorf("want no matches, got %+v", got)
+	}
+}
+
+func TestProcessMatcherLimits(t *testing.T) {
+	dir := t.TempDir()
+
+	for pid, comm := range map[int]string{10: "worker-1", 11: "worker-1", 12: "worker-2", 13: "worker-3"} {
+		d := filepath.Join(dir, strconv.Itoa(pid))
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(d, "comm"), []byte(comm+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pids, err := listPIDs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := newProcessMatcher(processConfig{Name: "worker", CommRegex: `worker-(?P<shard>\d+)`, MaxSeries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []matchedProcess{
+		{pid: 10, labelValues: []string{"worker", "1"}},
+		{pid: 12, labelValues: []string{"worker", "2"}},
+	}
+	if got := m.match(dir, pids); !reflect.DeepEqual(want, got) {
+		t.Errorf("want matches %+v, got %+v", want, got)
+	}
+
+	// Count-only mode counts all matching processes regardless of their
+	// labels and the series limit.
+	m, err = newProcessMatcher(processConfig{Name: "worker", CommRegex: `worker-(?P<shard>\d+)`, MaxSeries: 2, Metrics: []string{"count"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan prometheus.Metric, 1)
+	if got := m.collect(dir, pids, ch); got != nil {
+		t.Errorf("want no PIDs in count-only mode, got %v", got)
+	}
+	close(ch)
+	var metrics []prometheus.Metric
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+	if len(metrics) != 1 {
+		t.Fatalf("want 1 metric, got %d", len(metrics))
+	}
+	if want, got := `node_process_instances{name="worker"} 4`, sampleString(t, metrics[0]); want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// memoryMetrics are the memory metrics of the registered processes, from
+// their status, maps, smaps_rollup, numa_maps and threads, and their
+// configured memory thresholds.
+type memoryMetrics struct {
+	metricVecs
+
+	hwmReset            *prometheus.GaugeVec
+	residentMemoryBytes *prometheus.GaugeVec
+	swapBytes           *prometheus.GaugeVec
+	swapRate            *prometheus.GaugeVec
+	stackBytes          *prometheus.GaugeVec
+	virtualMemoryBytes  *prometheus.GaugeVec
+	vmPeakToRSS         *prometheus.GaugeVec
+	stackUtilization    *prometheus.GaugeVec
+	dirtyPages          *prometheus.GaugeVec
+	pssBytes            *prometheus.GaugeVec
+	ussBytes            *prometheus.GaugeVec
+	mmapFileCount       *prometheus.GaugeVec
+	mmapUniqueLibraries *prometheus.GaugeVec
+	numaLocalPages      *prometheus.GaugeVec
+	numaRemotePages     *prometheus.GaugeVec
+	maxThreadRSS        *prometheus.GaugeVec
+	maxThreadTID        *prometheus.GaugeVec
+	thresholdBreached   *prometheus.GaugeVec
+	thresholdBreaches   *prometheus.CounterVec
+	resourcePressure    *prometheus.GaugeVec
+}
+
+// newMemoryMetrics returns the memory metrics of processes with the given
+// label names.
+func newMemoryMetrics(labelNames []string) *memoryMetrics {
+	m := &memoryMetrics{
+		hwmReset: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "hwm_reset",
+				Help:      "Whether the peak resident memory (VmHWM) of the process decreased since the previous scrape, which indicates a restart.",
+			}, labelNames),
+		residentMemoryBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "rss_bytes",
+				Help:      "Resident memory of the process in bytes by type, anonymous, file-backed or shared memory, from RssAnon, RssFile and RssShmem of /proc/$PID/status.",
+			}, withLabelNames(labelNames, "type")),
+		swapBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "swap_bytes",
+				Help:      "Swapped out memory of the process in bytes (VmSwap).",
+			}, labelNames),
+		swapRate: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "swap_rate_bytes_per_second",
+				Help:      "Absolute change of the swapped out memory of the process (VmSwap) per second since the previous scrape.",
+			}, labelNames),
+		stackBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "stack_bytes",
+				Help:      "Size of the stack of the main thread of the process (VmStk).",
+			}, labelNames),
+		virtualMemoryBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "virtual_memory_bytes",
+				Help:      "Virtual memory size of the process in bytes (VmSize).",
+			}, labelNames),
+		vmPeakToRSS: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "vm_peak_to_rss_ratio",
+				Help:      "Peak virtual memory size of the process relative to its resident memory (VmPeak / VmRSS).",
+			}, labelNames),
+		stackUtilization: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "stack_utilization",
+				Help:      "Size of the stack of the process relative to its soft stack size limit, NaN if unlimited.",
+			}, labelNames),
+		dirtyPages: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "dirty_pages_bytes",
+				Help:      "Size of the private and shared dirty pages of the process, from /proc/$PID/smaps_rollup.",
+			}, labelNames),
+		pssBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "pss_bytes",
+				Help:      "Proportional set size of the process, its resident memory with shared pages divided among the processes mapping them, from Pss of /proc/$PID/smaps_rollup.",
+			}, labelNames),
+		ussBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "uss_bytes",
+				Help:      "Unique set size of the process, the resident memory only it maps, from Private_Clean and Private_Dirty of /proc/$PID/smaps_rollup.",
+			}, labelNames),
+		mmapFileCount: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "mmap_file_count",
+				Help:      "Number of unique files memory-mapped by the process, from /proc/$PID/maps.",
+			}, labelNames),
+		mmapUniqueLibraries: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "mmap_unique_libraries",
+				Help:      "Number of unique files memory-mapped by the process below the library directories of --collector.procstats.lib-path-prefixes.",
+			}, labelNames),
+		numaLocalPages: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "numa_local_pages",
+				Help:      "Number of pages of the process on the NUMA node of its allowed CPUs.",
+			}, labelNames),
+		numaRemotePages: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "numa_remote_pages",
+				Help:      "Number of pages of the process on other NUMA nodes than the one of its allowed CPUs.",
+			}, labelNames),
+		maxThreadRSS: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "max_thread_rss_bytes",
+				Help:      "Highest resident memory of a thread of the process.",
+			}, labelNames),
+		maxThreadTID: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "max_thread_tid",
+				Help:      "TID of the thread of the process with the highest resident memory.",
+			}, labelNames),
+		thresholdBreached: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "memory_threshold_breached",
+				Help:      "Whether the memory of the process is beyond the threshold of the procstats config in the direction.",
+			}, withLabelNames(labelNames, "metric", "direction")),
+		thresholdBreaches: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "memory_threshold_breaches_total",
+				Help:      "Number of times the memory of the process went beyond the threshold of the procstats config in the direction.",
+			}, withLabelNames(labelNames, "metric", "direction")),
+		resourcePressure: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "resource_pressure",
+				Help:      "Sum of the CPU, memory and IO wait pressure of the process, each between 0 and 1. Values above 2 are critical.",
+			}, labelNames),
+	}
+	m.metricVecs = metricVecs{
+		m.hwmReset,
+		m.residentMemoryBytes,
+		m.swapBytes,
+		m.swapRate,
+		m.stackBytes,
+		m.virtualMemoryBytes,
+		m.vmPeakToRSS,
+		m.stackUtilization,
+		m.dirtyPages,
+		m.pssBytes,
+		m.ussBytes,
+		m.mmapFileCount,
+		m.mmapUniqueLibraries,
+		m.numaLocalPages,
+		m.numaRemotePages,
+		m.maxThreadRSS,
+		m.maxThreadTID,
+		m.thresholdBreached,
+		m.thresholdBreaches,
+		m.resourcePressure,
+	}
+	return m
+}
@@ -0,0 +1,228 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/model"
+)
+
+// Naming schemes of the procstats metrics.
+const (
+	// Only the legacy metric and label names.
+	namingLegacy = "legacy"
+	// Both the legacy and the current names. This doubles the number of
+	// renamed series and is only meant for the migration of dashboards and
+	// alerts.
+	namingMigration = "migration"
+	// Only the current metric and label names.
+	namingCurrent = "current"
+)
+
+var (
+	namingScheme = flag.String("collector.procstats.naming-scheme", namingLegacy,
+		"Metric and label names of the procstats collector: legacy, migration (legacy and current names side by side) or current.")
+	processLabelName = flag.String("collector.procstats.process-label", "process",
+		"Name of the label identifying the process in the current naming scheme. It replaces the legacy label \"name\".")
+)
+
+// metricRename describes the current name of a metric with a legacy name.
+type metricRename struct {
+	name  string
+	help  string
+	scale float64
+}
+
+// metricRenames maps legacy metric names to their current replacement.
+var metricRenames = map[string]metricRename{
+	"node_process_mem_kilobytes": {
+		name:  "node_process_resident_memory_bytes",
+		help:  "Resident memory size of the process in bytes.",
+		scale: 1024,
+	},
+}
+
+// metricRenamer translates metrics from the legacy to the current naming
+// scheme.
+type metricRenamer struct {
+	keepLegacy bool
+	labelName  string
+}
+
+// newMetricRenamer returns a metricRenamer for the naming flags, or nil if
+// only the legacy names are exposed.
+func newMetricRenamer() (*metricRenamer, error) {
+	if !model.LabelName(*processLabelName).IsValid() {
+		return nil, fmt.Errorf("invalid process label name %q", *processLabelName)
+	}
+	switch *namingScheme {
+	case namingLegacy:
+		return nil, nil
+	case namingMigration:
+		return &metricRenamer{keepLegacy: true, labelName: *processLabelName}, nil
+	case namingCurrent:
+		return &metricRenamer{labelName: *processLabelName}, nil
+	default:
+		return nil, fmt.Errorf("unknown naming scheme %q", *namingScheme)
+	}
+}
+
+// translate returns the metrics to expose for the legacy metric m.
+func (r *metricRenamer) translate(m prometheus.Metric) []prometheus.Metric {
+	current, err := r.rename(m)
+	if err != nil {
+		log.Errorf("Unable to rename metric %s: %s", m.Desc(), err)
+		return []prometheus.Metric{m}
+	}
+	if current == nil {
+		return []prometheus.Metric{m}
+	}
+	if r.keepLegacy {
+		return []prometheus.Metric{deprecate(m), current}
+	}
+	return []prometheus.Metric{current}
+}
+
+// describe returns the descriptors of the metrics translate returns for
+// the metrics of the legacy descriptor d.
+func (r *metricRenamer) describe(d *prometheus.Desc) []*prometheus.Desc {
+	legacyName, legacyHelp, err := descNameAndHelp(d)
+	if err != nil {
+		return []*prometheus.Desc{d}
+	}
+	legacyLabelNames, err := descLabelNames(d)
+	if err != nil {
+		return []*prometheus.Desc{d}
+	}
+
+	name, help := legacyName, legacyHelp
+	rename, renamed := metricRenames[legacyName]
+	if renamed {
+		name, help = rename.name, rename.help
+	}
+	labelNames := make([]string, 0, len(legacyLabelNames))
+	for _, labelName := range legacyLabelNames {
+		if labelName == "name" {
+			labelName = r.labelName
+			renamed = true
+		}
+		labelNames = append(labelNames, labelName)
+	}
+	if !renamed {
+		return []*prometheus.Desc{d}
+	}
+	current := prometheus.NewDesc(name, help, labelNames, nil)
+	if !r.keepLegacy {
+		return []*prometheus.Desc{current}
+	}
+	if rename, ok := metricRenames[legacyName]; ok {
+		d = prometheus.NewDesc(legacyName, fmt.Sprintf("DEPRECATED: use %s. %s", rename.name, legacyHelp), legacyLabelNames, nil)
+	}
+	return []*prometheus.Desc{d, current}
+}
+
+// deprecate returns the legacy metric m with its help text pointing to the
+// current name, if it has one. Metrics whose name stays the same keep their
+// help, it must not differ from that of the current series.
+func deprecate(m prometheus.Metric) prometheus.Metric {
+	name, help, err := descNameAndHelp(m.Desc())
+	if err != nil {
+		return m
+	}
+	rename, ok := metricRenames[name]
+	if !ok {
+		return m
+	}
+	pb := &dto.Metric{}
+	if err := m.Write(pb); err != nil {
+		return m
+	}
+	valueType, value, err := metricValue(pb)
+	if err != nil {
+		return m
+	}
+	var labelNames, labelValues []string
+	for _, l := range pb.GetLabel() {
+		labelNames = append(labelNames, l.GetName())
+		labelValues = append(labelValues, l.GetValue())
+	}
+	desc := prometheus.NewDesc(name, fmt.Sprintf("DEPRECATED: use %s. %s", rename.name, help), labelNames, nil)
+	deprecated, err := prometheus.NewConstMetric(desc, valueType, value, labelValues...)
+	if err != nil {
+		return m
+	}
+	return deprecated
+}
+
+// rename returns m under its current metric and label names, or nil if the
+// names of m didn't change.
+func (r *metricRenamer) rename(m prometheus.Metric) (prometheus.Metric, error) {
+	pb := &dto.Metric{}
+	if err := m.Write(pb); err != nil {
+		return nil, err
+	}
+	name, help, err := descNameAndHelp(m.Desc())
+	if err != nil {
+		return nil, err
+	}
+
+	renamed := false
+	scale := 1.0
+	if rename, ok := metricRenames[name]; ok {
+		name, help, scale = rename.name, rename.help, rename.scale
+		renamed = true
+	}
+	var labelNames, labelValues []string
+	for _, l := range pb.GetLabel() {
+		labelName := l.GetName()
+		if labelName == "name" {
+			labelName = r.labelName
+			renamed = true
+		}
+		labelNames = append(labelNames, labelName)
+		labelValues = append(labelValues, l.GetValue())
+	}
+	if !renamed {
+		return nil, nil
+	}
+
+	valueType, value, err := metricValue(pb)
+	if err != nil {
+		return nil, err
+	}
+	desc := prometheus.NewDesc(name, help, labelNames, nil)
+	return prometheus.NewConstMetric(desc, valueType, value*scale, labelValues...)
+}
+
+// metricValue returns the type and value of a gauge, counter or untyped
+// metric.
+func metricValue(pb *dto.Metric) (prometheus.ValueType, float64, error) {
+	switch {
+	case pb.Gauge != nil:
+		return prometheus.GaugeValue, pb.GetGauge().GetValue(), nil
+	case pb.Counter != nil:
+		return prometheus.CounterValue, pb.GetCounter().GetValue(), nil
+	case pb.Untyped != nil:
+		return prometheus.UntypedValue, pb.GetUntyped().GetValue(), nil
+	default:
+		return 0, 0, fmt.Errorf("unsupported metric type")
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMetricRenamer(t *testing.T) {
+	memDesc := prometheus.NewDesc("node_process_mem_kilobytes", "The memory consumed", []string{"name"}, nil)
+	ratioDesc := prometheus.NewDesc("node_process_resolution_ratio", "Ratio of resolved processes", nil, nil)
+	mem := prometheus.MustNewConstMetric(memDesc, prometheus.GaugeValue, 2, "hekad")
+	ratio := prometheus.MustNewConstMetric(ratioDesc, prometheus.GaugeValue, 1)
+
+	tests := []struct {
+		renamer *metricRenamer
+		want    []string
+	}{
+		{
+			renamer: &metricRenamer{keepLegacy: true, labelName: "process"},
+			want: []string{
+				`node_process_mem_kilobytes{name="hekad"} 2`,
+				`node_process_resident_memory_bytes{process="hekad"} 2048`,
+				`node_process_resolution_ratio 1`,
+			},
+		},
+		{
+			renamer: &metricRenamer{labelName: "process"},
+			want: []string{
+				`node_process_resident_memory_bytes{process="hekad"} 2048`,
+				`node_process_resolution_ratio 1`,
+			},
+		},
+	}
+	for i, test := range tests {
+		var got []string
+		for _, m := range append(test.renamer.translate(mem), test.renamer.translate(ratio)...) {
+			got = append(got, sampleString(t, m))
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(test.want, got) {
+			t.Errorf("%d. want %v, got %v", i, test.want, got)
+		}
+	}
+
+	for _, m := range (&metricRenamer{keepLegacy: true, labelName: "process"}).translate(mem) {
+		name, help, err := descNameAndHelp(m.Desc())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "Resident memory size of the process in bytes."
+		if name == "node_process_mem_kilobytes" {
+			want = "DEPRECATED: use node_process_resident_memory_bytes. The memory consumed"
+		}
+		if help != want {
+			t.Errorf("%s: want help %q, got %q", name, want, help)
+		}
+	}
+}
+
+// sampleString formats a gauge sample similar to the text format.
+func sampleString(t *testing.T, m prometheus.Metric) string {
+	pb := &dto.Metric{}
+	if err := m.Write(pb); err != nil {
+		t.Fatal(err)
+	}
+	name, _, err := descNameAndHelp(m.Desc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := name
+	for i, l := range pb.GetLabel() {
+		if i == 0 {
+			s += "{"
+		} else {
+			s += ","
+		}
+		s += l.GetName() + `="` + l.GetValue() + `"`
+		if i == len(pb.GetLabel())-1 {
+			s += "}"
+		}
+	}
+	return s + " " + formatFloat(pb.GetGauge().GetValue())
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
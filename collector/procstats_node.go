@@ -0,0 +1,121 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/model"
+)
+
+var (
+	nodeLabelName = flag.String("collector.procstats.node-label", "",
+		"Name of a label identifying this node added to all procstats metrics. Disabled if empty. Prometheus adds an instance label by itself, so this is only needed by consumers reading the metrics directly.")
+	nodeLabelValue = flag.String("collector.procstats.node-label-value", "",
+		"Value of the node label. Defaults to the hostname.")
+)
+
+// nodeLabeler adds a static label to metrics.
+type nodeLabeler struct {
+	name, value string
+}
+
+// newNodeLabeler returns a nodeLabeler of the label name and value, or nil if
+// name is empty. Without a value the hostname is used. reserved are the label
+// names already used by the procstats metrics.
+func newNodeLabeler(name, value string, reserved []string) (*nodeLabeler, error) {
+	if name == "" {
+		return nil, nil
+	}
+	if !model.LabelName(name).IsValid() {
+		return nil, fmt.Errorf("invalid node label name %q", name)
+	}
+	for _, r := range reserved {
+		if name == r {
+			return nil, fmt.Errorf("node label %q conflicts with a procstats label", r)
+		}
+	}
+	l := &nodeLabeler{name: name, value: value}
+	if l.value == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("couldn't determine the node label value: %s", err)
+		}
+		l.value = hostname
+	}
+	return l, nil
+}
+
+// label returns m with the node label added. Metrics that already have a
+// label of that name are returned unchanged.
+func (l *nodeLabeler) label(m prometheus.Metric) []prometheus.Metric {
+	labeled, err := l.addLabel(m)
+	if err != nil {
+		log.Errorf("Unable to add the node label to metric %s: %s", m.Desc(), err)
+		return []prometheus.Metric{m}
+	}
+	return []prometheus.Metric{labeled}
+}
+
+// describe returns the descriptor of the metrics label returns for the
+// metrics of d.
+func (l *nodeLabeler) describe(d *prometheus.Desc) *prometheus.Desc {
+	name, help, err := descNameAndHelp(d)
+	if err != nil {
+		return d
+	}
+	labelNames, err := descLabelNames(d)
+	if err != nil {
+		return d
+	}
+	for _, labelName := range labelNames {
+		if labelName == l.name {
+			return d
+		}
+	}
+	return prometheus.NewDesc(name, help, append([]string{l.name}, labelNames...), nil)
+}
+
+func (l *nodeLabeler) addLabel(m prometheus.Metric) (prometheus.Metric, error) {
+	pb := &dto.Metric{}
+	if err := m.Write(pb); err != nil {
+		return nil, err
+	}
+	name, help, err := descNameAndHelp(m.Desc())
+	if err != nil {
+		return nil, err
+	}
+	labelNames := []string{l.name}
+	labelValues := []string{l.value}
+	for _, lp := range pb.GetLabel() {
+		if lp.GetName() == l.name {
+			return m, nil
+		}
+		labelNames = append(labelNames, lp.GetName())
+		labelValues = append(labelValues, lp.GetValue())
+	}
+	valueType, value, err := metricValue(pb)
+	if err != nil {
+		return nil, err
+	}
+	desc := prometheus.NewDesc(name, help, labelNames, nil)
+	return prometheus.NewConstMetric(desc, valueType, value, labelValues...)
+}
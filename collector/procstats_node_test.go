@@ -0,0 +1,58 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNodeLabeler(t *testing.T) {
+	if l, err := newNodeLabeler("", "", nil); err != nil || l != nil {
+		t.Fatalf("want no labeler by default, got %v, %v", l, err)
+	}
+
+	l, err := newNodeLabeler("node", "", []string{"name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.value != hostname {
+		t.Errorf("want value %q, got %q", hostname, l.value)
+	}
+
+	if l, err = newNodeLabeler("node", "web1", []string{"name"}); err != nil {
+		t.Fatal(err)
+	}
+	desc := prometheus.NewDesc("node_process_pid", "The PID of the process right now", []string{"name"}, nil)
+	m := prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1234, "hekad")
+	labeled := l.label(m)
+	if len(labeled) != 1 {
+		t.Fatalf("want 1 metric, got %d", len(labeled))
+	}
+	if want, got := `node_process_pid{name="hekad",node="web1"} 1234`, sampleString(t, labeled[0]); want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	for _, name := range []string{"name", "0node"} {
+		if _, err := newNodeLabeler(name, "web1", []string{"name"}); err == nil {
+			t.Errorf("want error for node label %q, got none", name)
+		}
+	}
+}
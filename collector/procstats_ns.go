@@ -0,0 +1,195 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxRootSymlinks is the number of symlinks followed resolving a path inside
+// the root of a container, like the kernel's limit.
+const maxRootSymlinks = 40
+
+// getNamespaceInode returns the inode number identifying the namespace of
+// type nsType (e.g. "net" or "pid") the given process is in.
+func getNamespaceInode(procRoot string, pid int, nsType string) (uint64, error) {
+	target, err := os.Readlink(processFilePath(procRoot, pid, "ns/"+nsType))
+	if err != nil {
+		return 0, err
+	}
+	// The link target has the form <type>:[<inode>].
+	prefix := nsType + ":["
+	if !strings.HasPrefix(target, prefix) || !strings.HasSuffix(target, "]") {
+		return 0, fmt.Errorf("unexpected namespace link target %q", target)
+	}
+	return strconv.ParseUint(target[len(prefix):len(target)-1], 10, 64)
+}
+
+// namespaceResolver resolves the PID of a process running in the PID
+// namespace of a container. Its PID file is read inside the container
+// through /proc/$INITPID/root and the PID found there is translated to the
+// PID on the host, from which all other metrics are read.
+type namespaceResolver struct {
+	initPID int
+	pidFile string
+
+	mtx  sync.Mutex
+	last int
+}
+
+func newNamespaceResolver(p processConfig) *namespaceResolver {
+	r := &namespaceResolver{
+		initPID: p.Namespace.InitPID,
+		pidFile: p.Namespace.PIDFile,
+	}
+	if r.pidFile == "" {
+		r.pidFile = filepath.Join(defaultPIDFileDir, p.Name+".pid")
+	}
+	return r
+}
+
+// resolve returns the host PID of the process. The host PID of the previous
+// scrape is reused while it still is the same process of the namespace.
+func (r *namespaceResolver) resolve(procRoot string) (int, error) {
+	path, err := resolveInRoot(processFilePath(procRoot, r.initPID, "root"), r.pidFile)
+	if err != nil {
+		return 0, err
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	nsPID, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid PID file %s: %s", r.pidFile, err)
+	}
+	ns, err := getNamespaceInode(procRoot, r.initPID, "pid")
+	if err != nil {
+		return 0, err
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.last != 0 && inNamespace(procRoot, r.last, ns, nsPID) {
+		return r.last, nil
+	}
+	pids, err := listPIDs(procRoot)
+	if err != nil {
+		return 0, err
+	}
+	for _, pid := range pids {
+		if inNamespace(procRoot, pid, ns, nsPID) {
+			r.last = pid
+			return pid, nil
+		}
+	}
+	return 0, fmt.Errorf("no process with PID %d in the PID namespace of process %d", nsPID, r.initPID)
+}
+
+// inNamespace returns whether the process of the given host PID is the
+// process nsPID of the PID namespace ns.
+func inNamespace(procRoot string, pid int, ns uint64, nsPID int) bool {
+	if inode, err := getNamespaceInode(procRoot, pid, "pid"); err != nil || inode != ns {
+		return false
+	}
+	pids, err := getProcessNSPIDs(procRoot, pid)
+	return err == nil && pids[len(pids)-1] == nsPID
+}
+
+// getProcessNSPIDs returns the PIDs of the given process in the nested PID
+// namespaces it is in, from the host's to its own, from the NSpid line of
+// /proc/$PID/status. The line was added in Linux 4.1.
+func getProcessNSPIDs(procRoot string, pid int) ([]int, error) {
+	f, err := os.Open(processFilePath(procRoot, pid, "status"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) < 2 || parts[0] != "NSpid:" {
+			continue
+		}
+		pids := make([]int, 0, len(parts)-1)
+		for _, p := range parts[1:] {
+			id, err := strconv.Atoi(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid NSpid %q", scanner.Text())
+			}
+			pids = append(pids, id)
+		}
+		return pids, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no NSpid in the status of process %d", pid)
+}
+
+// resolveInRoot returns the path of the absolute path inside root, e.g. the
+// root of a container, resolving symlinks as the processes chrooted to it
+// would. Absolute links like /var/run -> /run and ".." stay inside root. The
+// last element of path doesn't need to exist.
+func resolveInRoot(root, path string) (string, error) {
+	resolved := "/"
+	parts := strings.Split(path, "/")
+	for links := 0; len(parts) > 0; {
+		part := parts[0]
+		parts = parts[1:]
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, part)
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if os.IsNotExist(err) && len(parts) == 0 {
+			// Left to the caller opening the path.
+			resolved = next
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > maxRootSymlinks {
+			return "", fmt.Errorf("too many symlinks resolving %s", path)
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			resolved = "/"
+		}
+		parts = append(strings.Split(target, "/"), parts...)
+	}
+	return filepath.Join(root, resolved), nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetNamespaceInode(t *testing.T) {
+	dir := t.TempDir()
+
+	nsDir := filepath.Join(dir, "1234", "ns")
+	if err := os.MkdirAll(nsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range map[string]string{
+		"net": "net:[4026531992]",
+		"pid": "pid:[4026531836]",
+		"uts": "garbage",
+	} {
+		if err := os.Symlink(target, filepath.Join(nsDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for nsType, want := range map[string]uint64{
+		"net": 4026531992,
+		"pid": 4026531836,
+	} {
+		got, err := getNamespaceInode(dir, 1234, nsType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("want %s namespace inode %d, got %d", nsType, want, got)
+		}
+	}
+
+	for _, nsType := range []string{"uts", "ipc"} {
+		if _, err := getNamespaceInode(dir, 1234, nsType); err == nil {
+			t.Errorf("want error for %s namespace, got none", nsType)
+		}
+	}
+}
+
+// fixtures/procns is a host procfs with the container init process 3000,
+// whose PID namespace holds the process 3007 as PID 7, and a host process 7.
+// The PID file /var/run/app.pid of the container is below the link /var/run
+// -> /run inside its root.
+func TestNamespaceResolver(t *testing.T) {
+	r := newNamespaceResolver(processConfig{Name: "app", Namespace: &namespaceConfig{InitPID: 3000}})
+	for i := 0; i < 2; i++ {
+		pid, err := r.resolve("fixtures/procns")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pid != 3007 {
+			t.Errorf("%d. want host PID 3007, got %d", i, pid)
+		}
+	}
+
+	for _, n := range []*namespaceConfig{
+		{InitPID: 3000, PIDFile: "/run/missing.pid"},
+		{InitPID: 3007, PIDFile: "/run/app.pid"},
+	} {
+		r := newNamespaceResolver(processConfig{Name: "app", Namespace: n})
+		if _, err := r.resolve("fixtures/procns"); err == nil {
+			t.Errorf("%+v: want error, got none", n)
+		}
+	}
+}
+
+func TestGetProcessNSPIDs(t *testing.T) {
+	pids, err := getProcessNSPIDs("fixtures/procns", 3007)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{3007, 7}; !reflect.DeepEqual(pids, want) {
+		t.Errorf("want NSpid %v, got %v", want, pids)
+	}
+}
+
+func TestResolveInRoot(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "run", "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "var"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for link, target := range map[string]string{
+		"var/run":  "/run",
+		"run/lock": "app",
+		"run/up":   "../..",
+		"loop":     "/loop",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for path, want := range map[string]string{
+		"/var/run/app.pid":        "/run/app.pid",
+		"/var/run/lock/app.pid":   "/run/app/app.pid",
+		"/run/up/../../etc":       "/etc",
+		"/var/run/up/var/run/app": "/run/app",
+	} {
+		got, err := resolveInRoot(root, path)
+		if err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		if got != filepath.Join(root, want) {
+			t.Errorf("%s: want %s, got %s", path, filepath.Join(root, want), got)
+		}
+	}
+
+	if _, err := resolveInRoot(root, "/loop/x"); err == nil {
+		t.Error("want error for a symlink loop, got none")
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var numaPages = flag.Bool("collector.procstats.numa", false,
+	"Expose the pages of each process on its local and on remote NUMA nodes. Reading /proc/$PID/numa_maps walks the page tables of the process.")
+
+// parseCPUList parses a CPU list like "0-3,8,10-11" as used in sysfs and
+// the Cpus_allowed_list of /proc/$PID/status.
+func parseCPUList(s string) ([]int, error) {
+	var cpus []int
+	for _, r := range strings.Split(strings.TrimSpace(s), ",") {
+		if r == "" {
+			continue
+		}
+		bounds := strings.SplitN(r, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU list %q: %s", s, err)
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, fmt.Errorf("invalid CPU list %q: %s", s, err)
+			}
+		}
+		if last < first {
+			return nil, fmt.Errorf("invalid CPU range %q in CPU list %q", r, s)
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// getNUMANodeCPUs returns the CPUs of each NUMA node of the sysfs at
+// sysRoot.
+func getNUMANodeCPUs(sysRoot string) (map[int][]int, error) {
+	dirs, err := filepath.Glob(filepath.Join(sysRoot, "devices/system/node/node[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	nodes := map[int][]int{}
+	for _, dir := range dirs {
+		node, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dir, "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+		if nodes[node], err = parseCPUList(string(content)); err != nil {
+			return nil, err
+		}
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no NUMA nodes found")
+	}
+	return nodes, nil
+}
+
+// getProcessAllowedCPUs returns the CPUs the given process may run on.
+func getProcessAllowedCPUs(files *processFiles, pid int) ([]int, error) {
+	f, err := files.open(pid, "status")
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) == 2 && parts[0] == "Cpus_allowed_list" {
+			return parseCPUList(parts[1])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("missing Cpus_allowed_list in %s", processFilePath(files.procRoot, pid, "status"))
+}
+
+// localNUMANode returns the NUMA node with most of the allowed CPUs. If
+// several nodes have as many, e.g. for processes not pinned to CPUs, there
+// is no local node.
+func localNUMANode(allowed []int, nodes map[int][]int) (int, error) {
+	isAllowed := map[int]bool{}
+	for _, cpu := range allowed {
+		isAllowed[cpu] = true
+	}
+	local, most, tied := -1, 0, false
+	for node, cpus := range nodes {
+		n := 0
+		for _, cpu := range cpus {
+			if isAllowed[cpu] {
+				n++
+			}
+		}
+		switch {
+		case n > most:
+			local, most, tied = node, n, false
+		case n == most && n > 0:
+			tied = true
+		}
+	}
+	if local < 0 || tied {
+		return 0, fmt.Errorf("the allowed CPUs don't belong to a single NUMA node")
+	}
+	return local, nil
+}
+
+// getProcessNUMAPages returns the pages of the given process on its local
+// NUMA node and on all other nodes.
+func getProcessNUMAPages(files *processFiles, pid int, nodes map[int][]int) (local, remote int64, err error) {
+	allowed, err := getProcessAllowedCPUs(files, pid)
+	if err != nil {
+		return 0, 0, err
+	}
+	localNode, err := localNUMANode(allowed, nodes)
+	if err != nil {
+		return 0, 0, err
+	}
+	f, err := files.open(pid, "numa_maps")
+	if err != nil {
+		return 0, 0, err
+	}
+	return parseNUMAMaps(f, localNode)
+}
+
+// parseNUMAMaps sums up the N<node>=<pages> fields of all mappings in a
+// numa_maps file, separately for localNode and all other nodes.
+func parseNUMAMaps(r io.Reader, localNode int) (local, remote int64, err error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		for _, field := range strings.Fields(scanner.Text()) {
+			if !strings.HasPrefix(field, "N") {
+				continue
+			}
+			parts := strings.SplitN(field[1:], "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			node, err := strconv.Atoi(parts[0])
+			if err != nil {
+				continue
+			}
+			pages, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return 0, 0, fmt.Errorf("invalid numa_maps field %q: %s", field, err)
+			}
+			if node == localNode {
+				local += pages
+			} else {
+				remote += pages
+			}
+		}
+	}
+	return local, remote, scanner.Err()
+}
@@ -0,0 +1,97 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseNUMAMaps(t *testing.T) {
+	for localNode, want := range map[int][2]int64{
+		0: {1745, 942},
+		1: {942, 1745},
+		2: {0, 2687},
+	} {
+		f, err := os.Open("fixtures/proc/1234/numa_maps")
+		if err != nil {
+			t.Fatal(err)
+		}
+		local, remote, err := parseNUMAMaps(f, localNode)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := [2]int64{local, remote}; want != got {
+			t.Errorf("node %d: want local and remote pages %v, got %v", localNode, want, got)
+		}
+	}
+}
+
+func TestLocalNUMANode(t *testing.T) {
+	nodes, err := getNUMANodeCPUs("fixtures/sys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[int][]int{0: {0, 1, 2, 3}, 1: {4, 5, 6, 7}}; !reflect.DeepEqual(want, nodes) {
+		t.Fatalf("want NUMA nodes %v, got %v", want, nodes)
+	}
+
+	for i, test := range []struct {
+		allowed []int
+		node    int
+		err     bool
+	}{
+		{allowed: []int{0, 1}, node: 0},
+		{allowed: []int{5}, node: 1},
+		{allowed: []int{3, 4, 5}, node: 1},
+		{allowed: []int{0, 1, 2, 3, 4, 5, 6, 7}, err: true},
+		{allowed: []int{8}, err: true},
+	} {
+		node, err := localNUMANode(test.allowed, nodes)
+		if test.err {
+			if err == nil {
+				t.Errorf("%d. want error, got node %d", i, node)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if node != test.node {
+			t.Errorf("%d. want node %d, got %d", i, test.node, node)
+		}
+	}
+
+	// The fixture process may run on all CPUs.
+	if _, _, err := getProcessNUMAPages(newProcessFiles("fixtures/proc"), 1234, nodes); err == nil {
+		t.Error("want error for a process spanning both nodes, got none")
+	}
+}
+
+func TestParseCPUList(t *testing.T) {
+	cpus, err := parseCPUList("0-2,8,10-11\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{0, 1, 2, 8, 10, 11}; !reflect.DeepEqual(want, cpus) {
+		t.Errorf("want CPUs %v, got %v", want, cpus)
+	}
+	for _, invalid := range []string{"a", "0-", "3-1"} {
+		if _, err := parseCPUList(invalid); err == nil {
+			t.Errorf("want error for CPU list %q, got none", invalid)
+		}
+	}
+}
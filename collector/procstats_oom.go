@@ -0,0 +1,40 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"fmt"
+)
+
+// getCgroupOOMKills returns the number of processes killed by the OOM killer
+// in the cgroup v2 cgroup of the given process, as reported in its
+// memory.events. cgroup v1 has no equivalent.
+func getCgroupOOMKills(files *processFiles, sysRoot string, pid int) (int64, error) {
+	cgroupPath, err := getProcessCgroupV2Path(files, pid)
+	if err != nil {
+		return 0, err
+	}
+	filename := cgroupV2FilePath(sysRoot, cgroupPath, "memory.events")
+	events, err := parseCgroupStatFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	kills, ok := events["oom_kill"]
+	if !ok {
+		return 0, fmt.Errorf("missing oom_kill in %s", filename)
+	}
+	return int64(kills), nil
+}
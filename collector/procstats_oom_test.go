@@ -0,0 +1,28 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+)
+
+func TestGetOOMKills(t *testing.T) {
+	kills, err := getCgroupOOMKills(newProcessFiles("fixtures/proc"), "fixtures/sys", 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(2); want != kills {
+		t.Errorf("want %d cgroup OOM kills, got %d", want, kills)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"flag"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// maxCommLength is the length comm is truncated to by the kernel
+// (TASK_COMM_LEN without the terminating null byte).
+const maxCommLength = 15
+
+var pidDivergence = flag.Bool("collector.procstats.pid-divergence", false,
+	"Expose the PID read from the PID file of each process and the PID of the process running under its name, to spot stale PID files.")
+
+// findProcessByComm returns the lowest PID among pids whose comm is name,
+// truncated like the kernel does.
+func findProcessByComm(procRoot string, pids []int, name string) (int, bool) {
+	if len(name) > maxCommLength {
+		name = name[:maxCommLength]
+	}
+	for _, pid := range pids {
+		if comm, err := getProcessComm(procRoot, pid); err == nil && comm == name {
+			return pid, true
+		}
+	}
+	return 0, false
+}
+
+// collectPIDDivergence sends the PIDs read from the PID files of the
+// processes and, where a process of the name is running, its PID to ch.
+func (c *procstatsCollector) collectPIDDivergence(pidFilePIDs map[string]int, ch chan<- prometheus.Metric) {
+	if len(pidFilePIDs) == 0 {
+		return
+	}
+	pids, err := listPIDs(c.procRoot)
+	if err != nil {
+		log.Errorf("Unable to list the processes: %s", err)
+	}
+	for procName, pid := range pidFilePIDs {
+		ch <- prometheus.MustNewConstMetric(c.pidFilePID, prometheus.GaugeValue, float64(pid), procName)
+		if running, ok := findProcessByComm(c.procRoot, pids, procName); ok {
+			ch <- prometheus.MustNewConstMetric(c.runningPID, prometheus.GaugeValue, float64(running), procName)
+		}
+	}
+}
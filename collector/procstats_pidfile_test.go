@@ -0,0 +1,64 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollectPIDDivergence(t *testing.T) {
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan prometheus.Metric, 10)
+	// The PID file of hekad is stale, the process now runs as 1234.
+	c.collectPIDDivergence(map[string]int{"hekad": 999, "missing": 5}, ch)
+	close(ch)
+
+	var got []string
+	for m := range ch {
+		got = append(got, sampleString(t, m))
+	}
+	sort.Strings(got)
+	want := []string{
+		`node_process_pidfile_pid{name="hekad"} 999`,
+		`node_process_pidfile_pid{name="missing"} 5`,
+		`node_process_running_pid{name="hekad"} 1234`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("want metrics %v, got %v", want, got)
+	}
+	for i := range want {
+		if want[i] != got[i] {
+			t.Errorf("want %s, got %s", want[i], got[i])
+		}
+	}
+}
+
+func TestFindProcessByComm(t *testing.T) {
+	if pid, ok := findProcessByComm("fixtures/proc", []int{1234}, "hekad"); !ok || pid != 1234 {
+		t.Errorf("want PID 1234, got %d (found %t)", pid, ok)
+	}
+	// Names longer than the comm are compared truncated.
+	if _, ok := findProcessByComm("fixtures/proc", []int{1234}, "hekad-with-a-long-name"); ok {
+		t.Error("want no process for a differing long name, got one")
+	}
+	if _, ok := findProcessByComm("fixtures/proc", []int{4321}, "hekad"); ok {
+		t.Error("want no process for a missing PID, got one")
+	}
+}
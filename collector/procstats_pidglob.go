@@ -0,0 +1,120 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// isPIDFileGlob returns whether the PID file path of a registered process
+// is a glob pattern.
+func isPIDFileGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// pidFileGlob reads the PIDs of the instances of a process from the PID
+// files matching a glob pattern, e.g. the workers of kamailio in
+// /var/run/kamailio*.pid. Like processes discovered by regex, each instance
+// is exposed with its own basic stats, labeled with the name of its PID
+// file without the .pid suffix.
+type pidFileGlob struct {
+	name    string
+	pattern string
+	metrics processStatMetrics
+}
+
+func newPIDFileGlob(name, pattern string) (*pidFileGlob, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	return &pidFileGlob{
+		name:    name,
+		pattern: pattern,
+		metrics: newProcessStatMetrics([]string{"name", "instance"}),
+	}, nil
+}
+
+// pidFileInstance is a PID file matching a pidFileGlob.
+type pidFileInstance struct {
+	name string
+	pid  int
+}
+
+// instances returns the instances of the PID files matching the pattern in
+// lexical order of their paths. An instance with the PID of an earlier one
+// is skipped, so a PID isn't counted twice.
+func (g *pidFileGlob) instances() ([]pidFileInstance, error) {
+	paths, err := filepath.Glob(g.pattern)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		instances []pidFileInstance
+		seen      = map[int]bool{}
+	)
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			// Removed since the glob was expanded.
+			continue
+		}
+		pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+		if err != nil {
+			processLogger(g.name, 0).With("path", path).Errorf("Failed to convert byte array to int while reading the PID. Cause: %s", err)
+			continue
+		}
+		if seen[pid] {
+			processLogger(g.name, pid).With("path", path).Debugf("Skipping PID file, its PID is already used by another instance")
+			continue
+		}
+		seen[pid] = true
+		instances = append(instances, pidFileInstance{name: strings.TrimSuffix(filepath.Base(path), ".pid"), pid: pid})
+	}
+	return instances, nil
+}
+
+// collect sends the stats of the running instances to ch and returns their
+// PIDs.
+func (g *pidFileGlob) collect(procRoot string, ch chan<- prometheus.Metric) []int {
+	instances, err := g.instances()
+	if err != nil {
+		processLogger(g.name, 0).Errorf("Unable to expand the PID files %s: %s", g.pattern, err)
+		return nil
+	}
+	var pids []int
+	for _, instance := range instances {
+		f, err := os.Open(processFilePath(procRoot, instance.pid, "status"))
+		if err != nil {
+			processLogger(g.name, instance.pid).Debugf("Unable to open the status of %s: %s", instance.name, err)
+			continue
+		}
+		stats, err := parseProcessStats(f, instance.pid)
+		f.Close()
+		if err != nil {
+			processLogger(g.name, instance.pid).Errorf("Unable to parse the process statistics: %s", err)
+			continue
+		}
+		pids = append(pids, instance.pid)
+		g.metrics.collect(ch, stats, g.name, instance.name)
+	}
+	return pids
+}
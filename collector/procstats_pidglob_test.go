@@ -0,0 +1,82 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPIDFileGlob(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		pids    []int
+		want    []string
+	}{
+		{
+			pattern: "fixtures/pidfiles/hekad*.pid",
+			pids:    []int{1234},
+			want:    []string{`node_process_mem_kilobytes{instance="hekad",name="test"} 11708`},
+		},
+		// kamailio-2 has the PID of kamailio-1, kamailio-3 isn't running.
+		{
+			pattern: "fixtures/pidfiles/kamailio*.pid",
+			pids:    []int{1234},
+			want:    []string{`node_process_mem_kilobytes{instance="kamailio-1",name="test"} 11708`},
+		},
+		{pattern: "fixtures/pidfiles/missing*.pid"},
+	} {
+		g, err := newPIDFileGlob("test", test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch := make(chan prometheus.Metric, 20)
+		if pids := g.collect("fixtures/proc", ch); !reflect.DeepEqual(test.pids, pids) {
+			t.Errorf("%s: want PIDs %v, got %v", test.pattern, test.pids, pids)
+		}
+		close(ch)
+		var got []string
+		for m := range ch {
+			if s := sampleString(t, m); strings.HasPrefix(s, "node_process_mem_kilobytes") {
+				got = append(got, s)
+			}
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(test.want, got) {
+			t.Errorf("%s: want %v, got %v", test.pattern, test.want, got)
+		}
+	}
+
+	g, err := newPIDFileGlob("test", "fixtures/pidfiles/kamailio*.pid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances, err := g.instances()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []pidFileInstance{{name: "kamailio-1", pid: 1234}, {name: "kamailio-3", pid: 4321}}; !reflect.DeepEqual(want, instances) {
+		t.Errorf("want instances %+v, got %+v", want, instances)
+	}
+
+	if _, err := newPIDFileGlob("test", "/var/run/[.pid"); err == nil {
+		t.Error("want error for invalid pattern, got none")
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pressureSample is the state of a process at a scrape, used to compute
+// its CPU and IO wait ratios at the next one.
+type pressureSample struct {
+	time      time.Time
+	startTime uint64
+	cpuTicks  uint64
+	ioTicks   uint64
+}
+
+// resourcePressure returns the sum of the CPU, memory and IO pressure of a
+// process, each clamped to [0, 1]. cpuRatio is the CPU time of the process
+// per wall clock time, ioWaitRatio its block IO wait time per wall clock
+// time.
+func resourcePressure(cpuRatio, rssBytes, availableBytes, ioWaitRatio float64) float64 {
+	clamp := func(v float64) float64 {
+		if math.IsNaN(v) || v < 0 {
+			return 0
+		}
+		return math.Min(v, 1)
+	}
+	var mem float64
+	if rssBytes+availableBytes > 0 {
+		mem = rssBytes / (rssBytes + availableBytes)
+	}
+	return clamp(cpuRatio) + clamp(mem) + clamp(ioWaitRatio)
+}
+
+// updateResourcePressure sets the resource pressure of the process. The
+// CPU and IO ratios are computed over the time since the previous scrape,
+// so nothing is set at the first scrape and after a restart.
+func (c *procstatsCollector) updateResourcePressure(files *processFiles, procName string, pid int, rssBytes float64, availableBytes float64, now time.Time) {
+	stat, err := files.stat(pid)
+	if err != nil {
+		processLogger(procName, pid).Debugf("Unable to read the stat: %s", err)
+		return
+	}
+	sample := pressureSample{
+		time:      now,
+		startTime: stat.StartTime,
+		cpuTicks:  stat.UTime + stat.STime,
+		ioTicks:   stat.DelayacctBlkioTicks,
+	}
+
+	c.mtx.Lock()
+	last, ok := c.lastPressure[procName]
+	c.lastPressure[procName] = sample
+	c.mtx.Unlock()
+
+	elapsed := sample.time.Sub(last.time).Seconds()
+	if !ok || last.startTime != sample.startTime || elapsed <= 0 ||
+		sample.cpuTicks < last.cpuTicks || sample.ioTicks < last.ioTicks {
+		c.memory.resourcePressure.DeleteLabelValues(c.processLabels(procName)...)
+		return
+	}
+	cpuRatio := float64(sample.cpuTicks-last.cpuTicks) / userHZ / elapsed
+	ioWaitRatio := float64(sample.ioTicks-last.ioTicks) / userHZ / elapsed
+	c.memory.resourcePressure.WithLabelValues(c.processLabels(procName)...).Set(resourcePressure(cpuRatio, rssBytes, availableBytes, ioWaitRatio))
+}
+
+// getMemAvailableBytes returns the memory available for starting new
+// applications. Kernels without MemAvailable fall back to the sum of free,
+// buffer and page cache memory.
+func getMemAvailableBytes(procRoot string) (float64, error) {
+	f, err := os.Open(filepath.Join(procRoot, "meminfo"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	fields := map[string]float64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) < 2 {
+			continue
+		}
+		v, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid meminfo line %q: %s", scanner.Text(), err)
+		}
+		fields[strings.TrimSuffix(parts[0], ":")] = v * 1024
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if v, ok := fields["MemAvailable"]; ok {
+		return v, nil
+	}
+	return fields["MemFree"] + fields["Buffers"] + fields["Cached"], nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"math"
+	"testing"
+)
+
+func TestResourcePressure(t *testing.T) {
+	for i, tt := range []struct {
+		cpu, rss, available, io float64
+		want                    float64
+	}{
+		{cpu: 0, rss: 0, available: 1024, io: 0, want: 0},
+		{cpu: 1, rss: 1024, available: 0, io: 1, want: 3},
+		// Multi-threaded processes can exceed one CPU, the components are
+		// capped nonetheless.
+		{cpu: 4, rss: 1024, available: 0, io: 2.5, want: 3},
+		{cpu: 0.5, rss: 1024, available: 3072, io: 0.25, want: 1},
+		{cpu: -1, rss: 0, available: 0, io: math.NaN(), want: 0},
+	} {
+		if got := resourcePressure(tt.cpu, tt.rss, tt.available, tt.io); got != tt.want {
+			t.Errorf("%d. want pressure %f, got %f", i, tt.want, got)
+		}
+	}
+}
+
+func TestGetMemAvailableBytes(t *testing.T) {
+	available, err := getMemAvailableBytes("fixtures/proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fixture lacks MemAvailable: MemFree + Buffers + Cached.
+	if want := float64(225472+22040+930888) * 1024; available != want {
+		t.Errorf("want available %f, got %f", want, available)
+	}
+}
+
+func TestProcStatsResourcePressure(t *testing.T) {
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const name = `node_process_resource_pressure{name="hekad"}`
+	if _, ok := collectProcStats(t, c)[name]; ok {
+		t.Errorf("unexpected %s at the first scrape", name)
+	}
+
+	// The fixture doesn't change between scrapes, so only the memory
+	// pressure remains.
+	rss := 11708.0 * 1024
+	available := float64(225472+22040+930888) * 1024
+	if want, got := rss/(rss+available), collectProcStats(t, c)[name]; want != got {
+		t.Errorf("want %s %f, got %f", name, want, got)
+	}
+}
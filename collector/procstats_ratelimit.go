@@ -0,0 +1,61 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"flag"
+	"time"
+)
+
+var minInterval = flag.Duration("collector.procstats.min-interval", time.Second,
+	"Minimum interval between two reads of the status of a process. Scrapes within the interval reuse the previous read, 0 reads on every scrape.")
+
+// rateLimitedCache is the last read of the status of a process. It is a
+// token bucket of one token, refilled once per interval: a crashlooping
+// process scraped every second is not read more often than that.
+type rateLimitedCache struct {
+	lastRead time.Time
+	fields   processStatusFields
+}
+
+// allow returns whether the status may be read again at now.
+func (r *rateLimitedCache) allow(now time.Time, interval time.Duration) bool {
+	return r.lastRead.IsZero() || now.Sub(r.lastRead) >= interval
+}
+
+// statusFields returns the status of the named process, read from the
+// given PID at most once per --collector.procstats.min-interval, and its
+// age, 0 unless it was cached. Within the interval the previous read is
+// returned, even if the process restarted meanwhile. Failed reads aren't
+// cached.
+func (c *procstatsCollector) statusFields(files *processFiles, procName string, pid int, now time.Time) (processStatusFields, time.Duration, error) {
+	c.mtx.Lock()
+	cache, ok := c.statusCaches[procName]
+	if ok && !cache.allow(now, c.minInterval) {
+		c.mtx.Unlock()
+		return cache.fields, now.Sub(cache.lastRead), nil
+	}
+	c.mtx.Unlock()
+
+	fields, err := getProcessStatusFields(files, pid)
+	if err != nil {
+		return processStatusFields{}, 0, err
+	}
+	c.mtx.Lock()
+	c.statusCaches[procName] = &rateLimitedCache{lastRead: now, fields: fields}
+	c.mtx.Unlock()
+	return fields, 0, nil
+}
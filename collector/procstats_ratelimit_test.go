@@ -0,0 +1,116 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedCacheAllow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	var r rateLimitedCache
+	if !r.allow(now, time.Second) {
+		t.Error("want the first read allowed")
+	}
+	r.lastRead = now
+	if r.allow(now.Add(500*time.Millisecond), time.Second) {
+		t.Error("want a read within the interval limited")
+	}
+	if !r.allow(now.Add(time.Second), time.Second) {
+		t.Error("want a read after the interval allowed")
+	}
+	if !r.allow(now, 0) {
+		t.Error("want every read allowed without an interval")
+	}
+}
+
+func TestStatusFieldsRateLimited(t *testing.T) {
+	dir := t.TempDir()
+	status, err := ioutil.ReadFile("fixtures/proc/1234/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "1234", "status")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, status, 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewTestProcStatsCollector(dir, []string{"hekad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	first, age, err := c.statusFields(newProcessFiles(c.procRoot), "hekad", 1234, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if age != 0 {
+		t.Errorf("want age 0 of a read status, got %s", age)
+	}
+	// The second read within the interval mustn't touch procfs.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	second, age, err := c.statusFields(newProcessFiles(c.procRoot), "hekad", 1234, now.Add(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first {
+		t.Errorf("want the cached status %+v, got %+v", first, second)
+	}
+	if age != time.Millisecond {
+		t.Errorf("want age %s of the cached status, got %s", time.Millisecond, age)
+	}
+
+	if _, _, err := c.statusFields(newProcessFiles(c.procRoot), "hekad", 1234, now.Add(c.minInterval)); err == nil {
+		t.Error("want error for a read after the interval, got none")
+	}
+}
+
+func TestProcStatsCacheAge(t *testing.T) {
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad"}, func(o *ProcStatsOptions) {
+		o.MinInterval = time.Hour
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 0.0, collectProcStats(t, c)["node_process_collector_cache_age_seconds"]; want != got {
+		t.Errorf("want cache age %f at the first scrape, got %f", want, got)
+	}
+	// The status read by the first scrape is reused.
+	time.Sleep(10 * time.Millisecond)
+	if got, ok := collectProcStats(t, c)["node_process_collector_cache_age_seconds"]; !ok || got < 0.01 || got >= 3600 {
+		t.Errorf("want the age of the status of the first scrape, got %f (exposed %t)", got, ok)
+	}
+
+	c, err = NewTestProcStatsCollector("fixtures/proc", []string{"hekad"}, func(o *ProcStatsOptions) {
+		o.MinInterval = 0
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	collectProcStats(t, c)
+	if got, ok := collectProcStats(t, c)["node_process_collector_cache_age_seconds"]; !ok || got != 0 {
+		t.Errorf("want cache age 0 without caching, got %f (exposed %t)", got, ok)
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+var processesFile = flag.String("collector.procstats.processes-file", "",
+	"File listing processes to monitor in addition to --collector.procstats.registered-processes, one name per line. It is read again on SIGHUP.")
+
+// processList holds the processes of --collector.procstats.processes-file,
+// replaced on each reload, and the processes removed since the last scrape.
+type processList struct {
+	mtx       sync.Mutex
+	processes []string
+	removed   []string
+}
+
+func (l *processList) names() []string {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.processes
+}
+
+// replace replaces the processes. The previous ones that are neither among
+// them nor in registered are returned by the next call of takeRemoved.
+func (l *processList) replace(processes, registered []string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	for _, name := range l.processes {
+		if !containsString(processes, name) && !containsString(registered, name) && !containsString(l.removed, name) {
+			l.removed = append(l.removed, name)
+		}
+	}
+	for i := 0; i < len(l.removed); i++ {
+		if containsString(processes, l.removed[i]) {
+			l.removed = append(l.removed[:i], l.removed[i+1:]...)
+			i--
+		}
+	}
+	l.processes = processes
+}
+
+// takeRemoved returns the processes removed since its last call.
+func (l *processList) takeRemoved() []string {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	removed := l.removed
+	l.removed = nil
+	return removed
+}
+
+// parseProcessList parses the names of a processes file, one per line.
+// Empty lines and lines starting with # are skipped.
+func parseProcessList(s string) []string {
+	var processes []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		processes = append(processes, line)
+	}
+	return processes
+}
+
+// Reload replaces the processes of the processes file with the given ones.
+// They are collected from the next scrape on, which also deletes the series
+// of the processes that were removed. Deleting them then rather than right
+// away keeps a scrape in progress from exporting them again. Processes
+// registered by flag or in the config file stay monitored.
+func (c *procstatsCollector) Reload(processes []string) error {
+	for i, name := range processes {
+		if name == "" || strings.ContainsAny(name, "/,=") {
+			return fmt.Errorf("invalid process name %q", name)
+		}
+		if containsString(processes[:i], name) {
+			return fmt.Errorf("duplicate process %q", name)
+		}
+	}
+	c.listed.replace(processes, c.registeredProcessesList)
+	return nil
+}
+
+// reloadProcessesFile reads the processes file at path and reloads its
+// processes. The processes are kept if the file can't be read.
+func (c *procstatsCollector) reloadProcessesFile(path string) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := c.Reload(parseProcessList(string(content))); err != nil {
+		return fmt.Errorf("invalid processes file %s: %s", path, err)
+	}
+	return nil
+}
+
+// reloadingCollector is the procstats collector of a config or processes
+// file, which are read again on reload.
+type reloadingCollector struct {
+	build func() (Collector, error)
+	// configFile and processesFile are the paths of the files, if any.
+	configFile    string
+	processesFile string
+
+	mtx     sync.RWMutex
+	current Collector
+}
+
+func (r *reloadingCollector) collector() Collector {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.current
+}
+
+// Reload reads the config and processes files again. With a config file the
+// collector is rebuilt from the flags and the files, and replaced if that
+// succeeds: its rates and other state derived from previous scrapes start
+// over, except for continuous counters, which are carried over. Without one
+// only the processes are replaced, see procstatsCollector.Reload.
+func (r *reloadingCollector) Reload() error {
+	if r.configFile == "" {
+		if c, ok := r.collector().(*procstatsCollector); ok {
+			return c.reloadProcessesFile(r.processesFile)
+		}
+	}
+	next, err := r.build()
+	if err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	previous, ok := r.current.(*procstatsCollector)
+	if n, nok := next.(*procstatsCollector); ok && nok && previous.continuousCounters != nil && n.continuousCounters != nil {
+		n.continuousCounters = previous.continuousCounters
+	}
+	r.current = next
+	return nil
+}
+
+// reloadOnSIGHUP reloads whenever the exporter receives SIGHUP.
+func (r *reloadingCollector) reloadOnSIGHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := r.Reload(); err != nil {
+				log.Errorf("Unable to reload the procstats collector: %s", err)
+				continue
+			}
+			log.Infof("Reloaded the procstats collector")
+		}
+	}()
+}
+
+func (r *reloadingCollector) Update(ch chan<- prometheus.Metric) error {
+	return r.collector().Update(ch)
+}
+
+// Describe sends the descriptors of the current collector. Those of a
+// collector reloaded later with other labels aren't registered, which the
+// registry doesn't check.
+func (r *reloadingCollector) Describe(ch chan<- *prometheus.Desc) {
+	if d, ok := r.collector().(Describer); ok {
+		d.Describe(ch)
+	}
+}
+
+func (r *reloadingCollector) processNames() []string {
+	if f, ok := r.collector().(processFilterer); ok {
+		return f.processNames()
+	}
+	return nil
+}
+
+func (r *reloadingCollector) updateProcesses(ch chan<- prometheus.Metric, names map[string]bool) error {
+	f, ok := r.collector().(processFilterer)
+	if !ok {
+		return fmt.Errorf("processes can only be filtered for the local procstats collector")
+	}
+	return f.updateProcesses(ch, names)
+}
+
+// deleteProcessSeries deletes the series of the named processes from the
+// metric vectors, which otherwise keep exporting their last values.
+func (c *procstatsCollector) deleteProcessSeries(procNames ...string) {
+	if len(procNames) == 0 {
+		return
+	}
+	deleted := make(map[string]bool, len(procNames))
+	c.labelsMtx.Lock()
+	for _, name := range procNames {
+		deleted[name] = true
+		delete(c.seriesLabels, name)
+	}
+	c.labelsMtx.Unlock()
+	for _, v := range c.vecs() {
+		vec, ok := v.(interface {
+			Delete(prometheus.Labels) bool
+		})
+		if !ok {
+			continue
+		}
+		ch := make(chan prometheus.Metric)
+		go func() {
+			v.Collect(ch)
+			close(ch)
+		}()
+		var matching []prometheus.Labels
+		for m := range ch {
+			pb := &dto.Metric{}
+			if err := m.Write(pb); err != nil {
+				continue
+			}
+			labels := prometheus.Labels{}
+			for _, l := range pb.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if deleted[labels["name"]] {
+				matching = append(matching, labels)
+			}
+		}
+		for _, labels := range matching {
+			vec.Delete(labels)
+		}
+	}
+}
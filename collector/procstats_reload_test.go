@@ -0,0 +1,234 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseProcessList(t *testing.T) {
+	got := parseProcessList("hekad\n\n# disabled\n  kamailio \n")
+	if want := []string{"hekad", "kamailio"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want processes %q, got %q", want, got)
+	}
+}
+
+func newTestReloadCollector(t *testing.T) *procstatsCollector {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "hekad.pid"), []byte("1234\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewTestProcStatsCollector("fixtures/proc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.pidDir = dir
+	return c
+}
+
+// hasProcessSeries returns whether any of the metrics belongs to procName.
+func hasProcessSeries(metrics map[string]float64, procName string) bool {
+	for series := range metrics {
+		if strings.Contains(series, `name="`+procName+`"`) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestProcStatsReload(t *testing.T) {
+	c := newTestReloadCollector(t)
+	if hasProcessSeries(collectProcStats(t, c), "hekad") {
+		t.Fatal("want no series of hekad before the reload")
+	}
+
+	path := filepath.Join(t.TempDir(), "processes")
+	if err := ioutil.WriteFile(path, []byte("hekad\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.reloadProcessesFile(path); err != nil {
+		t.Fatal(err)
+	}
+	metrics := collectProcStats(t, c)
+	if want, got := 1234.0, metrics[`node_process_pid{name="hekad"}`]; want != got {
+		t.Errorf("want pid %f, got %f", want, got)
+	}
+
+	for _, invalid := range [][]string{{"hekad", "hekad"}, {""}, {"../hekad"}} {
+		if err := c.Reload(invalid); err == nil {
+			t.Errorf("want error for processes %q, got none", invalid)
+		}
+	}
+	if !hasProcessSeries(collectProcStats(t, c), "hekad") {
+		t.Error("want the processes kept after an invalid reload")
+	}
+
+	if err := c.Reload(nil); err != nil {
+		t.Fatal(err)
+	}
+	if hasProcessSeries(collectProcStats(t, c), "hekad") {
+		t.Error("want no series of hekad after removing it")
+	}
+	if err := c.reloadProcessesFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("want error for a missing processes file, got none")
+	}
+}
+
+func TestProcStatsReloadDuringScrape(t *testing.T) {
+	c := newTestReloadCollector(t)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			processes := []string{"hekad"}
+			if i%2 == 1 {
+				processes = nil
+			}
+			if err := c.Reload(processes); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		collectProcStats(t, c)
+	}
+	wg.Wait()
+}
+
+// writeTestConfig writes a procstats config file to path.
+func writeTestConfig(t *testing.T, path, config string) {
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcStatsStaticLabels(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "heka.pid"), []byte("1234\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yml")
+	writeTestConfig(t, path, `processes:
+  - name: heka
+    pid_file: `+filepath.Join(dir, "heka.pid")+`
+    labels:
+      team: platform
+      tier: "1"
+  - name: stale
+`)
+	withConfig := func(o *ProcStatsOptions) {
+		o.ConfigFile = path
+	}
+
+	c, err := NewTestProcStatsCollector("fixtures/proc", nil, withConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := collectProcStats(t, c)
+	if want, got := 1234.0, metrics[`node_process_pid{name="heka",team="platform",tier="1"}`]; want != got {
+		t.Errorf("want pid %f, got %f", want, got)
+	}
+	// All series of the process have the static labels.
+	for _, series := range []string{
+		`node_process_cpu_seconds_total{mode="user",name="heka",team="platform",tier="1"}`,
+		`node_process_stack_bytes{name="heka",team="platform",tier="1"}`,
+		`node_process_state{name="heka",state="sleeping",team="platform",tier="1"}`,
+		`node_process_rss_bytes{name="heka",team="platform",tier="1",type="anon"}`,
+	} {
+		if _, ok := metrics[series]; !ok {
+			t.Errorf("want series %s", series)
+		}
+	}
+	if _, ok := metrics[`node_process_stack_bytes{name="heka"}`]; ok {
+		t.Error("want no series without the static labels")
+	}
+	if want, got := 0.0, metrics[`node_process_up{name="stale"}`]; want != got {
+		t.Errorf("want stale down, got %f", got)
+	}
+
+	if _, err := NewTestProcStatsCollector("fixtures/proc", nil, withConfig, func(o *ProcStatsOptions) {
+		o.EnvLabels = "team=TEAM"
+	}); err == nil {
+		t.Error("want error for a static label conflicting with an env label, got none")
+	}
+
+	writeTestConfig(t, path, "processes: [{name: heka, labels: {state: up}}]")
+	if _, err := NewTestProcStatsCollector("fixtures/proc", nil, withConfig); err == nil {
+		t.Error("want error for a static label conflicting with a label of node_process_state, got none")
+	}
+}
+
+func TestReloadingCollector(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "hekad.pid"), []byte("1234\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yml")
+	writeTestConfig(t, path, "processes: [{name: hekad, labels: {team: platform}}]")
+
+	continuous := false
+	build := func() (Collector, error) {
+		return NewTestProcStatsCollector("fixtures/proc", nil, func(o *ProcStatsOptions) {
+			o.PIDDir = dir
+			o.ConfigFile = path
+			o.ContinuousCounters = continuous
+		})
+	}
+	current, err := build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &reloadingCollector{build: build, configFile: path, current: current}
+	if _, ok := collectProcStats(t, r)[`node_process_pid{name="hekad",team="platform"}`]; !ok {
+		t.Fatal("want the series of the initial config")
+	}
+
+	writeTestConfig(t, path, "processes: [{name: hekad, labels: {team: billing}}]")
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	metrics := collectProcStats(t, r)
+	if _, ok := metrics[`node_process_pid{name="hekad",team="billing"}`]; !ok {
+		t.Error("want the series of the reloaded config")
+	}
+	if _, ok := metrics[`node_process_pid{name="hekad",team="platform"}`]; ok {
+		t.Error("want no series of the previous config")
+	}
+
+	continuous = true
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	counters := r.collector().(*procstatsCollector).continuousCounters
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if counters == nil || r.collector().(*procstatsCollector).continuousCounters != counters {
+		t.Error("want the continuous counters carried over")
+	}
+
+	writeTestConfig(t, path, `processes: [{name: ""}]`)
+	if err := r.Reload(); err == nil {
+		t.Error("want error for an invalid config, got none")
+	}
+	if _, ok := collectProcStats(t, r)[`node_process_pid{name="hekad",team="billing"}`]; !ok {
+		t.Error("want the collector kept after an invalid config")
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	remoteHostsFile = flag.String("collector.procstats.remote-hosts-file", "",
+		"File listing user@host:port entries, one per line. If set, the process statistics are fetched from these hosts over SSH instead of the local host.")
+	remoteTimeout = flag.Duration("collector.procstats.remote-timeout", 10*time.Second,
+		"Timeout for fetching the process statistics of a single remote host.")
+)
+
+const defaultSSHPort = "22"
+
+// remoteHost is an SSH destination.
+type remoteHost struct {
+	user, host, port string
+}
+
+func (h remoteHost) String() string {
+	return h.user + "@" + net.JoinHostPort(h.host, h.port)
+}
+
+// remoteRunner runs a shell script on a remote host and returns its stdout.
+type remoteRunner func(h remoteHost, script string) ([]byte, error)
+
+// sshRunner runs the script with the ssh client of the host. Authentication
+// must work non-interactively, e.g. with an agent or a key without
+// passphrase.
+func sshRunner(h remoteHost, script string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), *remoteTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	// parseRemoteHosts rejects values that ssh would take for options, and
+	// "--" ends the options before the destination anyway.
+	cmd := exec.CommandContext(ctx, "ssh", "-o", "BatchMode=yes", "-p", h.port, "--", h.user+"@"+h.host, script)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("ssh to %s timed out after %s", h, *remoteTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ssh to %s failed: %s: %s", h, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// loadRemoteHosts reads a file of user@host[:port] entries. Empty lines and
+// lines starting with # are ignored.
+func loadRemoteHosts(path string) ([]remoteHost, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseRemoteHosts(bytes.NewReader(content))
+}
+
+func parseRemoteHosts(r io.Reader) ([]remoteHost, error) {
+	var hosts []remoteHost
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		at := strings.LastIndex(line, "@")
+		if at <= 0 || at == len(line)-1 {
+			return nil, fmt.Errorf("invalid remote host %q: want user@host:port", line)
+		}
+		h := remoteHost{user: line[:at], host: line[at+1:], port: defaultSSHPort}
+		if host, port, err := net.SplitHostPort(h.host); err == nil {
+			if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+				return nil, fmt.Errorf("invalid port in remote host %q", line)
+			}
+			h.host, h.port = host, port
+		}
+		for _, v := range []string{h.user, h.host, h.port} {
+			if !validSSHArg(v) {
+				return nil, fmt.Errorf("invalid remote host %q: user, host and port must not be empty, start with - or contain whitespace", line)
+			}
+		}
+		if seen[h.String()] {
+			return nil, fmt.Errorf("duplicate remote host %q", line)
+		}
+		seen[h.String()] = true
+		hosts = append(hosts, h)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no remote hosts configured")
+	}
+	return hosts, nil
+}
+
+// validSSHArg returns whether s can be passed to ssh as part of the
+// destination or as the port.
+func validSSHArg(s string) bool {
+	return s != "" && !strings.HasPrefix(s, "-") && strings.IndexFunc(s, unicode.IsSpace) < 0
+}
+
+// remotePIDFiles returns the PID file paths of the processes on the remote
+// hosts: the given path of a process, if any, or NAME.pid in pidDir.
+func remotePIDFiles(processes []string, pidDir string, pidFiles map[string]string) map[string]string {
+	paths := make(map[string]string, len(processes))
+	for _, name := range processes {
+		path, ok := pidFiles[name]
+		if !ok {
+			path = filepath.Join(pidDir, name+".pid")
+		}
+		paths[name] = path
+	}
+	return paths
+}
+
+// remoteProcstatsCollector fetches the statistics of the registered
+// processes of a single remote host.
+type remoteProcstatsCollector struct {
+	host      remoteHost
+	processes []string
+	pidFiles  map[string]string
+	run       remoteRunner
+}
+
+// remoteScript returns a script printing a "process PID NAME" header
+// followed by /proc/$PID/status for every process, whose PID is read from
+// its path in pidFiles. The PID is "-" if the PID file can't be read.
+func remoteScript(processes []string, pidFiles map[string]string) string {
+	script := `p() {
+  if pid=$(cat "$2" 2>/dev/null); then
+    echo "process $pid $1"
+    cat /proc/"$pid"/status 2>/dev/null
+  else
+    echo "process - $1"
+  fi
+}
+`
+	for _, name := range processes {
+		script += "p " + shellQuote(name) + " " + shellQuote(pidFiles[name]) + "\n"
+	}
+	return script
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// fetch returns the stats of the processes that are running on the host.
+func (c *remoteProcstatsCollector) fetch() (map[string]ProcessStats, error) {
+	out, err := c.run(c.host, remoteScript(c.processes, c.pidFiles))
+	if err != nil {
+		return nil, err
+	}
+	return parseRemoteOutput(bytes.NewReader(out))
+}
+
+// parseRemoteOutput parses the output of remoteScript. Processes without a
+// PID or without status are left out.
+func parseRemoteOutput(r io.Reader) (map[string]ProcessStats, error) {
+	stats := map[string]ProcessStats{}
+	var (
+		name   string
+		pid    int
+		status bytes.Buffer
+	)
+	flush := func() error {
+		if name == "" || status.Len() == 0 {
+			return nil
+		}
+		s, err := parseProcessStats(&status, pid)
+		if err != nil {
+			return err
+		}
+		stats[name] = s
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "process ") {
+			if name != "" {
+				status.WriteString(line + "\n")
+			}
+			continue
+		}
+		if err := flush(); err != nil {
+			return nil, err
+		}
+		name, pid = "", 0
+		status.Reset()
+
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 || fields[2] == "" {
+			return nil, fmt.Errorf("invalid process header %q", line)
+		}
+		if fields[1] == "-" {
+			continue
+		}
+		p, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid PID in process header %q", line)
+		}
+		name, pid = fields[2], p
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// aggregatingCollector collects the process statistics of several remote
+// hosts into a single stream of metrics with a host label.
+type aggregatingCollector struct {
+	hosts []*remoteProcstatsCollector
+	up    *prometheus.Desc
+	stats processStatMetrics
+}
+
+func newAggregatingCollector(hosts []remoteHost, processes []string, pidFiles map[string]string, run remoteRunner) *aggregatingCollector {
+	labelNames := []string{"host", "name"}
+	c := &aggregatingCollector{
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "up"),
+			"Whether the statistics of the process could be fetched from the host.",
+			labelNames, nil,
+		),
+		stats: newProcessStatMetrics(labelNames),
+	}
+	for _, h := range hosts {
+		c.hosts = append(c.hosts, &remoteProcstatsCollector{host: h, processes: processes, pidFiles: pidFiles, run: run})
+	}
+	return c
+}
+
+// Update fetches all hosts concurrently. A host that can't be reached
+// reports all its processes as down instead of failing the scrape.
+func (c *aggregatingCollector) Update(ch chan<- prometheus.Metric) error {
+	var wg sync.WaitGroup
+	for _, h := range c.hosts {
+		wg.Add(1)
+		go func(h *remoteProcstatsCollector) {
+			defer wg.Done()
+			c.updateHost(h, ch)
+		}(h)
+	}
+	wg.Wait()
+	return nil
+}
+
+// Describe sends the descriptors of the metrics of the collector to ch.
+func (c *aggregatingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	c.stats.describe(ch)
+}
+
+func (c *aggregatingCollector) updateHost(h *remoteProcstatsCollector, ch chan<- prometheus.Metric) {
+	host := h.host.String()
+	stats, err := h.fetch()
+	if err != nil {
+		log.With("host", host).Errorf("Unable to fetch the process statistics: %s", err)
+	}
+	for _, name := range h.processes {
+		s, ok := stats[name]
+		up := 0.0
+		if ok {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, up, host, name)
+		if ok {
+			c.stats.collect(ch, s, host, name)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseRemoteHosts(t *testing.T) {
+	hosts, err := parseRemoteHosts(strings.NewReader(`
+# monitored hosts
+deploy@web1:2222
+deploy@web2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []remoteHost{
+		{user: "deploy", host: "web1", port: "2222"},
+		{user: "deploy", host: "web2", port: "22"},
+	}
+	if len(hosts) != len(want) {
+		t.Fatalf("want %d hosts, got %d", len(want), len(hosts))
+	}
+	for i := range want {
+		if hosts[i] != want[i] {
+			t.Errorf("want host %+v, got %+v", want[i], hosts[i])
+		}
+	}
+
+	for _, in := range []string{
+		"", "web1:22", "deploy@", "deploy@web1:ssh", "a@b\na@b:22",
+		"-oProxyCommand=x@web1", "deploy@-oProxyCommand=x", "deploy@[-p]:22", "de ploy@web1", "deploy@web\t1",
+	} {
+		if _, err := parseRemoteHosts(strings.NewReader(in)); err == nil {
+			t.Errorf("expected error for %q", in)
+		}
+	}
+}
+
+func TestAggregatingCollector(t *testing.T) {
+	status, err := ioutil.ReadFile("fixtures/proc/1234/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// mockSSH serves web1 from the fixtures and fails to connect to web2.
+	var (
+		mtx     sync.Mutex
+		scripts []string
+	)
+	mockSSH := func(h remoteHost, script string) ([]byte, error) {
+		mtx.Lock()
+		scripts = append(scripts, script)
+		mtx.Unlock()
+		if h.host == "web2" {
+			return nil, errors.New("connection refused")
+		}
+		return []byte("process 1234 hekad\n" + string(status) + "process - sshd\n"), nil
+	}
+
+	c := newAggregatingCollector([]remoteHost{
+		{user: "deploy", host: "web1", port: "22"},
+		{user: "deploy", host: "web2", port: "22"},
+	}, []string{"hekad", "sshd"}, map[string]string{
+		"hekad": "/var/run/hekad.pid",
+		"sshd":  "/run/sshd/sshd's.pid",
+	}, mockSSH)
+	metrics := collectProcStats(t, c)
+
+	for name, want := range map[string]float64{
+		`node_process_up{host="deploy@web1:22",name="hekad"}`:                                  1,
+		`node_process_up{host="deploy@web1:22",name="sshd"}`:                                   0,
+		`node_process_up{host="deploy@web2:22",name="hekad"}`:                                  0,
+		`node_process_up{host="deploy@web2:22",name="sshd"}`:                                   0,
+		`node_process_pid{host="deploy@web1:22",name="hekad"}`:                                 1234,
+		`node_process_mem_kilobytes{host="deploy@web1:22",name="hekad"}`:                       11708,
+		`node_process_nonvoluntary_context_switches_total{host="deploy@web1:22",name="hekad"}`: 3,
+	} {
+		got, ok := metrics[name]
+		if !ok {
+			t.Errorf("missing metric %s", name)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: want %f, got %f", name, want, got)
+		}
+	}
+	if _, ok := metrics[`node_process_pid{host="deploy@web2:22",name="hekad"}`]; ok {
+		t.Error("unexpected pid of a process on an unreachable host")
+	}
+	if len(scripts) != 2 || !strings.Contains(scripts[0], "\np 'hekad' '/var/run/hekad.pid'\np 'sshd' '/run/sshd/sshd'\\''s.pid'\n") {
+		t.Errorf("unexpected remote scripts %q", scripts)
+	}
+}
+
+func TestRemotePIDFiles(t *testing.T) {
+	got := remotePIDFiles([]string{"hekad", "myapp"}, "/var/run", map[string]string{"myapp": "/run/myapp/myapp.pid"})
+	want := map[string]string{"hekad": "/var/run/hekad.pid", "myapp": "/run/myapp/myapp.pid"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want PID files %v, got %v", want, got)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	if want, got := `'it'\''s'`, shellQuote("it's"); want != got {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
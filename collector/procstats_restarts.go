@@ -0,0 +1,101 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// processInstance identifies a run of a process: a restarted process has a
+// new PID or, if the PID was reused, a new start time.
+type processInstance struct {
+	pid       int
+	startTime uint64
+	restarts  int
+}
+
+// nextProcessInstance returns the instance of a process with the given PID
+// and start time in clock ticks following last, counting a restart if any.
+// A process seen for the first time hasn't restarted.
+func nextProcessInstance(last processInstance, ok bool, pid int, startTime uint64) processInstance {
+	if !ok {
+		return processInstance{pid: pid, startTime: startTime}
+	}
+	if last.pid != pid || last.startTime != startTime {
+		return processInstance{pid: pid, startTime: startTime, restarts: last.restarts + 1}
+	}
+	return last
+}
+
+// lifecycleMetrics are the metrics of the registered processes about their
+// resolution, start and restarts.
+type lifecycleMetrics struct {
+	metricVecs
+
+	pidFileStale     *prometheus.GaugeVec
+	processCount     *prometheus.GaugeVec
+	startTimeSeconds *prometheus.GaugeVec
+	uptimeSeconds    *prometheus.GaugeVec
+	restarts         *prometheus.CounterVec
+}
+
+// newLifecycleMetrics returns the lifecycle metrics of processes with the
+// given label names.
+func newLifecycleMetrics(labelNames []string) *lifecycleMetrics {
+	m := &lifecycleMetrics{
+		pidFileStale: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "pid_file_stale",
+				Help:      "Whether the PID file of the process is older than the maximum PID file age or than the process itself.",
+			}, labelNames),
+		processCount: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "count",
+				Help:      "Number of processes found by the command name of a process without PID file.",
+			}, labelNames),
+		startTimeSeconds: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "start_time_seconds",
+				Help:      "Start time of the process since unix epoch in seconds.",
+			}, labelNames),
+		uptimeSeconds: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "uptime_seconds",
+				Help:      "Time in seconds since the process started.",
+			}, labelNames),
+		restarts: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "restarts_total",
+				Help:      "Number of times the PID or start time of the process changed between scrapes since the exporter started.",
+			}, labelNames),
+	}
+	m.metricVecs = metricVecs{
+		m.pidFileStale,
+		m.processCount,
+		m.startTimeSeconds,
+		m.uptimeSeconds,
+		m.restarts,
+	}
+	return m
+}
@@ -0,0 +1,40 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import "testing"
+
+func TestNextProcessInstance(t *testing.T) {
+	var (
+		instance processInstance
+		ok       bool
+	)
+	for i, test := range []struct {
+		pid       int
+		startTime uint64
+		restarts  int
+	}{
+		{pid: 10, startTime: 100, restarts: 0},
+		{pid: 10, startTime: 100, restarts: 0},
+		{pid: 11, startTime: 200, restarts: 1},
+		// The PID was reused by the restarted process.
+		{pid: 11, startTime: 300, restarts: 2},
+		{pid: 11, startTime: 300, restarts: 2},
+	} {
+		instance, ok = nextProcessInstance(instance, ok, test.pid, test.startTime), true
+		if instance.restarts != test.restarts {
+			t.Errorf("%d: want %d restarts, got %d", i, test.restarts, instance.restarts)
+		}
+	}
+}
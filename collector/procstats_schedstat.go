@@ -0,0 +1,77 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// processSchedstat holds the scheduler statistics of /proc/$PID/schedstat.
+type processSchedstat struct {
+	// RunNanoseconds is the time spent on the CPU.
+	RunNanoseconds uint64
+	// WaitNanoseconds is the time spent waiting on a runqueue.
+	WaitNanoseconds uint64
+	// Timeslices is the number of timeslices run on the CPU.
+	Timeslices uint64
+}
+
+// getProcessSchedstat reads the scheduler statistics of the given process.
+// They require a kernel with CONFIG_SCHEDSTATS or CONFIG_SCHED_INFO.
+func getProcessSchedstat(procRoot string, pid int) (processSchedstat, error) {
+	f, err := os.Open(processFilePath(procRoot, pid, "schedstat"))
+	if err != nil {
+		return processSchedstat{}, err
+	}
+	defer f.Close()
+	return parseProcessSchedstat(f)
+}
+
+// parseProcessSchedstat parses the single line of a schedstat file.
+func parseProcessSchedstat(r io.Reader) (processSchedstat, error) {
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return processSchedstat{}, err
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) != 3 {
+		return processSchedstat{}, fmt.Errorf("invalid schedstat %q", content)
+	}
+	var values [3]uint64
+	for i, field := range fields {
+		values[i], err = strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return processSchedstat{}, fmt.Errorf("invalid schedstat %q: %s", content, err)
+		}
+	}
+	return processSchedstat{
+		RunNanoseconds:  values[0],
+		WaitNanoseconds: values[1],
+		Timeslices:      values[2],
+	}, nil
+}
+
+// nanosecondsToSeconds converts ns to seconds. The whole seconds are
+// converted separately so that counters beyond 2^53 ns (104 days) don't
+// lose their fraction to the float64 conversion.
+func nanosecondsToSeconds(ns uint64) float64 {
+	return float64(ns/1e9) + float64(ns%1e9)/1e9
+}
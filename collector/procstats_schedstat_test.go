@@ -0,0 +1,50 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetProcessSchedstat(t *testing.T) {
+	stat, err := getProcessSchedstat("fixtures/proc", 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := processSchedstat{RunNanoseconds: 15830000000, WaitNanoseconds: 3166250001, Timeslices: 3201}
+	if want != stat {
+		t.Errorf("want schedstat %+v, got %+v", want, stat)
+	}
+
+	for _, invalid := range []string{"", "1 2", "1 2 3 4", "1 x 3\n"} {
+		if _, err := parseProcessSchedstat(strings.NewReader(invalid)); err == nil {
+			t.Errorf("want error for schedstat %q, got none", invalid)
+		}
+	}
+}
+
+func TestNanosecondsToSeconds(t *testing.T) {
+	for ns, want := range map[uint64]float64{
+		0:          0,
+		1:          0.000000001,
+		3166250001: 3.166250001,
+		1000000000: 1,
+		1500000000: 1.5,
+	} {
+		if got := nanosecondsToSeconds(ns); got != want {
+			t.Errorf("want %d ns to be %.9f s, got %.9f", ns, want, got)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cronSchedule is a cron expression of the minutes in which a process is
+// expected to run, e.g. "* 9-17 * * 1-5" for business hours.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// As in cron, a time matches either of a restricted day of month and
+	// day of week.
+	domRestricted, dowRestricted bool
+}
+
+// cronFields are the bounds of the fields of a cron expression.
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// parseCronSchedule parses a cron expression of five fields: minute, hour,
+// day of month, month and day of week. Fields are lists of *, values,
+// ranges, or either with a /step. Day of week 0 and 7 are Sunday.
+func parseCronSchedule(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("want %d fields in %q, got %d", len(cronFields), expr, len(fields))
+	}
+	var sets [5]uint64
+	for i, f := range cronFields {
+		set, err := parseCronField(fields[i], f.min, f.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %s", f.name, fields[i], err)
+		}
+		sets[i] = set
+	}
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return &cronSchedule{
+		minute:        sets[0],
+		hour:          sets[1],
+		dom:           sets[2],
+		month:         sets[3],
+		dow:           sets[4],
+		domRestricted: fields[2] != "*",
+		dowRestricted: fields[4] != "*",
+	}, nil
+}
+
+// parseCronField returns the set of values of a cron field as a bitmask.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		values, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", part[i+1:])
+			}
+			values = part[:i]
+		}
+		low, high := min, max
+		if values != "*" {
+			bounds := strings.SplitN(values, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", bounds[0])
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", bounds[1])
+				}
+			} else if step > 1 {
+				// As in cron, a value with a step starts a range.
+				high = max
+			}
+			if low < min || high > max || low > high {
+				return 0, fmt.Errorf("%q out of range %d-%d", values, min, max)
+			}
+		}
+		for v := low; v <= high; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// matches returns whether the minute of t is in the schedule.
+func (s *cronSchedule) matches(t time.Time) bool {
+	has := func(set uint64, v int) bool { return set&(1<<uint(v)) != 0 }
+	if !has(s.minute, t.Minute()) || !has(s.hour, t.Hour()) || !has(s.month, int(t.Month())) {
+		return false
+	}
+	dom, dow := has(s.dom, t.Day()), has(s.dow, int(t.Weekday()))
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// collectExpectedRunning sends whether the scheduled ones of the named
+// processes are expected to run at now to ch.
+func (c *procstatsCollector) collectExpectedRunning(procNames []string, now time.Time, ch chan<- prometheus.Metric) {
+	for _, procName := range procNames {
+		s, ok := c.schedules[procName]
+		if !ok {
+			continue
+		}
+		expected := 0.0
+		if s.matches(now) {
+			expected = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.expectedRunning, prometheus.GaugeValue, expected, procName)
+	}
+}
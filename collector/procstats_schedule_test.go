@@ -0,0 +1,112 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	for _, expr := range []string{
+		"* * * * *",
+		"*/15 9-17 * * 1-5",
+		"0,30 8 1 1-12/2 7",
+	} {
+		if _, err := parseCronSchedule(expr); err != nil {
+			t.Errorf("%q: unexpected error: %s", expr, err)
+		}
+	}
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+	} {
+		if _, err := parseCronSchedule(expr); err == nil {
+			t.Errorf("%q: want an error, got none", expr)
+		}
+	}
+}
+
+func TestCronScheduleMatches(t *testing.T) {
+	// 2026-10-14 is a Wednesday.
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	for _, test := range []struct {
+		expr string
+		t    time.Time
+		want bool
+	}{
+		{"* 9-17 * * 1-5", at(10, 14, 9, 0), true},
+		{"* 9-17 * * 1-5", at(10, 14, 17, 59), true},
+		{"* 9-17 * * 1-5", at(10, 14, 18, 0), false},
+		{"* 9-17 * * 1-5", at(10, 18, 12, 0), false},
+		{"*/15 * * * *", at(10, 14, 12, 45), true},
+		{"*/15 * * * *", at(10, 14, 12, 46), false},
+		{"10/20 * * * *", at(10, 14, 12, 50), true},
+		{"* * * * 7", at(10, 18, 12, 0), true},
+		{"* * * * 0", at(10, 18, 12, 0), true},
+		// A restricted day of month or of week matches.
+		{"* * 1 * 3", at(10, 14, 12, 0), true},
+		{"* * 1 * 3", at(10, 1, 12, 0), true},
+		{"* * 1 * 3", at(10, 2, 12, 0), false},
+		{"* * 1 * *", at(10, 14, 12, 0), false},
+		{"* * * 11 *", at(10, 14, 12, 0), false},
+	} {
+		s, err := parseCronSchedule(test.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.matches(test.t); got != test.want {
+			t.Errorf("%q at %s: want %t, got %t", test.expr, test.t, test.want, got)
+		}
+	}
+}
+
+func TestProcStatsExpectedRunning(t *testing.T) {
+	c, err := NewTestProcStatsCollector(t.TempDir(), []string{"hekad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.schedules = map[string]*cronSchedule{}
+	c.schedules["hekad"], _ = parseCronSchedule("* 9-17 * * 1-5")
+	c.schedules["nightly"], _ = parseCronSchedule("* 0-5 * * *")
+
+	ch := make(chan prometheus.Metric, 3)
+	c.collectExpectedRunning([]string{"hekad", "nightly", "other"}, time.Date(2026, 10, 14, 10, 0, 0, 0, time.Local), ch)
+	close(ch)
+	got := map[string]float64{}
+	for m := range ch {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		got[pb.GetLabel()[0].GetValue()] = pb.GetGauge().GetValue()
+	}
+	if want := map[string]float64{"hekad": 1, "nightly": 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want expected_running %v, got %v", want, got)
+	}
+}
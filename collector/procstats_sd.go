@@ -0,0 +1,172 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSDResponseBytes bounds the size of a service discovery response.
+const maxSDResponseBytes = 1 << 20
+
+var (
+	sdURL = flag.String("collector.procstats.sd-url", "",
+		"HTTPS URL returning a JSON list of processes in the format of --collector.procstats.config, added to the configured processes.")
+	sdRefreshInterval = flag.Duration("collector.procstats.sd-refresh-interval", time.Minute,
+		"Interval at which --collector.procstats.sd-url is fetched again.")
+	sdTimeout = flag.Duration("collector.procstats.sd-timeout", 5*time.Second,
+		"Timeout for fetching --collector.procstats.sd-url.")
+	sdAuthorizationFile = flag.String("collector.procstats.sd-authorization-file", "",
+		"File holding the value of the Authorization header sent to --collector.procstats.sd-url, e.g. \"Bearer <token>\".")
+)
+
+// processDiscovery fetches the processes to monitor from a service discovery
+// endpoint. The endpoint is fetched at most once per interval, and the
+// processes of the last successful fetch are kept while it fails.
+type processDiscovery struct {
+	url           string
+	authorization string
+	interval      time.Duration
+	client        *http.Client
+
+	mtx       sync.Mutex
+	processes []string
+	err       error
+	next      time.Time
+}
+
+// newProcessDiscovery returns a processDiscovery of the given HTTPS URL.
+func newProcessDiscovery(rawURL, authorization string, interval time.Duration, client *http.Client) (*processDiscovery, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("service discovery URL %q isn't https", rawURL)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid service discovery refresh interval %s", interval)
+	}
+	return &processDiscovery{url: rawURL, authorization: authorization, interval: interval, client: client}, nil
+}
+
+// newProcessDiscoveryFromFlags returns the processDiscovery configured by
+// the flags, or nil if --collector.procstats.sd-url isn't set.
+func newProcessDiscoveryFromFlags() (*processDiscovery, error) {
+	if *sdURL == "" {
+		return nil, nil
+	}
+	var authorization string
+	if *sdAuthorizationFile != "" {
+		content, err := ioutil.ReadFile(*sdAuthorizationFile)
+		if err != nil {
+			return nil, err
+		}
+		authorization = strings.TrimSpace(string(content))
+	}
+	return newProcessDiscovery(*sdURL, authorization, *sdRefreshInterval, &http.Client{Timeout: *sdTimeout})
+}
+
+// refresh fetches the processes if the interval has passed since the last
+// fetch and returns the error of the last fetch.
+func (d *processDiscovery) refresh(now time.Time) error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if now.Before(d.next) {
+		return d.err
+	}
+	d.next = now.Add(d.interval)
+	processes, err := d.fetch()
+	if err != nil {
+		d.err = fmt.Errorf("couldn't fetch %s, keeping the last processes: %s", d.url, err)
+		return d.err
+	}
+	d.processes, d.err = processes, nil
+	return nil
+}
+
+// names returns the processes of the last successful fetch.
+func (d *processDiscovery) names() []string {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.processes
+}
+
+func (d *processDiscovery) fetch() ([]string, error) {
+	req, err := http.NewRequest("GET", d.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if d.authorization != "" {
+		req.Header.Set("Authorization", d.authorization)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSDResponseBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxSDResponseBytes {
+		return nil, fmt.Errorf("response exceeds %d bytes", maxSDResponseBytes)
+	}
+	return parseDiscoveredProcesses(body)
+}
+
+// parseDiscoveredProcesses returns the names of the processes of a service
+// discovery response in the format of the config file. Unknown fields are
+// rejected, and discovered processes may only set their name, being found by
+// their PID file like --collector.procstats.registered-processes.
+func parseDiscoveredProcesses(body []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	config := &procstatsConfig{}
+	if err := dec.Decode(config); err != nil {
+		return nil, fmt.Errorf("couldn't parse the response: %s", err)
+	}
+	if config.Processes == nil {
+		return nil, fmt.Errorf("no processes in the response")
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid response: %s", err)
+	}
+	names := make([]string, 0, len(config.Processes))
+	for _, p := range config.Processes {
+		if !reflect.DeepEqual(p, processConfig{Name: p.Name}) {
+			return nil, fmt.Errorf("process %q sets more than its name", p.Name)
+		}
+		names = append(names, p.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProcessDiscovery(t *testing.T) {
+	var (
+		status        = http.StatusOK
+		body          = `{"processes": [{"name": "hekad"}, {"name": "worker"}]}`
+		authorization string
+		fetches       int
+	)
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		authorization = r.Header.Get("Authorization")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	d, err := newProcessDiscovery(ts.URL, "Bearer secret", time.Minute, ts.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1000, 0)
+	for i, step := range []struct {
+		offset  time.Duration
+		change  func()
+		fetches int
+		failed  bool
+		names   []string
+	}{
+		{offset: 0, fetches: 1, names: []string{"hekad", "worker"}},
+		// Within the refresh interval the endpoint isn't fetched.
+		{offset: 30 * time.Second, change: func() { body = `{"processes": []}` }, fetches: 1, names: []string{"hekad", "worker"}},
+		{offset: time.Minute, fetches: 2, names: []string{}},
+		// Failures keep the processes of the last successful fetch.
+		{offset: 2 * time.Minute, change: func() { body = `{"processes": [{"name": "api"}]}`; status = http.StatusInternalServerError }, fetches: 3, failed: true, names: []string{}},
+		{offset: 3 * time.Minute, change: func() { status = http.StatusOK }, fetches: 4, names: []string{"api"}},
+		{offset: 4 * time.Minute, change: func() { body = `{"processes": [{"name": "api", "comm_regex": "api"}]}` }, fetches: 5, failed: true, names: []string{"api"}},
+	} {
+		if step.change != nil {
+			step.change()
+		}
+		err := d.refresh(start.Add(step.offset))
+		if (err != nil) != step.failed {
+			t.Errorf("%d. want failure %t, got %v", i, step.failed, err)
+		}
+		if fetches != step.fetches {
+			t.Errorf("%d. want %d fetches, got %d", i, step.fetches, fetches)
+		}
+		if names := d.names(); !reflect.DeepEqual(names, step.names) {
+			t.Errorf("%d. want processes %v, got %v", i, step.names, names)
+		}
+	}
+	if authorization != "Bearer secret" {
+		t.Errorf("want the Authorization header sent, got %q", authorization)
+	}
+}
+
+func TestParseDiscoveredProcesses(t *testing.T) {
+	for _, body := range []string{
+		``,
+		`[{"name": "hekad"}]`,
+		`{}`,
+		`{"processes": [{"name": "hekad", "pid": 1}]}`,
+		`{"processes": [{"name": "hekad"}, {"name": "hekad"}]}`,
+		`{"processes": [{"name": "hekad", "command": ["pgrep", "hekad"]}]}`,
+	} {
+		if names, err := parseDiscoveredProcesses([]byte(body)); err == nil {
+			t.Errorf("%s: want an error, got %v", body, names)
+		}
+	}
+}
+
+func TestNewProcessDiscovery(t *testing.T) {
+	for _, u := range []string{"http://sd.example.com/processes", "sd.example.com", "://"} {
+		if _, err := newProcessDiscovery(u, "", time.Minute, http.DefaultClient); err == nil {
+			t.Errorf("%s: want an error, got none", u)
+		}
+	}
+	if _, err := newProcessDiscovery("https://sd.example.com/processes", "", 0, http.DefaultClient); err == nil {
+		t.Error("want an error for no refresh interval, got none")
+	}
+}
+
+func TestProcStatsDiscoveredProcesses(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"processes": [{"name": "hekad"}]}`))
+	}))
+	defer ts.Close()
+
+	c, err := NewTestProcStatsCollector("fixtures/proc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.discovery, err = newProcessDiscovery(ts.URL, "", time.Minute, ts.Client()); err != nil {
+		t.Fatal(err)
+	}
+	metrics := collectProcStats(t, c)
+	for series, want := range map[string]float64{
+		`node_process_sd_error`:          0,
+		`node_process_pid{name="hekad"}`: 1234,
+	} {
+		if got, ok := metrics[series]; !ok || got != want {
+			t.Errorf("%s: want %f, got %f (%t)", series, want, got, ok)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// processStatusFields holds the security relevant state of a process.
+type processStatusFields struct {
+	// RealUID, EffectiveUID, SavedUID and FilesystemUID are the user IDs
+	// from the Uid line of /proc/$PID/status.
+	RealUID       uint64
+	EffectiveUID  uint64
+	SavedUID      uint64
+	FilesystemUID uint64
+	// SeccompMode is 0 if seccomp is disabled, 1 for strict and 2 for
+	// filter mode.
+	SeccompMode int
+	// NoNewPrivs is whether the no_new_privs bit is set.
+	NoNewPrivs bool
+	// EffectiveCapabilities is the CapEff bitmask, bit n being set if
+	// capability n is effective.
+	EffectiveCapabilities uint64
+	// PIDNamespace and HostPIDNamespace are the inodes of the PID namespace
+	// of the process and of PID 1. They are 0 if unknown.
+	PIDNamespace     uint64
+	HostPIDNamespace uint64
+}
+
+// dangerousCapabilities are the capabilities by their number that give a
+// process control over the whole host.
+var dangerousCapabilities = map[uint]string{
+	1:  "CAP_DAC_OVERRIDE",
+	12: "CAP_NET_ADMIN",
+	19: "CAP_SYS_PTRACE",
+	21: "CAP_SYS_ADMIN",
+}
+
+// hasDangerousCapability returns whether any of dangerousCapabilities is
+// set in the capability mask.
+func hasDangerousCapability(mask uint64) bool {
+	for capability := range dangerousCapabilities {
+		if mask&(1<<capability) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCapabilityMask parses a capability bitmask of /proc/$PID/status like
+// CapEff, 16 hex digits of which the kernel currently uses the lowest 41
+// bits.
+func parseCapabilityMask(hexStr string) (uint64, error) {
+	return strconv.ParseUint(hexStr, 16, 64)
+}
+
+// setuidActive returns whether the process runs with an effective UID other
+// than its real UID, i.e. a setuid process that hasn't dropped its
+// privileges.
+func setuidActive(f processStatusFields) bool {
+	return f.RealUID != f.EffectiveUID
+}
+
+// computeSecurityScore returns the number of hardening measures in place
+// for a process: running as non-root, seccomp, no_new_privs and a PID
+// namespace different from the host's. An unknown PID namespace scores no
+// point.
+func computeSecurityScore(f processStatusFields) int {
+	score := 0
+	if f.EffectiveUID != 0 {
+		score++
+	}
+	if f.SeccompMode != 0 {
+		score++
+	}
+	if f.NoNewPrivs {
+		score++
+	}
+	if f.PIDNamespace != 0 && f.HostPIDNamespace != 0 && f.PIDNamespace != f.HostPIDNamespace {
+		score++
+	}
+	return score
+}
+
+// getProcessStatusFields reads the security relevant state of the given
+// process.
+func getProcessStatusFields(files *processFiles, pid int) (processStatusFields, error) {
+	f, err := files.open(pid, "status")
+	if err != nil {
+		return processStatusFields{}, err
+	}
+	fields, err := parseProcessStatusFields(f)
+	if err != nil {
+		return processStatusFields{}, err
+	}
+	// Reading the namespaces of other users' processes requires
+	// privileges, so failures leave them unknown.
+	fields.PIDNamespace, _ = getNamespaceInode(files.procRoot, pid, "pid")
+	fields.HostPIDNamespace, _ = getNamespaceInode(files.procRoot, 1, "pid")
+	return fields, nil
+}
+
+func parseProcessStatusFields(r io.Reader) (processStatusFields, error) {
+	status, err := parseStatusFile(r)
+	if err != nil {
+		return processStatusFields{}, err
+	}
+	uid, ok := status["Uid"]
+	if !ok {
+		return processStatusFields{}, fmt.Errorf("missing Uid in status")
+	}
+	uids, err := parseStatusUIDs(uid)
+	if err != nil {
+		return processStatusFields{}, fmt.Errorf("invalid Uid in status: %s", err)
+	}
+	fields := processStatusFields{
+		RealUID:       uids[0],
+		EffectiveUID:  uids[1],
+		SavedUID:      uids[2],
+		FilesystemUID: uids[3],
+	}
+	for name, value := range status {
+		if value == "" {
+			continue
+		}
+		switch name {
+		case "Seccomp":
+			fields.SeccompMode, err = strconv.Atoi(value)
+		case "NoNewPrivs":
+			fields.NoNewPrivs = value == "1"
+		case "CapEff":
+			fields.EffectiveCapabilities, err = parseCapabilityMask(value)
+		}
+		if err != nil {
+			return processStatusFields{}, fmt.Errorf("invalid %s in status: %s", name, err)
+		}
+	}
+	return fields, nil
+}
+
+// securityMetrics are the metrics of the registered processes about their
+// privileges and the integrity of their executables.
+type securityMetrics struct {
+	metricVecs
+
+	securityScore         *prometheus.GaugeVec
+	capabilitiesEffective *prometheus.GaugeVec
+	dangerousCapability   *prometheus.GaugeVec
+	setuidActive          *prometheus.GaugeVec
+	binaryStale           *prometheus.GaugeVec
+	binaryHashChanged     *prometheus.GaugeVec
+}
+
+// newSecurityMetrics returns the security metrics of processes with the
+// given label names.
+func newSecurityMetrics(labelNames []string) *securityMetrics {
+	m := &securityMetrics{
+		securityScore: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "security_score",
+				Help:      "Number of hardening measures in place for the process, from 0 to 4: non-root effective UID, seccomp, no_new_privs and a PID namespace separate from the host.",
+			}, labelNames),
+		capabilitiesEffective: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "capabilities_effective",
+				Help:      "Effective capabilities of the process, the CapEff bitmask of /proc/$PID/status as an integer.",
+			}, labelNames),
+		dangerousCapability: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "has_capability_dangerous",
+				Help:      "Whether CAP_SYS_ADMIN, CAP_NET_ADMIN, CAP_SYS_PTRACE or CAP_DAC_OVERRIDE is an effective capability of the process.",
+			}, labelNames),
+		setuidActive: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "setuid_active",
+				Help:      "Whether the effective UID of the process differs from its real UID.",
+			}, labelNames),
+		binaryStale: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "binary_stale",
+				Help:      "Whether the executable of the process has been deleted or replaced on disk since it started.",
+			}, labelNames),
+		binaryHashChanged: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "binary_hash_changed",
+				Help:      "Whether the SHA-256 of the executable of the process differs from the previous scrape.",
+			}, labelNames),
+	}
+	m.metricVecs = metricVecs{
+		m.securityScore,
+		m.capabilitiesEffective,
+		m.dangerousCapability,
+		m.setuidActive,
+		m.binaryStale,
+		m.binaryHashChanged,
+	}
+	return m
+}
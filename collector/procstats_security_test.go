@@ -0,0 +1,135 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestComputeSecurityScore(t *testing.T) {
+	for name, tt := range map[string]struct {
+		fields processStatusFields
+		want   int
+	}{
+		"root":              {processStatusFields{}, 0},
+		"non-root":          {processStatusFields{EffectiveUID: 1000}, 1},
+		"seccomp":           {processStatusFields{SeccompMode: 2}, 1},
+		"no_new_privs":      {processStatusFields{NoNewPrivs: true}, 1},
+		"pid namespace":     {processStatusFields{PIDNamespace: 2, HostPIDNamespace: 1}, 1},
+		"host namespace":    {processStatusFields{PIDNamespace: 1, HostPIDNamespace: 1}, 0},
+		"unknown namespace": {processStatusFields{PIDNamespace: 2}, 0},
+		"hardened": {processStatusFields{
+			EffectiveUID:     1000,
+			SeccompMode:      2,
+			NoNewPrivs:       true,
+			PIDNamespace:     2,
+			HostPIDNamespace: 1,
+		}, 4},
+	} {
+		if got := computeSecurityScore(tt.fields); got != tt.want {
+			t.Errorf("%s: want score %d, got %d", name, tt.want, got)
+		}
+	}
+}
+
+func TestParseProcessStatusFields(t *testing.T) {
+	file, err := os.Open("fixtures/proc/1234/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	fields, err := parseProcessStatusFields(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (processStatusFields{RealUID: 126, EffectiveUID: 126, SavedUID: 126, FilesystemUID: 126}); fields != want {
+		t.Errorf("want fields %+v, got %+v", want, fields)
+	}
+
+	fields, err = parseProcessStatusFields(strings.NewReader("Uid:\t1000\t0\t0\t0\nNoNewPrivs:\t1\nSeccomp:\t2\nCapEff:\t000001ffffffffff\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (processStatusFields{RealUID: 1000, SeccompMode: 2, NoNewPrivs: true, EffectiveCapabilities: 1<<41 - 1}); fields != want {
+		t.Errorf("want fields %+v, got %+v", want, fields)
+	}
+
+	if _, err := parseProcessStatusFields(strings.NewReader("Uid:\t0\t0\t0\t0\nCapEff:\tffffffffffffffffff\n")); err == nil {
+		t.Error("want error for an invalid CapEff, got none")
+	}
+
+	if _, err := parseProcessStatusFields(strings.NewReader("Seccomp:\t2\n")); err == nil {
+		t.Error("want error for missing Uid, got none")
+	}
+	for _, uid := range []string{"1000\t0", "1000\t0\t0\tx"} {
+		if _, err := parseProcessStatusFields(strings.NewReader("Uid:\t" + uid + "\n")); err == nil {
+			t.Errorf("%q: want error for an invalid Uid, got none", uid)
+		}
+	}
+}
+
+func TestParseCapabilityMask(t *testing.T) {
+	for hexStr, want := range map[string]uint64{
+		"0000000000000000": 0,
+		"0000000000003000": 1<<12 | 1<<13,
+		"000001ffffffffff": 1<<41 - 1,
+	} {
+		got, err := parseCapabilityMask(hexStr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: want mask %#x, got %#x", hexStr, want, got)
+		}
+	}
+	if _, err := parseCapabilityMask("cap_sys_admin"); err == nil {
+		t.Error("want error, got none")
+	}
+}
+
+func TestHasDangerousCapability(t *testing.T) {
+	for mask, want := range map[uint64]bool{
+		0:                    false,
+		1 << 10:              false, // CAP_NET_BIND_SERVICE
+		1<<10 | 1<<12:        true,  // and CAP_NET_ADMIN
+		1 << 21:              true,  // CAP_SYS_ADMIN
+		1<<41 - 1:            true,
+		1<<0 | 1<<6 | 1<<7:   false, // CAP_CHOWN, CAP_SETGID, CAP_SETUID
+		1<<1 | 1<<19 | 1<<21: true,
+	} {
+		if got := hasDangerousCapability(mask); got != want {
+			t.Errorf("%#x: want %t, got %t", mask, want, got)
+		}
+	}
+}
+
+func TestSetuidActive(t *testing.T) {
+	for name, tt := range map[string]struct {
+		fields processStatusFields
+		want   bool
+	}{
+		"root":            {processStatusFields{}, false},
+		"dropped":         {processStatusFields{RealUID: 1000, EffectiveUID: 1000, SavedUID: 1000, FilesystemUID: 1000}, false},
+		"setuid root":     {processStatusFields{RealUID: 1000, SavedUID: 0, FilesystemUID: 0}, true},
+		"regained":        {processStatusFields{RealUID: 0, EffectiveUID: 1000, SavedUID: 0, FilesystemUID: 1000}, true},
+		"saved root only": {processStatusFields{RealUID: 1000, EffectiveUID: 1000, SavedUID: 0, FilesystemUID: 1000}, false},
+	} {
+		if got := setuidActive(tt.fields); got != tt.want {
+			t.Errorf("%s: want %t, got %t", name, tt.want, got)
+		}
+	}
+}
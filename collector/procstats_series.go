@@ -0,0 +1,173 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"flag"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+)
+
+var maxSeries = flag.Int("collector.procstats.max-series", 10000,
+	"Maximum number of series the procstats collector exposes per scrape. Processes with the lowest resident memory are dropped beyond it. 0 disables the limit.")
+
+// seriesLimiter caps the number of series of a scrape. Series are dropped
+// per process name: the names with the lowest resident memory go first, so
+// that the biggest processes stay visible.
+type seriesLimiter struct {
+	max int
+	// labelNames are the labels identifying the process, the legacy and
+	// the current one.
+	labelNames []string
+	capped     *prometheus.Desc
+}
+
+func newSeriesLimiter(max int, labelNames []string) *seriesLimiter {
+	return &seriesLimiter{
+		max:        max,
+		labelNames: labelNames,
+		capped: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, processSubsystem, "series_capped"),
+			"Whether process series were dropped because the scrape exceeded --collector.procstats.max-series.",
+			nil, nil,
+		),
+	}
+}
+
+// processSeries are the series of a process name.
+type processSeries struct {
+	name    string
+	metrics []prometheus.Metric
+	// rssKilobytes and rssBytes are the summed resident memory of the
+	// legacy and the current memory metric. Either or both may be
+	// exposed, depending on the naming scheme.
+	rssKilobytes, rssBytes float64
+}
+
+func (p *processSeries) rss() float64 {
+	if p.rssKilobytes > 0 {
+		return p.rssKilobytes * 1024
+	}
+	return p.rssBytes
+}
+
+// byRSS sorts processSeries by descending resident memory and by name.
+type byRSS []*processSeries
+
+func (s byRSS) Len() int      { return len(s) }
+func (s byRSS) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byRSS) Less(i, j int) bool {
+	if s[i].rss() != s[j].rss() {
+		return s[i].rss() > s[j].rss()
+	}
+	return s[i].name < s[j].name
+}
+
+// limit returns the metrics to expose, including the series_capped metric.
+// Metrics without process label are always kept.
+func (l *seriesLimiter) limit(metrics []prometheus.Metric) []prometheus.Metric {
+	if len(metrics) <= l.max {
+		return append(metrics, prometheus.MustNewConstMetric(l.capped, prometheus.GaugeValue, 0))
+	}
+
+	var (
+		kept      []prometheus.Metric
+		processes = map[string]*processSeries{}
+	)
+	for _, m := range metrics {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			kept = append(kept, m)
+			continue
+		}
+		name, ok := labelValue(pb, l.labelNames)
+		if !ok {
+			kept = append(kept, m)
+			continue
+		}
+		p, ok := processes[name]
+		if !ok {
+			p = &processSeries{name: name}
+			processes[name] = p
+		}
+		p.metrics = append(p.metrics, m)
+		if metricName, _, err := descNameAndHelp(m.Desc()); err == nil {
+			switch metricName {
+			case "node_process_mem_kilobytes":
+				p.rssKilobytes += pb.GetGauge().GetValue()
+			case "node_process_resident_memory_bytes":
+				p.rssBytes += pb.GetGauge().GetValue()
+			}
+		}
+	}
+
+	sorted := make(byRSS, 0, len(processes))
+	for _, p := range processes {
+		sorted = append(sorted, p)
+	}
+	sort.Sort(sorted)
+
+	// Once a name doesn't fit, all names with less memory are dropped as
+	// well, even if they would fit.
+	var dropped []string
+	for _, p := range sorted {
+		if len(dropped) > 0 || len(kept)+len(p.metrics) > l.max {
+			dropped = append(dropped, p.name)
+			continue
+		}
+		kept = append(kept, p.metrics...)
+	}
+	log.Warnf("Procstats series exceed the limit of %d, dropped the series of %q", l.max, dropped)
+	return append(kept, prometheus.MustNewConstMetric(l.capped, prometheus.GaugeValue, 1))
+}
+
+// labelValue returns the value of the first label of pb with one of the
+// given names.
+func labelValue(pb *dto.Metric, names []string) (string, bool) {
+	for _, l := range pb.GetLabel() {
+		for _, name := range names {
+			if l.GetName() == name {
+				return l.GetValue(), true
+			}
+		}
+	}
+	return "", false
+}
+
+// bufferMetrics returns a channel whose metrics are collected until the
+// returned function is called, which passes them through process, sends
+// the result to out and waits until all metrics have been sent.
+func bufferMetrics(out chan<- prometheus.Metric, process func([]prometheus.Metric) []prometheus.Metric) (chan<- prometheus.Metric, func()) {
+	in := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		var metrics []prometheus.Metric
+		for m := range in {
+			metrics = append(metrics, m)
+		}
+		for _, m := range process(metrics) {
+			out <- m
+		}
+		close(done)
+	}()
+	return in, func() {
+		close(in)
+		<-done
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSeriesLimiter(t *testing.T) {
+	var (
+		pid   = prometheus.NewDesc("node_process_pid", "The PID of the process right now", []string{"name"}, nil)
+		mem   = prometheus.NewDesc("node_process_mem_kilobytes", "Resident memory size of the process in kilobytes (VmRSS).", []string{"name"}, nil)
+		limit = prometheus.NewDesc("node_process_open_fds_soft_limit", "Soft limit on the number of open file descriptors of the process.", []string{"name"}, nil)
+		// ratio has no process label and is never dropped.
+		ratio = prometheus.NewDesc("node_process_resolution_ratio", "Ratio of registered processes whose statistics could be read.", nil, nil)
+	)
+	metrics := []prometheus.Metric{
+		prometheus.MustNewConstMetric(pid, prometheus.GaugeValue, 1, "small"),
+		prometheus.MustNewConstMetric(mem, prometheus.GaugeValue, 10, "small"),
+		prometheus.MustNewConstMetric(pid, prometheus.GaugeValue, 2, "big"),
+		prometheus.MustNewConstMetric(mem, prometheus.GaugeValue, 1000, "big"),
+		prometheus.MustNewConstMetric(pid, prometheus.GaugeValue, 3, "medium"),
+		prometheus.MustNewConstMetric(mem, prometheus.GaugeValue, 100, "medium"),
+		prometheus.MustNewConstMetric(limit, prometheus.GaugeValue, 1024, "medium"),
+		prometheus.MustNewConstMetric(ratio, prometheus.GaugeValue, 1),
+	}
+
+	for max, want := range map[int][]string{
+		8: {
+			`node_process_pid{name="small"} 1`,
+			`node_process_mem_kilobytes{name="small"} 10`,
+			`node_process_pid{name="big"} 2`,
+			`node_process_mem_kilobytes{name="big"} 1000`,
+			`node_process_pid{name="medium"} 3`,
+			`node_process_mem_kilobytes{name="medium"} 100`,
+			`node_process_open_fds_soft_limit{name="medium"} 1024`,
+			`node_process_resolution_ratio 1`,
+			`node_process_series_capped 0`,
+		},
+		6: {
+			`node_process_resolution_ratio 1`,
+			`node_process_pid{name="big"} 2`,
+			`node_process_mem_kilobytes{name="big"} 1000`,
+			`node_process_pid{name="medium"} 3`,
+			`node_process_mem_kilobytes{name="medium"} 100`,
+			`node_process_open_fds_soft_limit{name="medium"} 1024`,
+			`node_process_series_capped 1`,
+		},
+		// small would fit once medium is dropped, but has less memory.
+		5: {
+			`node_process_resolution_ratio 1`,
+			`node_process_pid{name="big"} 2`,
+			`node_process_mem_kilobytes{name="big"} 1000`,
+			`node_process_series_capped 1`,
+		},
+		2: {
+			`node_process_resolution_ratio 1`,
+			`node_process_series_capped 1`,
+		},
+	} {
+		l := newSeriesLimiter(max, []string{"name", "process"})
+		var got []string
+		for _, m := range l.limit(append([]prometheus.Metric{}, metrics...)) {
+			got = append(got, sampleString(t, m))
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("max %d: want %q, got %q", max, want, got)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"flag"
+	"sync"
+	"time"
+)
+
+var (
+	sloWindowSize = flag.Int("collector.procstats.slo-window-size", 10,
+		"Number of recent collections node_process_collection_slo_ratio is computed over.")
+	sloBudget = flag.Int("collector.procstats.slo-budget-ms", 1000,
+		"Latency budget of a collection in milliseconds for node_process_collection_slo_ratio.")
+)
+
+// latencyWindow is a circular buffer of the durations of the latest
+// collections.
+type latencyWindow struct {
+	budget time.Duration
+
+	mtx       sync.Mutex
+	durations []time.Duration
+	next      int
+	full      bool
+}
+
+func newLatencyWindow(size int, budget time.Duration) *latencyWindow {
+	return &latencyWindow{budget: budget, durations: make([]time.Duration, size)}
+}
+
+// add records the duration of a collection, replacing the oldest duration
+// once the window is full.
+func (w *latencyWindow) add(d time.Duration) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	w.durations[w.next] = d
+	w.next = (w.next + 1) % len(w.durations)
+	if w.next == 0 {
+		w.full = true
+	}
+}
+
+// ratio returns the proportion of the recorded durations within the budget.
+// It is 1 before the first duration is recorded.
+func (w *latencyWindow) ratio() float64 {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	n := w.next
+	if w.full {
+		n = len(w.durations)
+	}
+	if n == 0 {
+		return 1
+	}
+	within := 0
+	for _, d := range w.durations[:n] {
+		if d <= w.budget {
+			within++
+		}
+	}
+	return float64(within) / float64(n)
+}
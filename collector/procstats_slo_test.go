@@ -0,0 +1,45 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyWindow(t *testing.T) {
+	w := newLatencyWindow(4, 100*time.Millisecond)
+	if want, got := 1.0, w.ratio(); want != got {
+		t.Errorf("want ratio %f without durations, got %f", want, got)
+	}
+
+	for i, test := range []struct {
+		duration time.Duration
+		ratio    float64
+	}{
+		{duration: 50 * time.Millisecond, ratio: 1},
+		{duration: 100 * time.Millisecond, ratio: 1},
+		{duration: 5 * time.Second, ratio: 2.0 / 3},
+		{duration: 5 * time.Second, ratio: 0.5},
+		// The window is full, the durations within the budget drop out.
+		{duration: 5 * time.Second, ratio: 0.25},
+		{duration: 5 * time.Second, ratio: 0},
+		{duration: 10 * time.Millisecond, ratio: 0.25},
+	} {
+		w.add(test.duration)
+		if got := w.ratio(); test.ratio != got {
+			t.Errorf("%d: want ratio %f, got %f", i, test.ratio, got)
+		}
+	}
+}
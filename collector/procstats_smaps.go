@@ -0,0 +1,82 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var smapsEnabled = flag.Bool("collector.procstats.smaps", false,
+	"Expose the dirty pages, proportional and unique set size of each process. Reads /proc/$PID/smaps_rollup on each scrape, which walks all mappings of the process.")
+
+// getProcessSmapsRollup reads the memory totals of the given process from
+// /proc/$PID/smaps_rollup, in kB.
+func getProcessSmapsRollup(procRoot string, pid int) (map[string]uint64, error) {
+	f, err := os.Open(processFilePath(procRoot, pid, "smaps_rollup"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseSmapsRollup(f)
+}
+
+// parseSmapsRollup parses the "Field: value kB" lines of a smaps_rollup
+// file. The header line of the rollup mapping is skipped.
+func parseSmapsRollup(r io.Reader) (map[string]uint64, error) {
+	fields := map[string]uint64{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) != 3 || parts[2] != "kB" || !strings.HasSuffix(parts[0], ":") {
+			continue
+		}
+		value, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value in smaps_rollup line %q: %s", scanner.Text(), err)
+		}
+		fields[strings.TrimSuffix(parts[0], ":")] = value
+	}
+	return fields, scanner.Err()
+}
+
+// Fields of smaps_rollup summed by smapsRollupBytes: the dirty pages, the
+// proportional set size, which splits shared pages among the processes
+// mapping them, and the unique set size, the pages only the process maps.
+var (
+	smapsDirty = []string{"Private_Dirty", "Shared_Dirty"}
+	smapsPSS   = []string{"Pss"}
+	smapsUSS   = []string{"Private_Clean", "Private_Dirty"}
+)
+
+// smapsRollupBytes returns the sum of the named fields of smaps_rollup in
+// bytes.
+func smapsRollupBytes(fields map[string]uint64, names []string) (uint64, error) {
+	var sum uint64
+	for _, name := range names {
+		v, ok := fields[name]
+		if !ok {
+			return 0, fmt.Errorf("missing %s in smaps_rollup", name)
+		}
+		sum += v
+	}
+	return sum * 1024, nil
+}
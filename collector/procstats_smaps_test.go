@@ -0,0 +1,68 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import "testing"
+
+func TestSmapsRollupBytes(t *testing.T) {
+	fields, err := getProcessSmapsRollup("fixtures/proc", 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := uint64(11708), fields["Rss"]; want != got {
+		t.Errorf("want Rss %d, got %d", want, got)
+	}
+
+	for _, test := range []struct {
+		name   string
+		fields []string
+		want   uint64
+	}{
+		{"dirty", smapsDirty, 5120 * 1024},
+		{"PSS", smapsPSS, 6342 * 1024},
+		{"USS", smapsUSS, 4784 * 1024},
+	} {
+		got, err := smapsRollupBytes(fields, test.fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("want %s bytes %d, got %d", test.name, test.want, got)
+		}
+	}
+
+	if _, err := smapsRollupBytes(map[string]uint64{"Pss": 1}, smapsUSS); err == nil {
+		t.Errorf("want an error for missing fields")
+	}
+}
+
+func TestProcStatsSmapsDisabled(t *testing.T) {
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := collectProcStats(t, c)
+	if _, ok := metrics[`node_process_up{name="hekad"}`]; !ok {
+		t.Fatal("want the process collected")
+	}
+	for _, series := range []string{
+		`node_process_dirty_pages_bytes{name="hekad"}`,
+		`node_process_pss_bytes{name="hekad"}`,
+		`node_process_uss_bytes{name="hekad"}`,
+	} {
+		if _, ok := metrics[series]; ok {
+			t.Errorf("%s: want no series without --collector.procstats.smaps", series)
+		}
+	}
+}
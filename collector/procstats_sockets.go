@@ -0,0 +1,477 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const ssTimeout = 5 * time.Second
+
+var (
+	socketsEnabled = flag.Bool("collector.procstats.sockets", false,
+		"Expose the TCP connections by state, the sockets by protocol, the largest socket receive queue and the listening ports of each process. Reads /proc/$PID/net/tcp, tcp6, udp, udp6 and unix on each scrape, which list the sockets of the whole network namespace.")
+	ssFallback = flag.Bool("collector.procstats.ss-fallback", false,
+		"Count the TCP connections of processes whose file descriptors can't be read from the output of ss. Spawns ss for each such process on every scrape.")
+	ssPath = flag.String("collector.procstats.ss-path", "ss", "Path of the ss binary used by --collector.procstats.ss-fallback.")
+)
+
+// tcpStates are the names of the TCP states by their number in
+// /proc/net/tcp. They match the states of the tcpstat collector, which may
+// be excluded from the build.
+var tcpStates = map[int64]string{
+	1:  "established",
+	2:  "syn_sent",
+	3:  "syn_recv",
+	4:  "fin_wait1",
+	5:  "fin_wait2",
+	6:  "time_wait",
+	7:  "close",
+	8:  "close_wait",
+	9:  "last_ack",
+	10: "listen",
+	11: "closing",
+}
+
+// ssStates maps the states printed by ss to the names of tcpStates.
+var ssStates = map[string]string{
+	"ESTAB":      "established",
+	"SYN-SENT":   "syn_sent",
+	"SYN-RECV":   "syn_recv",
+	"FIN-WAIT-1": "fin_wait1",
+	"FIN-WAIT-2": "fin_wait2",
+	"TIME-WAIT":  "time_wait",
+	"UNCONN":     "close",
+	"CLOSE-WAIT": "close_wait",
+	"LAST-ACK":   "last_ack",
+	"LISTEN":     "listen",
+	"CLOSING":    "closing",
+}
+
+var ssPIDRE = regexp.MustCompile(`pid=(\d+),`)
+
+// getSocketsByState returns the number of TCP sockets of the given process
+// by state. The sockets of the file descriptors of the process are looked up
+// in /proc/$PID/net/tcp and tcp6. If the file descriptors can't be read and
+// ssPath isn't empty, the output of the ss binary at ssPath is parsed
+// instead, unless the process is known to be in another network namespace
+// than the exporter, which ss doesn't show.
+func getSocketsByState(files *processFiles, pid int, ssPath string) (map[string]int, error) {
+	states, err := getProcessSocketsByState(files, pid)
+	if err == nil || ssPath == "" {
+		return states, err
+	}
+	if inode, nerr := getNamespaceInode(files.procRoot, pid, "net"); nerr == nil {
+		if own, oerr := getNamespaceInode(files.procRoot, os.Getpid(), "net"); oerr == nil && own != inode {
+			return nil, fmt.Errorf("%s, and the process isn't in the network namespace shown by ss", err)
+		}
+	}
+	return getSocketsByStateFromSS(ssPath, pid)
+}
+
+// getProcessSocketsByState counts the TCP sockets of the given process by
+// state from procfs.
+func getProcessSocketsByState(files *processFiles, pid int) (map[string]int, error) {
+	fds, err := files.processFDs(pid)
+	if err != nil {
+		return nil, err
+	}
+	inodes := socketInodes(fds)
+	states := map[string]int{}
+	for _, name := range []string{"net/tcp", "net/tcp6"} {
+		f, err := files.open(pid, name)
+		if os.IsNotExist(err) && name == "net/tcp6" {
+			// IPv6 is disabled.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = parseTCPSockets(f, inodes, states)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse %s: %s", name, err)
+		}
+	}
+	return states, nil
+}
+
+// socketTables are the tables of /proc/$PID/net the sockets of a process are
+// looked up in by protocol, and the column of the socket inode in them. The
+// IPv6 tables are missing if IPv6 is disabled.
+var socketTables = []struct {
+	protocol    string
+	names       []string
+	inodeColumn int
+}{
+	{"tcp", []string{"net/tcp", "net/tcp6"}, 9},
+	{"udp", []string{"net/udp", "net/udp6"}, 9},
+	{"unix", []string{"net/unix"}, 6},
+}
+
+// getProcessSocketsByProtocol returns the number of sockets of the given
+// process by protocol: tcp, udp, unix and other, e.g. netlink or raw
+// sockets. A socket open in several file descriptors counts once.
+func getProcessSocketsByProtocol(files *processFiles, pid int) (map[string]int, error) {
+	fds, err := files.processFDs(pid)
+	if err != nil {
+		return nil, err
+	}
+	inodes := socketInodes(fds)
+	counts := map[string]int{"other": len(inodes)}
+	for _, table := range socketTables {
+		counts[table.protocol] = 0
+		for i, name := range table.names {
+			f, err := files.open(pid, name)
+			if os.IsNotExist(err) && i > 0 {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			n, err := countSockets(f, inodes, table.inodeColumn)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't parse %s: %s", name, err)
+			}
+			counts[table.protocol] += n
+			counts["other"] -= n
+		}
+	}
+	return counts, nil
+}
+
+// countSockets returns the number of sockets of a table of /proc/net whose
+// inode, in the given column, is in inodes.
+func countSockets(r io.Reader, inodes map[string]bool, column int) (int, error) {
+	count := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) == 0 || parts[0] == "sl" || parts[0] == "Num" {
+			continue
+		}
+		if len(parts) <= column {
+			return 0, fmt.Errorf("unexpected line %q", scanner.Text())
+		}
+		if inodes[parts[column]] {
+			count++
+		}
+	}
+	return count, scanner.Err()
+}
+
+// socketInodes returns the inodes of the socket file descriptors, whose
+// targets have the form socket:[<inode>].
+func socketInodes(fds []processFD) map[string]bool {
+	inodes := map[string]bool{}
+	for _, fd := range fds {
+		if strings.HasPrefix(fd.target, "socket:[") && strings.HasSuffix(fd.target, "]") {
+			inodes[fd.target[len("socket:["):len(fd.target)-1]] = true
+		}
+	}
+	return inodes
+}
+
+// parseTCPSockets adds the sockets of /proc/net/tcp or tcp6 whose inode is
+// in inodes to states.
+func parseTCPSockets(r io.Reader, inodes map[string]bool, states map[string]int) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) == 0 || parts[0] == "sl" {
+			continue
+		}
+		if len(parts) < 10 {
+			return fmt.Errorf("unexpected line %q", scanner.Text())
+		}
+		if !inodes[parts[9]] {
+			continue
+		}
+		st, err := strconv.ParseInt(parts[3], 16, 8)
+		if err != nil {
+			return err
+		}
+		if name, ok := tcpStates[st]; ok {
+			states[name]++
+		}
+	}
+	return scanner.Err()
+}
+
+// tcpListen is the number of the LISTEN state in /proc/net/tcp.
+const tcpListen = 10
+
+// getProcessListeningPorts returns the sorted local ports of the listening
+// TCP sockets of the given process from /proc/$PID/net/tcp and tcp6. A port
+// listened on for IPv4 and IPv6 is returned once.
+func getProcessListeningPorts(files *processFiles, pid int) ([]int, error) {
+	fds, err := files.processFDs(pid)
+	if err != nil {
+		return nil, err
+	}
+	inodes := socketInodes(fds)
+	ports := map[int]bool{}
+	for _, name := range []string{"net/tcp", "net/tcp6"} {
+		f, err := files.open(pid, name)
+		if os.IsNotExist(err) && name == "net/tcp6" {
+			// IPv6 is disabled.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		err = parseListeningPorts(f, inodes, ports)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse %s: %s", name, err)
+		}
+	}
+	sorted := make([]int, 0, len(ports))
+	for port := range ports {
+		sorted = append(sorted, port)
+	}
+	sort.Ints(sorted)
+	return sorted, nil
+}
+
+// parseListeningPorts adds the local ports of the listening sockets of
+// /proc/net/tcp or tcp6 whose inode is in inodes to ports. The local address
+// has the form <hex address>:<hex port>.
+func parseListeningPorts(r io.Reader, inodes map[string]bool, ports map[int]bool) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) == 0 || parts[0] == "sl" {
+			continue
+		}
+		if len(parts) < 10 {
+			return fmt.Errorf("unexpected line %q", scanner.Text())
+		}
+		if !inodes[parts[9]] {
+			continue
+		}
+		st, err := strconv.ParseInt(parts[3], 16, 8)
+		if err != nil {
+			return err
+		}
+		if st != tcpListen {
+			continue
+		}
+		i := strings.LastIndex(parts[1], ":")
+		if i < 0 {
+			return fmt.Errorf("unexpected local address %q", parts[1])
+		}
+		port, err := strconv.ParseUint(parts[1][i+1:], 16, 16)
+		if err != nil {
+			return err
+		}
+		ports[int(port)] = true
+	}
+	return scanner.Err()
+}
+
+// getProcessMaxRxQueue returns the largest receive queue in bytes of the TCP
+// sockets of the given process from /proc/$PID/net/tcp and tcp6. Reading
+// the buffers of another process's sockets with getsockopt would require
+// privileges.
+func getProcessMaxRxQueue(files *processFiles, pid int) (int, error) {
+	fds, err := files.processFDs(pid)
+	if err != nil {
+		return 0, err
+	}
+	inodes := socketInodes(fds)
+	max := 0
+	for _, name := range []string{"net/tcp", "net/tcp6"} {
+		f, err := files.open(pid, name)
+		if os.IsNotExist(err) && name == "net/tcp6" {
+			// IPv6 is disabled.
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		queue, err := parseMaxRxQueue(f, inodes)
+		if err != nil {
+			return 0, fmt.Errorf("couldn't parse %s: %s", name, err)
+		}
+		if queue > max {
+			max = queue
+		}
+	}
+	return max, nil
+}
+
+// parseMaxRxQueue returns the largest receive queue of the sockets of
+// /proc/net/tcp or tcp6 whose inode is in inodes. The queues have the form
+// <hex tx_queue>:<hex rx_queue>. For listening sockets the receive queue is
+// the number of connections waiting to be accepted instead.
+func parseMaxRxQueue(r io.Reader, inodes map[string]bool) (int, error) {
+	max := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) == 0 || parts[0] == "sl" {
+			continue
+		}
+		if len(parts) < 10 {
+			return 0, fmt.Errorf("unexpected line %q", scanner.Text())
+		}
+		if !inodes[parts[9]] {
+			continue
+		}
+		queues := strings.SplitN(parts[4], ":", 2)
+		if len(queues) != 2 {
+			return 0, fmt.Errorf("unexpected queues %q", parts[4])
+		}
+		queue, err := strconv.ParseUint(queues[1], 16, 32)
+		if err != nil {
+			return 0, err
+		}
+		if int(queue) > max {
+			max = int(queue)
+		}
+	}
+	return max, scanner.Err()
+}
+
+// getSocketsByStateFromSS counts the TCP sockets of the given process by
+// state from the output of the ss binary at ssPath.
+func getSocketsByStateFromSS(ssPath string, pid int) (map[string]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ssTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ssPath, "-tanp")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%s timed out after %s", ssPath, ssTimeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %s: %s", ssPath, err, strings.TrimSpace(stderr.String()))
+	}
+	return parseSSOutput(&stdout, pid)
+}
+
+// parseSSOutput counts the sockets by state in the output of ss -tanp that
+// belong to the given process, e.g.
+//
+//	ESTAB 0 0 10.0.0.1:22 10.0.0.2:5555 users:(("sshd",pid=1234,fd=3))
+func parseSSOutput(r io.Reader, pid int) (map[string]int, error) {
+	states := map[string]int{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) == 0 || parts[0] == "State" {
+			continue
+		}
+		name, ok := ssStates[parts[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown ss state %q", parts[0])
+		}
+		for _, m := range ssPIDRE.FindAllStringSubmatch(scanner.Text(), -1) {
+			if m[1] == strconv.Itoa(pid) {
+				states[name]++
+				break
+			}
+		}
+	}
+	return states, scanner.Err()
+}
+
+// socketMetrics are the network metrics of the registered processes. Most of
+// them are only set with --collector.procstats.sockets.
+type socketMetrics struct {
+	metricVecs
+
+	netNamespaceInode     *prometheus.GaugeVec
+	connectionsByState    *prometheus.GaugeVec
+	byProtocol            *prometheus.GaugeVec
+	socketRxQueue         *prometheus.GaugeVec
+	listeningPorts        *prometheus.GaugeVec
+	expectedPortListening *prometheus.GaugeVec
+}
+
+// newSocketMetrics returns the network metrics of processes with the given
+// label names.
+func newSocketMetrics(labelNames []string) *socketMetrics {
+	m := &socketMetrics{
+		netNamespaceInode: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "net_namespace_inode",
+				Help:      "Inode number of the network namespace of the process. Processes with the same inode share a network stack.",
+			}, labelNames),
+		connectionsByState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "connections_by_state",
+				Help:      "Number of TCP sockets of the process by state.",
+			}, withLabelNames(labelNames, "state")),
+		byProtocol: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "sockets",
+				Help:      "Number of open sockets of the process by protocol, tcp, udp, unix or other.",
+			}, withLabelNames(labelNames, "protocol")),
+		socketRxQueue: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "socket_rx_queue_bytes",
+				Help:      "Largest receive queue of the TCP sockets of the process in bytes.",
+			}, labelNames),
+		listeningPorts: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "listening_ports_total",
+				Help:      "Number of local TCP ports the process listens on.",
+			}, labelNames),
+		expectedPortListening: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "expected_port_listening",
+				Help:      "Whether the process listens on the TCP port it is expected to from the config file.",
+			}, withLabelNames(labelNames, "port")),
+	}
+	m.metricVecs = metricVecs{
+		m.netNamespaceInode,
+		m.connectionsByState,
+		m.byProtocol,
+		m.socketRxQueue,
+		m.listeningPorts,
+		m.expectedPortListening,
+	}
+	return m
+}
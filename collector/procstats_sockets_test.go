@@ -0,0 +1,234 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testProcNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1001 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1F90 0100007F:A0C2 01 00000000:00000000 00:00000000 00000000     0        0 1002 1 0000000000000000 20 4 30 10 -1
+   2: 0100007F:1F90 0100007F:A0C4 01 00000000:00000000 00:00000000 00000000     0        0 1003 1 0000000000000000 20 4 30 10 -1
+   3: 0100007F:A0C6 0100007F:0CEA 08 00000000:00000000 00:00000000 00000000     0        0 2001 1 0000000000000000 20 4 30 10 -1
+`
+
+const testSSOutput = `State      Recv-Q Send-Q Local Address:Port  Peer Address:Port Process
+LISTEN     0      128    0.0.0.0:8080      0.0.0.0:*         users:(("hekad",pid=1234,fd=3))
+ESTAB      0      0      127.0.0.1:8080    127.0.0.1:41154   users:(("hekad",pid=1234,fd=5),("hekad",pid=1240,fd=5))
+ESTAB      0      0      127.0.0.1:41154   127.0.0.1:8080    users:(("curl",pid=12345,fd=3))
+TIME-WAIT  0      0      127.0.0.1:41156   127.0.0.1:8080
+`
+
+func TestGetSocketsByState(t *testing.T) {
+	dir := t.TempDir()
+
+	makeFDDir(t, dir, "1234", []string{"socket:[1001]", "socket:[1002]", "socket:[1003]", "/dev/null", "pipe:[2001]"})
+	if err := os.MkdirAll(filepath.Join(dir, "1234", "net"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "1234", "net", "tcp"), []byte(testProcNetTCP), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := getSocketsByState(newProcessFiles(dir), 1234, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"listen": 1, "established": 2}; !reflect.DeepEqual(states, want) {
+		t.Errorf("want states %v, got %v", want, states)
+	}
+}
+
+func TestGetProcessSocketsByProtocol(t *testing.T) {
+	dir := t.TempDir()
+
+	makeFDDir(t, dir, "1234", []string{"socket:[1001]", "socket:[1002]", "socket:[1001]", "socket:[1004]", "socket:[1005]", "socket:[1006]", "/dev/null"})
+	if err := os.MkdirAll(filepath.Join(dir, "1234", "net"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// No tcp6 and udp6 tables, as with IPv6 disabled. 1006 is a netlink
+	// socket.
+	for name, table := range map[string]string{
+		"tcp": testProcNetTCP,
+		"udp": `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  0: 00000000:0044 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 1004 2 0000000000000000 0
+  1: 00000000:0045 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 3004 2 0000000000000000 0
+`,
+		"unix": `Num       RefCount Protocol Flags    Type St Inode Path
+0000000000000000: 00000002 00000000 00010000 0001 01 1005 /run/systemd/notify
+0000000000000000: 00000002 00000000 00010000 0001 01 3005
+`,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, "1234", "net", name), []byte(table), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counts, err := getProcessSocketsByProtocol(newProcessFiles(dir), 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"tcp": 2, "udp": 1, "unix": 1, "other": 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("want sockets %v, got %v", want, counts)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "1234", "net", "unix")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getProcessSocketsByProtocol(newProcessFiles(dir), 1234); err == nil {
+		t.Error("want error for a missing unix table, got none")
+	}
+}
+
+func TestGetProcessListeningPorts(t *testing.T) {
+	dir := t.TempDir()
+
+	makeFDDir(t, dir, "1234", []string{"socket:[1001]", "socket:[1002]", "socket:[1004]", "socket:[1005]"})
+	if err := os.MkdirAll(filepath.Join(dir, "1234", "net"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "1234", "net", "tcp"), []byte(testProcNetTCP), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 8080 on IPv6 as well, 9090 only on IPv6 and 9100 by another process.
+	tcp6 := `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:1F90 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1004 1 0000000000000000 100 0 0 10 0
+   1: 00000000000000000000000000000000:2382 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1005 1 0000000000000000 100 0 0 10 0
+   2: 00000000000000000000000000000000:238C 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 3005 1 0000000000000000 100 0 0 10 0
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "1234", "net", "tcp6"), []byte(tcp6), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ports, err := getProcessListeningPorts(newProcessFiles(dir), 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{8080, 9090}; !reflect.DeepEqual(ports, want) {
+		t.Errorf("want ports %v, got %v", want, ports)
+	}
+
+	if _, err := getProcessListeningPorts(newProcessFiles(dir), 4321); err == nil {
+		t.Error("want error for missing process, got none")
+	}
+}
+
+func TestGetProcessMaxRxQueue(t *testing.T) {
+	dir := t.TempDir()
+
+	makeFDDir(t, dir, "1234", []string{"socket:[1001]", "socket:[1002]"})
+	if err := os.MkdirAll(filepath.Join(dir, "1234", "net"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// The transmit queue of 1001 and the receive queue of 1003 of another
+	// process don't count.
+	tcp := `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F90 0100007F:A0C2 01 00100000:00000010 00:00000000 00000000     0        0 1001 1 0000000000000000 20 4 30 10 -1
+   1: 0100007F:1F90 0100007F:A0C4 01 00000000:00000200 00:00000000 00000000     0        0 1002 1 0000000000000000 20 4 30 10 -1
+   2: 0100007F:1F90 0100007F:A0C6 01 00000000:00010000 00:00000000 00000000     0        0 1003 1 0000000000000000 20 4 30 10 -1
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "1234", "net", "tcp"), []byte(tcp), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	queue, err := getProcessMaxRxQueue(newProcessFiles(dir), 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue != 512 {
+		t.Errorf("want a receive queue of 512 bytes, got %d", queue)
+	}
+
+	if _, err := parseMaxRxQueue(strings.NewReader("   0: 0100007F:1F90 0100007F:A0C2 01 00000000 00:00000000 00000000     0        0 1001 1"), map[string]bool{"1001": true}); err == nil {
+		t.Error("want error for invalid queues, got none")
+	}
+}
+
+func TestProcStatsExpectedPortListening(t *testing.T) {
+	for port, want := range map[int]float64{8080: 1, 9090: 0} {
+		c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.expectedPorts = map[string]int{"hekad": port}
+
+		series := fmt.Sprintf(`node_process_expected_port_listening{name="hekad",port="%d"}`, port)
+		if got, ok := collectProcStats(t, c)[series]; !ok || got != want {
+			t.Errorf("%s: want %f, got %f (%t)", series, want, got, ok)
+		}
+	}
+}
+
+func TestGetSocketsByStateSSFallback(t *testing.T) {
+	dir := t.TempDir()
+	ss := filepath.Join(dir, "ss")
+	if err := ioutil.WriteFile(ss, []byte("#!/bin/sh\ncat <<'EOF'\n"+testSSOutput+"EOF\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The process has no readable file descriptors.
+	if _, err := getSocketsByState(newProcessFiles(dir), 1234, ""); err == nil {
+		t.Errorf("want an error without the ss fallback")
+	}
+
+	states, err := getSocketsByState(newProcessFiles(dir), 1234, ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"listen": 1, "established": 1}; !reflect.DeepEqual(states, want) {
+		t.Errorf("want states %v, got %v", want, states)
+	}
+}
+
+func TestParseSSOutput(t *testing.T) {
+	states, err := parseSSOutput(strings.NewReader(testSSOutput), 1240)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"established": 1}; !reflect.DeepEqual(states, want) {
+		t.Errorf("want states %v, got %v", want, states)
+	}
+
+	if _, err := parseSSOutput(strings.NewReader("BOGUS 0 0 a b\n"), 1240); err == nil {
+		t.Errorf("want an error for an unknown state")
+	}
+}
+
+func TestProcStatsSocketsDisabled(t *testing.T) {
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := collectProcStats(t, c)
+	if _, ok := metrics[`node_process_up{name="hekad"}`]; !ok {
+		t.Fatal("want the process collected")
+	}
+	for _, series := range []string{
+		`node_process_connections_by_state{name="hekad",state="established"}`,
+		`node_process_sockets{name="hekad",protocol="tcp"}`,
+		`node_process_socket_rx_queue_bytes{name="hekad"}`,
+		`node_process_listening_ports_total{name="hekad"}`,
+	} {
+		if _, ok := metrics[series]; ok {
+			t.Errorf("%s: want no series without --collector.procstats.sockets", series)
+		}
+	}
+}
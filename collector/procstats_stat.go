@@ -0,0 +1,240 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"github.com/prometheus/procfs"
+)
+
+// userHZ is the number of clock ticks per second used by the time fields of
+// /proc/$PID/stat. It is 100 on all architectures supported by Linux.
+const userHZ = 100
+
+// processStat holds the fields of /proc/$PID/stat used by the procstats
+// collector.
+type processStat struct {
+	// State is the state of the process, e.g. "R" for running or "D" for
+	// uninterruptible sleep.
+	State string
+	// PPID is the PID of the parent of the process.
+	PPID int
+	// UTime and STime are the time the process spent in user and kernel
+	// mode, in clock ticks.
+	UTime, STime uint64
+	// StartTime is the time the process started after system boot, in
+	// clock ticks.
+	StartTime uint64
+	// DelayacctBlkioTicks is the time the process waited for block IO, in
+	// clock ticks. It is 0 if delay accounting is disabled or the kernel
+	// doesn't report it.
+	DelayacctBlkioTicks uint64
+}
+
+// parseProcessStat parses the contents of a /proc/$PID/stat file. See proc(5)
+// for the meaning of the fields.
+func parseProcessStat(r io.Reader) (processStat, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return processStat{}, err
+	}
+	// The comm field is enclosed in parentheses and may itself contain
+	// spaces and parentheses, so the remaining fields start after the last
+	// closing parenthesis.
+	text := string(data)
+	end := strings.LastIndex(text, ")")
+	if end < 0 {
+		return processStat{}, fmt.Errorf("couldn't find end of comm field in %q", text)
+	}
+	// fields[0] is field 3 (state) in proc(5) numbering.
+	fields := strings.Fields(text[end+1:])
+	if len(fields) < 20 {
+		return processStat{}, fmt.Errorf("expected at least 22 fields, got %d", len(fields)+2)
+	}
+
+	stat := processStat{State: fields[0]}
+	if stat.PPID, err = strconv.Atoi(fields[1]); err != nil {
+		return processStat{}, fmt.Errorf("invalid ppid %q: %s", fields[1], err)
+	}
+	for _, f := range []struct {
+		dst   *uint64
+		index int
+		name  string
+	}{
+		{&stat.UTime, 11, "utime"},
+		{&stat.STime, 12, "stime"},
+		{&stat.StartTime, 19, "starttime"},
+		{&stat.DelayacctBlkioTicks, 39, "delayacct_blkio_ticks"},
+	} {
+		if f.index >= len(fields) {
+			continue
+		}
+		*f.dst, err = strconv.ParseUint(fields[f.index], 10, 64)
+		if err != nil {
+			return processStat{}, fmt.Errorf("invalid %s %q: %s", f.name, fields[f.index], err)
+		}
+	}
+	return stat, nil
+}
+
+// processStartTime returns the start time of the given process in seconds
+// since the Epoch, computed from its starttime and the system boot time.
+func processStartTime(files *processFiles, pid int) (float64, error) {
+	stat, err := files.stat(pid)
+	if err != nil {
+		return 0, err
+	}
+	bootTime, err := files.bootTime()
+	if err != nil {
+		return 0, err
+	}
+	return stat.startTimeSeconds(bootTime), nil
+}
+
+// startTimeSeconds returns the start time of the process in seconds since
+// the Epoch, given the system boot time.
+func (s processStat) startTimeSeconds(bootTime float64) float64 {
+	return bootTime + float64(s.StartTime)/userHZ
+}
+
+// processUptime returns the seconds since startTime, in seconds since the
+// Epoch, at now.
+func processUptime(startTime float64, now time.Time) float64 {
+	return float64(now.UnixNano())/1e9 - startTime
+}
+
+// getBootTime returns the system boot time in seconds since the Epoch.
+func getBootTime(procRoot string) (float64, error) {
+	fs, err := procfs.NewFS(procRoot)
+	if err != nil {
+		return 0, err
+	}
+	kernelStat, err := fs.NewStat()
+	if err != nil {
+		return 0, err
+	}
+	return float64(kernelStat.BootTime), nil
+}
+
+// oldestProcessAge returns the age in seconds of the process that started
+// first among pids. It returns false if the start time of none of them can
+// be read.
+func oldestProcessAge(files *processFiles, pids []int, now time.Time) (float64, bool) {
+	if len(pids) == 0 {
+		return 0, false
+	}
+	bootTime, err := files.bootTime()
+	if err != nil {
+		log.Debugf("Unable to read the boot time: %s", err)
+		return 0, false
+	}
+	var (
+		oldest uint64
+		found  bool
+	)
+	for _, pid := range pids {
+		stat, err := files.stat(pid)
+		if err != nil {
+			// The process may have exited since it was resolved.
+			continue
+		}
+		if !found || stat.StartTime < oldest {
+			oldest, found = stat.StartTime, true
+		}
+	}
+	if !found {
+		return 0, false
+	}
+	return float64(now.UnixNano())/1e9 - (bootTime + float64(oldest)/userHZ), true
+}
+
+// cpuMetrics are the CPU and scheduling metrics of the registered processes.
+type cpuMetrics struct {
+	metricVecs
+
+	cpuSeconds    *prometheus.CounterVec
+	cpuAffinity   *prometheus.GaugeVec
+	runqueueWait  *prometheus.CounterVec
+	idleSeconds   *prometheus.GaugeVec
+	kernelBlocked *prometheus.GaugeVec
+	threadsState  *prometheus.GaugeVec
+}
+
+// newCPUMetrics returns the CPU metrics of processes with the given label
+// names.
+func newCPUMetrics(labelNames []string) *cpuMetrics {
+	m := &cpuMetrics{
+		cpuSeconds: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "cpu_seconds_total",
+				Help:      "CPU time of the process in seconds by mode, user or system.",
+			}, withLabelNames(labelNames, "mode")),
+		cpuAffinity: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "cpu_affinity",
+				Help:      "Whether the process may run on the CPU, from Cpus_allowed of /proc/$PID/status.",
+			}, withLabelNames(labelNames, "cpu")),
+		runqueueWait: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "runqueue_wait_seconds_total",
+				Help:      "Time the process spent waiting on a runqueue to run, from /proc/$PID/schedstat.",
+			}, labelNames),
+		idleSeconds: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "idle_seconds",
+				Help:      "Seconds since the CPU time of the process last changed between scrapes.",
+			}, labelNames),
+		kernelBlocked: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "kernel_blocked",
+				Help:      "Whether the process is in uninterruptible sleep in the kernel function of the wchan label of node_process_info.",
+			}, labelNames),
+		threadsState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "threads_state",
+				Help:      "Number of threads of the process by scheduling state.",
+			}, withLabelNames(labelNames, "state")),
+	}
+	m.metricVecs = metricVecs{
+		m.cpuSeconds,
+		m.cpuAffinity,
+		m.runqueueWait,
+		m.idleSeconds,
+		m.kernelBlocked,
+		m.threadsState,
+	}
+	return m
+}
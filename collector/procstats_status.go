@@ -0,0 +1,179 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// parseStatusFile returns the fields of /proc/$PID/status by name, their
+// values as written by the kernel without the surrounding whitespace, e.g.
+// "11708 kB", "1000\t1000\t1000\t1000" or "S (sleeping)". The values are
+// converted by the callers, see parseMemoryKilobytes and parseStatusUIDs.
+// Lines without a colon are skipped, the value of a field without one is
+// empty. Only the first colon separates the name, so names of processes may
+// contain colons.
+func parseStatusFile(r io.Reader) (map[string]string, error) {
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		fields[parts[0]] = strings.TrimSpace(parts[1])
+	}
+	return fields, scanner.Err()
+}
+
+// processStates are the state codes of the State field of /proc/$PID/status
+// and the names exported for them, see proc(5).
+var processStates = []struct {
+	code byte
+	name string
+}{
+	{'R', "running"},
+	{'S', "sleeping"},
+	{'D', "waiting"},
+	{'Z', "zombie"},
+	{'T', "stopped"},
+	{'t', "tracing-stop"},
+	{'X', "dead"},
+	{'I', "idle"},
+}
+
+// parseStatusState returns the state code of the value of the State field of
+// /proc/$PID/status, e.g. 'S' of "S (sleeping)".
+func parseStatusState(value string) (byte, error) {
+	parts := strings.Fields(value)
+	if len(parts) == 0 || len(parts[0]) != 1 {
+		return 0, fmt.Errorf("invalid State %q", value)
+	}
+	return parts[0][0], nil
+}
+
+// parseStatusUIDs parses the value of the Uid field of /proc/$PID/status:
+// the real, effective, saved set and filesystem UID.
+func parseStatusUIDs(value string) ([4]uint64, error) {
+	var uids [4]uint64
+	parts := strings.Fields(value)
+	if len(parts) != len(uids) {
+		return uids, fmt.Errorf("invalid Uid %q", value)
+	}
+	for i, part := range parts {
+		uid, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return uids, err
+		}
+		uids[i] = uid
+	}
+	return uids, nil
+}
+
+// statusMetrics are the metrics of the registered processes read from the
+// basic fields of /proc/$PID/status.
+type statusMetrics struct {
+	metricVecs
+
+	pid                      *prometheus.GaugeVec
+	memKilobytes             *prometheus.GaugeVec
+	voluntaryCtxtSwitches    *prometheus.CounterVec
+	nonvoluntaryCtxtSwitches *prometheus.CounterVec
+	threads                  *prometheus.GaugeVec
+	signalsPending           *prometheus.GaugeVec
+	signalsCaught            *prometheus.GaugeVec
+	processState             *prometheus.GaugeVec
+}
+
+// newStatusMetrics returns the status metrics of processes with the given
+// label names.
+func newStatusMetrics(labelNames []string) *statusMetrics {
+	m := &statusMetrics{
+		pid: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "pid",
+				Help:      "The PID of the process right now",
+			}, labelNames),
+		memKilobytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "mem_kilobytes",
+				Help:      "Resident memory size of the process in kilobytes (VmRSS).",
+			}, labelNames),
+		voluntaryCtxtSwitches: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "voluntary_context_switches_total",
+				Help:      "Number of voluntary context switches of the process.",
+			}, labelNames),
+		nonvoluntaryCtxtSwitches: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "nonvoluntary_context_switches_total",
+				Help:      "Number of nonvoluntary context switches of the process.",
+			}, labelNames),
+		threads: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "threads",
+				Help:      "Number of threads of the process.",
+			}, labelNames),
+		signalsPending: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "signals_pending_count",
+				Help:      "Number of signals pending for the main thread of the process.",
+			}, labelNames),
+		signalsCaught: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "signals_caught_count",
+				Help:      "Number of signals the process has a handler installed for.",
+			}, labelNames),
+		processState: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "state",
+				Help:      "Whether the process is in the scheduling state, from the State field of /proc/$PID/status.",
+			}, withLabelNames(labelNames, "state")),
+	}
+	m.metricVecs = metricVecs{
+		m.pid,
+		m.memKilobytes,
+		m.voluntaryCtxtSwitches,
+		m.nonvoluntaryCtxtSwitches,
+		m.threads,
+		m.signalsPending,
+		m.signalsCaught,
+		m.processState,
+	}
+	return m
+}
@@ -0,0 +1,107 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseStatusFile(t *testing.T) {
+	// The field formats of proc(5).
+	status := `Name:	weird: name
+Umask:	0022
+State:	S (sleeping)
+Tgid:	1234
+Uid:	1000	0	1000	1000
+Groups:
+VmRSS:	   11708 kB
+VmPTE:	124
+SigQ:	0/31632
+SigCgt:	0000000180014003
+Cpus_allowed:	ffffffff,ffffffff
+Cpus_allowed_list:	0-3,8
+NoNewPrivs:	0
+Speculation_Store_Bypass:	thread vulnerable
+no colon
+`
+	fields, err := parseStatusFile(strings.NewReader(status))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Name":                     "weird: name",
+		"Umask":                    "0022",
+		"State":                    "S (sleeping)",
+		"Tgid":                     "1234",
+		"Uid":                      "1000\t0\t1000\t1000",
+		"Groups":                   "",
+		"VmRSS":                    "11708 kB",
+		"VmPTE":                    "124",
+		"SigQ":                     "0/31632",
+		"SigCgt":                   "0000000180014003",
+		"Cpus_allowed":             "ffffffff,ffffffff",
+		"Cpus_allowed_list":        "0-3,8",
+		"NoNewPrivs":               "0",
+		"Speculation_Store_Bypass": "thread vulnerable",
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("want fields %q, got %q", want, fields)
+	}
+
+	f, err := os.Open("fixtures/proc/1234/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if fields, err = parseStatusFile(f); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "hekad", fields["Name"]; want != got {
+		t.Errorf("want Name %q, got %q", want, got)
+	}
+}
+
+func TestParseStatusState(t *testing.T) {
+	for value, want := range map[string]byte{"S (sleeping)": 'S', "t (tracing stop)": 't', "Z": 'Z'} {
+		if got, err := parseStatusState(value); err != nil || got != want {
+			t.Errorf("%q: want %c, got %c (%v)", value, want, got, err)
+		}
+	}
+	for _, invalid := range []string{"", "sleeping", "(sleeping)"} {
+		if _, err := parseStatusState(invalid); err == nil {
+			t.Errorf("want error for State %q, got none", invalid)
+		}
+	}
+}
+
+func TestParseStatusUIDs(t *testing.T) {
+	uids, err := parseStatusUIDs("1000\t0\t1000\t1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [4]uint64{1000, 0, 1000, 1000}; uids != want {
+		t.Errorf("want UIDs %v, got %v", want, uids)
+	}
+
+	for _, invalid := range []string{"", "1000 0 1000", "1000 0 1000 1000 1", "1000 x 1000 1000"} {
+		if _, err := parseStatusUIDs(invalid); err == nil {
+			t.Errorf("want error for Uid %q, got none", invalid)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/rpc"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kolo/xmlrpc"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultSupervisorTimeout bounds supervisor queries without a configured
+// timeout.
+const defaultSupervisorTimeout = 5 * time.Second
+
+// supervisedProcess is a process managed by a supervisor. pid is 0 if the
+// process is not running.
+type supervisedProcess struct {
+	name string
+	pid  int
+}
+
+// supervisorClient lists the processes managed by a supervisor.
+type supervisorClient interface {
+	processes() ([]supervisedProcess, error)
+}
+
+// supervisorProtocols are the supported supervisor types, by the type of
+// the supervisor config.
+var supervisorProtocols = map[string]func(url string, timeout time.Duration) (supervisorClient, error){
+	"supervisord": newSupervisordClient,
+}
+
+// supervisorTransport returns an HTTP transport with the given timeout for
+// connecting and waiting for the response. unix:// URLs connect to the Unix
+// socket at their path, the returned URL is to be used for requests.
+func supervisorTransport(rawURL string, timeout time.Duration) (http.RoundTripper, string) {
+	dialer := &net.Dialer{Timeout: timeout}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		ResponseHeaderTimeout: timeout,
+	}
+	if strings.HasPrefix(rawURL, "unix://") {
+		socket := strings.TrimPrefix(rawURL, "unix://")
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+		rawURL = "http://localhost/RPC2"
+	}
+	return transport, rawURL
+}
+
+// supervisordClient queries supervisord over its XML-RPC interface.
+type supervisordClient struct {
+	url       string
+	transport http.RoundTripper
+
+	mtx    sync.Mutex
+	client *xmlrpc.Client
+}
+
+func newSupervisordClient(rawURL string, timeout time.Duration) (supervisorClient, error) {
+	transport, rawURL := supervisorTransport(rawURL, timeout)
+	client, err := xmlrpc.NewClient(rawURL, transport)
+	if err != nil {
+		return nil, err
+	}
+	return &supervisordClient{url: rawURL, transport: transport, client: client}, nil
+}
+
+func (c *supervisordClient) processes() ([]supervisedProcess, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var infos []struct {
+		Name  string `xmlrpc:"name"`
+		Group string `xmlrpc:"group"`
+		PID   int    `xmlrpc:"pid"`
+	}
+	err := c.client.Call("supervisor.getAllProcessInfo", nil, &infos)
+	if err == rpc.ErrShutdown {
+		// A failed response shuts the RPC client down for good.
+		if c.client, err = xmlrpc.NewClient(c.url, c.transport); err != nil {
+			return nil, err
+		}
+		err = c.client.Call("supervisor.getAllProcessInfo", nil, &infos)
+	}
+	if err != nil {
+		return nil, err
+	}
+	procs := make([]supervisedProcess, 0, len(infos))
+	for _, info := range infos {
+		// Processes of a group are addressed as group:name by supervisorctl.
+		name := info.Name
+		if info.Group != "" && info.Group != info.Name {
+			name = info.Group + ":" + info.Name
+		}
+		procs = append(procs, supervisedProcess{name: name, pid: info.PID})
+	}
+	return procs, nil
+}
+
+// supervisorResolver reports the processes managed by a supervisor, labelled
+// with the name the supervisor gives them.
+type supervisorResolver struct {
+	name    string
+	client  supervisorClient
+	ttl     time.Duration
+	metrics processStatMetrics
+
+	mtx     sync.Mutex
+	procs   []supervisedProcess
+	expires time.Time
+}
+
+func newSupervisorResolver(p processConfig) (*supervisorResolver, error) {
+	newClient, ok := supervisorProtocols[p.Supervisor.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown supervisor type %q", p.Supervisor.Type)
+	}
+	timeout := time.Duration(p.Supervisor.Timeout)
+	if timeout == 0 {
+		timeout = defaultSupervisorTimeout
+	}
+	client, err := newClient(p.Supervisor.URL, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &supervisorResolver{
+		name:    p.Name,
+		client:  client,
+		ttl:     time.Duration(p.Supervisor.CacheTTL),
+		metrics: newProcessStatMetrics([]string{"name", "service"}),
+	}, nil
+}
+
+// resolve returns the processes managed by the supervisor. Results are
+// cached for the configured TTL.
+func (r *supervisorResolver) resolve() ([]supervisedProcess, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.procs != nil && time.Now().Before(r.expires) {
+		return r.procs, nil
+	}
+	procs, err := r.client.processes()
+	if err != nil {
+		return nil, err
+	}
+	r.procs = procs
+	r.expires = time.Now().Add(r.ttl)
+	return procs, nil
+}
+
+// collect sends the stats of the running processes of the supervisor to ch
+// and returns their PIDs.
+func (r *supervisorResolver) collect(procRoot string, ch chan<- prometheus.Metric) []int {
+	procs, err := r.resolve()
+	if err != nil {
+		processLogger(r.name, 0).Errorf("Unable to query the supervisor: %s", err)
+		return nil
+	}
+	var pids []int
+	for _, p := range procs {
+		if p.pid <= 0 {
+			continue
+		}
+		pids = append(pids, p.pid)
+		f, err := os.Open(processFilePath(procRoot, p.pid, "status"))
+		if err != nil {
+			processLogger(r.name, p.pid).Debugf("Unable to open the status of %s: %s", p.name, err)
+			continue
+		}
+		stats, err := parseProcessStats(f, p.pid)
+		f.Close()
+		if err != nil {
+			processLogger(r.name, p.pid).Errorf("Unable to parse the process statistics: %s", err)
+			continue
+		}
+		r.metrics.collect(ch, stats, r.name, p.name)
+	}
+	return pids
+}
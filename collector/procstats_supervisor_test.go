@@ -0,0 +1,112 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const supervisordProcessInfo = `<?xml version="1.0"?>
+<methodResponse><params><param><value><array><data>
+<value><struct>
+<member><name>name</name><value><string>hekad</string></value></member>
+<member><name>group</name><value><string>hekad</string></value></member>
+<member><name>statename</name><value><string>RUNNING</string></value></member>
+<member><name>pid</name><value><int>1234</int></value></member>
+</struct></value>
+<value><struct>
+<member><name>name</name><value><string>worker_1</string></value></member>
+<member><name>group</name><value><string>workers</string></value></member>
+<member><name>statename</name><value><string>STOPPED</string></value></member>
+<member><name>pid</name><value><int>0</int></value></member>
+</struct></value>
+</data></array></value></param></params></methodResponse>`
+
+func TestSupervisorResolver(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "supervisor.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	var (
+		mtx     sync.Mutex
+		queries int
+	)
+	go http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !strings.Contains(string(body), "supervisor.getAllProcessInfo") {
+			http.Error(w, "unexpected method", http.StatusBadRequest)
+			return
+		}
+		mtx.Lock()
+		queries++
+		mtx.Unlock()
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(supervisordProcessInfo))
+	}))
+
+	r, err := newSupervisorResolver(processConfig{
+		Name: "supervised",
+		Supervisor: &supervisorConfig{
+			Type:     "supervisord",
+			URL:      "unix://" + socket,
+			CacheTTL: duration(time.Hour),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	procs, err := r.resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []supervisedProcess{{name: "hekad", pid: 1234}, {name: "workers:worker_1"}}
+	if !reflect.DeepEqual(want, procs) {
+		t.Errorf("want processes %+v, got %+v", want, procs)
+	}
+
+	ch := make(chan prometheus.Metric, 10)
+	if pids := r.collect("fixtures/proc", ch); !reflect.DeepEqual([]int{1234}, pids) {
+		t.Errorf("want PIDs [1234], got %v", pids)
+	}
+	close(ch)
+	var got []string
+	for m := range ch {
+		got = append(got, sampleString(t, m))
+	}
+	sort.Strings(got)
+	if want := `node_process_mem_kilobytes{name="supervised",service="hekad"} 11708`; len(got) != 4 || got[0] != want {
+		t.Errorf("want %s among 4 metrics, got %v", want, got)
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if queries != 1 {
+		t.Errorf("want 1 cached query, got %d", queries)
+	}
+}
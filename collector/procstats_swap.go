@@ -0,0 +1,43 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"math"
+	"time"
+)
+
+// swapSample is the swapped out memory of a process at a scrape.
+type swapSample struct {
+	time  time.Time
+	pid   int
+	bytes float64
+}
+
+// swapRate returns the absolute change per second of the swapped out memory
+// of a process from last to current. VmSwap goes up and down, both moving
+// pages to and from swap, so a steady rate above 0 reveals thrashing. There
+// is no rate without a previous sample of the same process.
+func swapRate(last swapSample, ok bool, current swapSample) (float64, bool) {
+	if !ok || last.pid != current.pid {
+		return 0, false
+	}
+	elapsed := current.time.Sub(last.time).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	return math.Abs(current.bytes-last.bytes) / elapsed, true
+}
@@ -0,0 +1,51 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSwapRate(t *testing.T) {
+	start := time.Unix(1000, 0)
+	var (
+		last swapSample
+		ok   bool
+	)
+	for i, test := range []struct {
+		pid     int
+		bytes   float64
+		hasRate bool
+		rate    float64
+	}{
+		// The first scrape has no rate.
+		{pid: 1, bytes: 1000},
+		// Increasing, decreasing and stable swap.
+		{pid: 1, bytes: 11000, hasRate: true, rate: 1000},
+		{pid: 1, bytes: 6000, hasRate: true, rate: 500},
+		{pid: 1, bytes: 6000, hasRate: true, rate: 0},
+		// A restart starts over.
+		{pid: 2, bytes: 0},
+	} {
+		current := swapSample{time: start.Add(time.Duration(i) * 10 * time.Second), pid: test.pid, bytes: test.bytes}
+		rate, hasRate := swapRate(last, ok, current)
+		last, ok = current, true
+		if hasRate != test.hasRate || rate != test.rate {
+			t.Errorf("%d: want rate %g (%t), got %g (%t)", i, test.rate, test.hasRate, rate, hasRate)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-systemd/dbus"
+)
+
+var systemdUnits = flag.String("collector.procstats.systemd-units", "",
+	"Comma-separated list of systemd units whose main process is registered as the process named like the unit without the .service suffix. The main PID is queried from systemd over D-Bus, falling back to the PID file of the process if systemd can't be reached.")
+
+// systemdUnavailableOnce warns the first time systemd can't be reached, the
+// later failures are only logged at debug level.
+var systemdUnavailableOnce sync.Once
+
+// systemdActiveStates are the values of the ActiveState property of a unit.
+var systemdActiveStates = []string{"active", "activating", "deactivating", "inactive", "failed", "reloading"}
+
+// systemdUnit holds the properties of a systemd service read by the procstats
+// collector.
+type systemdUnit struct {
+	// MainPID is 0 if the service isn't running.
+	MainPID     int
+	ActiveState string
+	// Restarts is the number of automatic restarts of the service, if
+	// HasRestarts. NRestarts was added in systemd 235.
+	Restarts    int
+	HasRestarts bool
+}
+
+// systemdClient reads the properties of systemd units.
+type systemdClient interface {
+	unit(name string) (systemdUnit, error)
+	close()
+}
+
+// dbusSystemdClient reads the properties of systemd units over D-Bus.
+type dbusSystemdClient struct {
+	conn *dbus.Conn
+}
+
+func newDBusSystemdClient() (systemdClient, error) {
+	conn, err := dbus.New()
+	if err != nil {
+		return nil, err
+	}
+	return &dbusSystemdClient{conn: conn}, nil
+}
+
+func (c *dbusSystemdClient) unit(name string) (systemdUnit, error) {
+	state, err := c.conn.GetUnitProperty(name, "ActiveState")
+	if err != nil {
+		return systemdUnit{}, err
+	}
+	props, err := c.conn.GetUnitTypeProperties(name, "Service")
+	if err != nil {
+		return systemdUnit{}, err
+	}
+	unit := systemdUnit{}
+	if s, ok := state.Value.Value().(string); ok {
+		unit.ActiveState = s
+	}
+	if pid, ok := props["MainPID"].(uint32); ok {
+		unit.MainPID = int(pid)
+	}
+	if restarts, ok := props["NRestarts"].(uint32); ok {
+		unit.Restarts, unit.HasRestarts = int(restarts), true
+	}
+	return unit, nil
+}
+
+func (c *dbusSystemdClient) close() {
+	c.conn.Close()
+}
+
+// parseSystemdUnits parses a comma-separated list of systemd units into the
+// names of their processes in order and the units by process name. The
+// process of bar.service is named bar, of other units like the unit.
+func parseSystemdUnits(s string) ([]string, map[string]string, error) {
+	var processes []string
+	units := map[string]string{}
+	for _, unit := range strings.Split(s, ",") {
+		if unit == "" {
+			continue
+		}
+		name := strings.TrimSuffix(unit, ".service")
+		if name == "" {
+			return nil, nil, fmt.Errorf("invalid systemd unit %q", unit)
+		}
+		if _, ok := units[name]; ok {
+			return nil, nil, fmt.Errorf("duplicate systemd unit %q", unit)
+		}
+		units[name] = unit
+		processes = append(processes, name)
+	}
+	return processes, units, nil
+}
+
+// querySystemdUnits returns the properties of the systemd units of the named
+// processes that are registered with one, by process name. Units that can't
+// be read are missing. The error is only set if systemd can't be reached.
+func (c *procstatsCollector) querySystemdUnits(names []string) (map[string]systemdUnit, error) {
+	client, err := c.systemdConnect()
+	if err != nil {
+		return nil, err
+	}
+	defer client.close()
+	units := map[string]systemdUnit{}
+	for _, procName := range names {
+		name, ok := c.systemdUnits[procName]
+		if !ok {
+			continue
+		}
+		unit, err := client.unit(name)
+		if err != nil {
+			processLogger(procName, 0).With("unit", name).Errorf("Unable to read the systemd unit: %s", err)
+			continue
+		}
+		units[procName] = unit
+	}
+	return units, nil
+}
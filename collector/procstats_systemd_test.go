@@ -0,0 +1,112 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type fakeSystemdClient map[string]systemdUnit
+
+func (c fakeSystemdClient) unit(name string) (systemdUnit, error) {
+	unit, ok := c[name]
+	if !ok {
+		return systemdUnit{}, fmt.Errorf("unit %s not loaded", name)
+	}
+	return unit, nil
+}
+
+func (c fakeSystemdClient) close() {}
+
+func TestParseSystemdUnits(t *testing.T) {
+	processes, units, err := parseSystemdUnits("nginx.service,cron.timer,,postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"nginx", "cron.timer", "postgres"}; !reflect.DeepEqual(want, processes) {
+		t.Errorf("want processes %q, got %q", want, processes)
+	}
+	if want := map[string]string{"nginx": "nginx.service", "cron.timer": "cron.timer", "postgres": "postgres"}; !reflect.DeepEqual(want, units) {
+		t.Errorf("want units %v, got %v", want, units)
+	}
+
+	for _, s := range []string{".service", "nginx.service,nginx"} {
+		if _, _, err := parseSystemdUnits(s); err == nil {
+			t.Errorf("%q: want an error", s)
+		}
+	}
+}
+
+func TestProcStatsSystemdUnits(t *testing.T) {
+	dir := t.TempDir()
+	for name, pid := range map[string]string{"hekad": "4321", "stopped": "1234", "unknown": "1234"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name+".pid"), []byte(pid+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad", "stopped", "unknown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.pidDir = dir
+	c.systemdUnits = map[string]string{"hekad": "hekad.service", "stopped": "stopped.service", "unknown": "unknown.service"}
+	c.systemdConnect = func() (systemdClient, error) {
+		return fakeSystemdClient{
+			"hekad.service":   {MainPID: 1234, ActiveState: "active", Restarts: 3, HasRestarts: true},
+			"stopped.service": {ActiveState: "failed"},
+		}, nil
+	}
+
+	metrics := collectProcStats(t, c)
+	for name, want := range map[string]float64{
+		`node_process_systemd_available`: 1,
+		// The main PID is preferred to the stale PID file.
+		`node_process_pid{name="hekad"}`: 1234,
+		`node_process_up{name="hekad"}`:  1,
+		// A unit that isn't running has no main PID.
+		`node_process_up{name="stopped"}`: 0,
+		// An unknown unit falls back to its PID file.
+		`node_process_up{name="unknown"}`: 1,
+		`node_process_systemd_unit_state{name="hekad",state="active",unit="hekad.service"}`:     1,
+		`node_process_systemd_unit_state{name="hekad",state="failed",unit="hekad.service"}`:     0,
+		`node_process_systemd_unit_state{name="stopped",state="failed",unit="stopped.service"}`: 1,
+		`node_process_systemd_unit_restarts_total{name="hekad",unit="hekad.service"}`:           3,
+	} {
+		if got, ok := metrics[name]; !ok || got != want {
+			t.Errorf("want %s %g, got %g (found %t)", name, want, got, ok)
+		}
+	}
+	if _, ok := metrics[`node_process_systemd_unit_restarts_total{name="stopped",unit="stopped.service"}`]; ok {
+		t.Errorf("want no restarts without NRestarts")
+	}
+
+	// Without systemd the PID files are read.
+	c.systemdConnect = func() (systemdClient, error) {
+		return nil, fmt.Errorf("no D-Bus")
+	}
+	metrics = collectProcStats(t, c)
+	for name, want := range map[string]float64{
+		`node_process_systemd_available`:  0,
+		`node_process_up{name="hekad"}`:   0,
+		`node_process_up{name="stopped"}`: 1,
+	} {
+		if got, ok := metrics[name]; !ok || got != want {
+			t.Errorf("want %s %g, got %g (found %t)", name, want, got, ok)
+		}
+	}
+}
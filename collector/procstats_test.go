@@ -14,27 +14,762 @@
 package collector
 
 import (
+	"fmt"
+	"io/ioutil"
+	"math"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 func TestProcStats(t *testing.T) {
-	file, err := os.Open("fixtures/proc/procstats")
+	present := func(names ...string) map[string]bool {
+		m := map[string]bool{"State": true}
+		for _, name := range append(names, "VmPeak", "VmSize", "VmHWM", "VmRSS", "VmStk", "VmSwap", "Threads", "SigPnd", "SigCgt", "voluntary_ctxt_switches", "nonvoluntary_ctxt_switches") {
+			m[name] = true
+		}
+		return m
+	}
+	for _, test := range []struct {
+		fixture string
+		pid     int
+		want    ProcessStats
+	}{
+		{
+			fixture: "fixtures/proc/procstats",
+			pid:     123,
+			want: ProcessStats{
+				PID:                      123,
+				VmRSS:                    11708,
+				VmHWM:                    11708,
+				VmStk:                    136,
+				VmPeak:                   277840,
+				VmSize:                   277840,
+				VoluntaryCtxtSwitches:    1,
+				NonvoluntaryCtxtSwitches: 3,
+				Threads:                  5,
+				SignalsCaught:            58,
+				State:                    'S',
+				present:                  present(),
+			},
+		},
+		{
+			fixture: "fixtures/proc/1234/status",
+			pid:     1234,
+			want: ProcessStats{
+				PID:                      1234,
+				VmRSS:                    11708,
+				VmHWM:                    11708,
+				VmStk:                    136,
+				VmPeak:                   277840,
+				VmSize:                   277840,
+				RssAnon:                  4200,
+				RssFile:                  6484,
+				RssShmem:                 1024,
+				VoluntaryCtxtSwitches:    1,
+				NonvoluntaryCtxtSwitches: 3,
+				Threads:                  5,
+				SignalsCaught:            58,
+				State:                    'S',
+				present:                  present("RssAnon", "RssFile", "RssShmem"),
+			},
+		},
+	} {
+		file, err := os.Open(test.fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		procStats, err := parseProcessStats(file, test.pid)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(test.want, procStats) {
+			t.Errorf("%s: want stats %+v, got %+v", test.fixture, test.want, procStats)
+		}
+	}
+
+	procStats, err := parseProcessStats(strings.NewReader("Name:\tkthreadd\nState:\tS (sleeping)\nVmRSS:\tx kB\nThreads:\t1\n"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ProcessStats{PID: 2, Threads: 1, State: 'S', present: map[string]bool{"State": true, "Threads": true}}
+	if !reflect.DeepEqual(want, procStats) {
+		t.Errorf("want stats %+v, got %+v", want, procStats)
+	}
+	for _, name := range []string{"VmRSS", "VmSwap", "RssAnon"} {
+		if procStats.Has(name) {
+			t.Errorf("want no %s", name)
+		}
+	}
+}
+
+func TestVMPeakToRSSRatio(t *testing.T) {
+	for fixture, want := range map[string]float64{
+		"fixtures/proc/procstats_fragmented":   10,
+		"fixtures/proc/procstats_unfragmented": 1,
+	} {
+		file, err := os.Open(fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		procStats, err := parseProcessStats(file, 123)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := vmPeakToRSSRatio(procStats); !ok || got != want {
+			t.Errorf("%s: want ratio %g, got %g (%t)", fixture, want, got, ok)
+		}
+	}
+
+	if _, ok := vmPeakToRSSRatio(ProcessStats{VmPeak: 100, present: map[string]bool{"VmPeak": true, "VmRSS": true}}); ok {
+		t.Error("want no ratio without resident memory")
+	}
+	if _, ok := vmPeakToRSSRatio(ProcessStats{VmRSS: 100, present: map[string]bool{"VmRSS": true}}); ok {
+		t.Error("want no ratio without VmPeak")
+	}
+}
+
+func TestProcStatsSignals(t *testing.T) {
+	file, err := os.Open("fixtures/proc/procstats_signals")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	procStats, err := parseProcessStats(file, 123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// SIGINT and SIGTERM are pending, no signal is caught.
+	if want, got := 2, procStats.SignalsPending; want != got {
+		t.Errorf("want SigPnd count %d, got %d", want, got)
+	}
+	if want, got := 0, procStats.SignalsCaught; want != got {
+		t.Errorf("want SigCgt count %d, got %d", want, got)
+	}
+
+	for _, invalid := range []string{"", "xyz", "10000000000000000"} {
+		if _, err := countBits(invalid); err == nil {
+			t.Errorf("want error for bitmask %q, got none", invalid)
+		}
+	}
+}
+
+func TestProcStatsMemoryUnits(t *testing.T) {
+	for _, test := range []struct {
+		fixture string
+		rss     int
+		hwm     int
+	}{
+		{fixture: "fixtures/proc/procstats_unitless", rss: 11708, hwm: 11708},
+		{fixture: "fixtures/proc/procstats_units", rss: 11708, hwm: 12288},
+	} {
+		file, err := os.Open(test.fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		procStats, err := parseProcessStats(file, 123)
+		file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, got := test.rss, procStats.VmRSS; want != got {
+			t.Errorf("%s: want VmRSS %d, got %d", test.fixture, want, got)
+		}
+		if want, got := test.hwm, procStats.VmHWM; want != got {
+			t.Errorf("%s: want VmHWM %d, got %d", test.fixture, want, got)
+		}
+	}
+	// procstats_units lacks VmStk.
+	file, err := os.Open("fixtures/proc/procstats_units")
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer file.Close()
-	pid := 123
-	procStats, err := parseProcessStats(file, pid)
+	procStats, err := parseProcessStats(file, 123)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if procStats.Has("VmStk") {
+		t.Errorf("want no VmStk, got %d", procStats.VmStk)
+	}
+
+	for _, invalid := range []string{"", "11708 TB", "11708 kB extra", "x kB"} {
+		if _, err := parseMemoryKilobytes("VmRSS", invalid); err == nil {
+			t.Errorf("want error for VmRSS %q, got none", invalid)
+		}
+	}
+}
 
-	if want, got := pid, procStats[0]; want != got {
-		t.Errorf("want procstats pid %d, got %d", want, got)
+func TestGetProcessEnvVar(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "APP_VERSION", want: "1.2.3"},
+		{name: "APP_VERSION_SUFFIX", want: "rc1"},
+		{name: "EMPTY", want: ""},
+		{name: "MISSING", want: ""},
+		{name: "LONG", want: strings.Repeat("x", maxEnvLabelValueLength)},
+	}
+	for _, test := range tests {
+		got, err := getProcessEnvVar("fixtures/proc", 1234, test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("want %s=%q, got %q", test.name, test.want, got)
+		}
 	}
-	if want, got := 11708, procStats[1]; want != got {
-		t.Errorf("want procstats VmRSS %d, got %d", want, got)
+
+	if _, err := getProcessEnvVar("fixtures/proc", 4321, "APP_VERSION"); err == nil {
+		t.Error("want error for missing environ file, got none")
 	}
 
+	// A multi-byte character crossing the limit is dropped as a whole.
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	value := strings.Repeat("x", maxEnvLabelValueLength-1) + "é"
+	if err := ioutil.WriteFile(filepath.Join(dir, "1", "environ"), []byte("TEAM="+value+"\x00"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := getProcessEnvVar(dir, 1, "TEAM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := value[:maxEnvLabelValueLength-1]; got != want || !utf8.ValidString(got) {
+		t.Errorf("want TEAM=%q, got %q", want, got)
+	}
+}
+
+func TestTruncateLabelValue(t *testing.T) {
+	for _, test := range []struct {
+		value string
+		n     int
+		want  string
+	}{
+		{value: "hekad", n: 8, want: "hekad"},
+		{value: "hekad", n: 3, want: "hek"},
+		{value: "héka", n: 2, want: "h"},
+		{value: "héka", n: 3, want: "hé"},
+		{value: "日本", n: 5, want: "日"},
+		{value: "日本", n: 2, want: ""},
+	} {
+		if got := truncateLabelValue(test.value, test.n); got != test.want {
+			t.Errorf("%q to %d bytes: want %q, got %q", test.value, test.n, test.want, got)
+		}
+	}
+}
+
+func TestProcStatsEnvLabels(t *testing.T) {
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad"}, func(o *ProcStatsOptions) {
+		o.EnvLabels = "version=APP_VERSION"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := collectProcStats(t, c)
+	// All series of the process have the env labels.
+	for _, series := range []string{
+		`node_process_pid{name="hekad",version="1.2.3"}`,
+		`node_process_cpu_seconds_total{mode="user",name="hekad",version="1.2.3"}`,
+		`node_process_stack_bytes{name="hekad",version="1.2.3"}`,
+		`node_process_state{name="hekad",state="sleeping",version="1.2.3"}`,
+		`node_process_rss_bytes{name="hekad",type="anon",version="1.2.3"}`,
+	} {
+		if _, ok := metrics[series]; !ok {
+			t.Errorf("want series %s", series)
+		}
+	}
+	if _, ok := metrics[`node_process_stack_bytes{name="hekad"}`]; ok {
+		t.Error("want no series without the env labels")
+	}
+}
+
+func TestParseEnvLabels(t *testing.T) {
+	labels, err := parseEnvLabels("version=APP_VERSION,build=BUILD_ID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []envLabel{
+		{labelName: "version", varName: "APP_VERSION"},
+		{labelName: "build", varName: "BUILD_ID"},
+	}
+	if !reflect.DeepEqual(want, labels) {
+		t.Errorf("want env labels %v, got %v", want, labels)
+	}
+
+	for _, invalid := range []string{"version", "version=", "1version=APP_VERSION", "name=APP_NAME", "mode=APP_MODE", "a=A,a=B"} {
+		if _, err := parseEnvLabels(invalid); err == nil {
+			t.Errorf("want error for env labels %q, got none", invalid)
+		}
+	}
+}
+
+func TestParseProcessStat(t *testing.T) {
+	file, err := os.Open("fixtures/proc/1234/stat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	stat, err := parseProcessStat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := processStat{State: "S", PPID: 1, UTime: 1583, STime: 421, StartTime: 8794, DelayacctBlkioTicks: 7}
+	if want != stat {
+		t.Errorf("want stat %+v, got %+v", want, stat)
+	}
+
+	if _, err := parseProcessStat(strings.NewReader("1234 (short) S 1 2 3")); err == nil {
+		t.Error("want error for truncated stat, got none")
+	}
+}
+
+func TestOldestProcessAge(t *testing.T) {
+	// The fixture booted at 1418183276 and PID 1234 started 87.94s later.
+	now := time.Unix(1418183276+1000, 0)
+	age, ok := oldestProcessAge(newProcessFiles("fixtures/proc"), []int{1234, 99999}, now)
+	if !ok {
+		t.Fatal("want an age, got none")
+	}
+	if want := 1000 - 87.94; math.Abs(age-want) > 1e-6 {
+		t.Errorf("want age %f, got %f", want, age)
+	}
+
+	for _, pids := range [][]int{nil, {99999}} {
+		if age, ok := oldestProcessAge(newProcessFiles("fixtures/proc"), pids, now); ok {
+			t.Errorf("want no age for %v, got %f", pids, age)
+		}
+	}
+}
+
+func TestProcessStartTime(t *testing.T) {
+	startTime, err := processStartTime(newProcessFiles("fixtures/proc"), 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 1418183276 + 87.94; math.Abs(startTime-want) > 1e-6 {
+		t.Errorf("want start time %f, got %f", want, startTime)
+	}
+	if want, got := 1000.0, processUptime(startTime, time.Unix(1418183276+1087, 940000000)); math.Abs(got-want) > 1e-3 {
+		t.Errorf("want uptime %f, got %f", want, got)
+	}
+	if _, err := processStartTime(newProcessFiles("fixtures/proc"), 99999); err == nil {
+		t.Error("want error for a missing process, got none")
+	}
+}
+
+func TestContinuousCounters(t *testing.T) {
+	c := newContinuousCounters()
+
+	steps := []struct {
+		startTime uint64
+		value     float64
+		want      float64
+	}{
+		{startTime: 100, value: 10, want: 10},
+		{startTime: 100, value: 15, want: 15},
+		// Restart: the counter resets to 2 but carries 15 forward.
+		{startTime: 200, value: 2, want: 17},
+		{startTime: 200, value: 5, want: 20},
+		// Second restart accumulates on top.
+		{startTime: 300, value: 1, want: 21},
+	}
+	for i, step := range steps {
+		if got := c.adjust("hekad", step.startTime, "voluntary_ctxt_switches", step.value); got != step.want {
+			t.Errorf("%d. want %f, got %f", i, step.want, got)
+		}
+	}
+
+	// Other processes have their own baseline.
+	if got := c.adjust("other", 300, "voluntary_ctxt_switches", 4); got != 4 {
+		t.Errorf("want 4 for independent process, got %f", got)
+	}
+}
+
+func TestGetProcessPIDFileStaleness(t *testing.T) {
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "hekad.pid")
+	if err := ioutil.WriteFile(pidFile, []byte("1234\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fixture process 1234 started at 1418183363.94.
+	tests := []struct {
+		mtime time.Time
+		min   float64
+		max   float64
+	}{
+		{mtime: time.Now().Add(-time.Hour), min: 3599, max: 3601},
+		{mtime: time.Now().Add(-48 * time.Hour), min: 48*3600 - 1, max: 48*3600 + 1},
+		{mtime: time.Unix(1418183300, 0), min: math.Inf(1), max: math.Inf(1)},
+	}
+	for i, test := range tests {
+		if err := os.Chtimes(pidFile, test.mtime, test.mtime); err != nil {
+			t.Fatal(err)
+		}
+		got, err := getProcessPIDFileStaleness(newProcessFiles("fixtures/proc"), pidFile, 1234)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got < test.min || got > test.max {
+			t.Errorf("%d. want staleness in [%f, %f], got %f", i, test.min, test.max, got)
+		}
+	}
+
+	if _, err := getProcessPIDFileStaleness(newProcessFiles("fixtures/proc"), filepath.Join(dir, "missing.pid"), 1234); err == nil {
+		t.Error("want error for missing PID file, got none")
+	}
+}
+
+func TestProcStatsRootfs(t *testing.T) {
+	c, err := NewTestProcStatsCollector("fixtures/rootfs/proc", []string{"hekad"}, func(o *ProcStatsOptions) {
+		o.PIDDir = "fixtures/rootfs/var/run"
+		o.CPUAffinityCores = 4
+		o.Maps = true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := collectProcStats(t, c)
+
+	if want, got := 1234.0, metrics[`node_process_pid{name="hekad"}`]; want != got {
+		t.Errorf("want pid %f, got %f", want, got)
+	}
+	if want, got := 11708.0, metrics[`node_process_mem_kilobytes{name="hekad"}`]; want != got {
+		t.Errorf("want mem_kilobytes %f, got %f", want, got)
+	}
+	// Each field of ProcessStats ends up in its own metric.
+	for series, want := range map[string]float64{
+		`node_process_threads{name="hekad"}`:                             5,
+		`node_process_signals_pending_count{name="hekad"}`:               0,
+		`node_process_signals_caught_count{name="hekad"}`:                58,
+		`node_process_voluntary_context_switches_total{name="hekad"}`:    1,
+		`node_process_nonvoluntary_context_switches_total{name="hekad"}`: 3,
+		`node_process_stack_bytes{name="hekad"}`:                         136 * 1024,
+		`node_process_virtual_memory_bytes{name="hekad"}`:                277840 * 1024,
+		`node_process_swap_bytes{name="hekad"}`:                          0,
+	} {
+		if got, ok := metrics[series]; !ok || got != want {
+			t.Errorf("want %s %f, got %f (exposed %t)", series, want, got, ok)
+		}
+	}
+	if want, got := 1.0, metrics[`node_process_info{cgroup="/system.slice/hekad.service",container_id="",container_runtime="",cpu_affinity="ff",exe_sha256="",name="hekad",wchan="pipe_wait"}`]; want != got {
+		t.Errorf("want info %f, got %f", want, got)
+	}
+	if want, got := 0.0, metrics[`node_process_idle_seconds{name="hekad"}`]; want != got {
+		t.Errorf("want idle_seconds %f at the first scrape, got %f", want, got)
+	}
+	if want, got := 0.0, metrics[`node_process_kernel_blocked{name="hekad"}`]; want != got {
+		t.Errorf("want kernel_blocked %f, got %f", want, got)
+	}
+	for cpu := 0; cpu < 8; cpu++ {
+		want, ok := 1.0, cpu < 4
+		got, found := metrics[fmt.Sprintf(`node_process_cpu_affinity{cpu="%d",name="hekad"}`, cpu)]
+		if found != ok || (ok && want != got) {
+			t.Errorf("CPU %d: want cpu_affinity %f (exposed %t), got %f (exposed %t)", cpu, want, ok, got, found)
+		}
+	}
+	scraped, ok := metrics["node_process_collector_last_scrape_timestamp_seconds"]
+	if now := float64(time.Now().Unix()); !ok || scraped < now-60 || scraped > now+1 {
+		t.Errorf("want last scrape timestamp around %f, got %f", now, scraped)
+	}
+	if want, got := 9.0, metrics[`node_process_mmap_file_count{name="hekad"}`]; want != got {
+		t.Errorf("want mmap_file_count %f, got %f", want, got)
+	}
+	if want, got := 5.0, metrics[`node_process_mmap_unique_libraries{name="hekad"}`]; want != got {
+		t.Errorf("want mmap_unique_libraries %f, got %f", want, got)
+	}
+	if want, got := 136.0*1024, metrics[`node_process_stack_bytes{name="hekad"}`]; want != got {
+		t.Errorf("want stack_bytes %f, got %f", want, got)
+	}
+	if want, got := 136.0*1024/8388608, metrics[`node_process_stack_utilization{name="hekad"}`]; want != got {
+		t.Errorf("want stack_utilization %f, got %f", want, got)
+	}
+	if want, got := 3.166250001, metrics[`node_process_runqueue_wait_seconds_total{name="hekad"}`]; want != got {
+		t.Errorf("want runqueue_wait_seconds_total %f, got %f", want, got)
+	}
+	if want, got := 1024.0, metrics[`node_process_open_fds_soft_limit{name="hekad"}`]; want != got {
+		t.Errorf("want open_fds_soft_limit %f, got %f", want, got)
+	}
+	if want, got := 4096.0, metrics[`node_process_open_fds_hard_limit{name="hekad"}`]; want != got {
+		t.Errorf("want open_fds_hard_limit %f, got %f", want, got)
+	}
+}
+
+func TestProcStatsPIDFiles(t *testing.T) {
+	c, err := NewTestProcStatsCollector("fixtures/rootfs/proc", []string{"hekad", "other", "heka"}, func(o *ProcStatsOptions) {
+		o.PIDDir = "fixtures/rootfs/run"
+		o.PIDFiles = map[string]string{
+			"hekad": "fixtures/rootfs/var/run/hekad.pid",
+			"heka":  "fixtures/rootfs/var/run/heka*.pid",
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "fixtures/rootfs/run/other.pid", c.pidFilePath("other"); want != got {
+		t.Errorf("want PID file %s, got %s", want, got)
+	}
+	metrics := collectProcStats(t, c)
+	if want, got := 1234.0, metrics[`node_process_pid{name="hekad"}`]; want != got {
+		t.Errorf("want pid %f, got %f", want, got)
+	}
+	if want, got := 1234.0, metrics[`node_process_pid{instance="hekad",name="heka"}`]; want != got {
+		t.Errorf("want pid %f of the instance, got %f", want, got)
+	}
+	if _, ok := metrics[`node_process_pid{name="heka"}`]; ok {
+		t.Error("want no metric vector series of a PID file pattern")
+	}
+}
+
+func TestProcStatsInvalidPIDFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "hekad.pid"), []byte("not a pid\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewTestProcStatsCollector("fixtures/rootfs/proc", []string{"hekad"}, func(o *ProcStatsOptions) {
+		o.PIDDir = dir
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := collectProcStats(t, c)
+	if want, got := 0.0, metrics[`node_process_up{name="hekad"}`]; want != got {
+		t.Errorf("want up %f, got %f", want, got)
+	}
+	if _, ok := metrics[`node_process_pid{name="hekad"}`]; ok {
+		t.Error("want no pid of an invalid PID file")
+	}
+}
+
+func TestParseRegisteredProcesses(t *testing.T) {
+	processes, pidFiles, err := parseRegisteredProcesses("hekad,myapp=/run/myapp/myapp.pid,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"hekad", "myapp"}; !reflect.DeepEqual(want, processes) {
+		t.Errorf("want processes %v, got %v", want, processes)
+	}
+	if want := map[string]string{"myapp": "/run/myapp/myapp.pid"}; !reflect.DeepEqual(want, pidFiles) {
+		t.Errorf("want PID files %v, got %v", want, pidFiles)
+	}
+
+	for _, invalid := range []string{"=/run/a.pid", "a,a", "a,a=/run/a.pid", "a=run/a.pid", "a="} {
+		if _, _, err := parseRegisteredProcesses(invalid); err == nil {
+			t.Errorf("want error for registered processes %q, got none", invalid)
+		}
+	}
+}
+
+// collectProcStats runs an update of c and returns the values of the
+// collected metrics, keyed by metric name and labels.
+func collectProcStats(t *testing.T, c Collector) map[string]float64 {
+	ch := make(chan prometheus.Metric)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Update(ch)
+		close(ch)
+	}()
+
+	metrics := map[string]float64{}
+	for m := range ch {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		name, _, err := descNameAndHelp(m.Desc())
+		if err != nil {
+			t.Fatal(err)
+		}
+		labels := make([]string, 0, len(pb.GetLabel()))
+		for _, l := range pb.GetLabel() {
+			labels = append(labels, fmt.Sprintf("%s=%q", l.GetName(), l.GetValue()))
+		}
+		sort.Strings(labels)
+		if len(labels) > 0 {
+			name += "{" + strings.Join(labels, ",") + "}"
+		}
+		switch {
+		case pb.Gauge != nil:
+			metrics[name] = pb.GetGauge().GetValue()
+		case pb.Counter != nil:
+			metrics[name] = pb.GetCounter().GetValue()
+		default:
+			metrics[name] = pb.GetUntyped().GetValue()
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	return metrics
+}
+
+func TestDetectHWMReset(t *testing.T) {
+	c := &procstatsCollector{lastHWM: map[string]int{}}
+
+	for i, step := range []struct {
+		hwm  int
+		want float64
+	}{
+		{hwm: 1000, want: 0},
+		{hwm: 1200, want: 0},
+		{hwm: 1200, want: 0},
+		{hwm: 300, want: 1},
+		{hwm: 400, want: 0},
+	} {
+		if got := c.detectHWMReset("hekad", step.hwm); got != step.want {
+			t.Errorf("%d. want hwm_reset %f, got %f", i, step.want, got)
+		}
+	}
+}
+
+func TestProcStatsUp(t *testing.T) {
+	dir := t.TempDir()
+	for name, pid := range map[string]string{"hekad": "1234", "stale": "4321", "invalid": "x"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name+".pid"), []byte(pid+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad", "stale", "invalid", "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.pidDir = dir
+	// A stale PID file doesn't fail the scrape.
+	metrics := collectProcStats(t, c)
+	for name, want := range map[string]float64{"hekad": 1, "stale": 0, "invalid": 0, "missing": 0} {
+		if got, ok := metrics[fmt.Sprintf(`node_process_up{name="%s"}`, name)]; !ok || got != want {
+			t.Errorf("%s: want up %f, got %f (%t)", name, want, got, ok)
+		}
+	}
+	if want, got := 1234.0, metrics[`node_process_pid{name="hekad"}`]; want != got {
+		t.Errorf("want pid %f, got %f", want, got)
+	}
+}
+
+func TestProcStatsVanishedProcess(t *testing.T) {
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "hekad.pid")
+	if err := ioutil.WriteFile(pidFile, []byte("1234\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.pidDir = dir
+	if _, ok := collectProcStats(t, c)[`node_process_pid{name="hekad"}`]; !ok {
+		t.Fatalf("want a pid of the running process")
+	}
+
+	for i, change := range []func() error{
+		// The PID file is left behind by the exited process.
+		func() error { return ioutil.WriteFile(pidFile, []byte("4321\n"), 0644) },
+		func() error { return os.Remove(pidFile) },
+	} {
+		if err := change(); err != nil {
+			t.Fatal(err)
+		}
+		metrics := collectProcStats(t, c)
+		for name := range metrics {
+			if strings.Contains(name, `name="hekad"`) && !strings.HasPrefix(name, "node_process_up{") && !strings.HasPrefix(name, "node_process_pid_file_stale{") {
+				t.Errorf("%d: want no series of the vanished process, got %s", i, name)
+			}
+		}
+		if want, got := 0.0, metrics[`node_process_up{name="hekad"}`]; want != got {
+			t.Errorf("%d: want up %f, got %f", i, want, got)
+		}
+	}
+}
+
+func TestProcStatsState(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "hekad.pid"), []byte("1234\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"hekad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.pidDir = dir
+	metrics := collectProcStats(t, c)
+	for _, state := range processStates {
+		want := 0.0
+		if state.name == "sleeping" {
+			want = 1
+		}
+		if got, ok := metrics[fmt.Sprintf(`node_process_state{name="hekad",state="%s"}`, state.name)]; !ok || got != want {
+			t.Errorf("%s: want %f, got %f (%t)", state.name, want, got, ok)
+		}
+	}
+}
+
+func TestProcStatsHeartbeat(t *testing.T) {
+	c, err := NewTestProcStatsCollector("fixtures/proc", []string{"missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := collectProcStats(t, c)
+	if _, ok := metrics["node_process_collector_last_scrape_timestamp_seconds"]; !ok {
+		t.Error("want last scrape timestamp without any process found, got none")
+	}
+	if want, got := 0.0, metrics["node_process_resolution_ratio"]; want != got {
+		t.Errorf("want resolution ratio %f, got %f", want, got)
+	}
+}
+
+func TestProcStatsProcfsUnavailable(t *testing.T) {
+	procRoot := filepath.Join(t.TempDir(), "proc")
+	c, err := NewTestProcStatsCollector(procRoot, []string{"hekad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan prometheus.Metric)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Update(ch)
+		close(ch)
+	}()
+	var samples []string
+	for m := range ch {
+		samples = append(samples, sampleString(t, m))
+	}
+	if err := <-errc; err == nil {
+		t.Error("want an error without procfs, got none")
+	}
+	want := "node_process_collector_procfs_available 0"
+	found := false
+	for _, s := range samples {
+		if strings.Contains(s, `name="`) {
+			t.Errorf("want no process metrics without procfs, got %s", s)
+		}
+		found = found || s == want
+	}
+	if !found {
+		t.Errorf("want %s, got %v", want, samples)
+	}
+
+	if err := os.Mkdir(procRoot, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(procRoot, "stat"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1.0, collectProcStats(t, c)["node_process_collector_procfs_available"]; want != got {
+		t.Errorf("want procfs_available %f once procfs is back, got %f", want, got)
+	}
 }
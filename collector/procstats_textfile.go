@@ -0,0 +1,92 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	outputFormatTextfile = "textfile"
+	textfileName         = "procstats.prom"
+)
+
+var (
+	outputFormat = flag.String("output.format", "",
+		"Additional output of the procstats metrics. With \"textfile\", the metrics are also written to procstats.prom in --output.textfile-dir on every scrape.")
+	outputTextfileDir = flag.String("output.textfile-dir", "",
+		"Directory of a textfile collector to write procstats.prom to, e.g. /var/lib/node_exporter/textfile_collector.")
+)
+
+// textfileWriter writes metrics in the text exposition format to a file
+// suitable for the textfile collector of another node_exporter.
+type textfileWriter struct {
+	path string
+}
+
+// newTextfileWriter returns a textfileWriter for the output flags, or nil if
+// no textfile output is configured.
+func newTextfileWriter() (*textfileWriter, error) {
+	switch *outputFormat {
+	case "":
+		return nil, nil
+	case outputFormatTextfile:
+		if *outputTextfileDir == "" {
+			return nil, fmt.Errorf("--output.format=%s requires --output.textfile-dir", outputFormatTextfile)
+		}
+		return &textfileWriter{path: filepath.Join(*outputTextfileDir, textfileName)}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q", *outputFormat)
+	}
+}
+
+// write atomically replaces the file of w with the given metrics.
+func (w *textfileWriter) write(metrics []prometheus.Metric) error {
+	families, err := metricFamilies(metrics)
+	if err != nil {
+		return err
+	}
+
+	// The temporary file doesn't match *.prom, so it is never read
+	// half-written by the textfile collector.
+	tmp, err := ioutil.TempFile(filepath.Dir(w.path), textfileName+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	enc := expfmt.NewEncoder(tmp, expfmt.FmtText)
+	for _, mf := range families {
+		if err := enc.Encode(mf); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), w.path)
+}
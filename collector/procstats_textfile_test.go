@@ -0,0 +1,70 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestTextfileWriter(t *testing.T) {
+	dir := t.TempDir()
+
+	gaugeDesc := prometheus.NewDesc("node_process_pid", "The PID of the process right now", []string{"name"}, nil)
+	counterDesc := prometheus.NewDesc("node_process_voluntary_context_switches_total", "Number of voluntary context switches.", []string{"name"}, nil)
+	metrics := []prometheus.Metric{
+		prometheus.MustNewConstMetric(gaugeDesc, prometheus.GaugeValue, 42, "sshd"),
+		prometheus.MustNewConstMetric(counterDesc, prometheus.CounterValue, 7, "hekad"),
+		prometheus.MustNewConstMetric(gaugeDesc, prometheus.GaugeValue, 1234, "hekad"),
+	}
+
+	w := &textfileWriter{path: filepath.Join(dir, textfileName)}
+	if err := w.write(metrics); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP node_process_pid The PID of the process right now
+# TYPE node_process_pid gauge
+node_process_pid{name="hekad"} 1234
+node_process_pid{name="sshd"} 42
+# HELP node_process_voluntary_context_switches_total Number of voluntary context switches.
+# TYPE node_process_voluntary_context_switches_total counter
+node_process_voluntary_context_switches_total{name="hekad"} 7
+`
+	if string(got) != want {
+		t.Errorf("want textfile:\n%s\ngot:\n%s", want, got)
+	}
+
+	var parser expfmt.TextParser
+	if _, err := parser.TextToMetricFamilies(strings.NewReader(string(got))); err != nil {
+		t.Errorf("textfile isn't valid text format: %s", err)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("want only %s in textfile directory, got %d files", textfileName, len(files))
+	}
+}
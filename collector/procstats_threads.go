@@ -0,0 +1,116 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+var (
+	perThreadRSS = flag.Bool("collector.procstats.per-thread-rss", false,
+		"Expose the highest resident memory of a thread of each process. Reads /proc/$PID/task/$TID/status of every thread on each scrape.")
+	perThreadStates = flag.Bool("collector.procstats.per-thread-states", false,
+		"Expose the number of threads of each process by scheduling state. Reads /proc/$PID/task/$TID/stat of every thread on each scrape.")
+)
+
+// threadStates are the scheduling states of /proc/$PID/task/$TID/stat that
+// threads are counted by, see proc(5).
+var threadStates = []string{"R", "S", "D", "Z", "T", "t", "X", "I"}
+
+// getMaxThreadRSS returns the highest resident memory in bytes of a thread
+// of the given process and the TID of that thread. Threads exiting while
+// reading are skipped.
+func getMaxThreadRSS(procRoot string, pid int) (int64, int, error) {
+	dir := processFilePath(procRoot, pid, "task")
+	d, err := os.Open(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer d.Close()
+
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return 0, 0, err
+	}
+	var maxRSS int64
+	maxTID := -1
+	for _, name := range names {
+		tid, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, name, "status"))
+		if err != nil {
+			continue
+		}
+		stats, err := parseProcessStats(f, tid)
+		f.Close()
+		if err != nil {
+			continue
+		}
+		if !stats.Has("VmRSS") {
+			continue
+		}
+		if bytes := int64(kbToBytes(stats.VmRSS)); maxTID < 0 || bytes > maxRSS {
+			maxRSS, maxTID = bytes, tid
+		}
+	}
+	if maxTID < 0 {
+		return 0, 0, fmt.Errorf("no thread with VmRSS in %s", dir)
+	}
+	return maxRSS, maxTID, nil
+}
+
+// getThreadStates counts the threads of the given process by their
+// scheduling state. Threads exiting while reading are skipped.
+func getThreadStates(procRoot string, pid int) (map[string]int, error) {
+	dir := processFilePath(procRoot, pid, "task")
+	d, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	states := map[string]int{}
+	for _, name := range names {
+		if _, err := strconv.Atoi(name); err != nil {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, name, "stat"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		stat, err := parseProcessStat(f)
+		f.Close()
+		if err != nil {
+			// A thread exiting while its stat is read leaves it empty.
+			continue
+		}
+		states[stat.State]++
+	}
+	return states, nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetMaxThreadRSS(t *testing.T) {
+	rss, tid, err := getMaxThreadRSS("fixtures/proc", 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(12940 * 1024); rss != want {
+		t.Errorf("want max thread RSS %d, got %d", want, rss)
+	}
+	if want := 1235; tid != want {
+		t.Errorf("want max thread TID %d, got %d", want, tid)
+	}
+
+	if _, _, err := getMaxThreadRSS("fixtures/proc", 4321); err == nil {
+		t.Errorf("want an error for a missing process")
+	}
+}
+
+func TestGetThreadStates(t *testing.T) {
+	states, err := getThreadStates("fixtures/proc", 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"S": 1, "D": 1, "R": 1}; !reflect.DeepEqual(want, states) {
+		t.Errorf("want thread states %v, got %v", want, states)
+	}
+
+	// Threads exit while the task directory is walked.
+	dir := t.TempDir()
+	for _, tid := range []string{"10", "11"} {
+		if err := os.MkdirAll(filepath.Join(dir, "10", "task", tid), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "10", "task", "10", "stat"), []byte("10 (worker) D 1 10 10 0 -1 0 0 0 0 0 1 1 0 0 20 0 1 0 100 0 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "10", "task", "11", "stat"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "10", "task", "12"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	states, err = getThreadStates(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"D": 1}; !reflect.DeepEqual(want, states) {
+		t.Errorf("want thread states %v, got %v", want, states)
+	}
+
+	if _, err := getThreadStates(dir, 4321); err == nil {
+		t.Errorf("want an error for a missing process")
+	}
+}
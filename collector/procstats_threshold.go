@@ -0,0 +1,75 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import "sync"
+
+// Directions of a memory threshold breach.
+const (
+	breachAbove = "above"
+	breachBelow = "below"
+)
+
+// memoryThresholds tracks the breaches of the resident memory thresholds of
+// processes, see memoryThresholdsConfig.
+type memoryThresholds struct {
+	limits map[string]memoryThresholdsConfig
+
+	mtx      sync.Mutex
+	breached map[string]map[string]bool
+}
+
+func newMemoryThresholds(limits map[string]memoryThresholdsConfig) *memoryThresholds {
+	return &memoryThresholds{limits: limits, breached: map[string]map[string]bool{}}
+}
+
+// update records the resident memory of the named process and returns the
+// breach state of each configured direction and whether the breach is new
+// since the previous update. It returns nil for processes without
+// thresholds.
+func (t *memoryThresholds) update(procName string, rssBytes float64) map[string]thresholdBreach {
+	limit, ok := t.limits[procName]
+	if !ok {
+		return nil
+	}
+	current := map[string]bool{}
+	if limit.MaxRSSBytes > 0 {
+		current[breachAbove] = rssBytes > float64(limit.MaxRSSBytes)
+	}
+	if limit.MinRSSBytes > 0 {
+		current[breachBelow] = rssBytes < float64(limit.MinRSSBytes)
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	previous := t.breached[procName]
+	breaches := make(map[string]thresholdBreach, len(current))
+	for direction, breached := range current {
+		breaches[direction] = thresholdBreach{
+			active: breached,
+			new:    breached && !previous[direction],
+		}
+	}
+	t.breached[procName] = current
+	return breaches
+}
+
+// thresholdBreach is the state of a threshold of a process at an update.
+type thresholdBreach struct {
+	active bool
+	// new is whether the threshold wasn't breached at the previous update.
+	new bool
+}
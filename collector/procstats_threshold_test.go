@@ -0,0 +1,93 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"reflect"
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMemoryThresholds(t *testing.T) {
+	thresholds := newMemoryThresholds(map[string]memoryThresholdsConfig{
+		"hekad": {MaxRSSBytes: 1000, MinRSSBytes: 100},
+	})
+	if breaches := thresholds.update("other", 5000); breaches != nil {
+		t.Errorf("want no breaches without thresholds, got %v", breaches)
+	}
+
+	for i, step := range []struct {
+		rss  float64
+		want map[string]thresholdBreach
+	}{
+		{rss: 2000, want: map[string]thresholdBreach{
+			breachAbove: {active: true, new: true},
+			breachBelow: {},
+		}},
+		{rss: 3000, want: map[string]thresholdBreach{
+			breachAbove: {active: true},
+			breachBelow: {},
+		}},
+		{rss: 50, want: map[string]thresholdBreach{
+			breachAbove: {},
+			breachBelow: {active: true, new: true},
+		}},
+		{rss: 500, want: map[string]thresholdBreach{
+			breachAbove: {},
+			breachBelow: {},
+		}},
+		{rss: 1001, want: map[string]thresholdBreach{
+			breachAbove: {active: true, new: true},
+			breachBelow: {},
+		}},
+	} {
+		if got := thresholds.update("hekad", step.rss); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%d: want breaches %v, got %v", i, step.want, got)
+		}
+	}
+}
+
+func TestProcStatsMemoryThresholdBreaches(t *testing.T) {
+	c, err := NewTestProcStatsCollector(t.TempDir(), []string{"hekad"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.memoryThresholds = newMemoryThresholds(map[string]memoryThresholdsConfig{
+		"hekad": {MaxRSSBytes: 1000, MinRSSBytes: 100},
+	})
+
+	for _, rss := range []float64{2000, 50, 2000, 500, 50} {
+		c.updateMemoryThresholds("hekad", rss)
+	}
+	for direction, want := range map[string]float64{breachAbove: 2, breachBelow: 2} {
+		pb := &dto.Metric{}
+		if err := c.memory.thresholdBreaches.WithLabelValues("hekad", "rss", direction).Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		if got := pb.GetCounter().GetValue(); got != want {
+			t.Errorf("%s: want %f breaches, got %f", direction, want, got)
+		}
+	}
+	// The last scrape is below the minimum only.
+	for direction, want := range map[string]float64{breachAbove: 0, breachBelow: 1} {
+		pb := &dto.Metric{}
+		if err := c.memory.thresholdBreached.WithLabelValues("hekad", "rss", direction).Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		if got := pb.GetGauge().GetValue(); got != want {
+			t.Errorf("%s: want breached %f, got %f", direction, want, got)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"flag"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var sampleTimestamps = flag.Bool("collector.procstats.sample-timestamps", false,
+	"Attach the time the process statistics were read as explicit timestamp to the procstats metrics.")
+
+// timestampedMetric is a metric exposed with an explicit timestamp.
+type timestampedMetric struct {
+	prometheus.Metric
+	timestamp time.Time
+}
+
+// Write implements prometheus.Metric.
+func (m timestampedMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+	out.TimestampMs = proto.Int64(m.timestamp.UnixNano() / int64(time.Millisecond))
+	return nil
+}
+
+// withTimestamp returns a transform for transformMetrics attaching t to all
+// metrics.
+func withTimestamp(t time.Time) func(prometheus.Metric) []prometheus.Metric {
+	return func(m prometheus.Metric) []prometheus.Metric {
+		return []prometheus.Metric{timestampedMetric{Metric: m, timestamp: t}}
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestWithTimestamp(t *testing.T) {
+	desc := prometheus.NewDesc("node_process_pid", "The PID of the process right now", []string{"name"}, nil)
+	m := prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1234, "hekad")
+
+	ts := time.Unix(1418183276, 250*int64(time.Millisecond))
+	out := withTimestamp(ts)(m)
+	if len(out) != 1 {
+		t.Fatalf("want 1 metric, got %d", len(out))
+	}
+	if out[0].Desc() != desc {
+		t.Errorf("want desc %s, got %s", desc, out[0].Desc())
+	}
+
+	var pb dto.Metric
+	if err := out[0].Write(&pb); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := int64(1418183276250), pb.GetTimestampMs(); want != got {
+		t.Errorf("want timestamp %d, got %d", want, got)
+	}
+	if want, got := 1234.0, pb.GetGauge().GetValue(); want != got {
+		t.Errorf("want value %f, got %f", want, got)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// labelTransform normalizes the label values of discovered processes, see
+// labelTransformConfig.
+type labelTransform struct {
+	trimPrefix  string
+	trimSuffix  string
+	re          *regexp.Regexp
+	replacement string
+	lowercase   bool
+}
+
+func newLabelTransform(c *labelTransformConfig) (*labelTransform, error) {
+	t := &labelTransform{
+		trimPrefix:  c.TrimPrefix,
+		trimSuffix:  c.TrimSuffix,
+		replacement: c.Replacement,
+		lowercase:   c.Lowercase,
+	}
+	if c.Regex != "" {
+		re, err := regexp.Compile(c.Regex)
+		if err != nil {
+			return nil, err
+		}
+		t.re = re
+	} else if c.Replacement != "" {
+		return nil, fmt.Errorf("replacement set without a regex")
+	}
+	return t, nil
+}
+
+// apply returns the transformed label value. The prefix and suffix are
+// stripped first, then the regex is replaced and finally the value is
+// lowercased. It fails if the result is empty or not a valid label value.
+func (t *labelTransform) apply(value string) (string, error) {
+	v := strings.TrimSuffix(strings.TrimPrefix(value, t.trimPrefix), t.trimSuffix)
+	if t.re != nil {
+		v = t.re.ReplaceAllString(v, t.replacement)
+	}
+	if t.lowercase {
+		v = strings.ToLower(v)
+	}
+	if v == "" {
+		return "", fmt.Errorf("label value %q is empty after the transform", value)
+	}
+	if !model.LabelValue(v).IsValid() {
+		return "", fmt.Errorf("label value %q is invalid after the transform: %q", value, v)
+	}
+	return v, nil
+}
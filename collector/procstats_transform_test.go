@@ -0,0 +1,52 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import "testing"
+
+func TestLabelTransform(t *testing.T) {
+	for _, test := range []struct {
+		config      labelTransformConfig
+		value, want string
+	}{
+		{config: labelTransformConfig{Lowercase: true}, value: "Hekad", want: "hekad"},
+		{config: labelTransformConfig{TrimPrefix: "/opt/", TrimSuffix: ".bin"}, value: "/opt/worker.bin", want: "worker"},
+		{config: labelTransformConfig{TrimPrefix: "/opt/"}, value: "/usr/bin/worker", want: "/usr/bin/worker"},
+		{config: labelTransformConfig{Regex: `-\d+(\.\d+)*$`}, value: "java-11.0.2", want: "java"},
+		{config: labelTransformConfig{Regex: `^.*/`, Lowercase: true}, value: "/usr/lib/jvm/bin/Java", want: "java"},
+		{config: labelTransformConfig{Regex: `(?P<base>\w+)-v\d+`, Replacement: "${base}"}, value: "api-v2", want: "api"},
+		// Empty results and invalid UTF-8 are rejected.
+		{config: labelTransformConfig{TrimPrefix: "worker"}, value: "worker"},
+		{config: labelTransformConfig{Regex: "x", Replacement: "\xff"}, value: "x"},
+	} {
+		transform, err := newLabelTransform(&test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := transform.apply(test.value)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%+v: want an error for %q, got %q", test.config, test.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: %s", test.config, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%+v: want %q for %q, got %q", test.config, test.want, test.value, got)
+		}
+	}
+}
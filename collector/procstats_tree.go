@@ -0,0 +1,170 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"flag"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var includeChildren = flag.Bool("collector.procstats.include-children", false,
+	"Also expose the resident memory and CPU time of each process summed over its process tree, including all descendants such as forked workers. Reads /proc/$PID/stat of every process on each scrape.")
+
+// Values of the scope label of the process tree metrics.
+const (
+	treeScopeParent = "parent"
+	treeScopeTree   = "tree"
+)
+
+// processTreeUsage is the resource usage of a set of processes.
+type processTreeUsage struct {
+	// Processes is the number of processes the usage was read from.
+	Processes int
+	// RSSBytes is the sum of VmRSS.
+	RSSBytes float64
+	// UTime and STime are the sums of the CPU times, in clock ticks.
+	UTime, STime uint64
+}
+
+// getProcessParents returns the parent PID of each of pids. Processes
+// exiting while reading are skipped.
+func getProcessParents(files *processFiles, pids []int) map[int]int {
+	parents := make(map[int]int, len(pids))
+	for _, pid := range pids {
+		stat, err := files.stat(pid)
+		if err != nil {
+			continue
+		}
+		parents[pid] = stat.PPID
+	}
+	return parents
+}
+
+// processTree returns the sorted roots and all their descendants according
+// to parents, each PID once.
+func processTree(parents map[int]int, roots []int) []int {
+	children := map[int][]int{}
+	for pid, ppid := range parents {
+		children[ppid] = append(children[ppid], pid)
+	}
+	seen := map[int]bool{}
+	queue := append([]int{}, roots...)
+	var tree []int
+	for len(queue) > 0 {
+		pid := queue[0]
+		queue = queue[1:]
+		if seen[pid] {
+			continue
+		}
+		seen[pid] = true
+		tree = append(tree, pid)
+		queue = append(queue, children[pid]...)
+	}
+	sort.Ints(tree)
+	return tree
+}
+
+// getProcessTreeUsage sums the resident memory and CPU times of pids.
+// Processes exiting while reading are skipped.
+func getProcessTreeUsage(files *processFiles, pids []int) processTreeUsage {
+	var usage processTreeUsage
+	for _, pid := range pids {
+		stat, err := files.stat(pid)
+		if err != nil {
+			continue
+		}
+		f, err := files.open(pid, "status")
+		if err != nil {
+			continue
+		}
+		stats, err := parseProcessStats(f, pid)
+		if err != nil {
+			continue
+		}
+		usage.Processes++
+		// Kernel threads have no VmRSS.
+		usage.RSSBytes += kbToBytes(stats.VmRSS)
+		usage.UTime += stat.UTime
+		usage.STime += stat.STime
+	}
+	return usage
+}
+
+// updateTree sets the usage of the resolved pids of the process and of their
+// process tree.
+func (c *procstatsCollector) updateTree(files *processFiles, procName string, pids []int, parents map[int]int) {
+	for _, scope := range []struct {
+		name string
+		pids []int
+	}{
+		{treeScopeParent, pids},
+		{treeScopeTree, processTree(parents, pids)},
+	} {
+		usage := getProcessTreeUsage(files, scope.pids)
+		c.tree.rssBytes.WithLabelValues(c.processLabels(procName, scope.name)...).Set(usage.RSSBytes)
+		c.tree.cpuSeconds.WithLabelValues(c.processLabels(procName, "user", scope.name)...).Set(float64(usage.UTime) / userHZ)
+		c.tree.cpuSeconds.WithLabelValues(c.processLabels(procName, "system", scope.name)...).Set(float64(usage.STime) / userHZ)
+		if scope.name == treeScopeTree {
+			c.tree.processes.WithLabelValues(c.processLabels(procName)...).Set(float64(usage.Processes))
+		}
+	}
+}
+
+// treeMetrics are the metrics of the process trees of the registered
+// processes, see --collector.procstats.include-children.
+type treeMetrics struct {
+	metricVecs
+
+	rssBytes   *prometheus.GaugeVec
+	cpuSeconds *prometheus.GaugeVec
+	processes  *prometheus.GaugeVec
+}
+
+// newTreeMetrics returns the process tree metrics of processes with the
+// given label names.
+func newTreeMetrics(labelNames []string) *treeMetrics {
+	m := &treeMetrics{
+		rssBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "tree_resident_memory_bytes",
+				Help:      "Resident memory of the process (scope parent) or of its process tree including all descendants (scope tree) in bytes.",
+			}, withLabelNames(labelNames, "scope")),
+		cpuSeconds: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "tree_cpu_seconds",
+				Help:      "CPU time by mode of the process (scope parent) or of the running processes of its process tree (scope tree) in seconds. Drops when a descendant exits.",
+			}, withLabelNames(labelNames, "mode", "scope")),
+		processes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: Namespace,
+				Subsystem: processSubsystem,
+				Name:      "tree_processes",
+				Help:      "Number of processes in the process tree of the process, including itself.",
+			}, labelNames),
+	}
+	m.metricVecs = metricVecs{
+		m.rssBytes,
+		m.cpuSeconds,
+		m.processes,
+	}
+	return m
+}
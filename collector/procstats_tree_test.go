@@ -0,0 +1,119 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestProcessTree(t *testing.T) {
+	parents := map[int]int{1: 0, 10: 1, 11: 10, 12: 10, 13: 11, 20: 1, 21: 20}
+	for i, test := range []struct {
+		roots []int
+		want  []int
+	}{
+		{roots: []int{10}, want: []int{10, 11, 12, 13}},
+		{roots: []int{13}, want: []int{13}},
+		{roots: []int{11, 20}, want: []int{11, 13, 20, 21}},
+		// Resolved PIDs of the same tree are counted once.
+		{roots: []int{10, 11}, want: []int{10, 11, 12, 13}},
+		// The process exited since it was resolved.
+		{roots: []int{30}, want: []int{30}},
+	} {
+		if got := processTree(parents, test.roots); !reflect.DeepEqual(test.want, got) {
+			t.Errorf("%d: want tree %v, got %v", i, test.want, got)
+		}
+	}
+}
+
+// writeTreeProcess writes the stat and status of a process to procRoot.
+func writeTreeProcess(t *testing.T, procRoot string, pid, ppid, utime, stime, rssKB int) {
+	dir := filepath.Join(procRoot, fmt.Sprint(pid))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	stat := fmt.Sprintf("%d (worker) S %d %d %d 0 -1 0 0 0 0 0 %d %d 0 0 20 0 1 0 100 0 0\n", pid, ppid, pid, pid, utime, stime)
+	if err := ioutil.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644); err != nil {
+		t.Fatal(err)
+	}
+	status := fmt.Sprintf("Name:\tworker\nPid:\t%d\nPPid:\t%d\nVmRSS:\t%d kB\n", pid, ppid, rssKB)
+	if err := ioutil.WriteFile(filepath.Join(dir, "status"), []byte(status), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetProcessTreeUsage(t *testing.T) {
+	procRoot := t.TempDir()
+	writeTreeProcess(t, procRoot, 10, 1, 100, 50, 1000)
+	writeTreeProcess(t, procRoot, 11, 10, 200, 20, 3000)
+	writeTreeProcess(t, procRoot, 12, 11, 300, 30, 5000)
+	writeTreeProcess(t, procRoot, 20, 1, 400, 40, 7000)
+
+	pids, err := listPIDs(procRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parents := getProcessParents(newProcessFiles(procRoot), pids)
+	if want := map[int]int{10: 1, 11: 10, 12: 11, 20: 1}; !reflect.DeepEqual(want, parents) {
+		t.Errorf("want parents %v, got %v", want, parents)
+	}
+
+	// PID 13 exited since the tree was built.
+	usage := getProcessTreeUsage(newProcessFiles(procRoot), append(processTree(parents, []int{10}), 13))
+	want := processTreeUsage{Processes: 3, RSSBytes: 9000 * 1024, UTime: 600, STime: 100}
+	if want != usage {
+		t.Errorf("want usage %+v, got %+v", want, usage)
+	}
+}
+
+func TestProcStatsIncludeChildren(t *testing.T) {
+	procRoot := t.TempDir()
+	writeTreeProcess(t, procRoot, 10, 1, 100, 50, 1000)
+	writeTreeProcess(t, procRoot, 11, 10, 200, 20, 3000)
+	writeTreeProcess(t, procRoot, 12, 10, 300, 30, 5000)
+	writeTreeProcess(t, procRoot, 20, 1, 400, 40, 7000)
+	if err := ioutil.WriteFile(filepath.Join(procRoot, "stat"), []byte("btime 1418183276\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(v bool) { *includeChildren = v }(*includeChildren)
+	*includeChildren = true
+	c, err := NewTestProcStatsCollector(procRoot, []string{"nginx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.pidDir = t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(c.pidDir, "nginx.pid"), []byte("10\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := collectProcStats(t, c)
+	for name, want := range map[string]float64{
+		`node_process_tree_resident_memory_bytes{name="nginx",scope="parent"}`:   1000 * 1024,
+		`node_process_tree_resident_memory_bytes{name="nginx",scope="tree"}`:     9000 * 1024,
+		`node_process_tree_cpu_seconds{mode="user",name="nginx",scope="parent"}`: 1,
+		`node_process_tree_cpu_seconds{mode="user",name="nginx",scope="tree"}`:   6,
+		`node_process_tree_cpu_seconds{mode="system",name="nginx",scope="tree"}`: 1,
+		`node_process_tree_processes{name="nginx"}`:                              3,
+	} {
+		if got, ok := metrics[name]; !ok || got != want {
+			t.Errorf("want %s %g, got %g (found %t)", name, want, got, ok)
+		}
+	}
+}
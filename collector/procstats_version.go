@@ -0,0 +1,165 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBinaryVersionBytes is the size of the start of an executable searched
+// for its version.
+const maxBinaryVersionBytes = 10 << 20
+
+// versionSource extracts the version of a process from an environment
+// variable, the first line of a file or its executable.
+type versionSource struct {
+	env    string
+	file   string
+	binary bool
+	// re extracts the version from the value, from its first capture group
+	// if it has one. nil takes the whole value.
+	re *regexp.Regexp
+
+	// The version found in the executable is kept until the PID, the size
+	// or the modification time of the executable change.
+	mtx  sync.Mutex
+	last binaryVersion
+}
+
+// binaryVersion is the cached version of the executable of a process.
+type binaryVersion struct {
+	pid     int
+	size    int64
+	modTime time.Time
+	version string
+}
+
+func newVersionSource(c *versionConfig) (*versionSource, error) {
+	s := &versionSource{env: c.Env, file: c.File, binary: c.Binary}
+	if c.Regex != "" {
+		re, err := regexp.Compile(c.Regex)
+		if err != nil {
+			return nil, err
+		}
+		if re.NumSubexp() > 1 {
+			return nil, fmt.Errorf("regex %q has more than one capture group", c.Regex)
+		}
+		s.re = re
+	}
+	return s, nil
+}
+
+// version returns the version of the given process, truncated to
+// maxEnvLabelValueLength bytes. It fails if the version is unavailable.
+func (s *versionSource) version(procRoot string, pid int) (string, error) {
+	var (
+		value string
+		err   error
+	)
+	switch {
+	case s.binary:
+		if value, err = s.binaryVersion(procRoot, pid); err != nil {
+			return "", err
+		}
+	case s.env != "":
+		if value, err = getProcessEnvVar(procRoot, pid, s.env); err != nil {
+			return "", err
+		}
+		if value == "" {
+			return "", fmt.Errorf("%s isn't set", s.env)
+		}
+	default:
+		if value, err = readFirstLine(s.file); err != nil {
+			return "", err
+		}
+	}
+	if s.re != nil && !s.binary {
+		m := s.re.FindStringSubmatch(value)
+		if m == nil {
+			return "", fmt.Errorf("%q doesn't match %q", value, s.re)
+		}
+		value = m[len(m)-1]
+	}
+	if value == "" {
+		return "", fmt.Errorf("empty version")
+	}
+	return truncateLabelValue(value, maxEnvLabelValueLength), nil
+}
+
+// binaryVersion returns the version in the executable of the given process,
+// read through /proc/$PID/exe.
+func (s *versionSource) binaryVersion(procRoot string, pid int) (string, error) {
+	exe := processFilePath(procRoot, pid, "exe")
+	fi, err := os.Stat(exe)
+	if err != nil {
+		return "", err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.last.pid == pid && s.last.size == fi.Size() && s.last.modTime.Equal(fi.ModTime()) {
+		return s.last.version, nil
+	}
+	version, err := extractBinaryVersion(exe, s.re)
+	if err != nil {
+		return "", err
+	}
+	s.last = binaryVersion{pid: pid, size: fi.Size(), modTime: fi.ModTime(), version: version}
+	return version, nil
+}
+
+// extractBinaryVersion returns the first match of re in the first
+// maxBinaryVersionBytes of the file at path, e.g. an executable embedding
+// version="1.2.3", from its capture group if it has one.
+func extractBinaryVersion(path string, re *regexp.Regexp) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	content, err := ioutil.ReadAll(io.LimitReader(f, maxBinaryVersionBytes))
+	if err != nil {
+		return "", err
+	}
+	m := re.FindSubmatch(content)
+	if m == nil {
+		return "", fmt.Errorf("no match of %q in %s", re, path)
+	}
+	return string(m[len(m)-1]), nil
+}
+
+// readFirstLine returns the first line of a file without surrounding
+// whitespace.
+func readFirstLine(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan()
+	return strings.TrimSpace(scanner.Text()), scanner.Err()
+}
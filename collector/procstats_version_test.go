@@ -0,0 +1,101 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVersionSource(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "VERSION"), []byte("hekad 0.10.0 (abc123)\nbuilt by ci\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		config  versionConfig
+		version string
+	}{
+		{config: versionConfig{Env: "APP_VERSION"}, version: "1.2.3"},
+		{config: versionConfig{Env: "APP_VERSION", Regex: `^(\d+)\.`}, version: "1"},
+		{config: versionConfig{Env: "LONG"}, version: strings.Repeat("x", maxEnvLabelValueLength)},
+		{config: versionConfig{File: filepath.Join(dir, "VERSION")}, version: "hekad 0.10.0 (abc123)"},
+		{config: versionConfig{File: filepath.Join(dir, "VERSION"), Regex: `\d+\.\d+\.\d+`}, version: "0.10.0"},
+		{config: versionConfig{Env: "EMPTY"}},
+		{config: versionConfig{Env: "MISSING"}},
+		{config: versionConfig{Env: "APP_VERSION", Regex: "^v"}},
+		{config: versionConfig{File: filepath.Join(dir, "MISSING")}},
+	} {
+		src, err := newVersionSource(&test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		version, err := src.version("fixtures/proc", 1234)
+		if test.version == "" {
+			if err == nil {
+				t.Errorf("%+v: want an error, got version %q", test.config, version)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: %s", test.config, err)
+			continue
+		}
+		if version != test.version {
+			t.Errorf("%+v: want version %q, got %q", test.config, test.version, version)
+		}
+	}
+}
+
+func TestBinaryVersionSource(t *testing.T) {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "app")
+	content := append([]byte("\x7fELF\x02\x01\x01\x00"), make([]byte, 4096)...)
+	content = append(content, []byte("go1.21\x00version=\"1.2.3\"\x00main.main")...)
+	if err := ioutil.WriteFile(binary, content, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "1234"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(binary, filepath.Join(dir, "1234", "exe")); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := newVersionSource(&versionConfig{Binary: true, Regex: `version="([^"]+)"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		version, err := src.version(dir, 1234)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != "1.2.3" {
+			t.Errorf("%d. want version 1.2.3, got %q", i, version)
+		}
+	}
+
+	src, err = newVersionSource(&versionConfig{Binary: true, Regex: `release=(\S+)`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := src.version(dir, 1234); err == nil {
+		t.Errorf("want an error, got version %q", version)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !noprocstats
+
+package collector
+
+import (
+	"io/ioutil"
+	"strings"
+)
+
+// getProcessWchan returns the kernel function the given process is sleeping
+// in, from /proc/$PID/wchan. It is empty if the process isn't sleeping in
+// the kernel, which the kernel reports as "0".
+func getProcessWchan(procRoot string, pid int) (string, error) {
+	data, err := ioutil.ReadFile(processFilePath(procRoot, pid, "wchan"))
+	if err != nil {
+		return "", err
+	}
+	wchan := strings.TrimSpace(string(data))
+	if wchan == "0" {
+		return "", nil
+	}
+	return wchan, nil
+}
+
+// kernelBlocked returns whether a process in the given state with the given
+// wait channel is blocked in uninterruptible sleep in the kernel.
+func kernelBlocked(state, wchan string) bool {
+	return state == "D" && wchan != ""
+}
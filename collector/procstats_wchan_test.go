@@ -0,0 +1,61 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetProcessWchan(t *testing.T) {
+	wchan, err := getProcessWchan("fixtures/proc", 1234)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "pipe_wait"; wchan != want {
+		t.Errorf("want wchan %q, got %q", want, wchan)
+	}
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "1234"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "1234", "wchan"), []byte("0"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if wchan, err := getProcessWchan(dir, 1234); err != nil || wchan != "" {
+		t.Errorf("want empty wchan for 0, got %q (error %v)", wchan, err)
+	}
+	if _, err := getProcessWchan(dir, 4321); err == nil {
+		t.Error("want error for a missing process, got none")
+	}
+}
+
+func TestKernelBlocked(t *testing.T) {
+	for _, test := range []struct {
+		state, wchan string
+		want         bool
+	}{
+		{state: "D", wchan: "nfs_wait_bit_killable", want: true},
+		{state: "D", wchan: ""},
+		{state: "S", wchan: "pipe_wait"},
+		{state: "R", wchan: ""},
+	} {
+		if got := kernelBlocked(test.state, test.wchan); got != test.want {
+			t.Errorf("state %s, wchan %q: want blocked %t, got %t", test.state, test.wchan, test.want, got)
+		}
+	}
+}
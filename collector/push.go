@@ -0,0 +1,349 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/log"
+)
+
+const (
+	// PushModeRemoteWrite pushes to the remote write API of Prometheus or a
+	// compatible receiver.
+	PushModeRemoteWrite = "remote_write"
+	// PushModePushgateway pushes to a Pushgateway.
+	PushModePushgateway = "pushgateway"
+
+	// pushMinBackoff is the wait before the first retry of a failed push,
+	// doubled for each further retry.
+	pushMinBackoff = 500 * time.Millisecond
+)
+
+// Pusher periodically pushes the metrics of a collector.
+type Pusher struct {
+	collector prometheus.Collector
+	mode      string
+	url       string
+	job       string
+	instance  string
+	interval  time.Duration
+	client    *http.Client
+	now       func() time.Time
+	sleep     func(time.Duration)
+}
+
+// NewPusher returns a Pusher pushing the metrics of c every interval in the
+// given mode. Pushgateway pushes replace the group of job and instance below
+// pushURL, remote write pushes add job and instance labels to all series
+// and post them to pushURL.
+func NewPusher(c prometheus.Collector, mode, pushURL, job, instance string, interval time.Duration) (*Pusher, error) {
+	if mode != PushModeRemoteWrite && mode != PushModePushgateway {
+		return nil, fmt.Errorf("unknown push mode %q, want %s or %s", mode, PushModeRemoteWrite, PushModePushgateway)
+	}
+	u, err := url.Parse(pushURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid push URL %q", pushURL)
+	}
+	if job == "" {
+		return nil, fmt.Errorf("pushing requires a job name")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("the push interval must be positive, got %s", interval)
+	}
+	if mode == PushModePushgateway {
+		pushURL = strings.TrimSuffix(pushURL, "/") + "/metrics/job/" + url.PathEscape(job)
+		if instance != "" {
+			pushURL += "/instance/" + url.PathEscape(instance)
+		}
+	}
+	return &Pusher{
+		collector: c,
+		mode:      mode,
+		url:       pushURL,
+		job:       job,
+		instance:  instance,
+		interval:  interval,
+		client:    &http.Client{Timeout: interval},
+		now:       time.Now,
+		sleep:     time.Sleep,
+	}, nil
+}
+
+// Run pushes the metrics every interval until stop is closed.
+func (p *Pusher) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Push(p.now().Add(p.interval)); err != nil {
+			log.Errorf("Unable to push the metrics to %s: %s", p.url, err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Push collects the metrics and pushes them. A push failing with a network
+// error or a 5xx or 429 status is retried with exponential backoff as long
+// as the next retry starts before deadline. The retries send the samples of
+// the first attempt with their original timestamps.
+func (p *Pusher) Push(deadline time.Time) error {
+	timestamp := p.now()
+	families, err := metricFamilies(gatherMetrics(p.collector))
+	if err != nil {
+		return err
+	}
+	var (
+		body        []byte
+		contentType string
+		header      = http.Header{}
+	)
+	switch p.mode {
+	case PushModePushgateway:
+		// The Pushgateway rejects samples with timestamps, it records the
+		// time of the push instead.
+		var buf bytes.Buffer
+		enc := expfmt.NewEncoder(&buf, expfmt.FmtProtoDelim)
+		for _, mf := range families {
+			for _, m := range mf.GetMetric() {
+				m.TimestampMs = nil
+			}
+			if err := enc.Encode(mf); err != nil {
+				return err
+			}
+		}
+		body, contentType = buf.Bytes(), string(expfmt.FmtProtoDelim)
+	case PushModeRemoteWrite:
+		extra := []pushLabel{{"job", p.job}}
+		if p.instance != "" {
+			extra = append(extra, pushLabel{"instance", p.instance})
+		}
+		series := familiesSeries(families, extra)
+		body = snappyEncode(encodeWriteRequest(series, timestamp.UnixNano()/int64(time.Millisecond)))
+		contentType = "application/x-protobuf"
+		header.Set("Content-Encoding", "snappy")
+		header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	}
+	header.Set("Content-Type", contentType)
+
+	backoff := pushMinBackoff
+	for {
+		err := p.send(body, header)
+		if err == nil {
+			return nil
+		}
+		if _, ok := err.(retryableError); !ok || p.now().Add(backoff).After(deadline) {
+			return err
+		}
+		log.Debugf("Retrying the push to %s in %s: %s", p.url, backoff, err)
+		p.sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// retryableError is an error of a push worth retrying.
+type retryableError struct {
+	error
+}
+
+func (p *Pusher) send(body []byte, header http.Header) error {
+	method := "POST"
+	if p.mode == PushModePushgateway {
+		method = "PUT"
+	}
+	req, err := http.NewRequest(method, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return retryableError{err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 256))
+	err = fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		return retryableError{err}
+	}
+	return err
+}
+
+// pushLabel is a label of a remote write series.
+type pushLabel struct {
+	name, value string
+}
+
+// pushSeries is a series of a remote write request, with its labels sorted
+// by name. timestamp is the explicit timestamp of the sample in
+// milliseconds, or 0 for the time of the push.
+type pushSeries struct {
+	labels    []pushLabel
+	value     float64
+	timestamp int64
+}
+
+// familiesSeries flattens metric families into series, splitting summaries
+// and histograms into their quantiles or buckets, sum and count like the
+// text format. The extra labels are added to all series unless a metric has
+// a label of the same name.
+func familiesSeries(families []*dto.MetricFamily, extra []pushLabel) []pushSeries {
+	var series []pushSeries
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			add := func(suffix string, value float64, labels ...pushLabel) {
+				s := pushSeries{value: value, timestamp: m.GetTimestampMs()}
+				s.labels = append(s.labels, pushLabel{"__name__", mf.GetName() + suffix})
+				for _, l := range m.GetLabel() {
+					s.labels = append(s.labels, pushLabel{l.GetName(), l.GetValue()})
+				}
+				s.labels = append(s.labels, labels...)
+			extraLabels:
+				for _, e := range extra {
+					for _, l := range s.labels {
+						if l.name == e.name {
+							continue extraLabels
+						}
+					}
+					s.labels = append(s.labels, e)
+				}
+				sort.Slice(s.labels, func(i, j int) bool { return s.labels[i].name < s.labels[j].name })
+				series = append(series, s)
+			}
+			switch {
+			case m.Gauge != nil:
+				add("", m.GetGauge().GetValue())
+			case m.Counter != nil:
+				add("", m.GetCounter().GetValue())
+			case m.Untyped != nil:
+				add("", m.GetUntyped().GetValue())
+			case m.Summary != nil:
+				for _, q := range m.GetSummary().GetQuantile() {
+					add("", q.GetValue(), pushLabel{"quantile", formatLabelFloat(q.GetQuantile())})
+				}
+				add("_sum", m.GetSummary().GetSampleSum())
+				add("_count", float64(m.GetSummary().GetSampleCount()))
+			case m.Histogram != nil:
+				infSeen := false
+				for _, b := range m.GetHistogram().GetBucket() {
+					add("_bucket", float64(b.GetCumulativeCount()), pushLabel{"le", formatLabelFloat(b.GetUpperBound())})
+					infSeen = infSeen || math.IsInf(b.GetUpperBound(), 1)
+				}
+				if !infSeen {
+					add("_bucket", float64(m.GetHistogram().GetSampleCount()), pushLabel{"le", "+Inf"})
+				}
+				add("_sum", m.GetHistogram().GetSampleSum())
+				add("_count", float64(m.GetHistogram().GetSampleCount()))
+			}
+		}
+	}
+	return series
+}
+
+// formatLabelFloat formats the bound of a bucket or a quantile as a label
+// value.
+func formatLabelFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// encodeWriteRequest encodes series as a remote write WriteRequest protobuf
+// message with a sample each, at the timestamp of the series if it has one
+// and else at timestamp in milliseconds:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(series []pushSeries, timestamp int64) []byte {
+	req := proto.NewBuffer(nil)
+	for _, s := range series {
+		ts := proto.NewBuffer(nil)
+		for _, l := range s.labels {
+			label := proto.NewBuffer(nil)
+			label.EncodeVarint(1<<3 | proto.WireBytes)
+			label.EncodeStringBytes(l.name)
+			label.EncodeVarint(2<<3 | proto.WireBytes)
+			label.EncodeStringBytes(l.value)
+			ts.EncodeVarint(1<<3 | proto.WireBytes)
+			ts.EncodeRawBytes(label.Bytes())
+		}
+		sample := proto.NewBuffer(nil)
+		sample.EncodeVarint(1<<3 | proto.WireFixed64)
+		sample.EncodeFixed64(math.Float64bits(s.value))
+		sample.EncodeVarint(2<<3 | proto.WireVarint)
+		if s.timestamp != 0 {
+			sample.EncodeVarint(uint64(s.timestamp))
+		} else {
+			sample.EncodeVarint(uint64(timestamp))
+		}
+		ts.EncodeVarint(2<<3 | proto.WireBytes)
+		ts.EncodeRawBytes(sample.Bytes())
+
+		req.EncodeVarint(1<<3 | proto.WireBytes)
+		req.EncodeRawBytes(ts.Bytes())
+	}
+	return req.Bytes()
+}
+
+// snappyEncode returns b as a snappy block made of literals only. Remote
+// write requires the snappy block format, and as no snappy implementation
+// is vendored the block is not compressed; any snappy decoder reads it.
+func snappyEncode(b []byte) []byte {
+	buf := proto.NewBuffer(nil)
+	buf.EncodeVarint(uint64(len(b)))
+	out := buf.Bytes()
+	// A literal element holds up to 2^32 bytes, its tag encodes the length
+	// minus one in the upper six bits up to 60, or else in 1 to 4 bytes
+	// following the tag. Chunks of 64KiB keep the tags to 3 bytes.
+	const maxChunk = 1 << 16
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > maxChunk {
+			chunk = chunk[:maxChunk]
+		}
+		n := len(chunk) - 1
+		switch {
+		case n < 60:
+			out = append(out, byte(n)<<2)
+		case n < 1<<8:
+			out = append(out, 60<<2, byte(n))
+		default:
+			out = append(out, 61<<2, byte(n), byte(n>>8))
+		}
+		out = append(out, chunk...)
+		b = b[len(chunk):]
+	}
+	return out
+}
@@ -0,0 +1,339 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// snappyDecodeLiterals decodes a snappy block made of literals only.
+func snappyDecodeLiterals(t *testing.T, b []byte) []byte {
+	buf := proto.NewBuffer(b)
+	n, err := buf.DecodeVarint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = b[proto.SizeVarint(n):]
+	var out []byte
+	for len(b) > 0 {
+		tag := b[0]
+		if tag&3 != 0 {
+			t.Fatalf("unexpected snappy copy element %x", tag)
+		}
+		length, extra := int(tag>>2), 0
+		if length >= 60 {
+			extra = length - 59
+			length = 0
+			for i := 0; i < extra; i++ {
+				length |= int(b[1+i]) << (8 * uint(i))
+			}
+		}
+		b = b[1+extra:]
+		out = append(out, b[:length+1]...)
+		b = b[length+1:]
+	}
+	if uint64(len(out)) != n {
+		t.Fatalf("want %d decoded bytes, got %d", n, len(out))
+	}
+	return out
+}
+
+// decodeWriteRequest returns the series of a WriteRequest as
+// `name{label="value",...} value timestamp`, sorted.
+func decodeWriteRequest(t *testing.T, b []byte) []string {
+	fields := func(b []byte) map[uint64][][]byte {
+		buf := proto.NewBuffer(b)
+		fields := map[uint64][][]byte{}
+		for {
+			key, err := buf.DecodeVarint()
+			if err != nil {
+				return fields
+			}
+			var v []byte
+			switch key & 7 {
+			case proto.WireBytes:
+				v, err = buf.DecodeRawBytes(true)
+			case proto.WireFixed64:
+				var x uint64
+				x, err = buf.DecodeFixed64()
+				v = []byte(fmt.Sprint(math.Float64frombits(x)))
+			case proto.WireVarint:
+				var x uint64
+				x, err = buf.DecodeVarint()
+				v = []byte(fmt.Sprint(x))
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			fields[key>>3] = append(fields[key>>3], v)
+		}
+	}
+	var series []string
+	for _, ts := range fields(b)[1] {
+		tsFields := fields(ts)
+		var name string
+		var labels []string
+		for _, l := range tsFields[1] {
+			lFields := fields(l)
+			if string(lFields[1][0]) == "__name__" {
+				name = string(lFields[2][0])
+				continue
+			}
+			labels = append(labels, fmt.Sprintf("%s=%q", lFields[1][0], lFields[2][0]))
+		}
+		for _, s := range tsFields[2] {
+			sFields := fields(s)
+			series = append(series, fmt.Sprintf("%s{%s} %s %s", name, strings.Join(labels, ","), sFields[1][0], sFields[2][0]))
+		}
+	}
+	sort.Strings(series)
+	return series
+}
+
+// timestampedCollector adds an explicit timestamp to the metrics of a
+// collector, like --collector.procstats.sample-timestamps.
+type timestampedCollector struct {
+	prometheus.Collector
+	timestampMs int64
+}
+
+func (c timestampedCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range gatherMetrics(c.Collector) {
+		ch <- timestampedTestMetric{Metric: m, timestampMs: c.timestampMs}
+	}
+}
+
+type timestampedTestMetric struct {
+	prometheus.Metric
+	timestampMs int64
+}
+
+func (m timestampedTestMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+	out.TimestampMs = proto.Int64(m.timestampMs)
+	return nil
+}
+
+func newTestPusher(t *testing.T, mode string, h http.HandlerFunc) *Pusher {
+	server := httptest.NewServer(h)
+	t.Cleanup(server.Close)
+	c := &fakeCollector{
+		desc:   prometheus.NewDesc("test_value", "Test value.", []string{"name"}, nil),
+		values: map[string]float64{"a": 1, "b": 2},
+	}
+	p, err := NewPusher(c, mode, server.URL, "node", "host1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.now = func() time.Time { return time.Unix(1500000000, 0) }
+	return p
+}
+
+func TestPusherRemoteWrite(t *testing.T) {
+	var got []string
+	p := newTestPusher(t, PushModeRemoteWrite, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected request %s with headers %v", r.Method, r.Header)
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = decodeWriteRequest(t, snappyDecodeLiterals(t, body))
+	})
+
+	if err := p.Push(p.now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`test_value{instance="host1",job="node",name="a"} 1 1500000000000`,
+		`test_value{instance="host1",job="node",name="b"} 2 1500000000000`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want series %q, got %q", want, got)
+	}
+
+	// Explicit timestamps are kept.
+	p.collector = timestampedCollector{Collector: p.collector, timestampMs: 1499999990000}
+	if err := p.Push(p.now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		`test_value{instance="host1",job="node",name="a"} 1 1499999990000`,
+		`test_value{instance="host1",job="node",name="b"} 2 1499999990000`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want series %q with their timestamps, got %q", want, got)
+	}
+}
+
+func TestPusherPushgateway(t *testing.T) {
+	var got []string
+	p := newTestPusher(t, PushModePushgateway, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.URL.Path != "/metrics/job/node/instance/host1" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		dec := expfmt.NewDecoder(r.Body, expfmt.Format(r.Header.Get("Content-Type")))
+		for {
+			var mf dto.MetricFamily
+			if err := dec.Decode(&mf); err != nil {
+				break
+			}
+			for _, m := range mf.GetMetric() {
+				if m.TimestampMs != nil {
+					t.Errorf("unexpected timestamp of %s", mf.GetName())
+				}
+				got = append(got, fmt.Sprintf("%s{%s} %v", mf.GetName(), m.GetLabel()[0].GetValue(), m.GetGauge().GetValue()))
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	// The Pushgateway rejects the timestamps of the samples.
+	p.collector = timestampedCollector{Collector: p.collector, timestampMs: 1499999990000}
+
+	if err := p.Push(p.now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"test_value{a} 1", "test_value{b} 2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want series %q, got %q", want, got)
+	}
+}
+
+func TestPusherRetries(t *testing.T) {
+	var statuses []int
+	attempts := 0
+	p := newTestPusher(t, PushModeRemoteWrite, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statuses[attempts])
+		attempts++
+	})
+	var sleeps []time.Duration
+	p.sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+
+	for i, test := range []struct {
+		statuses []int
+		deadline time.Duration
+		ok       bool
+		attempts int
+	}{
+		{statuses: []int{503, 429, 200}, deadline: time.Minute, ok: true, attempts: 3},
+		// Client errors are not retried.
+		{statuses: []int{400}, deadline: time.Minute, attempts: 1},
+		// The first retry would start after the deadline.
+		{statuses: []int{503}, deadline: time.Second / 4, attempts: 1},
+	} {
+		statuses, attempts, sleeps = test.statuses, 0, nil
+		err := p.Push(p.now().Add(test.deadline))
+		if (err == nil) != test.ok {
+			t.Errorf("%d: want success %t, got error %v", i, test.ok, err)
+		}
+		if attempts != test.attempts {
+			t.Errorf("%d: want %d attempts, got %d", i, test.attempts, attempts)
+		}
+		if want := test.attempts - 1; len(sleeps) != want {
+			t.Errorf("%d: want %d retries, got %v", i, want, sleeps)
+		} else if want > 1 && sleeps[1] != 2*sleeps[0] {
+			t.Errorf("%d: want an exponential backoff, got %v", i, sleeps)
+		}
+	}
+}
+
+func TestFamiliesSeries(t *testing.T) {
+	families := []*dto.MetricFamily{
+		{
+			Name: proto.String("test_summary"),
+			Type: dto.MetricType_SUMMARY.Enum(),
+			Metric: []*dto.Metric{{
+				Label: []*dto.LabelPair{{Name: proto.String("job"), Value: proto.String("custom")}},
+				Summary: &dto.Summary{
+					SampleCount: proto.Uint64(2),
+					SampleSum:   proto.Float64(3),
+					Quantile:    []*dto.Quantile{{Quantile: proto.Float64(0.5), Value: proto.Float64(1)}},
+				},
+			}},
+		},
+		{
+			Name: proto.String("test_histogram"),
+			Type: dto.MetricType_HISTOGRAM.Enum(),
+			Metric: []*dto.Metric{{
+				Histogram: &dto.Histogram{
+					SampleCount: proto.Uint64(4),
+					SampleSum:   proto.Float64(5),
+					Bucket:      []*dto.Bucket{{UpperBound: proto.Float64(0.1), CumulativeCount: proto.Uint64(3)}},
+				},
+			}},
+		},
+	}
+
+	var got []string
+	for _, s := range familiesSeries(families, []pushLabel{{"job", "node"}}) {
+		var labels []string
+		for _, l := range s.labels {
+			labels = append(labels, l.name+"="+l.value)
+		}
+		got = append(got, fmt.Sprintf("%s %v", strings.Join(labels, ","), s.value))
+	}
+	want := []string{
+		"__name__=test_summary,job=custom,quantile=0.5 1",
+		"__name__=test_summary_sum,job=custom 3",
+		"__name__=test_summary_count,job=custom 2",
+		"__name__=test_histogram_bucket,job=node,le=0.1 3",
+		"__name__=test_histogram_bucket,job=node,le=+Inf 4",
+		"__name__=test_histogram_sum,job=node 5",
+		"__name__=test_histogram_count,job=node 4",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want series %q, got %q", want, got)
+	}
+}
+
+func TestSnappyEncode(t *testing.T) {
+	for _, n := range []int{0, 3, 60, 61, 300, 1<<16 + 5} {
+		b := []byte(strings.Repeat("x", n))
+		if got := snappyDecodeLiterals(t, snappyEncode(b)); string(got) != string(b) {
+			t.Errorf("%d bytes: want a round trip, got %d bytes", n, len(got))
+		}
+	}
+}
+
+func TestNewPusherInvalid(t *testing.T) {
+	for _, test := range []struct {
+		mode, url, job string
+		interval       time.Duration
+	}{
+		{"graphite", "http://localhost:9091", "node", time.Minute},
+		{PushModePushgateway, "localhost:9091", "node", time.Minute},
+		{PushModePushgateway, "http://localhost:9091", "", time.Minute},
+		{PushModeRemoteWrite, "http://localhost:9090/api/v1/write", "node", 0},
+	} {
+		if _, err := NewPusher(&fakeCollector{}, test.mode, test.url, test.job, "", test.interval); err == nil {
+			t.Errorf("want error for %+v, got none", test)
+		}
+	}
+}
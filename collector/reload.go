@@ -0,0 +1,56 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/common/log"
+)
+
+// reloader is implemented by collectors that can read their configuration
+// again.
+type reloader interface {
+	Reload() error
+}
+
+// reloadHandler reloads the configuration of a collector on POST requests.
+type reloadHandler struct {
+	collector reloader
+}
+
+// NewReloadHandler returns a handler reloading the configuration files of
+// the procstats collector c, like SIGHUP does.
+func NewReloadHandler(c Collector) (http.Handler, error) {
+	r, ok := c.(reloader)
+	if !ok {
+		return nil, fmt.Errorf("the procstats collector has nothing to reload without --collector.procstats.config or --collector.procstats.processes-file")
+	}
+	return &reloadHandler{collector: r}, nil
+}
+
+func (h *reloadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "Only POST requests reload the configuration.", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := h.collector.Reload(); err != nil {
+		log.Errorf("Unable to reload the procstats collector: %s", err)
+		http.Error(w, fmt.Sprintf("Unable to reload: %s", err), http.StatusInternalServerError)
+		return
+	}
+	log.Infof("Reloaded the procstats collector")
+}
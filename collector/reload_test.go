@@ -0,0 +1,69 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type fakeReloader struct {
+	reloads int
+	err     error
+}
+
+func (r *fakeReloader) Update(ch chan<- prometheus.Metric) error {
+	return nil
+}
+
+func (r *fakeReloader) Reload() error {
+	r.reloads++
+	return r.err
+}
+
+func TestReloadHandler(t *testing.T) {
+	c := &fakeReloader{}
+	h, err := NewReloadHandler(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		method  string
+		err     error
+		status  int
+		reloads int
+	}{
+		{method: "GET", status: http.StatusMethodNotAllowed},
+		{method: "POST", status: http.StatusOK, reloads: 1},
+		{method: "POST", err: errors.New("invalid config"), status: http.StatusInternalServerError, reloads: 2},
+	} {
+		c.err = test.err
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(test.method, "/-/reload", nil))
+		if rec.Code != test.status {
+			t.Errorf("%s: want status %d, got %d", test.method, test.status, rec.Code)
+		}
+		if c.reloads != test.reloads {
+			t.Errorf("%s: want %d reloads, got %d", test.method, test.reloads, c.reloads)
+		}
+	}
+
+	if _, err := NewReloadHandler(struct{ Collector }{}); err == nil {
+		t.Error("want error for a collector without reload, got none")
+	}
+}
@@ -36,6 +36,10 @@ func TestParseTextFiles(t *testing.T) {
 			path: "fixtures/textfile/two_metric_files",
 			out:  "fixtures/textfile/two_metric_files.out",
 		},
+		{
+			path: "fixtures/textfile/unparsable_metric_file",
+			out:  "fixtures/textfile/unparsable_metric_file.out",
+		},
 		{
 			path: "fixtures/textfile/nonexistent_path",
 			out:  "fixtures/textfile/nonexistent_path.out",
@@ -58,8 +62,9 @@ func TestParseTextFiles(t *testing.T) {
 		textMFs := make([]string, 0, len(mfs))
 		for _, mf := range mfs {
 			if mf.GetName() == "node_textfile_mtime" {
-				mf.GetMetric()[0].GetGauge().Value = proto.Float64(1)
-				mf.GetMetric()[1].GetGauge().Value = proto.Float64(2)
+				for i, m := range mf.GetMetric() {
+					m.GetGauge().Value = proto.Float64(float64(i + 1))
+				}
 			}
 			textMFs = append(textMFs, proto.MarshalTextString(mf))
 		}
@@ -16,12 +16,12 @@
 package collector
 
 func unameToString(input [65]int8) string {
-	var str string
+	var buf []byte
 	for _, a := range input {
 		if a == 0 {
 			break
 		}
-		str += string(a)
+		buf = append(buf, byte(a))
 	}
-	return str
+	return string(buf)
 }
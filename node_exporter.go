@@ -14,6 +14,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"net/http"
@@ -44,16 +45,35 @@ var (
 		},
 		[]string{"collector", "result"},
 	)
+	scrapeDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(collector.Namespace, "scrape", "collector_duration_seconds"),
+		"node_exporter: Duration of the last scrape of a collector.",
+		[]string{"collector"}, nil,
+	)
+	scrapeSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(collector.Namespace, "scrape", "collector_success"),
+		"node_exporter: Whether the last scrape of a collector succeeded within --collector.timeout.",
+		[]string{"collector"}, nil,
+	)
 )
 
 // NodeCollector implements the prometheus.Collector interface.
 type NodeCollector struct {
 	collectors map[string]collector.Collector
+	// timeout bounds the Update of each collector, unless 0.
+	timeout time.Duration
 }
 
 // Describe implements the prometheus.Collector interface.
 func (n NodeCollector) Describe(ch chan<- *prometheus.Desc) {
 	scrapeDurations.Describe(ch)
+	ch <- scrapeDurationDesc
+	ch <- scrapeSuccessDesc
+	for _, c := range n.collectors {
+		if d, ok := c.(collector.Describer); ok {
+			d.Describe(ch)
+		}
+	}
 }
 
 // Collect implements the prometheus.Collector interface.
@@ -62,7 +82,7 @@ func (n NodeCollector) Collect(ch chan<- prometheus.Metric) {
 	wg.Add(len(n.collectors))
 	for name, c := range n.collectors {
 		go func(name string, c collector.Collector) {
-			execute(name, c, ch)
+			execute(name, c, ch, n.timeout)
 			wg.Done()
 		}(name, c)
 	}
@@ -70,6 +90,41 @@ func (n NodeCollector) Collect(ch chan<- prometheus.Metric) {
 	scrapeDurations.Collect(ch)
 }
 
+// metricsHandler serves the metrics of the collectors requested by collect[]
+// parameters, e.g. ?collect[]=cpu&collect[]=procstats, and all metrics of the
+// default registry without any.
+type metricsHandler struct {
+	node NodeCollector
+	all  http.Handler
+}
+
+func (h metricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	names := r.URL.Query()["collect[]"]
+	if len(names) == 0 {
+		h.all.ServeHTTP(w, r)
+		return
+	}
+	filtered := NodeCollector{collectors: map[string]collector.Collector{}, timeout: h.node.timeout}
+	for _, name := range names {
+		c, ok := h.node.collectors[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Collector %q is not enabled", name), http.StatusBadRequest)
+			return
+		}
+		filtered.collectors[name] = c
+	}
+	collector.NewCollectorHandler(filtered).ServeHTTP(w, r)
+}
+
+// hostname returns the host name of the node, or "" if it is unknown.
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
 func filterAvailableCollectors(collectors string) string {
 	availableCollectors := make([]string, 0)
 	for _, c := range strings.Split(collectors, ",") {
@@ -81,20 +136,96 @@ func filterAvailableCollectors(collectors string) string {
 	return strings.Join(availableCollectors, ",")
 }
 
-func execute(name string, c collector.Collector, ch chan<- prometheus.Metric) {
+// updating holds a token of each collector while its Update runs, so that a
+// collector is only updated once at a time. An Update that timed out keeps
+// its token until it returns.
+var updating = struct {
+	sync.Mutex
+	tokens map[string]chan struct{}
+}{tokens: map[string]chan struct{}{}}
+
+// updateToken returns the token of the named collector.
+func updateToken(name string) chan struct{} {
+	updating.Lock()
+	defer updating.Unlock()
+	token, ok := updating.tokens[name]
+	if !ok {
+		token = make(chan struct{}, 1)
+		updating.tokens[name] = token
+	}
+	return token
+}
+
+// execute updates the collector, forwarding its metrics to ch for at most
+// timeout unless it is 0. A collector still running then fails the scrape,
+// its later metrics are dropped once it returns. Concurrent scrapes wait for
+// the running Update within their timeout instead of starting another one.
+func execute(name string, c collector.Collector, ch chan<- prometheus.Metric, timeout time.Duration) {
 	begin := time.Now()
-	err := c.Update(ch)
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	var err error
+	token := updateToken(name)
+	select {
+	case token <- struct{}{}:
+		err = update(c, ch, expired, func() { <-token })
+		if err == errUpdateExpired {
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+	case <-expired:
+		err = fmt.Errorf("timed out after %s waiting for its previous update to return", timeout)
+	}
 	duration := time.Since(begin)
-	var result string
-
+	var (
+		result  string
+		success float64
+	)
 	if err != nil {
 		log.Errorf("ERROR: %s collector failed after %fs: %s", name, duration.Seconds(), err)
 		result = "error"
 	} else {
 		log.Debugf("OK: %s collector succeeded after %fs.", name, duration.Seconds())
 		result = "success"
+		success = 1
 	}
 	scrapeDurations.WithLabelValues(name, result).Observe(duration.Seconds())
+	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), name)
+	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, name)
+}
+
+// errUpdateExpired is returned by update if the Update didn't return in
+// time.
+var errUpdateExpired = errors.New("update expired")
+
+// update runs the Update of c, forwarding its metrics to ch until expired.
+// done is called once Update returned.
+func update(c collector.Collector, ch chan<- prometheus.Metric, expired <-chan time.Time, done func()) error {
+	metrics := make(chan prometheus.Metric)
+	errc := make(chan error, 1)
+	go func() {
+		defer done()
+		errc <- c.Update(metrics)
+		close(metrics)
+	}()
+	for {
+		select {
+		case m, ok := <-metrics:
+			if !ok {
+				return <-errc
+			}
+			ch <- m
+		case <-expired:
+			go func() {
+				for range metrics {
+				}
+			}()
+			return errUpdateExpired
+		}
+	}
 }
 
 func loadCollectors(list string) (map[string]collector.Collector, error) {
@@ -124,6 +255,17 @@ func main() {
 		metricsPath       = flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics.")
 		enabledCollectors = flag.String("collectors.enabled", filterAvailableCollectors(defaultCollectors), "Comma-separated list of collectors to use.")
 		printCollectors   = flag.Bool("collectors.print", false, "If true, print available collectors and exit.")
+		deltaPath         = flag.String("web.delta-path", "", "Path under which to expose the metrics changed since the pull of a cursor. Disabled if empty.")
+		deltaCursors      = flag.Int("web.delta-cursors", 4, "Number of cursors of the delta endpoint to keep.")
+		processPath       = flag.String("web.process-path", "", "Path under which to expose the procstats metrics of the processes requested by ?process=name1,name2. Disabled if empty.")
+		reloadPath        = flag.String("web.reload-path", "", "Path under which a POST request reloads the procstats config and processes files, like SIGHUP, e.g. /-/reload. Disabled if empty.")
+		webConfigFile     = flag.String("web.config", "", "Path of a YAML file configuring TLS and basic authentication of the HTTP endpoint.")
+		pushURL           = flag.String("push.url", "", "URL to push the metrics of the enabled collectors to, the remote write endpoint or the base URL of a Pushgateway. Disabled if empty.")
+		pushMode          = flag.String("push.mode", collector.PushModeRemoteWrite, "Protocol of --push.url, remote_write or pushgateway.")
+		pushInterval      = flag.Duration("push.interval", time.Minute, "Interval at which the metrics are pushed.")
+		pushJob           = flag.String("push.job", "node", "Job label of the pushed metrics.")
+		pushInstance      = flag.String("push.instance", hostname(), "Instance label of the pushed metrics.")
+		collectorTimeout  = flag.Duration("collector.timeout", 0, "Time after which a collector that hasn't finished fails the scrape, so that the other collectors are still exported. Disabled if 0.")
 	)
 	flag.Parse()
 
@@ -156,12 +298,48 @@ func main() {
 		log.Infof(" - %s", n)
 	}
 
-	nodeCollector := NodeCollector{collectors: collectors}
+	nodeCollector := NodeCollector{collectors: collectors, timeout: *collectorTimeout}
 	prometheus.MustRegister(nodeCollector)
 
-	handler := prometheus.Handler()
+	handler := metricsHandler{node: nodeCollector, all: prometheus.Handler()}
 
 	http.Handle(*metricsPath, handler)
+	if *deltaPath != "" {
+		deltaHandler, err := collector.NewDeltaHandler(nodeCollector, *deltaCursors)
+		if err != nil {
+			log.Fatalf("Couldn't create the delta endpoint: %s", err)
+		}
+		http.Handle(*deltaPath, deltaHandler)
+	}
+	if *processPath != "" {
+		c, ok := collectors["procstats"]
+		if !ok {
+			log.Fatalf("--web.process-path requires the procstats collector")
+		}
+		processHandler, err := collector.NewProcessFilterHandler(c)
+		if err != nil {
+			log.Fatalf("Couldn't create the process endpoint: %s", err)
+		}
+		http.Handle(*processPath, processHandler)
+	}
+	// The reload endpoint is only served if there is something to reload.
+	if *reloadPath != "" {
+		if c, ok := collectors["procstats"]; !ok {
+			log.Infof("Not serving %s: the procstats collector isn't enabled", *reloadPath)
+		} else if reloadHandler, err := collector.NewReloadHandler(c); err != nil {
+			log.Infof("Not serving %s: %s", *reloadPath, err)
+		} else {
+			http.Handle(*reloadPath, reloadHandler)
+		}
+	}
+	if *pushURL != "" {
+		pusher, err := collector.NewPusher(nodeCollector, *pushMode, *pushURL, *pushJob, *pushInstance, *pushInterval)
+		if err != nil {
+			log.Fatalf("Couldn't configure pushing: %s", err)
+		}
+		log.Infof("Pushing to %s every %s", *pushURL, *pushInterval)
+		go pusher.Run(make(chan struct{}))
+	}
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
 			<head><title>Node Exporter</title></head>
@@ -172,8 +350,24 @@ func main() {
 			</html>`))
 	})
 
+	server := &http.Server{Addr: *listenAddress, Handler: http.DefaultServeMux}
+	if *webConfigFile != "" {
+		config, err := loadWebConfig(*webConfigFile)
+		if err != nil {
+			log.Fatalf("Couldn't load the web config: %s", err)
+		}
+		server.Handler = config.handler(server.Handler)
+		if server.TLSConfig, err = config.tlsConfig(); err != nil {
+			log.Fatalf("Couldn't configure TLS: %s", err)
+		}
+	}
+
 	log.Infoln("Listening on", *listenAddress)
-	err = http.ListenAndServe(*listenAddress, nil)
+	if server.TLSConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,78 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// blockingCollector blocks in Update until release is closed.
+type blockingCollector struct {
+	updates int32
+	release chan struct{}
+}
+
+func (c *blockingCollector) Update(ch chan<- prometheus.Metric) error {
+	atomic.AddInt32(&c.updates, 1)
+	<-c.release
+	return nil
+}
+
+// executeSuccess executes c and returns its node_scrape_collector_success.
+func executeSuccess(t *testing.T, name string, c *blockingCollector, timeout time.Duration) float64 {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		execute(name, c, ch, timeout)
+		close(ch)
+	}()
+	success := -1.0
+	for m := range ch {
+		if m.Desc() != scrapeSuccessDesc {
+			continue
+		}
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err != nil {
+			t.Fatal(err)
+		}
+		success = pb.GetGauge().GetValue()
+	}
+	return success
+}
+
+func TestExecuteBlockingCollector(t *testing.T) {
+	c := &blockingCollector{release: make(chan struct{})}
+	if want, got := 0.0, executeSuccess(t, "blocking", c, 10*time.Millisecond); want != got {
+		t.Errorf("want success %f after the timeout, got %f", want, got)
+	}
+	// The Update that timed out is still running.
+	if want, got := 0.0, executeSuccess(t, "blocking", c, 10*time.Millisecond); want != got {
+		t.Errorf("want success %f while the previous update runs, got %f", want, got)
+	}
+	if want, got := int32(1), atomic.LoadInt32(&c.updates); want != got {
+		t.Errorf("want %d update while the previous update runs, got %d", want, got)
+	}
+
+	close(c.release)
+	if want, got := 1.0, executeSuccess(t, "blocking", c, time.Second); want != got {
+		t.Errorf("want success %f once the previous update returned, got %f", want, got)
+	}
+	if want, got := int32(2), atomic.LoadInt32(&c.updates); want != got {
+		t.Errorf("want %d updates, got %d", want, got)
+	}
+}
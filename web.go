@@ -0,0 +1,112 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+// webConfig is the --web.config file securing the HTTP endpoint.
+type webConfig struct {
+	TLSServerConfig *tlsServerConfig `yaml:"tls_server_config,omitempty"`
+
+	// BasicAuthUsers maps the users allowed to access the endpoint to the
+	// bcrypt hashes of their passwords.
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users,omitempty"`
+}
+
+// tlsServerConfig configures the TLS of the HTTP endpoint.
+type tlsServerConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+
+	// ClientCAFile requires clients to present a certificate signed by one
+	// of the CAs in the file.
+	ClientCAFile string `yaml:"client_ca_file,omitempty"`
+}
+
+// loadWebConfig reads and validates a --web.config file.
+func loadWebConfig(filename string) (*webConfig, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var config webConfig
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %s", filename, err)
+	}
+	if tlsConfig := config.TLSServerConfig; tlsConfig != nil && (tlsConfig.CertFile == "" || tlsConfig.KeyFile == "") {
+		return nil, fmt.Errorf("tls_server_config in %s requires cert_file and key_file", filename)
+	}
+	for user, hash := range config.BasicAuthUsers {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("invalid password of user %q in %s, want the bcrypt hash of the password: %s", user, filename, err)
+		}
+	}
+	return &config, nil
+}
+
+// tlsConfig returns the TLS configuration of the server, or nil to serve
+// plain HTTP.
+func (c *webConfig) tlsConfig() (*tls.Config, error) {
+	if c.TLSServerConfig == nil {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.TLSServerConfig.CertFile, c.TLSServerConfig.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load the certificate: %s", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if c.TLSServerConfig.ClientCAFile != "" {
+		content, err := ioutil.ReadFile(c.TLSServerConfig.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no certificates found in %s", c.TLSServerConfig.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// handler wraps h to require the basic authentication of one of the users,
+// if any are configured.
+func (c *webConfig) handler(h http.Handler) http.Handler {
+	if len(c.BasicAuthUsers) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); ok {
+			if hash, ok := c.BasicAuthUsers[user]; ok && bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="node_exporter"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
@@ -0,0 +1,177 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// writeWebConfig writes a web config file to a temporary directory and
+// returns its path.
+func writeWebConfig(t *testing.T, config string) string {
+	path := filepath.Join(t.TempDir(), "web.yml")
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeTestCertificate writes a self-signed certificate and its key to dir
+// and returns their paths.
+func writeTestCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "node_exporter"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "node_exporter.crt"), filepath.Join(dir, "node_exporter.key")
+	for path, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: cert},
+		keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyBytes},
+	} {
+		if err := ioutil.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile
+}
+
+func TestLoadWebConfigInvalid(t *testing.T) {
+	for name, config := range map[string]string{
+		"SHA-256 hash":         "basic_auth_users: {prometheus: 2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b}",
+		"short hash":           "basic_auth_users: {prometheus: $2a$10$qmEWqPwvjEWDoGlgEAoMU}",
+		"invalid cost":         "basic_auth_users: {prometheus: $2a$99$qmEWqPwvjEWDoGlgEAoMUObjWs1QaSB1cvkxd6MwzfVROLlYptMa2}",
+		"cert without key":     "tls_server_config: {cert_file: /etc/node_exporter/node_exporter.crt}",
+		"key without cert":     "tls_server_config: {key_file: /etc/node_exporter/node_exporter.key}",
+		"invalid YAML":         "basic_auth_users: [prometheus",
+		"invalid users format": "basic_auth_users: prometheus",
+	} {
+		if _, err := loadWebConfig(writeWebConfig(t, config)); err == nil {
+			t.Errorf("%s: want error, got none", name)
+		}
+	}
+}
+
+func TestWebConfigHandler(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadWebConfig(writeWebConfig(t, "basic_auth_users:\n  prometheus: "+string(hash)+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := config.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	for _, test := range []struct {
+		name               string
+		user, password     string
+		withoutCredentials bool
+		status             int
+	}{
+		{name: "no credentials", withoutCredentials: true, status: http.StatusUnauthorized},
+		{name: "wrong password", user: "prometheus", password: "guess", status: http.StatusUnauthorized},
+		{name: "unknown user", user: "admin", password: "secret", status: http.StatusUnauthorized},
+		{name: "valid credentials", user: "prometheus", password: "secret", status: http.StatusOK},
+	} {
+		r := httptest.NewRequest("GET", "/metrics", nil)
+		if !test.withoutCredentials {
+			r.SetBasicAuth(test.user, test.password)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != test.status {
+			t.Errorf("%s: want status %d, got %d", test.name, test.status, rec.Code)
+		}
+		if challenge := rec.Header().Get("WWW-Authenticate"); (test.status == http.StatusUnauthorized) != (challenge != "") {
+			t.Errorf("%s: unexpected WWW-Authenticate header %q", test.name, challenge)
+		}
+	}
+}
+
+func TestWebConfigTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, dir)
+
+	config, err := loadWebConfig(writeWebConfig(t, "basic_auth_users: {}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig, err := config.tlsConfig(); err != nil || tlsConfig != nil {
+		t.Errorf("want plain HTTP without tls_server_config, got %v, %v", tlsConfig, err)
+	}
+
+	config, err = loadWebConfig(writeWebConfig(t, "tls_server_config:\n  cert_file: "+certFile+"\n  key_file: "+keyFile+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tlsConfig.Certificates) != 1 || tlsConfig.MinVersion != tls.VersionTLS12 || tlsConfig.ClientAuth != tls.NoClientCert {
+		t.Errorf("want the certificate with TLS 1.2 and no client certificates, got %+v", tlsConfig)
+	}
+
+	// The self-signed certificate is the CA of the client certificates.
+	config, err = loadWebConfig(writeWebConfig(t, "tls_server_config:\n  cert_file: "+certFile+"\n  key_file: "+keyFile+"\n  client_ca_file: "+certFile+"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig, err = config.tlsConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.ClientAuth != tls.RequireAndVerifyClientCert || tlsConfig.ClientCAs == nil {
+		t.Errorf("want verified client certificates with a client CA, got client auth %v", tlsConfig.ClientAuth)
+	}
+
+	config.TLSServerConfig.ClientCAFile = keyFile
+	if _, err := config.tlsConfig(); err == nil {
+		t.Error("want error for a client CA file without certificates, got none")
+	}
+}